@@ -0,0 +1,9 @@
+// Package docs embeds the API documentation so the server can validate against it
+package docs
+
+import _ "embed"
+
+// OpenAPI is the OpenAPI 3 description of the REST API
+//
+//go:embed openapi.yaml
+var OpenAPI []byte
@@ -0,0 +1,22 @@
+//go:build embed_frontend
+
+// Package frontend exposes the built UI when the binary is built with the embed_frontend
+// build tag. Run `npm run build` in this directory first so dist/ exists.
+package frontend
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed all:dist
+var dist embed.FS
+
+// FS returns the embedded Vite build output and whether it is available
+func FS() (fs.FS, bool) {
+	sub, err := fs.Sub(dist, "dist")
+	if err != nil {
+		return nil, false
+	}
+	return sub, true
+}
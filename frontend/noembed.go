@@ -0,0 +1,12 @@
+//go:build !embed_frontend
+
+// Package frontend exposes the built UI when the binary is built with the embed_frontend
+// build tag. Without the tag the UI is served from disk.
+package frontend
+
+import "io/fs"
+
+// FS returns the embedded Vite build output and whether it is available
+func FS() (fs.FS, bool) {
+	return nil, false
+}
@@ -0,0 +1,241 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/IBM/openkommander/pkg/cluster"
+	"github.com/IBM/openkommander/pkg/output"
+)
+
+// TopicSpec is the desired state of a topic. Configs are the complete set of configs
+// overriding the broker defaults; configs set on the topic but not listed are reset.
+type TopicSpec struct {
+	Name              string       `json:"name"`
+	Partitions        int32        `json:"partitions"`
+	ReplicationFactor int16        `json:"replication_factor"`
+	Configs           ConfigValues `json:"configs,omitempty"`
+}
+
+// ConfigValues are topic configs by name. Numbers and booleans are accepted as values so
+// that YAML specs need not quote them.
+type ConfigValues map[string]string
+
+func (c *ConfigValues) UnmarshalJSON(data []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*c = make(ConfigValues, len(raw))
+	for name, value := range raw {
+		var text string
+		var number json.Number
+		var flag bool
+		switch {
+		case json.Unmarshal(value, &text) == nil:
+			(*c)[name] = text
+		case json.Unmarshal(value, &number) == nil:
+			(*c)[name] = number.String()
+		case json.Unmarshal(value, &flag) == nil:
+			(*c)[name] = strconv.FormatBool(flag)
+		default:
+			return fmt.Errorf("config '%s' must be a string, number or boolean", name)
+		}
+	}
+	return nil
+}
+
+// TopicSpecDocument is the file format of ok apply and ok diff
+type TopicSpecDocument struct {
+	Topics []TopicSpec `json:"topics"`
+}
+
+// ParseTopicSpecs decodes and validates a topic spec document in the given format
+func ParseTopicSpecs(data []byte, format string) ([]TopicSpec, error) {
+	var document TopicSpecDocument
+	if err := output.Decode(data, format, &document); err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	for i, spec := range document.Topics {
+		if failure := ValidateTopicName(spec.Name); failure != nil {
+			return nil, fmt.Errorf("topic %d: %w", i+1, failure.Err)
+		}
+		if seen[spec.Name] {
+			return nil, fmt.Errorf("topic '%s' is listed more than once", spec.Name)
+		}
+		seen[spec.Name] = true
+		if spec.Partitions < 1 || spec.ReplicationFactor < 1 {
+			return nil, fmt.Errorf("topic '%s': partitions and replication_factor must be at least 1", spec.Name)
+		}
+	}
+	return document.Topics, nil
+}
+
+// Kinds of change in a topic plan
+const (
+	ChangeCreate     = "create"
+	ChangePartitions = "partitions"
+	ChangeConfig     = "config"
+	ChangeDelete     = "delete"
+)
+
+// TopicChange is one step of a plan. Partitions, ReplicationFactor and Configs hold the
+// desired values the step applies; Description says what changes in words.
+type TopicChange struct {
+	Kind              string            `json:"kind"`
+	Topic             string            `json:"topic"`
+	Description       string            `json:"description"`
+	Partitions        int32             `json:"partitions,omitempty"`
+	ReplicationFactor int16             `json:"replication_factor,omitempty"`
+	Configs           map[string]string `json:"configs,omitempty"`
+}
+
+// TopicPlan lists the changes that bring the cluster to the desired topics, in the order
+// they are applied, and the differences that cannot be applied
+type TopicPlan struct {
+	Changes  []TopicChange `json:"changes"`
+	Warnings []string      `json:"warnings,omitempty"`
+}
+
+// PlanTopics compares the desired topics with the cluster. With prune, topics that are not
+// in the specs are deleted; internal topics are never pruned.
+func PlanTopics(ctx context.Context, h *cluster.Handle, specs []TopicSpec, prune bool) (*TopicPlan, *Failure) {
+	existing, failure := ListTopics(ctx, h)
+	if failure != nil {
+		return nil, failure
+	}
+
+	plan := &TopicPlan{Changes: []TopicChange{}}
+	var partitionChanges, configChanges []TopicChange
+	wanted := map[string]bool{}
+	for _, spec := range specs {
+		wanted[spec.Name] = true
+		current, ok := existing[spec.Name]
+		if !ok {
+			plan.Changes = append(plan.Changes, TopicChange{
+				Kind:              ChangeCreate,
+				Topic:             spec.Name,
+				Description:       fmt.Sprintf("create with %d partitions, replication factor %d%s", spec.Partitions, spec.ReplicationFactor, describeConfigs(spec.Configs)),
+				Partitions:        spec.Partitions,
+				ReplicationFactor: spec.ReplicationFactor,
+				Configs:           spec.Configs,
+			})
+			continue
+		}
+
+		switch {
+		case spec.Partitions > current.NumPartitions:
+			partitionChanges = append(partitionChanges, TopicChange{
+				Kind:        ChangePartitions,
+				Topic:       spec.Name,
+				Description: fmt.Sprintf("partitions %d -> %d", current.NumPartitions, spec.Partitions),
+				Partitions:  spec.Partitions,
+			})
+		case spec.Partitions < current.NumPartitions:
+			plan.Warnings = append(plan.Warnings, fmt.Sprintf("%s: has %d partitions, more than the %d wanted; partitions cannot be removed", spec.Name, current.NumPartitions, spec.Partitions))
+		}
+		if spec.ReplicationFactor != current.ReplicationFactor {
+			plan.Warnings = append(plan.Warnings, fmt.Sprintf("%s: replication factor is %d, not %d; changing it requires a partition reassignment", spec.Name, current.ReplicationFactor, spec.ReplicationFactor))
+		}
+
+		entries, failure := DescribeTopicConfig(ctx, h, spec.Name)
+		if failure != nil {
+			return nil, failure
+		}
+		if differences := diffConfigs(TopicConfigOverrides(entries), spec.Configs); len(differences) > 0 {
+			configChanges = append(configChanges, TopicChange{
+				Kind:        ChangeConfig,
+				Topic:       spec.Name,
+				Description: strings.Join(differences, ", "),
+				Configs:     spec.Configs,
+			})
+		}
+	}
+	plan.Changes = append(plan.Changes, partitionChanges...)
+	plan.Changes = append(plan.Changes, configChanges...)
+
+	if prune {
+		var unmanaged []string
+		for name := range existing {
+			if !wanted[name] && !IsInternalTopic(name) {
+				unmanaged = append(unmanaged, name)
+			}
+		}
+		sort.Strings(unmanaged)
+		for _, name := range unmanaged {
+			plan.Changes = append(plan.Changes, TopicChange{Kind: ChangeDelete, Topic: name, Description: "delete, not in the spec"})
+		}
+	}
+	return plan, nil
+}
+
+// diffConfigs describes how the desired configs differ from the current ones, sorted by
+// config name
+func diffConfigs(current, desired map[string]string) []string {
+	var differences []string
+	for _, name := range slices.Sorted(maps.Keys(desired)) {
+		value, ok := current[name]
+		switch {
+		case !ok:
+			differences = append(differences, fmt.Sprintf("+%s=%s", name, desired[name]))
+		case value != desired[name]:
+			differences = append(differences, fmt.Sprintf("%s: %s -> %s", name, value, desired[name]))
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(current)) {
+		if _, ok := desired[name]; !ok {
+			differences = append(differences, fmt.Sprintf("-%s (reset to default)", name))
+		}
+	}
+	return differences
+}
+
+func describeConfigs(configs map[string]string) string {
+	if len(configs) == 0 {
+		return ""
+	}
+	pairs := make([]string, 0, len(configs))
+	for _, name := range slices.Sorted(maps.Keys(configs)) {
+		pairs = append(pairs, name+"="+configs[name])
+	}
+	return ", " + strings.Join(pairs, ", ")
+}
+
+// ApplyTopicPlan applies the changes in order and returns one result per change. A change
+// that fails does not stop the others.
+func ApplyTopicPlan(ctx context.Context, h *cluster.Handle, plan *TopicPlan) ([]TopicResult, *Failure) {
+	if failure := contextFailure(ctx); failure != nil {
+		return nil, failure
+	}
+	if failure := CheckWritable(ctx, h); failure != nil {
+		return nil, failure
+	}
+
+	results := make([]TopicResult, 0, len(plan.Changes))
+	for _, change := range plan.Changes {
+		result := TopicResult{Topic: change.Topic}
+		switch change.Kind {
+		case ChangeCreate:
+			result.Message, result.Failure = CreateTopicWithConfig(ctx, h, change.Topic, int(change.Partitions), int(change.ReplicationFactor), change.Configs)
+		case ChangePartitions:
+			result.Message, result.Failure = UpdateTopic(ctx, h, change.Topic, int(change.Partitions))
+		case ChangeConfig:
+			result.Message, result.Failure = UpdateTopicConfig(ctx, h, change.Topic, change.Configs)
+		case ChangeDelete:
+			result.Message, result.Failure = DeleteTopic(ctx, h, change.Topic)
+		default:
+			result.Failure = NewFailure(fmt.Sprintf("Unknown change '%s'", change.Kind), http.StatusBadRequest)
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
@@ -0,0 +1,121 @@
+package commands
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/IBM/openkommander/pkg/output"
+	"github.com/IBM/sarama"
+)
+
+func TestParseTopicSpecs(t *testing.T) {
+	specs, err := ParseTopicSpecs([]byte(`topics:
+  - name: orders
+    partitions: 12
+    replication_factor: 3
+    configs:
+      retention.ms: 604800000
+      cleanup.policy: compact
+      unclean.leader.election.enable: false
+`), output.YAML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	configs := specs[0].Configs
+	if configs["retention.ms"] != "604800000" || configs["cleanup.policy"] != "compact" || configs["unclean.leader.election.enable"] != "false" {
+		t.Errorf("configs = %v", configs)
+	}
+
+	for _, invalid := range []string{
+		`{"topics":[{"name":"a","partitions":1,"replication_factor":1},{"name":"a","partitions":1,"replication_factor":1}]}`,
+		`{"topics":[{"name":"bad name","partitions":1,"replication_factor":1}]}`,
+		`{"topics":[{"name":"a","replication_factor":1}]}`,
+	} {
+		if _, err := ParseTopicSpecs([]byte(invalid), output.JSON); err == nil {
+			t.Errorf("ParseTopicSpecs(%s) succeeded, want an error", invalid)
+		}
+	}
+}
+
+func TestDiffConfigs(t *testing.T) {
+	current := TopicConfigOverrides([]sarama.ConfigEntry{
+		{Name: "retention.ms", Value: "86400000", Source: sarama.SourceTopic},
+		{Name: "cleanup.policy", Value: "compact", Source: sarama.SourceTopic},
+		{Name: "segment.bytes", Value: "1073741824", Source: sarama.SourceDefault, Default: true},
+		{Name: "min.insync.replicas", Value: "2", Source: sarama.SourceStaticBroker},
+	})
+
+	differences := diffConfigs(current, map[string]string{"retention.ms": "604800000", "max.message.bytes": "2097152"})
+	want := []string{"+max.message.bytes=2097152", "retention.ms: 86400000 -> 604800000", "-cleanup.policy (reset to default)"}
+	if !slices.Equal(differences, want) {
+		t.Errorf("differences = %q, want %q", differences, want)
+	}
+	if differences := diffConfigs(current, current); len(differences) != 0 {
+		t.Errorf("differences = %q, want none", differences)
+	}
+}
+
+func TestPlanTopics(t *testing.T) {
+	broker := sarama.NewMockBroker(t, 1)
+	metadata := sarama.NewMockMetadataResponse(t).
+		SetBroker(broker.Addr(), broker.BrokerID()).
+		SetController(broker.BrokerID())
+	for _, topic := range []string{"orders", "payments", "legacy", "archive", "__consumer_offsets", "_schemas"} {
+		metadata.SetLeader(topic, 0, broker.BrokerID())
+	}
+	for partition := int32(0); partition < 4; partition++ {
+		metadata.SetLeader("events", partition, broker.BrokerID())
+	}
+	// Every topic has a single replica, and the mock reports retention.ms=5000 set on it
+	h := openMockCluster(t, broker, map[string]sarama.MockResponse{
+		"MetadataRequest":        metadata,
+		"DescribeConfigsRequest": sarama.NewMockDescribeConfigsResponse(t),
+	})
+
+	plan, failure := PlanTopics(context.Background(), h, []TopicSpec{
+		{Name: "payments", Partitions: 1, ReplicationFactor: 1},
+		{Name: "orders", Partitions: 6, ReplicationFactor: 1, Configs: map[string]string{"retention.ms": "5000"}},
+		{Name: "events", Partitions: 2, ReplicationFactor: 3, Configs: map[string]string{"retention.ms": "5000"}},
+		{Name: "audit", Partitions: 3, ReplicationFactor: 1},
+	}, true)
+	if failure != nil {
+		t.Fatal(failure.Err)
+	}
+
+	// Creations come first, then partition increases, config changes and deletions, the
+	// last sorted by name
+	var changes []string
+	for _, change := range plan.Changes {
+		changes = append(changes, change.Kind+" "+change.Topic)
+	}
+	want := []string{
+		ChangeCreate + " audit",
+		ChangePartitions + " orders",
+		ChangeConfig + " payments",
+		ChangeDelete + " archive",
+		ChangeDelete + " legacy",
+	}
+	if !slices.Equal(changes, want) {
+		t.Errorf("changes = %q, want %q", changes, want)
+	}
+	if plan.Changes[1].Partitions != 6 || plan.Changes[2].Description != "-retention.ms (reset to default)" {
+		t.Errorf("changes = %+v", plan.Changes)
+	}
+
+	wantWarnings := []string{
+		"events: has 4 partitions, more than the 2 wanted; partitions cannot be removed",
+		"events: replication factor is 1, not 3; changing it requires a partition reassignment",
+	}
+	if !slices.Equal(plan.Warnings, wantWarnings) {
+		t.Errorf("warnings = %q, want %q", plan.Warnings, wantWarnings)
+	}
+
+	plan, failure = PlanTopics(context.Background(), h, nil, false)
+	if failure != nil {
+		t.Fatal(failure.Err)
+	}
+	if len(plan.Changes) != 0 {
+		t.Errorf("changes without prune = %+v, want none", plan.Changes)
+	}
+}
@@ -0,0 +1,178 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/IBM/openkommander/pkg/cluster"
+)
+
+// DefaultBulkConcurrency is how many topics a bulk operation changes at once
+const DefaultBulkConcurrency = 8
+
+// TopicSelector selects topics by a glob such as "orders-*" or, with Regex set, a regular
+// expression that must match the whole name. Internal topics, whose names start with an
+// underscore like __consumer_offsets, are only selected with IncludeInternal.
+type TopicSelector struct {
+	Pattern         string
+	Regex           bool
+	IncludeInternal bool
+}
+
+// IsInternalTopic reports whether a topic is managed by Kafka or its ecosystem rather than
+// by users, e.g. __consumer_offsets, __transaction_state or _schemas
+func IsInternalTopic(topicName string) bool {
+	return strings.HasPrefix(topicName, "_")
+}
+
+// matcher compiles the selector into a predicate on topic names
+func (s TopicSelector) matcher() (func(string) bool, *Failure) {
+	if s.Pattern == "" {
+		return nil, NewFailure("Topic pattern cannot be empty", http.StatusBadRequest).WithCode(CodeValidationFailed)
+	}
+	if s.Regex {
+		re, err := regexp.Compile("^(?:" + s.Pattern + ")$")
+		if err != nil {
+			return nil, NewFailure(fmt.Sprintf("Invalid topic regular expression '%s': %v", s.Pattern, err), http.StatusBadRequest).WithCode(CodeValidationFailed)
+		}
+		return re.MatchString, nil
+	}
+	if _, err := path.Match(s.Pattern, ""); err != nil {
+		return nil, NewFailure(fmt.Sprintf("Invalid topic glob '%s': %v", s.Pattern, err), http.StatusBadRequest).WithCode(CodeValidationFailed)
+	}
+	return func(topicName string) bool {
+		matched, _ := path.Match(s.Pattern, topicName)
+		return matched
+	}, nil
+}
+
+// SelectTopics returns the details of the topics matching the selector, sorted by name
+func SelectTopics(ctx context.Context, h *cluster.Handle, selector TopicSelector) ([]TopicSummary, *Failure) {
+	matches, failure := selector.matcher()
+	if failure != nil {
+		return nil, failure
+	}
+
+	topics, failure := ListTopics(ctx, h)
+	if failure != nil {
+		return nil, failure
+	}
+
+	selected := []TopicSummary{}
+	for name, detail := range topics {
+		if !selector.IncludeInternal && IsInternalTopic(name) {
+			continue
+		}
+		if matches(name) {
+			selected = append(selected, TopicSummary{
+				Name:              name,
+				Partitions:        detail.NumPartitions,
+				ReplicationFactor: detail.ReplicationFactor,
+			})
+		}
+	}
+	sort.Slice(selected, func(i, j int) bool { return selected[i].Name < selected[j].Name })
+	return selected, nil
+}
+
+// TopicSummary is the name and layout of a topic
+type TopicSummary struct {
+	Name              string `json:"name"`
+	Partitions        int32  `json:"partitions"`
+	ReplicationFactor int16  `json:"replication_factor"`
+}
+
+// TopicResult is the outcome of a bulk operation on one topic
+type TopicResult struct {
+	Topic   string
+	Message string
+	Failure *Failure
+}
+
+// MarshalJSON reports the result with status "ok" or "error", and the failure's code and
+// message in place of the success message when it failed
+func (r TopicResult) MarshalJSON() ([]byte, error) {
+	out := struct {
+		Topic   string `json:"topic"`
+		Status  string `json:"status"`
+		Message string `json:"message"`
+		Code    string `json:"code,omitempty"`
+	}{Topic: r.Topic, Status: "ok", Message: r.Message}
+	if r.Failure != nil {
+		out.Status, out.Message, out.Code = "error", r.Failure.Err.Error(), r.Failure.Code
+		if out.Code == "" {
+			out.Code = CodeForStatus(r.Failure.HttpCode)
+		}
+	}
+	return json.Marshal(out)
+}
+
+// DeleteTopics deletes the topics concurrently and returns one result per topic, in the
+// order given. A read-only cluster fails the whole operation before anything is deleted.
+func DeleteTopics(ctx context.Context, h *cluster.Handle, topics []string, concurrency int) ([]TopicResult, *Failure) {
+	return runBulk(ctx, h, topics, concurrency, func(topicName string) (string, *Failure) {
+		return DeleteTopic(ctx, h, topicName)
+	})
+}
+
+// UpdateTopics raises the partition count of the topics concurrently and returns one
+// result per topic, in the order given
+func UpdateTopics(ctx context.Context, h *cluster.Handle, topics []string, newPartitions int, concurrency int) ([]TopicResult, *Failure) {
+	return runBulk(ctx, h, topics, concurrency, func(topicName string) (string, *Failure) {
+		return UpdateTopic(ctx, h, topicName, newPartitions)
+	})
+}
+
+// runBulk applies operation to every topic with at most concurrency running at once.
+// Topics not started before the context is done fail with the context's error.
+func runBulk(ctx context.Context, h *cluster.Handle, topics []string, concurrency int, operation func(string) (string, *Failure)) ([]TopicResult, *Failure) {
+	if failure := contextFailure(ctx); failure != nil {
+		return nil, failure
+	}
+	if failure := CheckWritable(ctx, h); failure != nil {
+		return nil, failure
+	}
+	if concurrency < 1 {
+		concurrency = DefaultBulkConcurrency
+	}
+
+	results := make([]TopicResult, len(topics))
+	slots := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, topicName := range topics {
+		results[i].Topic = topicName
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			results[i].Failure = contextFailure(ctx)
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			results[i].Message, results[i].Failure = operation(topicName)
+		}()
+	}
+	wg.Wait()
+	return results, nil
+}
+
+// CountFailures returns how many results failed
+func CountFailures(results []TopicResult) int {
+	failed := 0
+	for _, result := range results {
+		if result.Failure != nil {
+			failed++
+		}
+	}
+	return failed
+}
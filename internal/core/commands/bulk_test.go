@@ -0,0 +1,110 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/IBM/openkommander/pkg/cluster"
+	"github.com/IBM/sarama"
+)
+
+func TestSelectTopics(t *testing.T) {
+	broker := sarama.NewMockBroker(t, 1)
+	h := openMockCluster(t, broker, map[string]sarama.MockResponse{
+		"DescribeConfigsRequest": sarama.NewMockDescribeConfigsResponse(t),
+	}, "orders", "orders-eu", "payments", "__consumer_offsets", "_schemas")
+
+	cases := []struct {
+		name     string
+		selector TopicSelector
+		want     []string
+	}{
+		{"glob", TopicSelector{Pattern: "orders*"}, []string{"orders", "orders-eu"}},
+		{"regex matches the whole name", TopicSelector{Pattern: "orders", Regex: true}, []string{"orders"}},
+		{"regex is anchored", TopicSelector{Pattern: "rders", Regex: true}, []string{}},
+		{"glob is not a regex", TopicSelector{Pattern: "orders.*"}, []string{}},
+		{"internal topics are skipped", TopicSelector{Pattern: "*"}, []string{"orders", "orders-eu", "payments"}},
+		{"internal topics on request", TopicSelector{Pattern: "_*", IncludeInternal: true}, []string{"__consumer_offsets", "_schemas"}},
+	}
+	for _, tc := range cases {
+		selected, failure := SelectTopics(context.Background(), h, tc.selector)
+		if failure != nil {
+			t.Fatalf("%s: %v", tc.name, failure.Err)
+		}
+		names := []string{}
+		for _, topic := range selected {
+			names = append(names, topic.Name)
+		}
+		if !slices.Equal(names, tc.want) {
+			t.Errorf("%s: selected %v, want %v", tc.name, names, tc.want)
+		}
+	}
+
+	for _, selector := range []TopicSelector{{Pattern: ""}, {Pattern: "(", Regex: true}, {Pattern: "["}} {
+		if _, failure := SelectTopics(context.Background(), h, selector); failure == nil || failure.Code != CodeValidationFailed {
+			t.Errorf("SelectTopics(%+v) = %v, want a validation failure", selector, failure)
+		}
+	}
+}
+
+func TestRunBulkBoundsConcurrency(t *testing.T) {
+	topics := make([]string, 12)
+	for i := range topics {
+		topics[i] = fmt.Sprintf("topic-%02d", i)
+	}
+
+	var running, peak atomic.Int32
+	results, failure := runBulk(context.Background(), &cluster.Handle{Name: "test"}, topics, 3, func(topicName string) (string, *Failure) {
+		now := running.Add(1)
+		defer running.Add(-1)
+		for {
+			seen := peak.Load()
+			if now <= seen || peak.CompareAndSwap(seen, now) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		return "changed " + topicName, nil
+	})
+	if failure != nil {
+		t.Fatal(failure.Err)
+	}
+
+	if peak.Load() > 3 {
+		t.Errorf("%d topics changed at once, want at most 3", peak.Load())
+	}
+	for i, result := range results {
+		if result.Topic != topics[i] || result.Message != "changed "+topics[i] || result.Failure != nil {
+			t.Errorf("result %d = %+v, want topic %s in order", i, result, topics[i])
+		}
+	}
+}
+
+func TestRunBulkRefusesReadOnlyClusters(t *testing.T) {
+	var called atomic.Int32
+	operation := func(string) (string, *Failure) {
+		called.Add(1)
+		return "", nil
+	}
+
+	for name, run := range map[string]func() ([]TopicResult, *Failure){
+		"read-only profile": func() ([]TopicResult, *Failure) {
+			return runBulk(context.Background(), &cluster.Handle{Name: "prod", ReadOnly: true}, []string{"a", "b"}, 2, operation)
+		},
+		"read-only mode": func() ([]TopicResult, *Failure) {
+			return runBulk(WithReadOnly(context.Background()), &cluster.Handle{Name: "dev"}, []string{"a", "b"}, 2, operation)
+		},
+	} {
+		results, failure := run()
+		if failure == nil || failure.Code != CodeReadOnly || results != nil {
+			t.Errorf("%s: results = %v, failure = %v, want the whole batch refused", name, results, failure)
+		}
+	}
+	if called.Load() != 0 {
+		t.Errorf("%d topics were changed on a read-only cluster", called.Load())
+	}
+}
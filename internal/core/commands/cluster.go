@@ -1,8 +1,10 @@
 package commands
 
 import (
+	"context"
 	"net/http"
 
+	"github.com/IBM/openkommander/pkg/cluster"
 	"github.com/IBM/sarama"
 )
 
@@ -17,15 +19,15 @@ type ClusterInfo struct {
 
 // ListClusters returns information about all available clusters/brokers
 // When successful, returns a slice of ClusterInfo structs
-func ListClusters() (clusters []ClusterInfo, f *Failure) {
-	client, validateFailure := GetClient()
-	if validateFailure != nil {
-		return nil, validateFailure
+func ListClusters(ctx context.Context, h *cluster.Handle) (clusters []ClusterInfo, f *Failure) {
+	if failure := contextFailure(ctx); failure != nil {
+		return nil, failure
 	}
+	client := h.Client
 
 	brokers := client.Brokers()
 	if len(brokers) == 0 {
-		return nil, NewFailure("No clusters found", http.StatusNotFound)
+		return nil, NewFailure("No clusters found", http.StatusNotFound).WithCode(CodeClusterNotConfigured)
 	}
 
 	clusters = make([]ClusterInfo, 0, len(brokers))
@@ -65,11 +67,11 @@ func ListClusters() (clusters []ClusterInfo, f *Failure) {
 
 // GetClusterMetadata returns metadata about the current cluster
 // When successful, returns cluster metadata information
-func GetClusterMetadata() (metadata map[string]interface{}, f *Failure) {
-	client, validateFailure := GetClient()
-	if validateFailure != nil {
-		return nil, validateFailure
+func GetClusterMetadata(ctx context.Context, h *cluster.Handle) (metadata map[string]interface{}, f *Failure) {
+	if failure := contextFailure(ctx); failure != nil {
+		return nil, failure
 	}
+	client := h.Client
 
 	brokers := client.Brokers()
 
@@ -0,0 +1,157 @@
+package commands
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+)
+
+// Where a compared topic exists
+const (
+	PresenceBoth  = "both"
+	PresenceLeft  = "left"
+	PresenceRight = "right"
+)
+
+// ClusterComparison lists the differences between two cluster snapshots. Topics and ACLs
+// that are the same on both clusters are left out.
+type ClusterComparison struct {
+	Left      string            `json:"left"`
+	Right     string            `json:"right"`
+	InSync    bool              `json:"in_sync"`
+	Topics    []TopicDifference `json:"topics"`
+	ACLsLeft  []ACLEntry        `json:"acls_only_left"`
+	ACLsRight []ACLEntry        `json:"acls_only_right"`
+	Warnings  []string          `json:"warnings,omitempty"`
+}
+
+// TopicDifference is a topic missing from one cluster, or the fields that differ when it
+// exists on both
+type TopicDifference struct {
+	Topic    string            `json:"topic"`
+	Presence string            `json:"presence"`
+	Fields   []FieldDifference `json:"fields,omitempty"`
+}
+
+// FieldDifference is a setting with different values on the two clusters. A config that
+// is not set on the topic, so takes the broker default, has a null value.
+type FieldDifference struct {
+	Field string  `json:"field"`
+	Left  *string `json:"left"`
+	Right *string `json:"right"`
+}
+
+// CompareSnapshots returns the differences between the topics and ACLs of two snapshots
+func CompareSnapshots(left, right *ClusterSnapshot) *ClusterComparison {
+	comparison := &ClusterComparison{
+		Left:      left.Cluster,
+		Right:     right.Cluster,
+		Topics:    []TopicDifference{},
+		ACLsLeft:  []ACLEntry{},
+		ACLsRight: []ACLEntry{},
+	}
+	for _, warning := range left.Warnings {
+		comparison.Warnings = append(comparison.Warnings, left.Cluster+": "+warning)
+	}
+	for _, warning := range right.Warnings {
+		comparison.Warnings = append(comparison.Warnings, right.Cluster+": "+warning)
+	}
+
+	leftTopics := topicsByName(left.Topics)
+	rightTopics := topicsByName(right.Topics)
+	names := slices.Sorted(maps.Keys(leftTopics))
+	for name := range rightTopics {
+		if _, ok := leftTopics[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		l, inLeft := leftTopics[name]
+		r, inRight := rightTopics[name]
+		switch {
+		case !inRight:
+			comparison.Topics = append(comparison.Topics, TopicDifference{Topic: name, Presence: PresenceLeft})
+		case !inLeft:
+			comparison.Topics = append(comparison.Topics, TopicDifference{Topic: name, Presence: PresenceRight})
+		default:
+			if fields := compareTopics(l, r); len(fields) > 0 {
+				comparison.Topics = append(comparison.Topics, TopicDifference{Topic: name, Presence: PresenceBoth, Fields: fields})
+			}
+		}
+	}
+
+	comparison.ACLsLeft = subtractACLs(left.ACLs, right.ACLs)
+	comparison.ACLsRight = subtractACLs(right.ACLs, left.ACLs)
+	comparison.InSync = len(comparison.Topics) == 0 && len(comparison.ACLsLeft) == 0 && len(comparison.ACLsRight) == 0
+	return comparison
+}
+
+func topicsByName(topics []TopicSpec) map[string]TopicSpec {
+	byName := make(map[string]TopicSpec, len(topics))
+	for _, topic := range topics {
+		byName[topic.Name] = topic
+	}
+	return byName
+}
+
+func compareTopics(left, right TopicSpec) []FieldDifference {
+	var fields []FieldDifference
+	if left.Partitions != right.Partitions {
+		fields = append(fields, FieldDifference{"partitions", valueOf(strconv.Itoa(int(left.Partitions))), valueOf(strconv.Itoa(int(right.Partitions)))})
+	}
+	if left.ReplicationFactor != right.ReplicationFactor {
+		fields = append(fields, FieldDifference{"replication_factor", valueOf(strconv.Itoa(int(left.ReplicationFactor))), valueOf(strconv.Itoa(int(right.ReplicationFactor)))})
+	}
+
+	names := slices.Sorted(maps.Keys(left.Configs))
+	for name := range right.Configs {
+		if _, ok := left.Configs[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		l, inLeft := left.Configs[name]
+		r, inRight := right.Configs[name]
+		if inLeft && inRight && l == r {
+			continue
+		}
+		field := FieldDifference{Field: "config " + name}
+		if inLeft {
+			field.Left = valueOf(l)
+		}
+		if inRight {
+			field.Right = valueOf(r)
+		}
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+func valueOf(s string) *string {
+	return &s
+}
+
+// subtractACLs returns the entries of acls that are not in other
+func subtractACLs(acls, other []ACLEntry) []ACLEntry {
+	present := make(map[ACLEntry]bool, len(other))
+	for _, acl := range other {
+		present[acl] = true
+	}
+	missing := []ACLEntry{}
+	for _, acl := range acls {
+		if !present[acl] {
+			missing = append(missing, acl)
+		}
+	}
+	return missing
+}
+
+// String describes the entry like kafka-acls does
+func (a ACLEntry) String() string {
+	return fmt.Sprintf("%s has %s permission for %s from host %s on %s:%s (%s)",
+		a.Principal, a.Permission, a.Operation, a.Host, a.ResourceType, a.ResourceName, a.PatternType)
+}
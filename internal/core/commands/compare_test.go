@@ -0,0 +1,68 @@
+package commands
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCompareSnapshots(t *testing.T) {
+	readOrders := ACLEntry{ResourceType: "Topic", ResourceName: "orders", PatternType: "Literal", Principal: "User:alice", Host: "*", Operation: "Read", Permission: "Allow"}
+	writeOrders := readOrders
+	writeOrders.Operation = "Write"
+
+	left := &ClusterSnapshot{
+		Cluster: "prod",
+		Topics: []TopicSpec{
+			{Name: "orders", Partitions: 12, ReplicationFactor: 3, Configs: ConfigValues{"retention.ms": "604800000", "cleanup.policy": "delete"}},
+			{Name: "payments", Partitions: 6, ReplicationFactor: 3},
+			{Name: "legacy", Partitions: 1, ReplicationFactor: 3},
+		},
+		ACLs: []ACLEntry{readOrders, writeOrders},
+	}
+	right := &ClusterSnapshot{
+		Cluster: "staging",
+		Topics: []TopicSpec{
+			{Name: "orders", Partitions: 6, ReplicationFactor: 3, Configs: ConfigValues{"retention.ms": "86400000", "min.insync.replicas": "2"}},
+			{Name: "payments", Partitions: 6, ReplicationFactor: 3},
+			{Name: "audit", Partitions: 1, ReplicationFactor: 1},
+		},
+		ACLs: []ACLEntry{readOrders},
+	}
+
+	comparison := CompareSnapshots(left, right)
+	if comparison.InSync {
+		t.Fatal("comparison is in sync, want differences")
+	}
+
+	presence := map[string]string{}
+	for _, topic := range comparison.Topics {
+		presence[topic.Topic] = topic.Presence
+	}
+	if len(presence) != 3 || presence["audit"] != PresenceRight || presence["legacy"] != PresenceLeft || presence["orders"] != PresenceBoth {
+		t.Fatalf("topics = %+v", comparison.Topics)
+	}
+
+	var fields []string
+	for _, field := range comparison.Topics[2].Fields {
+		fields = append(fields, field.Field+"="+fieldString(field.Left)+"/"+fieldString(field.Right))
+	}
+	want := "partitions=12/6 config cleanup.policy=delete/- config min.insync.replicas=-/2 config retention.ms=604800000/86400000"
+	if got := strings.Join(fields, " "); got != want {
+		t.Errorf("orders fields = %s, want %s", got, want)
+	}
+
+	if len(comparison.ACLsLeft) != 1 || comparison.ACLsLeft[0] != writeOrders || len(comparison.ACLsRight) != 0 {
+		t.Errorf("ACLs only left = %v, only right = %v", comparison.ACLsLeft, comparison.ACLsRight)
+	}
+
+	if !CompareSnapshots(left, left).InSync {
+		t.Error("a snapshot compared with itself is not in sync")
+	}
+}
+
+func fieldString(value *string) string {
+	if value == nil {
+		return "-"
+	}
+	return *value
+}
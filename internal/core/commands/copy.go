@@ -0,0 +1,635 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/IBM/openkommander/pkg/cluster"
+	"github.com/IBM/sarama"
+)
+
+const (
+	// copyBatchSize is the most messages produced in one request
+	copyBatchSize = 500
+	// copyIdleTimeout is how long a partition waits for the next message, on top of the
+	// consumer's retry backoff and fetch wait, before taking the messages left before its
+	// end offset as removed by compaction or taken by transaction markers
+	copyIdleTimeout = 2 * time.Second
+	// checkpointInterval is how often progress is written to the checkpoint file
+	checkpointInterval = time.Second
+)
+
+// CopyOptions control which messages CopyTopic copies and where they go
+type CopyOptions struct {
+	// PartitionMap maps source to target partitions; source partitions it leaves out are
+	// not copied. When nil every partition is copied to the partition with the same number.
+	PartitionMap map[int32]int32
+	// Repartition lets the target's hash partitioner place messages by key instead
+	Repartition bool
+
+	OffsetRange
+
+	// RateLimit is the most messages copied per second, unlimited when zero
+	RateLimit float64
+	// Checkpoint is a file recording the progress, from which an interrupted copy resumes
+	Checkpoint string
+	// Progress is called about once a second with the number of messages copied so far
+	Progress func(copied int64)
+}
+
+// OffsetRange bounds the messages read from every partition of a topic. Messages are read
+// up to the end offsets the partitions had when reading started.
+type OffsetRange struct {
+	// StartOffset and EndOffset bound the range to [StartOffset, EndOffset); negative values
+	// mean the oldest and the newest offset
+	StartOffset int64
+	EndOffset   int64
+	// StartTime and EndTime, when set, bound the range by message timestamp instead
+	StartTime time.Time
+	EndTime   time.Time
+}
+
+// PartitionCopy is the range of a source partition copied and the partition it went to,
+// -1 when the target partitioner chose
+type PartitionCopy struct {
+	Partition       int32 `json:"partition"`
+	TargetPartition int32 `json:"target_partition"`
+	StartOffset     int64 `json:"start_offset"`
+	EndOffset       int64 `json:"end_offset"`
+	Copied          int64 `json:"copied"`
+	// Skipped counts the offsets at the end of the range no message arrived for, such as
+	// compacted records or transaction markers
+	Skipped int64 `json:"skipped,omitempty"`
+}
+
+// CopyReport summarises a copy. Resumed is set when it continued from a checkpoint.
+type CopyReport struct {
+	Partitions []PartitionCopy `json:"partitions"`
+	Copied     int64           `json:"copied"`
+	Resumed    bool            `json:"resumed"`
+}
+
+// copyCheckpoint is the content of a checkpoint file: the next offset to copy from each
+// source partition
+type copyCheckpoint struct {
+	Source      string          `json:"source"`
+	Target      string          `json:"target"`
+	NextOffsets map[int32]int64 `json:"next_offsets"`
+}
+
+// CopyTopic copies the messages of a topic to a topic of another, or the same, cluster
+// with their keys, headers and timestamps. The target topic must exist. Messages are copied
+// at least once: after an interruption the copy resumes from the checkpoint, which may
+// repeat the messages of the last unconfirmed batch. The report is returned even when the
+// copy fails part way.
+func CopyTopic(ctx context.Context, source *cluster.Handle, sourceTopic string, target *cluster.Handle, targetTopic string, options CopyOptions) (*CopyReport, *Failure) {
+	if failure := contextFailure(ctx); failure != nil {
+		return nil, failure
+	}
+	if failure := CheckWritable(ctx, target); failure != nil {
+		return nil, failure
+	}
+	if source.Name == target.Name && sourceTopic == targetTopic {
+		return nil, NewFailure("Source and target are the same topic", http.StatusBadRequest).WithCode(CodeValidationFailed)
+	}
+
+	sourcePartitions, failure := topicPartitions(ctx, source, sourceTopic)
+	if failure != nil {
+		return nil, failure
+	}
+	targetPartitions, failure := topicPartitions(ctx, target, targetTopic)
+	if failure != nil {
+		return nil, failure
+	}
+	copies, failure := mapPartitions(sourcePartitions, len(targetPartitions), options)
+	if failure != nil {
+		return nil, failure
+	}
+
+	report := &CopyReport{}
+	checkpoint := &copyCheckpoint{
+		Source:      source.Name + "/" + sourceTopic,
+		Target:      target.Name + "/" + targetTopic,
+		NextOffsets: map[int32]int64{},
+	}
+	if options.Checkpoint != "" {
+		saved, err := loadCheckpoint(options.Checkpoint)
+		if err != nil {
+			return nil, NewFailure(err.Error(), http.StatusBadRequest).WithCode(CodeValidationFailed)
+		}
+		if saved != nil {
+			if saved.Source != checkpoint.Source || saved.Target != checkpoint.Target {
+				return nil, NewFailure(fmt.Sprintf("Checkpoint %s belongs to a copy from %s to %s", options.Checkpoint, saved.Source, saved.Target), http.StatusBadRequest).WithCode(CodeValidationFailed)
+			}
+			checkpoint.NextOffsets = saved.NextOffsets
+			report.Resumed = true
+		}
+	}
+
+	for i := range copies {
+		start, end, failure := resolveRange(ctx, source, sourceTopic, copies[i].Partition, options.OffsetRange)
+		if failure != nil {
+			return nil, failure
+		}
+		copies[i].StartOffset, copies[i].EndOffset = start, end
+		if next, ok := checkpoint.NextOffsets[copies[i].Partition]; ok && next > copies[i].StartOffset {
+			copies[i].StartOffset = min(next, copies[i].EndOffset)
+		}
+		checkpoint.NextOffsets[copies[i].Partition] = copies[i].StartOffset
+	}
+	report.Partitions = copies
+
+	producer, err := cluster.Await(ctx, func() (sarama.SyncProducer, error) {
+		return sarama.NewSyncProducer(target.Brokers, copyProducerConfig(target, options.Repartition))
+	})
+	if err != nil {
+		return report, NewKafkaFailure("Failed to open Kafka producer", err)
+	}
+	defer func() { _ = producer.Close() }()
+
+	consumer, err := sarama.NewConsumerFromClient(source.Client)
+	if err != nil {
+		return report, NewKafkaFailure("Failed to open Kafka consumer", err)
+	}
+	defer func() { _ = consumer.Close() }()
+
+	copyCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	progress := &copyProgress{checkpoint: checkpoint, path: options.Checkpoint}
+	limiter := newRateLimiter(options.RateLimit)
+
+	var wg sync.WaitGroup
+	var firstErr error
+	var errOnce sync.Once
+	for i := range copies {
+		if copies[i].StartOffset >= copies[i].EndOffset {
+			continue
+		}
+		wg.Add(1)
+		go func(partition *PartitionCopy) {
+			defer wg.Done()
+			err := copyPartition(copyCtx, consumer, rangeIdleTimeout(source.Client.Config()), producer, limiter, progress, sourceTopic, targetTopic, partition)
+			if err != nil {
+				errOnce.Do(func() {
+					firstErr = fmt.Errorf("partition %d: %w", partition.Partition, err)
+					cancel()
+				})
+			}
+		}(&copies[i])
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	ticker := time.NewTicker(checkpointInterval)
+	defer ticker.Stop()
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		case <-ticker.C:
+			if err := progress.save(); err != nil {
+				errOnce.Do(func() {
+					firstErr = err
+					cancel()
+				})
+			}
+			if options.Progress != nil {
+				options.Progress(progress.total())
+			}
+		}
+	}
+
+	saveErr := progress.save()
+	for i := range copies {
+		copies[i].Copied = progress.copied(copies[i].Partition)
+	}
+	report.Copied = progress.total()
+
+	switch {
+	case firstErr != nil && ctx.Err() == nil:
+		return report, NewKafkaFailure("Error copying messages", firstErr)
+	case ctx.Err() != nil:
+		return report, contextFailure(ctx)
+	case saveErr != nil:
+		return report, NewFailure(saveErr.Error(), http.StatusInternalServerError)
+	}
+	return report, nil
+}
+
+// topicPartitions returns the partitions of a topic, failing when it does not exist
+func topicPartitions(ctx context.Context, h *cluster.Handle, topicName string) ([]int32, *Failure) {
+	partitions, err := cluster.Await(ctx, func() ([]int32, error) {
+		if err := h.Client.RefreshMetadata(topicName); err != nil {
+			return nil, err
+		}
+		return h.Client.Partitions(topicName)
+	})
+	if errors.Is(err, sarama.ErrUnknownTopicOrPartition) {
+		return nil, NewFailure(fmt.Sprintf("Topic '%s' not found on cluster '%s'", topicName, h.Name), http.StatusNotFound).WithCode(CodeTopicNotFound)
+	}
+	if err != nil {
+		return nil, NewKafkaFailure(fmt.Sprintf("Error reading partitions of topic '%s' on cluster '%s'", topicName, h.Name), err)
+	}
+	sorted := append([]int32(nil), partitions...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted, nil
+}
+
+// ParsePartitionMap parses a partition mapping such as "0:1,1:0", mapping source partition 0
+// to target partition 1 and source partition 1 to target partition 0
+func ParsePartitionMap(value string) (map[int32]int32, error) {
+	mapping := map[int32]int32{}
+	for _, pair := range strings.Split(value, ",") {
+		source, target, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid partition mapping '%s', want SOURCE:TARGET", pair)
+		}
+		from, err := strconv.ParseInt(strings.TrimSpace(source), 10, 32)
+		if err != nil || from < 0 {
+			return nil, fmt.Errorf("invalid source partition in '%s'", pair)
+		}
+		to, err := strconv.ParseInt(strings.TrimSpace(target), 10, 32)
+		if err != nil || to < 0 {
+			return nil, fmt.Errorf("invalid target partition in '%s'", pair)
+		}
+		if _, duplicate := mapping[int32(from)]; duplicate {
+			return nil, fmt.Errorf("source partition %d is mapped twice", from)
+		}
+		mapping[int32(from)] = int32(to)
+	}
+	return mapping, nil
+}
+
+// mapPartitions decides the target partition of each source partition to copy
+func mapPartitions(sourcePartitions []int32, targetPartitionCount int, options CopyOptions) ([]PartitionCopy, *Failure) {
+	copies := []PartitionCopy{}
+	for _, partition := range sourcePartitions {
+		target := partition
+		switch {
+		case options.Repartition:
+			target = -1
+		case options.PartitionMap != nil:
+			mapped, ok := options.PartitionMap[partition]
+			if !ok {
+				continue
+			}
+			target = mapped
+		}
+		if target >= int32(targetPartitionCount) {
+			return nil, NewFailure(fmt.Sprintf("Target topic has %d partitions, so partition %d cannot be copied to partition %d; map it with a partition map or repartition by key",
+				targetPartitionCount, partition, target), http.StatusBadRequest).WithCode(CodeValidationFailed)
+		}
+		copies = append(copies, PartitionCopy{Partition: partition, TargetPartition: target})
+	}
+
+	for partition := range options.PartitionMap {
+		if !containsPartition(sourcePartitions, partition) {
+			return nil, NewFailure(fmt.Sprintf("Source topic has no partition %d", partition), http.StatusBadRequest).WithCode(CodeValidationFailed)
+		}
+	}
+	if len(copies) == 0 {
+		return nil, NewFailure("No partitions to copy", http.StatusBadRequest).WithCode(CodeValidationFailed)
+	}
+	return copies, nil
+}
+
+func containsPartition(partitions []int32, partition int32) bool {
+	for _, p := range partitions {
+		if p == partition {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveRange returns the offsets of a partition in the range, within the offsets the
+// partition currently holds
+func resolveRange(ctx context.Context, h *cluster.Handle, topicName string, partition int32, r OffsetRange) (int64, int64, *Failure) {
+	offset := func(at int64) (int64, *Failure) {
+		return partitionOffset(ctx, h, topicName, partition, at)
+	}
+
+	oldest, failure := offset(sarama.OffsetOldest)
+	if failure != nil {
+		return 0, 0, failure
+	}
+	newest, failure := offset(sarama.OffsetNewest)
+	if failure != nil {
+		return 0, 0, failure
+	}
+
+	start, end := oldest, newest
+	switch {
+	case !r.StartTime.IsZero():
+		if start, failure = offsetAtTime(offset, r.StartTime, newest); failure != nil {
+			return 0, 0, failure
+		}
+	case r.StartOffset >= 0:
+		start = max(r.StartOffset, oldest)
+	}
+	switch {
+	case !r.EndTime.IsZero():
+		if end, failure = offsetAtTime(offset, r.EndTime, newest); failure != nil {
+			return 0, 0, failure
+		}
+	case r.EndOffset >= 0:
+		end = min(r.EndOffset, newest)
+	}
+	return start, max(start, end), nil
+}
+
+// offsetAtTime returns the first offset whose message is not older than t, or newest when
+// there is none
+func offsetAtTime(offset func(int64) (int64, *Failure), t time.Time, newest int64) (int64, *Failure) {
+	value, failure := offset(t.UnixMilli())
+	if failure != nil {
+		return 0, failure
+	}
+	if value < 0 {
+		return newest, nil
+	}
+	return value, nil
+}
+
+// copyProducerConfig returns the target's client config set up to produce in order and
+// report every message
+func copyProducerConfig(target *cluster.Handle, repartition bool) *sarama.Config {
+	config := *target.Client.Config()
+	config.Producer.Return.Successes = true
+	config.Producer.Return.Errors = true
+	config.Producer.RequiredAcks = sarama.WaitForAll
+	config.Producer.MaxMessageBytes = int(sarama.MaxRequestSize)
+	// One request in flight per broker keeps retried batches in order
+	config.Net.MaxOpenRequests = 1
+	if repartition {
+		config.Producer.Partitioner = sarama.NewHashPartitioner
+	} else {
+		config.Producer.Partitioner = sarama.NewManualPartitioner
+	}
+	return &config
+}
+
+// copyPartition copies the messages of one partition in batches, recording the progress
+// after each batch the target acknowledged
+func copyPartition(ctx context.Context, consumer sarama.Consumer, idleTimeout time.Duration, producer sarama.SyncProducer, limiter *rateLimiter, progress *copyProgress,
+	sourceTopic, targetTopic string, partition *PartitionCopy) error {
+	reached, err := consumeRange(ctx, consumer, idleTimeout, sourceTopic, partition.Partition, partition.StartOffset, partition.EndOffset, func(messages []*sarama.ConsumerMessage) error {
+		batch := make([]*sarama.ProducerMessage, 0, len(messages))
+		for _, message := range messages {
+			if err := limiter.wait(ctx); err != nil {
+				return err
+			}
+			batch = append(batch, copyMessage(message, targetTopic, partition.TargetPartition))
+		}
+		if err := producer.SendMessages(batch); err != nil {
+			return err
+		}
+		progress.advance(partition.Partition, messages[len(messages)-1].Offset+1, int64(len(batch)))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	partition.Skipped = partition.EndOffset - reached
+	return nil
+}
+
+// rangeIdleTimeout is how long consumeRange waits without a message before it ends a
+// range. It outlasts a leader failover, after which the consumer waits its retry backoff
+// and a fetch wait before messages arrive again.
+func rangeIdleTimeout(config *sarama.Config) time.Duration {
+	return config.Consumer.Retry.Backoff + config.Consumer.MaxWaitTime + copyIdleTimeout
+}
+
+// consumeRange consumes the messages of a partition from start up to end, exclusive, and
+// hands them to handle in batches of at most copyBatchSize. It returns the offset after
+// the last message consumed, or end when a message at or past it arrived. When no message
+// arrives for idleTimeout while the partition holds the whole range, the offsets left are
+// taken as compacted or transaction markers, and the offset returned is short of end.
+func consumeRange(ctx context.Context, consumer sarama.Consumer, idleTimeout time.Duration, topicName string, partition int32, start, end int64,
+	handle func([]*sarama.ConsumerMessage) error) (int64, error) {
+	pc, err := consumer.ConsumePartition(topicName, partition, start)
+	if err != nil {
+		return start, err
+	}
+	defer func() { _ = pc.Close() }()
+
+	idle := time.NewTimer(idleTimeout)
+	defer idle.Stop()
+	next := start
+	for next < end {
+		var batch []*sarama.ConsumerMessage
+		collect := func(message *sarama.ConsumerMessage) {
+			if message.Offset >= end {
+				next = end
+				return
+			}
+			batch = append(batch, message)
+		}
+
+		select {
+		case <-ctx.Done():
+			return next, ctx.Err()
+		case consumerErr := <-pc.Errors():
+			return next, consumerErr
+		case message := <-pc.Messages():
+			collect(message)
+		case <-idle.C:
+			if pc.HighWaterMarkOffset() >= end {
+				return next, nil
+			}
+			idle.Reset(idleTimeout)
+			continue
+		}
+	drain:
+		for len(batch) > 0 && len(batch) < copyBatchSize && batch[len(batch)-1].Offset+1 < end {
+			select {
+			case message := <-pc.Messages():
+				collect(message)
+			default:
+				break drain
+			}
+		}
+		if len(batch) == 0 {
+			continue
+		}
+
+		if err := handle(batch); err != nil {
+			return next, err
+		}
+		next = max(next, batch[len(batch)-1].Offset+1)
+		idle.Reset(idleTimeout)
+	}
+	return next, nil
+}
+
+// copyMessage returns a message to produce with the key, value, headers and timestamp of
+// the consumed one. A nil value stays nil, so tombstones are copied as tombstones.
+func copyMessage(message *sarama.ConsumerMessage, topicName string, partition int32) *sarama.ProducerMessage {
+	copied := &sarama.ProducerMessage{
+		Topic:     topicName,
+		Partition: partition,
+		Timestamp: message.Timestamp,
+	}
+	if message.Key != nil {
+		copied.Key = sarama.ByteEncoder(message.Key)
+	}
+	if message.Value != nil {
+		copied.Value = sarama.ByteEncoder(message.Value)
+	}
+	for _, header := range message.Headers {
+		if header != nil {
+			copied.Headers = append(copied.Headers, *header)
+		}
+	}
+	return copied
+}
+
+// copyProgress tracks the messages copied and the checkpoint shared by the partitions
+type copyProgress struct {
+	mu         sync.Mutex
+	checkpoint *copyCheckpoint
+	path       string
+	counts     map[int32]int64
+	dirty      bool
+}
+
+func (p *copyProgress) advance(partition int32, next int64, copied int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.counts == nil {
+		p.counts = map[int32]int64{}
+	}
+	p.counts[partition] += copied
+	p.checkpoint.NextOffsets[partition] = next
+	p.dirty = true
+}
+
+func (p *copyProgress) copied(partition int32) int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.counts[partition]
+}
+
+func (p *copyProgress) total() int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var total int64
+	for _, count := range p.counts {
+		total += count
+	}
+	return total
+}
+
+// save writes the checkpoint if it changed since the last save
+func (p *copyProgress) save() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.path == "" || !p.dirty {
+		return nil
+	}
+	if err := writeCheckpoint(p.path, p.checkpoint); err != nil {
+		return err
+	}
+	p.dirty = false
+	return nil
+}
+
+// loadCheckpoint reads a checkpoint file, returning nil when it does not exist yet
+func loadCheckpoint(path string) (*copyCheckpoint, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading checkpoint: %w", err)
+	}
+	var checkpoint copyCheckpoint
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		return nil, fmt.Errorf("checkpoint %s is not valid: %w", path, err)
+	}
+	if checkpoint.NextOffsets == nil {
+		checkpoint.NextOffsets = map[int32]int64{}
+	}
+	return &checkpoint, nil
+}
+
+// writeCheckpoint replaces the checkpoint file atomically, so an interruption never
+// leaves it half written
+func writeCheckpoint(path string, checkpoint *copyCheckpoint) error {
+	data, err := json.MarshalIndent(checkpoint, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("error writing checkpoint: %w", err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("error writing checkpoint: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing checkpoint: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("error writing checkpoint: %w", err)
+	}
+	return nil
+}
+
+// rateLimiter spaces events evenly to at most a given number per second. A nil limiter
+// does not limit.
+type rateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+func newRateLimiter(perSecond float64) *rateLimiter {
+	if perSecond <= 0 {
+		return nil
+	}
+	return &rateLimiter{interval: time.Duration(float64(time.Second) / perSecond)}
+}
+
+// wait blocks until the next event is allowed or the context is done
+func (l *rateLimiter) wait(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	delay := l.next.Sub(now)
+	l.next = l.next.Add(l.interval)
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
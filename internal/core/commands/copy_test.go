@@ -0,0 +1,190 @@
+package commands
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+func TestParsePartitionMap(t *testing.T) {
+	mapping, err := ParsePartitionMap("0:1, 1:0,2:2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mapping) != 3 || mapping[0] != 1 || mapping[1] != 0 || mapping[2] != 2 {
+		t.Errorf("mapping = %v", mapping)
+	}
+
+	for _, invalid := range []string{"0", "a:1", "0:-1", "0:1,0:2"} {
+		if _, err := ParsePartitionMap(invalid); err == nil {
+			t.Errorf("ParsePartitionMap(%q) succeeded, want an error", invalid)
+		}
+	}
+}
+
+func TestMapPartitions(t *testing.T) {
+	source := []int32{0, 1, 2}
+
+	if _, failure := mapPartitions(source, 2, CopyOptions{}); failure == nil {
+		t.Error("copying 3 partitions to 2 by number succeeded, want an error")
+	}
+
+	copies, failure := mapPartitions(source, 2, CopyOptions{PartitionMap: map[int32]int32{2: 0}})
+	if failure != nil {
+		t.Fatal(failure.Err)
+	}
+	if len(copies) != 1 || copies[0].Partition != 2 || copies[0].TargetPartition != 0 {
+		t.Errorf("mapped copies = %+v, want partition 2 to 0 only", copies)
+	}
+
+	if _, failure := mapPartitions(source, 2, CopyOptions{PartitionMap: map[int32]int32{5: 0}}); failure == nil {
+		t.Error("mapping a missing source partition succeeded, want an error")
+	}
+
+	copies, failure = mapPartitions(source, 1, CopyOptions{Repartition: true})
+	if failure != nil {
+		t.Fatal(failure.Err)
+	}
+	if len(copies) != 3 || copies[0].TargetPartition != -1 {
+		t.Errorf("repartitioned copies = %+v", copies)
+	}
+}
+
+func TestCopyTopic(t *testing.T) {
+	broker := sarama.NewMockBroker(t, 1)
+	h := openMockCluster(t, broker, map[string]sarama.MockResponse{
+		"OffsetRequest": sarama.NewMockOffsetResponse(t).
+			SetOffset("orders", 0, sarama.OffsetOldest, 0).
+			SetOffset("orders", 0, sarama.OffsetNewest, 3),
+		"FetchRequest": sarama.NewMockFetchResponse(t, 10).
+			SetMessageWithKey("orders", 0, 0, sarama.StringEncoder("a"), sarama.StringEncoder("first")).
+			SetMessageWithKey("orders", 0, 1, sarama.StringEncoder("b"), sarama.StringEncoder("second")).
+			SetMessageWithKey("orders", 0, 2, sarama.StringEncoder("c"), sarama.StringEncoder("third")).
+			SetHighWaterMark("orders", 0, 3),
+		"ProduceRequest": sarama.NewMockProduceResponse(t),
+	}, "orders", "orders-copy")
+
+	checkpoint := filepath.Join(t.TempDir(), "copy.json")
+	options := CopyOptions{OffsetRange: OffsetRange{StartOffset: 1, EndOffset: -1}, Checkpoint: checkpoint}
+	report, failure := CopyTopic(context.Background(), h, "orders", h, "orders-copy", options)
+	if failure != nil {
+		t.Fatal(failure.Err)
+	}
+	if report.Copied != 2 || report.Resumed || report.Partitions[0].StartOffset != 1 || report.Partitions[0].EndOffset != 3 {
+		t.Errorf("report = %+v, want offsets 1 and 2 copied", report)
+	}
+
+	produced := false
+	for _, rr := range broker.History() {
+		if _, ok := rr.Request.(*sarama.ProduceRequest); ok {
+			produced = true
+		}
+	}
+	if !produced {
+		t.Error("no messages were produced to the target")
+	}
+
+	saved, err := loadCheckpoint(checkpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved == nil || saved.Source != "test/orders" || saved.NextOffsets[0] != 3 {
+		t.Fatalf("checkpoint = %+v, want next offset 3", saved)
+	}
+
+	// Resuming a finished copy copies nothing more
+	report, failure = CopyTopic(context.Background(), h, "orders", h, "orders-copy", options)
+	if failure != nil {
+		t.Fatal(failure.Err)
+	}
+	if report.Copied != 0 || !report.Resumed {
+		t.Errorf("resumed report = %+v, want nothing copied", report)
+	}
+
+	if _, failure := CopyTopic(context.Background(), h, "orders", h, "orders", CopyOptions{}); failure == nil {
+		t.Error("copying a topic onto itself succeeded, want an error")
+	}
+}
+
+func TestCopyMessage(t *testing.T) {
+	consumed := &sarama.ConsumerMessage{
+		Key:       []byte("order-1"),
+		Timestamp: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		Headers:   []*sarama.RecordHeader{{Key: []byte("trace"), Value: []byte("abc")}},
+	}
+
+	copied := copyMessage(consumed, "orders-copy", 3)
+	if copied.Topic != "orders-copy" || copied.Partition != 3 || !copied.Timestamp.Equal(consumed.Timestamp) {
+		t.Errorf("copied = %+v", copied)
+	}
+	if key, _ := copied.Key.Encode(); string(key) != "order-1" {
+		t.Errorf("key = %q, want order-1", key)
+	}
+	if copied.Value != nil {
+		t.Errorf("value = %v, want a tombstone", copied.Value)
+	}
+	if len(copied.Headers) != 1 || string(copied.Headers[0].Key) != "trace" || string(copied.Headers[0].Value) != "abc" {
+		t.Errorf("headers = %+v", copied.Headers)
+	}
+}
+
+// idleConsumer serves a partition whose messages stop before the end of the range
+type idleConsumer struct {
+	sarama.Consumer
+	partition *idlePartitionConsumer
+}
+
+func (c *idleConsumer) ConsumePartition(string, int32, int64) (sarama.PartitionConsumer, error) {
+	return c.partition, nil
+}
+
+type idlePartitionConsumer struct {
+	sarama.PartitionConsumer
+	messages      chan *sarama.ConsumerMessage
+	highWaterMark int64
+}
+
+func (pc *idlePartitionConsumer) Messages() <-chan *sarama.ConsumerMessage { return pc.messages }
+func (pc *idlePartitionConsumer) Errors() <-chan *sarama.ConsumerError     { return nil }
+func (pc *idlePartitionConsumer) HighWaterMarkOffset() int64               { return pc.highWaterMark }
+func (pc *idlePartitionConsumer) Close() error                             { return nil }
+
+func newIdleConsumer(highWaterMark int64, offsets ...int64) *idleConsumer {
+	messages := make(chan *sarama.ConsumerMessage, len(offsets))
+	for _, offset := range offsets {
+		messages <- &sarama.ConsumerMessage{Offset: offset}
+	}
+	return &idleConsumer{partition: &idlePartitionConsumer{messages: messages, highWaterMark: highWaterMark}}
+}
+
+func TestConsumeRangeReportsTheOffsetReached(t *testing.T) {
+	var consumed int
+	handle := func(messages []*sarama.ConsumerMessage) error {
+		consumed += len(messages)
+		return nil
+	}
+
+	// The last two offsets of the range never arrive, as with transaction markers
+	reached, err := consumeRange(context.Background(), newIdleConsumer(5, 0, 1, 2), 50*time.Millisecond, "orders", 0, 0, 5, handle)
+	if err != nil || reached != 3 || consumed != 3 {
+		t.Errorf("consumeRange = %d, %v after %d messages, want 3 reached", reached, err, consumed)
+	}
+
+	// While the partition has not caught up with the range, waiting is not the end of it
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if reached, err := consumeRange(ctx, newIdleConsumer(3, 0, 1, 2), 50*time.Millisecond, "orders", 0, 0, 5, handle); err == nil || reached != 3 {
+		t.Errorf("consumeRange behind the range = %d, %v, want to wait until cancelled", reached, err)
+	}
+}
+
+func TestRangeIdleTimeoutOutlastsConsumerRetries(t *testing.T) {
+	config := sarama.NewConfig()
+	if timeout := rangeIdleTimeout(config); timeout <= config.Consumer.Retry.Backoff+config.Consumer.MaxWaitTime {
+		t.Errorf("idle timeout %v does not outlast the retry backoff %v and fetch wait %v",
+			timeout, config.Consumer.Retry.Backoff, config.Consumer.MaxWaitTime)
+	}
+}
@@ -0,0 +1,532 @@
+package commands
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/IBM/openkommander/pkg/cluster"
+	"github.com/IBM/sarama"
+)
+
+// Formats of topic dump files
+const (
+	DumpFormatJSONLines = "jsonl"
+	DumpFormatBinary    = "binary"
+)
+
+// DumpVersion is the version of the dump file format written by DumpTopic
+const DumpVersion = 1
+
+// dumpFileFormat identifies a dump in the header of JSON-lines files
+const dumpFileFormat = "ok-topic-dump"
+
+// binaryDumpMagic starts every binary dump file
+var binaryDumpMagic = []byte("OKDUMP1\n")
+
+// DumpOptions control which records DumpTopic writes and how
+type DumpOptions struct {
+	OffsetRange
+	// Format is DumpFormatJSONLines or DumpFormatBinary
+	Format string
+	// Uncompressed writes the file without gzip compression
+	Uncompressed bool
+}
+
+// PartitionDump is the range of a partition written to a dump
+type PartitionDump struct {
+	Partition   int32 `json:"partition"`
+	StartOffset int64 `json:"start_offset"`
+	EndOffset   int64 `json:"end_offset"`
+	Records     int64 `json:"records"`
+	// Skipped counts the offsets at the end of the range no message arrived for, such as
+	// compacted records or transaction markers
+	Skipped int64 `json:"skipped,omitempty"`
+}
+
+// DumpReport summarises a dump
+type DumpReport struct {
+	Topic      string          `json:"topic"`
+	Format     string          `json:"format"`
+	Partitions []PartitionDump `json:"partitions"`
+	Records    int64           `json:"records"`
+}
+
+// RestoreOptions control how RestoreTopic replays a dump
+type RestoreOptions struct {
+	// Repartition lets the target's hash partitioner place records by key instead of
+	// keeping the partitions they were dumped from
+	Repartition bool
+	// RateLimit is the most records produced per second, unlimited when zero
+	RateLimit float64
+}
+
+// RestoreReport summarises a restore. Source is the cluster and topic the dump was taken from.
+type RestoreReport struct {
+	Topic   string `json:"topic"`
+	Source  string `json:"source"`
+	Records int64  `json:"records"`
+}
+
+// DumpHeader starts every dump file and describes where it was taken
+type DumpHeader struct {
+	Format     string    `json:"format"`
+	Version    int       `json:"version"`
+	Cluster    string    `json:"cluster"`
+	Topic      string    `json:"topic"`
+	Partitions []int32   `json:"partitions"`
+	TakenAt    time.Time `json:"taken_at"`
+}
+
+// DumpFormatForPath returns the dump format implied by a file extension, ignoring a
+// trailing .gz, or "" when the extension is not known
+func DumpFormatForPath(path string) string {
+	switch strings.ToLower(filepath.Ext(strings.TrimSuffix(strings.ToLower(path), ".gz"))) {
+	case ".jsonl", ".ndjson", ".json":
+		return DumpFormatJSONLines
+	case ".bin", ".okdump":
+		return DumpFormatBinary
+	default:
+		return ""
+	}
+}
+
+// DumpTopic writes the records of a topic, with their partitions, offsets, timestamps, keys,
+// values and headers, to w. Partitions are written one after another up to the end offsets
+// they had when the dump started.
+func DumpTopic(ctx context.Context, h *cluster.Handle, topicName string, w io.Writer, options DumpOptions) (*DumpReport, *Failure) {
+	if failure := contextFailure(ctx); failure != nil {
+		return nil, failure
+	}
+	if options.Format == "" {
+		options.Format = DumpFormatJSONLines
+	}
+	if options.Format != DumpFormatJSONLines && options.Format != DumpFormatBinary {
+		return nil, NewFailure(fmt.Sprintf("Unknown dump format '%s', want %s or %s", options.Format, DumpFormatJSONLines, DumpFormatBinary), http.StatusBadRequest).WithCode(CodeValidationFailed)
+	}
+
+	partitions, failure := topicPartitions(ctx, h, topicName)
+	if failure != nil {
+		return nil, failure
+	}
+	report := &DumpReport{Topic: topicName, Format: options.Format, Partitions: make([]PartitionDump, 0, len(partitions))}
+	for _, partition := range partitions {
+		start, end, failure := resolveRange(ctx, h, topicName, partition, options.OffsetRange)
+		if failure != nil {
+			return nil, failure
+		}
+		report.Partitions = append(report.Partitions, PartitionDump{Partition: partition, StartOffset: start, EndOffset: end})
+	}
+
+	writer, err := newDumpWriter(w, options.Format, !options.Uncompressed, &DumpHeader{
+		Format:     dumpFileFormat,
+		Version:    DumpVersion,
+		Cluster:    h.Name,
+		Topic:      topicName,
+		Partitions: partitions,
+		TakenAt:    time.Now().UTC(),
+	})
+	if err != nil {
+		return nil, NewFailure(fmt.Sprintf("Error writing dump: %v", err), http.StatusInternalServerError)
+	}
+
+	consumer, err := sarama.NewConsumerFromClient(h.Client)
+	if err != nil {
+		return nil, NewKafkaFailure("Failed to open Kafka consumer", err)
+	}
+	defer func() { _ = consumer.Close() }()
+
+	var writeErr error
+	for i := range report.Partitions {
+		partition := &report.Partitions[i]
+		if partition.StartOffset >= partition.EndOffset {
+			continue
+		}
+		reached, err := consumeRange(ctx, consumer, rangeIdleTimeout(h.Client.Config()), topicName, partition.Partition, partition.StartOffset, partition.EndOffset, func(messages []*sarama.ConsumerMessage) error {
+			for _, message := range messages {
+				if writeErr = writer.write(message); writeErr != nil {
+					return writeErr
+				}
+				partition.Records++
+				report.Records++
+			}
+			return nil
+		})
+		switch {
+		case writeErr != nil:
+			return report, NewFailure(fmt.Sprintf("Error writing dump: %v", writeErr), http.StatusInternalServerError)
+		case ctx.Err() != nil:
+			return report, contextFailure(ctx)
+		case err != nil:
+			return report, NewKafkaFailure(fmt.Sprintf("Error reading partition %d", partition.Partition), err)
+		}
+		partition.Skipped = partition.EndOffset - reached
+	}
+
+	if err := writer.close(); err != nil {
+		return report, NewFailure(fmt.Sprintf("Error writing dump: %v", err), http.StatusInternalServerError)
+	}
+	return report, nil
+}
+
+// RestoreTopic produces the records of a dump to a topic, which must exist, in the
+// partitions they were dumped from. The topic of the dump is used when topicName is empty.
+func RestoreTopic(ctx context.Context, h *cluster.Handle, topicName string, r io.Reader, options RestoreOptions) (*RestoreReport, *Failure) {
+	if failure := contextFailure(ctx); failure != nil {
+		return nil, failure
+	}
+	if failure := CheckWritable(ctx, h); failure != nil {
+		return nil, failure
+	}
+
+	reader, err := openDump(r)
+	if err != nil {
+		return nil, NewFailure(err.Error(), http.StatusBadRequest).WithCode(CodeValidationFailed)
+	}
+	if topicName == "" {
+		topicName = reader.header.Topic
+	}
+	report := &RestoreReport{Topic: topicName, Source: reader.header.Cluster + "/" + reader.header.Topic}
+
+	targetPartitions, failure := topicPartitions(ctx, h, topicName)
+	if failure != nil {
+		return nil, failure
+	}
+	if _, failure := mapPartitions(reader.header.Partitions, len(targetPartitions), CopyOptions{Repartition: options.Repartition}); failure != nil {
+		return nil, failure
+	}
+
+	producer, err := cluster.Await(ctx, func() (sarama.SyncProducer, error) {
+		return sarama.NewSyncProducer(h.Brokers, copyProducerConfig(h, options.Repartition))
+	})
+	if err != nil {
+		return nil, NewKafkaFailure("Failed to open Kafka producer", err)
+	}
+	defer func() { _ = producer.Close() }()
+
+	limiter := newRateLimiter(options.RateLimit)
+	batch := make([]*sarama.ProducerMessage, 0, copyBatchSize)
+	flush := func() *Failure {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := producer.SendMessages(batch); err != nil {
+			return NewKafkaFailure("Error producing records", err)
+		}
+		report.Records += int64(len(batch))
+		batch = batch[:0]
+		return nil
+	}
+	for {
+		message, err := reader.next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return report, NewFailure(err.Error(), http.StatusBadRequest).WithCode(CodeValidationFailed)
+		}
+		if err := limiter.wait(ctx); err != nil {
+			return report, contextFailure(ctx)
+		}
+		partition := message.Partition
+		if options.Repartition {
+			partition = -1
+		}
+		batch = append(batch, copyMessage(message, topicName, partition))
+		if len(batch) == copyBatchSize {
+			if failure := flush(); failure != nil {
+				return report, failure
+			}
+			if failure := contextFailure(ctx); failure != nil {
+				return report, failure
+			}
+		}
+	}
+	if failure := flush(); failure != nil {
+		return report, failure
+	}
+	return report, nil
+}
+
+// ReadDumpHeader returns the header of a dump file
+func ReadDumpHeader(r io.Reader) (*DumpHeader, error) {
+	reader, err := openDump(r)
+	if err != nil {
+		return nil, err
+	}
+	return &reader.header, nil
+}
+
+// dumpWriter writes the records of a dump in one of the formats
+type dumpWriter struct {
+	buffered *bufio.Writer
+	gzip     *gzip.Writer
+	format   string
+	encoder  *json.Encoder
+}
+
+func newDumpWriter(w io.Writer, format string, compress bool, header *DumpHeader) (*dumpWriter, error) {
+	writer := &dumpWriter{format: format}
+	if compress {
+		writer.gzip = gzip.NewWriter(w)
+		w = writer.gzip
+	}
+	writer.buffered = bufio.NewWriter(w)
+
+	if format == DumpFormatJSONLines {
+		writer.encoder = json.NewEncoder(writer.buffered)
+		return writer, writer.encoder.Encode(header)
+	}
+	data, err := json.Marshal(header)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := writer.buffered.Write(binaryDumpMagic); err != nil {
+		return nil, err
+	}
+	return writer, writeBytes(writer.buffered, data)
+}
+
+func (w *dumpWriter) write(message *sarama.ConsumerMessage) error {
+	if w.format == DumpFormatJSONLines {
+		return w.encoder.Encode(NewRecord(message))
+	}
+
+	fields := []any{message.Partition, message.Offset, message.Timestamp.UnixMilli()}
+	for _, field := range fields {
+		if err := binary.Write(w.buffered, binary.BigEndian, field); err != nil {
+			return err
+		}
+	}
+	if err := writeBytes(w.buffered, message.Key); err != nil {
+		return err
+	}
+	if err := writeBytes(w.buffered, message.Value); err != nil {
+		return err
+	}
+	if err := binary.Write(w.buffered, binary.BigEndian, int32(len(message.Headers))); err != nil {
+		return err
+	}
+	for _, header := range message.Headers {
+		if err := writeBytes(w.buffered, header.Key); err != nil {
+			return err
+		}
+		if err := writeBytes(w.buffered, header.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *dumpWriter) close() error {
+	if err := w.buffered.Flush(); err != nil {
+		return err
+	}
+	if w.gzip != nil {
+		return w.gzip.Close()
+	}
+	return nil
+}
+
+// writeBytes writes a length-prefixed byte slice, with a length of -1 for nil
+func writeBytes(w io.Writer, data []byte) error {
+	length := int32(len(data))
+	if data == nil {
+		length = -1
+	}
+	if err := binary.Write(w, binary.BigEndian, length); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+// readBytes reads a slice written by writeBytes. Lengths above the largest response sarama
+// accepts cannot come from a record, so they are refused before allocating.
+func readBytes(r io.Reader) ([]byte, error) {
+	var length int32
+	if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+		return nil, err
+	}
+	if length < 0 {
+		return nil, nil
+	}
+	if length > sarama.MaxResponseSize {
+		return nil, fmt.Errorf("length %d is larger than the %d byte limit", length, sarama.MaxResponseSize)
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// dumpReader reads back a file written by dumpWriter, whatever its format and compression
+type dumpReader struct {
+	header  DumpHeader
+	binary  *bufio.Reader
+	decoder *json.Decoder
+}
+
+func openDump(r io.Reader) (*dumpReader, error) {
+	buffered := bufio.NewReader(r)
+	if magic, _ := buffered.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		decompressed, err := gzip.NewReader(buffered)
+		if err != nil {
+			return nil, fmt.Errorf("dump is not valid gzip: %w", err)
+		}
+		buffered = bufio.NewReader(decompressed)
+	}
+
+	reader := &dumpReader{}
+	if magic, _ := buffered.Peek(len(binaryDumpMagic)); bytes.Equal(magic, binaryDumpMagic) {
+		_, _ = buffered.Discard(len(binaryDumpMagic))
+		data, err := readBytes(buffered)
+		if err != nil {
+			return nil, fmt.Errorf("dump header is not valid: %w", err)
+		}
+		if err := json.Unmarshal(data, &reader.header); err != nil {
+			return nil, fmt.Errorf("dump header is not valid: %w", err)
+		}
+		reader.binary = buffered
+	} else {
+		reader.decoder = json.NewDecoder(buffered)
+		if err := reader.decoder.Decode(&reader.header); err != nil || reader.header.Format != dumpFileFormat {
+			return nil, errors.New("file is not a topic dump")
+		}
+	}
+	if reader.header.Version > DumpVersion {
+		return nil, fmt.Errorf("dump version %d is newer than the supported version %d", reader.header.Version, DumpVersion)
+	}
+	return reader, nil
+}
+
+// next returns the next record, or io.EOF after the last one
+func (r *dumpReader) next() (*sarama.ConsumerMessage, error) {
+	if r.decoder != nil {
+		var record Record
+		if err := r.decoder.Decode(&record); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, err
+			}
+			return nil, fmt.Errorf("dump record is not valid: %w", err)
+		}
+		return record.message(), nil
+	}
+
+	message := &sarama.ConsumerMessage{}
+	if err := binary.Read(r.binary, binary.BigEndian, &message.Partition); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("dump record is not valid: %w", err)
+	}
+	var timestamp int64
+	var headers int32
+	err := binary.Read(r.binary, binary.BigEndian, &message.Offset)
+	if err == nil {
+		err = binary.Read(r.binary, binary.BigEndian, &timestamp)
+	}
+	if err == nil {
+		message.Key, err = readBytes(r.binary)
+	}
+	if err == nil {
+		message.Value, err = readBytes(r.binary)
+	}
+	if err == nil {
+		err = binary.Read(r.binary, binary.BigEndian, &headers)
+	}
+	for i := int32(0); err == nil && i < headers; i++ {
+		header := &sarama.RecordHeader{}
+		if header.Key, err = readBytes(r.binary); err == nil {
+			header.Value, err = readBytes(r.binary)
+		}
+		message.Headers = append(message.Headers, header)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("dump record is not valid: %w", err)
+	}
+	message.Timestamp = time.UnixMilli(timestamp)
+	return message, nil
+}
+
+// Record is a Kafka record as written to JSON-lines dumps and returned by searches. Keys
+// and values are text when they are valid UTF-8 and base64 otherwise; a missing key or
+// value is left out.
+type Record struct {
+	Partition   int32          `json:"partition"`
+	Offset      int64          `json:"offset"`
+	Timestamp   time.Time      `json:"timestamp"`
+	Key         *string        `json:"key,omitempty"`
+	KeyBase64   []byte         `json:"key_base64,omitempty"`
+	Value       *string        `json:"value,omitempty"`
+	ValueBase64 []byte         `json:"value_base64,omitempty"`
+	Headers     []RecordHeader `json:"headers,omitempty"`
+}
+
+// RecordHeader is a header of a Record
+type RecordHeader struct {
+	Key         string  `json:"key"`
+	Value       *string `json:"value,omitempty"`
+	ValueBase64 []byte  `json:"value_base64,omitempty"`
+}
+
+// NewRecord returns the Record of a consumed message
+func NewRecord(message *sarama.ConsumerMessage) *Record {
+	record := &Record{Partition: message.Partition, Offset: message.Offset, Timestamp: message.Timestamp}
+	record.Key, record.KeyBase64 = textOrBase64(message.Key)
+	record.Value, record.ValueBase64 = textOrBase64(message.Value)
+	for _, header := range message.Headers {
+		h := RecordHeader{Key: string(header.Key)}
+		h.Value, h.ValueBase64 = textOrBase64(header.Value)
+		record.Headers = append(record.Headers, h)
+	}
+	return record
+}
+
+func (r *Record) message() *sarama.ConsumerMessage {
+	message := &sarama.ConsumerMessage{
+		Partition: r.Partition,
+		Offset:    r.Offset,
+		Timestamp: r.Timestamp,
+		Key:       fromTextOrBase64(r.Key, r.KeyBase64),
+		Value:     fromTextOrBase64(r.Value, r.ValueBase64),
+	}
+	for _, header := range r.Headers {
+		message.Headers = append(message.Headers, &sarama.RecordHeader{
+			Key:   []byte(header.Key),
+			Value: fromTextOrBase64(header.Value, header.ValueBase64),
+		})
+	}
+	return message
+}
+
+func textOrBase64(data []byte) (*string, []byte) {
+	switch {
+	case data == nil:
+		return nil, nil
+	case utf8.Valid(data):
+		text := string(data)
+		return &text, nil
+	default:
+		return nil, data
+	}
+}
+
+func fromTextOrBase64(text *string, data []byte) []byte {
+	if text != nil {
+		return []byte(*text)
+	}
+	return data
+}
@@ -0,0 +1,153 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+func TestDumpFileRoundTrip(t *testing.T) {
+	messages := []*sarama.ConsumerMessage{
+		{
+			Partition: 1, Offset: 7, Timestamp: time.UnixMilli(1714564800123),
+			Key: []byte("order-1"), Value: []byte(`{"total":12}`),
+			Headers: []*sarama.RecordHeader{{Key: []byte("trace"), Value: []byte("abc")}, {Key: []byte("empty")}},
+		},
+		// A tombstone without a key, and a value that is not valid UTF-8
+		{Partition: 0, Offset: 3, Timestamp: time.UnixMilli(1714564800000)},
+		{Partition: 0, Offset: 4, Timestamp: time.UnixMilli(1714564800001), Key: []byte{}, Value: []byte{0xff, 0x00, 0xfe}},
+	}
+
+	for _, format := range []string{DumpFormatJSONLines, DumpFormatBinary} {
+		for _, compress := range []bool{true, false} {
+			var buffer bytes.Buffer
+			writer, err := newDumpWriter(&buffer, format, compress, &DumpHeader{Format: dumpFileFormat, Version: DumpVersion, Topic: "orders", Partitions: []int32{0, 1}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, message := range messages {
+				if err := writer.write(message); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := writer.close(); err != nil {
+				t.Fatal(err)
+			}
+
+			reader, err := openDump(&buffer)
+			if err != nil {
+				t.Fatalf("%s compressed=%v: %v", format, compress, err)
+			}
+			if reader.header.Topic != "orders" || len(reader.header.Partitions) != 2 {
+				t.Errorf("%s compressed=%v: header = %+v", format, compress, reader.header)
+			}
+			for i, want := range messages {
+				got, err := reader.next()
+				if err != nil {
+					t.Fatalf("%s compressed=%v: record %d: %v", format, compress, i, err)
+				}
+				if !sameMessage(got, want) {
+					t.Errorf("%s compressed=%v: record %d = %+v, want %+v", format, compress, i, got, want)
+				}
+			}
+			if _, err := reader.next(); !errors.Is(err, io.EOF) {
+				t.Errorf("%s compressed=%v: after the last record err = %v, want EOF", format, compress, err)
+			}
+		}
+	}
+
+	if _, err := openDump(strings.NewReader(`{"topics":[]}`)); err == nil {
+		t.Error("opening a file that is not a dump succeeded, want an error")
+	}
+}
+
+func TestDumpFileRejectsCorruptRecords(t *testing.T) {
+	var header bytes.Buffer
+	writer, err := newDumpWriter(&header, DumpFormatBinary, false, &DumpHeader{Format: dumpFileFormat, Version: DumpVersion, Topic: "orders", Partitions: []int32{0}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	record := func(fields ...any) []byte {
+		data := bytes.Clone(header.Bytes())
+		buffer := bytes.NewBuffer(data)
+		for _, field := range fields {
+			if err := binary.Write(buffer, binary.BigEndian, field); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return buffer.Bytes()
+	}
+	cases := map[string][]byte{
+		// Partition, offset, timestamp and a key length no record can have
+		"oversized key":  record(int32(0), int64(1), int64(1714564800000), int32(math.MaxInt32)),
+		"truncated key":  record(int32(0), int64(1), int64(1714564800000), int32(10), []byte("abc")),
+		"missing offset": record(int32(0)),
+	}
+	for name, data := range cases {
+		reader, err := openDump(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if _, err := reader.next(); err == nil || !strings.Contains(err.Error(), "dump record is not valid") {
+			t.Errorf("%s: err = %v, want the record reported as not valid", name, err)
+		}
+	}
+}
+
+func sameMessage(a, b *sarama.ConsumerMessage) bool {
+	if a.Partition != b.Partition || a.Offset != b.Offset || !a.Timestamp.Equal(b.Timestamp) ||
+		(a.Key == nil) != (b.Key == nil) || !bytes.Equal(a.Key, b.Key) ||
+		(a.Value == nil) != (b.Value == nil) || !bytes.Equal(a.Value, b.Value) ||
+		len(a.Headers) != len(b.Headers) {
+		return false
+	}
+	for i := range a.Headers {
+		if !bytes.Equal(a.Headers[i].Key, b.Headers[i].Key) || !bytes.Equal(a.Headers[i].Value, b.Headers[i].Value) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestDumpAndRestoreTopic(t *testing.T) {
+	broker := sarama.NewMockBroker(t, 1)
+	h := openMockCluster(t, broker, map[string]sarama.MockResponse{
+		"OffsetRequest": sarama.NewMockOffsetResponse(t).
+			SetOffset("orders", 0, sarama.OffsetOldest, 0).
+			SetOffset("orders", 0, sarama.OffsetNewest, 2),
+		"FetchRequest": sarama.NewMockFetchResponse(t, 10).
+			SetMessageWithKey("orders", 0, 0, sarama.StringEncoder("a"), sarama.StringEncoder("first")).
+			SetMessageWithKey("orders", 0, 1, sarama.StringEncoder("b"), sarama.StringEncoder("second")).
+			SetHighWaterMark("orders", 0, 2),
+		"ProduceRequest": sarama.NewMockProduceResponse(t),
+	}, "orders", "orders-restored")
+
+	var buffer bytes.Buffer
+	dump, failure := DumpTopic(context.Background(), h, "orders", &buffer, DumpOptions{OffsetRange: OffsetRange{StartOffset: -1, EndOffset: -1}})
+	if failure != nil {
+		t.Fatal(failure.Err)
+	}
+	if dump.Records != 2 || dump.Format != DumpFormatJSONLines {
+		t.Errorf("dump = %+v, want 2 records as JSON lines", dump)
+	}
+
+	restore, failure := RestoreTopic(context.Background(), h, "orders-restored", &buffer, RestoreOptions{})
+	if failure != nil {
+		t.Fatal(failure.Err)
+	}
+	if restore.Records != 2 || restore.Source != "test/orders" || restore.Topic != "orders-restored" {
+		t.Errorf("restore = %+v, want 2 records from test/orders", restore)
+	}
+}
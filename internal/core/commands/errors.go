@@ -0,0 +1,124 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/IBM/sarama"
+)
+
+// Error codes carried by a Failure and returned to REST clients
+const (
+	CodeBadRequest           = "BAD_REQUEST"
+	CodeUnauthorized         = "UNAUTHORIZED"
+	CodeForbidden            = "FORBIDDEN"
+	CodeNotFound             = "NOT_FOUND"
+	CodeMethodNotAllowed     = "METHOD_NOT_ALLOWED"
+	CodeConflict             = "CONFLICT"
+	CodePayloadTooLarge      = "PAYLOAD_TOO_LARGE"
+	CodeNotImplemented       = "NOT_IMPLEMENTED"
+	CodeInternal             = "INTERNAL_ERROR"
+	CodeUnavailable          = "KAFKA_UNAVAILABLE"
+	CodeTimeout              = "TIMEOUT"
+	CodeCancelled            = "CANCELLED"
+	CodeTopicNotFound        = "TOPIC_NOT_FOUND"
+	CodeTopicAlreadyExists   = "TOPIC_ALREADY_EXISTS"
+	CodeKafkaAuthentication  = "KAFKA_AUTHENTICATION_FAILED"
+	CodeKafkaAuthorization   = "KAFKA_AUTHORIZATION_FAILED"
+	CodeInvalidKafkaRequest  = "INVALID_KAFKA_REQUEST"
+	CodeValidationFailed     = "VALIDATION_FAILED"
+	CodeNoActiveSession      = "NO_ACTIVE_SESSION"
+	CodeClusterNotConfigured = "CLUSTER_NOT_CONFIGURED"
+	CodeReadOnly             = "READ_ONLY"
+)
+
+// StatusClientClosedRequest is reported when the caller cancelled the operation, e.g. by
+// interrupting the CLI or disconnecting from the REST API
+const StatusClientClosedRequest = 499
+
+// CodeForStatus is the generic error code used for an HTTP status when nothing more
+// specific is known
+func CodeForStatus(httpCode int) string {
+	switch httpCode {
+	case http.StatusBadRequest:
+		return CodeBadRequest
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusMethodNotAllowed:
+		return CodeMethodNotAllowed
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusRequestEntityTooLarge:
+		return CodePayloadTooLarge
+	case http.StatusNotImplemented:
+		return CodeNotImplemented
+	case http.StatusServiceUnavailable:
+		return CodeUnavailable
+	case http.StatusGatewayTimeout:
+		return CodeTimeout
+	case StatusClientClosedRequest:
+		return CodeCancelled
+	default:
+		return CodeInternal
+	}
+}
+
+// ClassifyError maps Kafka and context errors to an HTTP status and error code
+func ClassifyError(err error) (httpCode int, code string) {
+	switch {
+	case err == nil:
+		return http.StatusOK, ""
+	case errors.Is(err, sarama.ErrTopicAlreadyExists):
+		return http.StatusConflict, CodeTopicAlreadyExists
+	case errors.Is(err, sarama.ErrUnknownTopicOrPartition):
+		return http.StatusNotFound, CodeTopicNotFound
+	case errors.Is(err, sarama.ErrTopicAuthorizationFailed),
+		errors.Is(err, sarama.ErrClusterAuthorizationFailed),
+		errors.Is(err, sarama.ErrGroupAuthorizationFailed),
+		errors.Is(err, sarama.ErrTransactionalIDAuthorizationFailed),
+		errors.Is(err, sarama.ErrDelegationTokenAuthorizationFailed):
+		return http.StatusForbidden, CodeKafkaAuthorization
+	case errors.Is(err, sarama.ErrSASLAuthenticationFailed),
+		errors.Is(err, sarama.ErrIllegalSASLState),
+		errors.Is(err, sarama.ErrUnsupportedSASLMechanism):
+		return http.StatusUnauthorized, CodeKafkaAuthentication
+	case errors.Is(err, sarama.ErrInvalidPartitions),
+		errors.Is(err, sarama.ErrInvalidReplicationFactor),
+		errors.Is(err, sarama.ErrInvalidReplicaAssignment),
+		errors.Is(err, sarama.ErrInvalidTopic),
+		errors.Is(err, sarama.ErrInvalidConfig),
+		errors.Is(err, sarama.ErrInvalidRequest),
+		errors.Is(err, sarama.ErrPolicyViolation):
+		return http.StatusBadRequest, CodeInvalidKafkaRequest
+	case errors.Is(err, sarama.ErrRequestTimedOut),
+		errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout, CodeTimeout
+	case errors.Is(err, context.Canceled):
+		return StatusClientClosedRequest, CodeCancelled
+	case errors.Is(err, sarama.ErrOutOfBrokers),
+		errors.Is(err, sarama.ErrBrokerNotAvailable),
+		errors.Is(err, sarama.ErrLeaderNotAvailable),
+		errors.Is(err, sarama.ErrNotController),
+		errors.Is(err, sarama.ErrClosedClient),
+		errors.Is(err, sarama.ErrNotConnected):
+		return http.StatusServiceUnavailable, CodeUnavailable
+	default:
+		return http.StatusInternalServerError, CodeInternal
+	}
+}
+
+// NewKafkaFailure wraps an error returned by Kafka, deriving the status and code from it
+func NewKafkaFailure(message string, err error) *Failure {
+	httpCode, code := ClassifyError(err)
+	return &Failure{
+		Err:      fmt.Errorf("%s: %w", message, err),
+		HttpCode: httpCode,
+		Code:     code,
+	}
+}
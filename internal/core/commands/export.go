@@ -0,0 +1,221 @@
+package commands
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/IBM/openkommander/pkg/cluster"
+	"github.com/IBM/sarama"
+)
+
+// SnapshotVersion is the version of the snapshot format written by ExportCluster
+const SnapshotVersion = 1
+
+// ClusterSnapshot is the state of a cluster at one point in time. Its topics use the
+// format of ok apply, so a snapshot can re-create them on another cluster.
+type ClusterSnapshot struct {
+	Version        int            `json:"version"`
+	Cluster        string         `json:"cluster"`
+	Brokers        []string       `json:"brokers"`
+	TakenAt        time.Time      `json:"taken_at"`
+	Topics         []TopicSpec    `json:"topics"`
+	ACLs           []ACLEntry     `json:"acls,omitempty"`
+	ConsumerGroups []GroupOffsets `json:"consumer_groups,omitempty"`
+	Warnings       []string       `json:"warnings,omitempty"`
+}
+
+// ACLEntry is one access control entry, with the names Kafka's tools use for its enums
+type ACLEntry struct {
+	ResourceType string `json:"resource_type"`
+	ResourceName string `json:"resource_name"`
+	PatternType  string `json:"pattern_type"`
+	Principal    string `json:"principal"`
+	Host         string `json:"host"`
+	Operation    string `json:"operation"`
+	Permission   string `json:"permission"`
+}
+
+// GroupOffsets are the committed offsets of a consumer group
+type GroupOffsets struct {
+	Group   string            `json:"group"`
+	Offsets []PartitionOffset `json:"offsets"`
+}
+
+// PartitionOffset is an offset in one partition of a topic
+type PartitionOffset struct {
+	Topic     string `json:"topic"`
+	Partition int32  `json:"partition"`
+	Offset    int64  `json:"offset"`
+}
+
+// ExportOptions select what ExportCluster captures
+type ExportOptions struct {
+	// Topics selects the topics to export; every non-internal topic when the pattern is empty
+	Topics     TopicSelector
+	SkipACLs   bool
+	SkipGroups bool
+}
+
+// ExportCluster captures the topics with their partition counts, replication factors and
+// non-default configs, the ACLs and the committed consumer group offsets. ACLs and groups
+// that cannot be read, for example because the cluster has no authorizer, are reported as
+// warnings rather than failing the export.
+func ExportCluster(ctx context.Context, h *cluster.Handle, options ExportOptions) (*ClusterSnapshot, *Failure) {
+	if options.Topics.Pattern == "" {
+		options.Topics.Pattern = "*"
+	}
+	topics, failure := SelectTopics(ctx, h, options.Topics)
+	if failure != nil {
+		return nil, failure
+	}
+
+	snapshot := &ClusterSnapshot{
+		Version: SnapshotVersion,
+		Cluster: h.Name,
+		Brokers: h.Brokers,
+		TakenAt: time.Now().UTC().Truncate(time.Second),
+		Topics:  make([]TopicSpec, 0, len(topics)),
+	}
+	exported := map[string]bool{}
+	for _, topic := range topics {
+		entries, failure := DescribeTopicConfig(ctx, h, topic.Name)
+		if failure != nil {
+			return nil, failure
+		}
+		spec := TopicSpec{Name: topic.Name, Partitions: topic.Partitions, ReplicationFactor: topic.ReplicationFactor}
+		if overrides := TopicConfigOverrides(entries); len(overrides) > 0 {
+			spec.Configs = overrides
+		}
+		snapshot.Topics = append(snapshot.Topics, spec)
+		exported[topic.Name] = true
+	}
+
+	if !options.SkipACLs {
+		acls, err := listACLs(ctx, h)
+		switch {
+		case errors.Is(err, sarama.ErrSecurityDisabled):
+			snapshot.Warnings = append(snapshot.Warnings, "ACLs not exported: the cluster has no authorizer")
+		case err != nil:
+			if failure := contextFailure(ctx); failure != nil {
+				return nil, failure
+			}
+			snapshot.Warnings = append(snapshot.Warnings, fmt.Sprintf("ACLs not exported: %v", err))
+		default:
+			snapshot.ACLs = acls
+		}
+	}
+
+	if !options.SkipGroups {
+		groups, warnings, failure := groupOffsets(ctx, h, exported)
+		if failure != nil {
+			return nil, failure
+		}
+		snapshot.ConsumerGroups = groups
+		snapshot.Warnings = append(snapshot.Warnings, warnings...)
+	}
+	return snapshot, nil
+}
+
+func listACLs(ctx context.Context, h *cluster.Handle) ([]ACLEntry, error) {
+	resources, err := cluster.Await(ctx, func() ([]sarama.ResourceAcls, error) {
+		return h.Admin.ListAcls(sarama.AclFilter{
+			ResourceType:              sarama.AclResourceAny,
+			ResourcePatternTypeFilter: sarama.AclPatternAny,
+			Operation:                 sarama.AclOperationAny,
+			PermissionType:            sarama.AclPermissionAny,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []ACLEntry{}
+	for _, resource := range resources {
+		for _, acl := range resource.Acls {
+			entries = append(entries, ACLEntry{
+				ResourceType: resource.ResourceType.String(),
+				ResourceName: resource.ResourceName,
+				PatternType:  resource.ResourcePatternType.String(),
+				Principal:    acl.Principal,
+				Host:         acl.Host,
+				Operation:    acl.Operation.String(),
+				Permission:   acl.PermissionType.String(),
+			})
+		}
+	}
+	slices.SortFunc(entries, compareACLEntries)
+	return entries, nil
+}
+
+// compareACLEntries orders ACL entries by every field, so that exports of the same ACLs
+// are identical
+func compareACLEntries(a, b ACLEntry) int {
+	return cmp.Or(
+		cmp.Compare(a.ResourceType, b.ResourceType),
+		cmp.Compare(a.ResourceName, b.ResourceName),
+		cmp.Compare(a.PatternType, b.PatternType),
+		cmp.Compare(a.Principal, b.Principal),
+		cmp.Compare(a.Host, b.Host),
+		cmp.Compare(a.Operation, b.Operation),
+		cmp.Compare(a.Permission, b.Permission),
+	)
+}
+
+// groupOffsets returns the committed offsets of every consumer group in the exported
+// topics, sorted by group, topic and partition. Groups whose offsets cannot be read are
+// reported as warnings.
+func groupOffsets(ctx context.Context, h *cluster.Handle, topics map[string]bool) ([]GroupOffsets, []string, *Failure) {
+	groups, err := cluster.Await(ctx, h.Admin.ListConsumerGroups)
+	if err != nil {
+		return nil, nil, NewKafkaFailure("Error listing consumer groups", err)
+	}
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var result []GroupOffsets
+	var warnings []string
+	for _, group := range names {
+		response, err := cluster.Await(ctx, func() (*sarama.OffsetFetchResponse, error) {
+			return h.Admin.ListConsumerGroupOffsets(group, nil)
+		})
+		if err != nil {
+			if failure := contextFailure(ctx); failure != nil {
+				return nil, nil, failure
+			}
+			warnings = append(warnings, fmt.Sprintf("offsets of group '%s' not exported: %v", group, err))
+			continue
+		}
+
+		offsets := []PartitionOffset{}
+		for topic, blocks := range response.Blocks {
+			if !topics[topic] {
+				continue
+			}
+			for partition, block := range blocks {
+				if block == nil || block.Err != sarama.ErrNoError || block.Offset < 0 {
+					continue
+				}
+				offsets = append(offsets, PartitionOffset{Topic: topic, Partition: partition, Offset: block.Offset})
+			}
+		}
+		if len(offsets) == 0 {
+			continue
+		}
+		sort.Slice(offsets, func(i, j int) bool {
+			if offsets[i].Topic != offsets[j].Topic {
+				return offsets[i].Topic < offsets[j].Topic
+			}
+			return offsets[i].Partition < offsets[j].Partition
+		})
+		result = append(result, GroupOffsets{Group: group, Offsets: offsets})
+	}
+	return result, warnings, nil
+}
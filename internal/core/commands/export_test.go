@@ -0,0 +1,93 @@
+package commands
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/IBM/openkommander/pkg/cluster"
+	"github.com/IBM/sarama"
+)
+
+// openMockCluster returns a handle on a mock broker answering with the given handlers in
+// addition to metadata listing the topics
+func openMockCluster(t *testing.T, broker *sarama.MockBroker, handlers map[string]sarama.MockResponse, topics ...string) *cluster.Handle {
+	t.Helper()
+
+	t.Cleanup(broker.Close)
+	metadata := sarama.NewMockMetadataResponse(t).
+		SetBroker(broker.Addr(), broker.BrokerID()).
+		SetController(broker.BrokerID())
+	for _, topic := range topics {
+		metadata.SetLeader(topic, 0, broker.BrokerID())
+	}
+	all := map[string]sarama.MockResponse{
+		"ApiVersionsRequest": sarama.NewMockApiVersionsResponse(t),
+		"MetadataRequest":    metadata,
+	}
+	for name, handler := range handlers {
+		all[name] = handler
+	}
+	broker.SetHandlerByMap(all)
+
+	h, err := cluster.NewCluster([]string{broker.Addr()}, sarama.V2_1_0_0).Open(context.Background(), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = h.Close() })
+	return h
+}
+
+func TestExportCluster(t *testing.T) {
+	broker := sarama.NewMockBroker(t, 1)
+	h := openMockCluster(t, broker, map[string]sarama.MockResponse{
+		"DescribeConfigsRequest": sarama.NewMockDescribeConfigsResponse(t),
+		"DescribeAclsRequest":    sarama.NewMockListAclsResponse(t),
+		"ListGroupsRequest":      sarama.NewMockListGroupsResponse(t).AddGroup("billing", "consumer"),
+		"FindCoordinatorRequest": sarama.NewMockFindCoordinatorResponse(t).SetCoordinator(sarama.CoordinatorGroup, "billing", broker),
+		"OffsetFetchRequest": sarama.NewMockOffsetFetchResponse(t).
+			SetOffset("billing", "orders", 0, 42, "", sarama.ErrNoError).
+			SetOffset("billing", "__consumer_offsets", 0, 7, "", sarama.ErrNoError),
+	}, "orders", "__consumer_offsets")
+
+	snapshot, failure := ExportCluster(context.Background(), h, ExportOptions{})
+	if failure != nil {
+		t.Fatal(failure.Err)
+	}
+
+	if len(snapshot.Topics) != 1 || snapshot.Topics[0].Name != "orders" {
+		t.Fatalf("topics = %+v, want orders only", snapshot.Topics)
+	}
+	// The mock reports retention.ms as set on the topic, max.message.bytes as a default
+	// and password as sensitive
+	if configs := snapshot.Topics[0].Configs; len(configs) != 1 || configs["retention.ms"] != "5000" {
+		t.Errorf("configs = %v, want retention.ms only", configs)
+	}
+	if len(snapshot.ACLs) != 1 || snapshot.ACLs[0].Principal != "User:test" {
+		t.Errorf("ACLs = %+v", snapshot.ACLs)
+	}
+	want := []GroupOffsets{{Group: "billing", Offsets: []PartitionOffset{{Topic: "orders", Partition: 0, Offset: 42}}}}
+	if len(snapshot.ConsumerGroups) != 1 || len(snapshot.ConsumerGroups[0].Offsets) != 1 || snapshot.ConsumerGroups[0].Offsets[0] != want[0].Offsets[0] {
+		t.Errorf("consumer groups = %+v, want %+v", snapshot.ConsumerGroups, want)
+	}
+}
+
+func TestCompareACLEntries(t *testing.T) {
+	// Entries that differ only in pattern type, host or permission still have one order
+	want := []ACLEntry{
+		{ResourceType: "Topic", ResourceName: "orders", PatternType: "Literal", Principal: "User:app", Host: "*", Operation: "Read", Permission: "Allow"},
+		{ResourceType: "Topic", ResourceName: "orders", PatternType: "Literal", Principal: "User:app", Host: "*", Operation: "Read", Permission: "Deny"},
+		{ResourceType: "Topic", ResourceName: "orders", PatternType: "Literal", Principal: "User:app", Host: "10.0.0.1", Operation: "Read", Permission: "Allow"},
+		{ResourceType: "Topic", ResourceName: "orders", PatternType: "Prefixed", Principal: "User:app", Host: "*", Operation: "Read", Permission: "Allow"},
+	}
+	for _, order := range [][]int{{3, 2, 1, 0}, {1, 3, 0, 2}, {2, 0, 3, 1}} {
+		entries := make([]ACLEntry, 0, len(want))
+		for _, i := range order {
+			entries = append(entries, want[i])
+		}
+		slices.SortFunc(entries, compareACLEntries)
+		if !slices.Equal(entries, want) {
+			t.Errorf("sorted %v to %+v", order, entries)
+		}
+	}
+}
@@ -0,0 +1,324 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/IBM/openkommander/pkg/cluster"
+	"github.com/IBM/sarama"
+)
+
+// DefaultMaxLeaderSkew is the leader skew, in percent, above which a broker is reported
+const DefaultMaxLeaderSkew = 50.0
+
+// PartitionIssue identifies a partition reported by a health check
+type PartitionIssue struct {
+	Topic     string  `json:"topic"`
+	Partition int32   `json:"partition"`
+	Leader    int32   `json:"leader"`
+	Replicas  []int32 `json:"replicas"`
+	Isr       []int32 `json:"isr"`
+	MinIsr    int     `json:"min_isr,omitempty"`
+}
+
+// BrokerHealth is the health of a single broker
+type BrokerHealth struct {
+	ID         int32   `json:"id"`
+	Address    string  `json:"address"`
+	Reachable  bool    `json:"reachable"`
+	Controller bool    `json:"controller"`
+	Leaders    int     `json:"leaders"`
+	Replicas   int     `json:"replicas"`
+	LeaderSkew float64 `json:"leader_skew_percent"`
+}
+
+// HealthReport is an assessment of a cluster's brokers and partitions
+type HealthReport struct {
+	Healthy                   bool             `json:"healthy"`
+	Problems                  []string         `json:"problems"`
+	ControllerID              int32            `json:"controller_id"`
+	ControllerAddress         string           `json:"controller_address"`
+	Brokers                   []BrokerHealth   `json:"brokers"`
+	UnreachableBrokers        []int32          `json:"unreachable_brokers"`
+	TopicCount                int              `json:"topic_count"`
+	PartitionCount            int              `json:"partition_count"`
+	OfflinePartitions         []PartitionIssue `json:"offline_partitions"`
+	LeaderlessPartitions      []PartitionIssue `json:"leaderless_partitions"`
+	UnderReplicatedPartitions []PartitionIssue `json:"under_replicated_partitions"`
+	UnderMinIsrPartitions     []PartitionIssue `json:"under_min_isr_partitions"`
+}
+
+// BuildHealthReport assesses the cluster reached through the handle.
+//
+//   - unreachable brokers cannot be connected to, or host replicas but are missing from the
+//     metadata because they are down
+//   - leaderless partitions have no elected leader
+//   - offline partitions have no replica on a live broker, so no leader can be elected
+//   - under-replicated partitions have fewer in-sync replicas than replicas
+//   - under-min-ISR partitions have fewer in-sync replicas than the topic's min.insync.replicas,
+//     so producers using acks=all are rejected
+//   - leader skew is how far a broker's leader count is from the cluster average, in percent
+func BuildHealthReport(ctx context.Context, h *cluster.Handle, maxLeaderSkew float64) (*HealthReport, *Failure) {
+	if failure := contextFailure(ctx); failure != nil {
+		return nil, failure
+	}
+	client, admin := h.Client, h.Admin
+
+	if err := cluster.Run(ctx, func() error { return client.RefreshMetadata() }); err != nil {
+		return nil, NewKafkaFailure("Error refreshing cluster metadata", err)
+	}
+
+	report := &HealthReport{
+		Problems:                  []string{},
+		ControllerID:              -1,
+		Brokers:                   []BrokerHealth{},
+		UnreachableBrokers:        []int32{},
+		OfflinePartitions:         []PartitionIssue{},
+		LeaderlessPartitions:      []PartitionIssue{},
+		UnderReplicatedPartitions: []PartitionIssue{},
+		UnderMinIsrPartitions:     []PartitionIssue{},
+	}
+
+	if controller, err := client.Controller(); err == nil {
+		report.ControllerID = controller.ID()
+		report.ControllerAddress = controller.Addr()
+	} else {
+		report.Problems = append(report.Problems, fmt.Sprintf("No active controller: %v", err))
+	}
+
+	brokers := client.Brokers()
+	sort.Slice(brokers, func(i, j int) bool { return brokers[i].ID() < brokers[j].ID() })
+
+	liveBrokers := make(map[int32]bool, len(brokers))
+	brokerIndex := make(map[int32]int, len(brokers))
+	reachability := probeBrokers(ctx, brokers, client.Config())
+	if failure := contextFailure(ctx); failure != nil {
+		return nil, failure
+	}
+	for i, broker := range brokers {
+		reachable := reachability[i]
+		liveBrokers[broker.ID()] = reachable
+		brokerIndex[broker.ID()] = len(report.Brokers)
+		report.Brokers = append(report.Brokers, BrokerHealth{
+			ID:         broker.ID(),
+			Address:    broker.Addr(),
+			Reachable:  reachable,
+			Controller: broker.ID() == report.ControllerID,
+		})
+		if !reachable {
+			report.UnreachableBrokers = append(report.UnreachableBrokers, broker.ID())
+		}
+	}
+
+	topicNames, err := client.Topics()
+	if err != nil {
+		return nil, NewKafkaFailure("Error listing topics", err)
+	}
+	sort.Strings(topicNames)
+	report.TopicCount = len(topicNames)
+
+	topics := []*sarama.TopicMetadata{}
+	if len(topicNames) > 0 {
+		topics, err = cluster.Await(ctx, func() ([]*sarama.TopicMetadata, error) {
+			return admin.DescribeTopics(topicNames)
+		})
+		if err != nil {
+			return nil, NewKafkaFailure("Error describing topics", err)
+		}
+	}
+
+	minIsrs, minIsrErrors, err := topicMinIsrs(ctx, client, topicNames)
+	if failure := contextFailure(ctx); failure != nil {
+		return nil, failure
+	}
+	if err != nil {
+		report.Problems = append(report.Problems, fmt.Sprintf("Could not read min.insync.replicas, so under-min-ISR partitions are not checked: %v", err))
+	}
+	for _, topic := range topicNames {
+		if err := minIsrErrors[topic]; err != nil {
+			report.Problems = append(report.Problems, fmt.Sprintf("Could not read min.insync.replicas of topic '%s', so its partitions are not checked for it: %v", topic, err))
+		}
+	}
+
+	// Replicas on brokers missing from the metadata are on brokers that are down
+	missingBrokers := map[int32]bool{}
+	for _, topic := range topics {
+		minIsr, minIsrKnown := minIsrs[topic.Name]
+
+		for _, partition := range topic.Partitions {
+			report.PartitionCount++
+			issue := PartitionIssue{
+				Topic:     topic.Name,
+				Partition: partition.ID,
+				Leader:    partition.Leader,
+				Replicas:  partition.Replicas,
+				Isr:       partition.Isr,
+			}
+
+			liveReplicas := 0
+			for _, replica := range partition.Replicas {
+				if i, ok := brokerIndex[replica]; ok {
+					report.Brokers[i].Replicas++
+				}
+				if liveBrokers[replica] {
+					liveReplicas++
+				} else if _, known := brokerIndex[replica]; !known {
+					missingBrokers[replica] = true
+				}
+			}
+
+			if partition.Leader < 0 {
+				report.LeaderlessPartitions = append(report.LeaderlessPartitions, issue)
+			} else if i, ok := brokerIndex[partition.Leader]; ok {
+				report.Brokers[i].Leaders++
+			}
+
+			if liveReplicas == 0 {
+				report.OfflinePartitions = append(report.OfflinePartitions, issue)
+			}
+
+			if len(partition.Isr) < len(partition.Replicas) {
+				report.UnderReplicatedPartitions = append(report.UnderReplicatedPartitions, issue)
+			}
+
+			if minIsrKnown && len(partition.Isr) < minIsr {
+				issue.MinIsr = minIsr
+				report.UnderMinIsrPartitions = append(report.UnderMinIsrPartitions, issue)
+			}
+		}
+	}
+
+	for id := range missingBrokers {
+		report.UnreachableBrokers = append(report.UnreachableBrokers, id)
+	}
+	sort.Slice(report.UnreachableBrokers, func(i, j int) bool { return report.UnreachableBrokers[i] < report.UnreachableBrokers[j] })
+
+	if len(report.Brokers) > 0 {
+		average := float64(report.PartitionCount-len(report.LeaderlessPartitions)) / float64(len(report.Brokers))
+		for i := range report.Brokers {
+			if average > 0 {
+				report.Brokers[i].LeaderSkew = math.Round((float64(report.Brokers[i].Leaders)-average)/average*1000) / 10
+			}
+			// With fewer partitions than brokers an even spread is impossible, so skew is not a problem
+			if report.PartitionCount >= len(report.Brokers) && math.Abs(report.Brokers[i].LeaderSkew) > maxLeaderSkew {
+				report.Problems = append(report.Problems, fmt.Sprintf("Broker %d leads %d partitions (%+.1f%% from average)",
+					report.Brokers[i].ID, report.Brokers[i].Leaders, report.Brokers[i].LeaderSkew))
+			}
+		}
+	}
+
+	addCountProblem(&report.Problems, len(report.UnreachableBrokers), "unreachable broker(s)")
+	addCountProblem(&report.Problems, len(report.OfflinePartitions), "offline partition(s)")
+	addCountProblem(&report.Problems, len(report.LeaderlessPartitions), "leaderless partition(s)")
+	addCountProblem(&report.Problems, len(report.UnderReplicatedPartitions), "under-replicated partition(s)")
+	addCountProblem(&report.Problems, len(report.UnderMinIsrPartitions), "under-min-ISR partition(s)")
+
+	report.Healthy = len(report.Problems) == 0
+	return report, nil
+}
+
+func addCountProblem(problems *[]string, count int, description string) {
+	if count > 0 {
+		*problems = append(*problems, fmt.Sprintf("%d %s", count, description))
+	}
+}
+
+// probeBrokers dials the brokers that are not connected, all at once, and returns
+// whether each one is reachable. A broker still dialling when ctx is done is reported
+// unreachable.
+func probeBrokers(ctx context.Context, brokers []*sarama.Broker, config *sarama.Config) []bool {
+	reachable := make([]bool, len(brokers))
+	var wg sync.WaitGroup
+	for i, broker := range brokers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			reachable[i] = isBrokerReachable(ctx, broker, config)
+		}()
+	}
+	wg.Wait()
+	return reachable
+}
+
+// isBrokerReachable dials the broker if needed and waits for the result, or for ctx
+func isBrokerReachable(ctx context.Context, broker *sarama.Broker, config *sarama.Config) bool {
+	err := cluster.Run(ctx, func() error {
+		if err := broker.Open(config); err != nil && !errors.Is(err, sarama.ErrAlreadyConnected) {
+			return err
+		}
+		connected, err := broker.Connected()
+		if err == nil && !connected {
+			err = sarama.ErrNotConnected
+		}
+		return err
+	})
+	return err == nil
+}
+
+// topicMinIsrs reads the min.insync.replicas of every topic in one DescribeConfigs request.
+// Topics whose configs the broker could not describe are returned with their error; err is
+// set when the request itself failed.
+func topicMinIsrs(ctx context.Context, client sarama.Client, topics []string) (minIsrs map[string]int, topicErrors map[string]error, err error) {
+	minIsrs, topicErrors = map[string]int{}, map[string]error{}
+	if len(topics) == 0 {
+		return minIsrs, topicErrors, nil
+	}
+
+	request := &sarama.DescribeConfigsRequest{}
+	for _, topic := range topics {
+		request.Resources = append(request.Resources, &sarama.ConfigResource{
+			Type:        sarama.TopicResource,
+			Name:        topic,
+			ConfigNames: []string{"min.insync.replicas"},
+		})
+	}
+	// The versions the cluster admin uses for DescribeConfig
+	if version := client.Config().Version; version.IsAtLeast(sarama.V2_0_0_0) {
+		request.Version = 2
+	} else if version.IsAtLeast(sarama.V1_1_0_0) {
+		request.Version = 1
+	}
+
+	response, err := cluster.Await(ctx, func() (*sarama.DescribeConfigsResponse, error) {
+		broker := client.LeastLoadedBroker()
+		if broker == nil {
+			return nil, sarama.ErrBrokerNotAvailable
+		}
+		return broker.DescribeConfigs(request)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, resource := range response.Resources {
+		if resource.ErrorCode != 0 {
+			topicErrors[resource.Name] = &sarama.DescribeConfigError{Err: sarama.KError(resource.ErrorCode), ErrMsg: resource.ErrorMsg}
+			continue
+		}
+		// Kafka's default applies when the broker does not report the config
+		minIsrs[resource.Name] = 1
+		for _, config := range resource.Configs {
+			if config.Name != "min.insync.replicas" {
+				continue
+			}
+			value, err := strconv.Atoi(config.Value)
+			if err != nil {
+				delete(minIsrs, resource.Name)
+				topicErrors[resource.Name] = fmt.Errorf("invalid value '%s'", config.Value)
+				continue
+			}
+			minIsrs[resource.Name] = value
+		}
+	}
+	for _, topic := range topics {
+		if _, ok := minIsrs[topic]; !ok && topicErrors[topic] == nil {
+			topicErrors[topic] = errors.New("not in the DescribeConfigs response")
+		}
+	}
+	return minIsrs, topicErrors, nil
+}
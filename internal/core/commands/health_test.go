@@ -0,0 +1,92 @@
+package commands
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/IBM/openkommander/pkg/cluster"
+	"github.com/IBM/sarama"
+)
+
+func TestBuildHealthReport(t *testing.T) {
+	broker := sarama.NewMockBroker(t, 1)
+	t.Cleanup(broker.Close)
+
+	// Partition 0 has a replica on broker 2, which is down and missing from the metadata
+	metadata := &sarama.MetadataResponse{
+		Version:      sarama.NewMetadataRequest(sarama.V2_1_0_0, nil).Version,
+		ControllerID: broker.BrokerID(),
+	}
+	metadata.AddBroker(broker.Addr(), broker.BrokerID())
+	metadata.AddTopicPartition("orders", 0, broker.BrokerID(), []int32{1, 2}, []int32{1}, nil, sarama.ErrNoError)
+	metadata.AddTopicPartition("orders", 1, broker.BrokerID(), []int32{1}, []int32{1}, nil, sarama.ErrNoError)
+
+	handlers := map[string]sarama.MockResponse{
+		"ApiVersionsRequest":     sarama.NewMockApiVersionsResponse(t),
+		"MetadataRequest":        sarama.NewMockWrapper(metadata),
+		"DescribeConfigsRequest": sarama.NewMockDescribeConfigsResponse(t),
+	}
+	broker.SetHandlerByMap(handlers)
+	h, err := cluster.NewCluster([]string{broker.Addr()}, sarama.V2_1_0_0).Open(context.Background(), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = h.Close() })
+
+	report, failure := BuildHealthReport(context.Background(), h, DefaultMaxLeaderSkew)
+	if failure != nil {
+		t.Fatal(failure.Err)
+	}
+	if !slices.Equal(report.UnreachableBrokers, []int32{2}) {
+		t.Errorf("unreachable brokers = %v, want broker 2", report.UnreachableBrokers)
+	}
+	if len(report.UnderReplicatedPartitions) != 1 || len(report.UnderMinIsrPartitions) != 0 || report.Healthy {
+		t.Errorf("report = %+v, want one under-replicated partition and an unhealthy cluster", report)
+	}
+
+	// A failed min.insync.replicas lookup is reported instead of assuming 1
+	handlers["DescribeConfigsRequest"] = sarama.NewMockDescribeConfigsResponseWithErrorCode(t)
+	broker.SetHandlerByMap(handlers)
+	report, failure = BuildHealthReport(context.Background(), h, DefaultMaxLeaderSkew)
+	if failure != nil {
+		t.Fatal(failure.Err)
+	}
+	if !slices.ContainsFunc(report.Problems, func(problem string) bool {
+		return strings.Contains(problem, "min.insync.replicas of topic 'orders'")
+	}) {
+		t.Errorf("problems = %v, want the failed min.insync.replicas lookup", report.Problems)
+	}
+}
+
+func TestProbeBrokers(t *testing.T) {
+	mock := sarama.NewMockBroker(t, 1)
+	t.Cleanup(mock.Close)
+	mock.SetHandlerByMap(map[string]sarama.MockResponse{
+		"ApiVersionsRequest": sarama.NewMockApiVersionsResponse(t),
+	})
+
+	config := sarama.NewConfig()
+	config.Net.DialTimeout = time.Second
+	brokers := []*sarama.Broker{sarama.NewBroker(mock.Addr()), sarama.NewBroker("127.0.0.1:1")}
+	t.Cleanup(func() {
+		for _, broker := range brokers {
+			_ = broker.Close()
+		}
+	})
+
+	if reachable := probeBrokers(context.Background(), brokers, config); !slices.Equal(reachable, []bool{true, false}) {
+		t.Errorf("reachable = %v, want [true false]", reachable)
+	}
+	// Already connected brokers are still reachable, and a done context reports none
+	if reachable := probeBrokers(context.Background(), brokers[:1], config); !reachable[0] {
+		t.Error("a connected broker was reported unreachable")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if reachable := probeBrokers(ctx, brokers[:1], config); reachable[0] {
+		t.Error("a broker was probed after the context was done")
+	}
+}
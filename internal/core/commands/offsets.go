@@ -0,0 +1,73 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/IBM/openkommander/pkg/cluster"
+	"github.com/IBM/sarama"
+)
+
+// PartitionOffsets are the offsets a partition currently holds. Count is the difference
+// between them, which overstates the records of compacted or transactional topics.
+type PartitionOffsets struct {
+	Partition int32 `json:"partition"`
+	Earliest  int64 `json:"earliest"`
+	Latest    int64 `json:"latest"`
+	Count     int64 `json:"count"`
+	// At is the first offset whose record is not older than the requested time, or Latest
+	// when there is none. It is only set when a time was requested.
+	At *int64 `json:"at,omitempty"`
+}
+
+// TopicOffsets returns the earliest and latest offset of every partition of a topic, and
+// when at is not zero the offset of the first record written at or after that time
+func TopicOffsets(ctx context.Context, h *cluster.Handle, topicName string, at time.Time) ([]PartitionOffsets, *Failure) {
+	if failure := contextFailure(ctx); failure != nil {
+		return nil, failure
+	}
+
+	partitions, failure := topicPartitions(ctx, h, topicName)
+	if failure != nil {
+		return nil, failure
+	}
+
+	offsets := make([]PartitionOffsets, 0, len(partitions))
+	for _, partition := range partitions {
+		offset := func(at int64) (int64, *Failure) {
+			return partitionOffset(ctx, h, topicName, partition, at)
+		}
+		earliest, failure := offset(sarama.OffsetOldest)
+		if failure != nil {
+			return nil, failure
+		}
+		latest, failure := offset(sarama.OffsetNewest)
+		if failure != nil {
+			return nil, failure
+		}
+
+		entry := PartitionOffsets{Partition: partition, Earliest: earliest, Latest: latest, Count: latest - earliest}
+		if !at.IsZero() {
+			value, failure := offsetAtTime(offset, at, latest)
+			if failure != nil {
+				return nil, failure
+			}
+			entry.At = &value
+		}
+		offsets = append(offsets, entry)
+	}
+	return offsets, nil
+}
+
+// partitionOffset asks the partition leader for an offset: sarama.OffsetOldest,
+// sarama.OffsetNewest, or the first offset at or after a time in milliseconds
+func partitionOffset(ctx context.Context, h *cluster.Handle, topicName string, partition int32, at int64) (int64, *Failure) {
+	value, err := cluster.Await(ctx, func() (int64, error) {
+		return h.Client.GetOffset(topicName, partition, at)
+	})
+	if err != nil {
+		return 0, NewKafkaFailure(fmt.Sprintf("Error reading offsets of partition %d", partition), err)
+	}
+	return value, nil
+}
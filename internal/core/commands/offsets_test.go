@@ -0,0 +1,43 @@
+package commands
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+func TestTopicOffsets(t *testing.T) {
+	before := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	after := before.Add(time.Hour)
+	broker := sarama.NewMockBroker(t, 1)
+	h := openMockCluster(t, broker, map[string]sarama.MockResponse{
+		"OffsetRequest": sarama.NewMockOffsetResponse(t).
+			SetOffset("orders", 0, sarama.OffsetOldest, 3).
+			SetOffset("orders", 0, sarama.OffsetNewest, 10).
+			SetOffset("orders", 0, before.UnixMilli(), 7).
+			SetOffset("orders", 0, after.UnixMilli(), -1),
+	}, "orders")
+
+	offsets, failure := TopicOffsets(context.Background(), h, "orders", time.Time{})
+	if failure != nil {
+		t.Fatal(failure.Err)
+	}
+	if len(offsets) != 1 || offsets[0] != (PartitionOffsets{Partition: 0, Earliest: 3, Latest: 10, Count: 7}) {
+		t.Errorf("offsets = %+v, want 3 to 10 in partition 0", offsets)
+	}
+
+	for _, test := range []struct {
+		at   time.Time
+		want int64
+	}{{before, 7}, {after, 10}} {
+		offsets, failure := TopicOffsets(context.Background(), h, "orders", test.at)
+		if failure != nil {
+			t.Fatal(failure.Err)
+		}
+		if len(offsets) != 1 || offsets[0].At == nil || *offsets[0].At != test.want {
+			t.Errorf("offsets at %s = %+v, want %d", test.at, offsets, test.want)
+		}
+	}
+}
@@ -1,22 +1,24 @@
 package commands
 
 import (
+	"context"
 	"fmt"
-	"net/http"
 
+	"github.com/IBM/openkommander/pkg/cluster"
 	"github.com/IBM/openkommander/pkg/logger"
-	"github.com/IBM/openkommander/pkg/session"
 	"github.com/IBM/sarama"
 )
 
-func ProduceMessage(topicName, key, msg string, partition, acks int) (successMessage string, f *Failure) {
-	// validate the session is open
-	_, validateFailure := GetClient()
-	if validateFailure != nil {
-		return "", validateFailure
+func ProduceMessage(ctx context.Context, h *cluster.Handle, topicName, key, msg string, partition, acks int) (successMessage string, f *Failure) {
+	if failure := contextFailure(ctx); failure != nil {
+		return "", failure
+	}
+	if failure := CheckWritable(ctx, h); failure != nil {
+		return "", failure
 	}
 
 	config := sarama.NewConfig()
+	config.Version = h.Client.Config().Version
 	config.Producer.RequiredAcks = sarama.RequiredAcks(acks)
 	config.Producer.Return.Successes = true
 
@@ -34,9 +36,11 @@ func ProduceMessage(topicName, key, msg string, partition, acks int) (successMes
 
 	message.Value = sarama.StringEncoder(msg)
 
-	producer, err := sarama.NewSyncProducer(session.GetCurrentSession().GetBrokers(), config)
+	producer, err := cluster.Await(ctx, func() (sarama.SyncProducer, error) {
+		return sarama.NewSyncProducer(h.Brokers, config)
+	})
 	if err != nil {
-		return "", NewFailure("Failed to open Kafka producer", http.StatusBadRequest)
+		return "", NewKafkaFailure("Failed to open Kafka producer", err)
 	}
 	defer func() {
 		if err := producer.Close(); err != nil {
@@ -44,9 +48,15 @@ func ProduceMessage(topicName, key, msg string, partition, acks int) (successMes
 		}
 	}()
 
-	part, offset, err := producer.SendMessage(message)
+	var part int32
+	var offset int64
+	err = cluster.Run(ctx, func() error {
+		var err error
+		part, offset, err = producer.SendMessage(message)
+		return err
+	})
 	if err != nil {
-		return "", NewFailure(fmt.Sprintf("Failed to produce message: %s", err), http.StatusBadRequest)
+		return "", NewKafkaFailure("Failed to produce message", err)
 	}
 
 	return fmt.Sprintf("successfully written to topic %s, partition %d with offset %d", topicName, part, offset), nil
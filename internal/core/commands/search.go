@@ -0,0 +1,319 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/IBM/openkommander/pkg/cluster"
+	"github.com/IBM/sarama"
+)
+
+// SearchFilter selects the records a search returns. Every condition that is set must hold.
+type SearchFilter struct {
+	// Key matches records whose key is exactly this
+	Key string `json:"key,omitempty"`
+	// Contains matches records whose value contains this
+	Contains string `json:"contains,omitempty"`
+	// Regex matches records whose value matches this regular expression
+	Regex string `json:"regex,omitempty"`
+	// JSONPath is a path such as $.customer.id or items[0].sku, optionally followed by
+	// =VALUE. It matches JSON values where the path exists, or has the value.
+	JSONPath string `json:"json_path,omitempty"`
+	// Header is NAME or NAME=VALUE and matches records with the header, or the header value
+	Header string `json:"header,omitempty"`
+}
+
+// SearchOptions control which records SearchTopic scans and how many matches it returns
+type SearchOptions struct {
+	OffsetRange
+	Filter SearchFilter
+	// Limit stops the search after this many matches, unlimited when zero
+	Limit int
+}
+
+// SearchSummary reports how much of the topic a search scanned
+type SearchSummary struct {
+	Scanned      int64 `json:"scanned"`
+	Matches      int   `json:"matches"`
+	LimitReached bool  `json:"limit_reached"`
+	// Skipped counts the offsets at the end of the partitions no message arrived for,
+	// such as compacted records or transaction markers
+	Skipped int64 `json:"skipped,omitempty"`
+}
+
+// SearchResult is the outcome of a search that collected its matches
+type SearchResult struct {
+	Records []*Record `json:"records"`
+	SearchSummary
+}
+
+// searchMatcher is a compiled SearchFilter
+type searchMatcher struct {
+	key         *string
+	contains    []byte
+	regex       *regexp.Regexp
+	jsonPath    []any
+	jsonValue   *string
+	headerName  string
+	headerValue *string
+}
+
+// compileSearchFilter checks a filter, returning a validation failure naming what is invalid
+func compileSearchFilter(filter SearchFilter) (*searchMatcher, *Failure) {
+	invalid := func(format string, args ...any) *Failure {
+		return NewFailure(fmt.Sprintf(format, args...), http.StatusBadRequest).WithCode(CodeValidationFailed)
+	}
+
+	matcher := &searchMatcher{}
+	if filter.Key != "" {
+		matcher.key = &filter.Key
+	}
+	if filter.Contains != "" {
+		matcher.contains = []byte(filter.Contains)
+	}
+	if filter.Regex != "" {
+		regex, err := regexp.Compile(filter.Regex)
+		if err != nil {
+			return nil, invalid("Invalid regular expression '%s': %v", filter.Regex, err)
+		}
+		matcher.regex = regex
+	}
+	if filter.JSONPath != "" {
+		path, value, hasValue := strings.Cut(filter.JSONPath, "=")
+		steps, err := parseJSONPath(path)
+		if err != nil {
+			return nil, invalid("Invalid JSON path '%s': %v", path, err)
+		}
+		matcher.jsonPath = steps
+		if hasValue {
+			matcher.jsonValue = &value
+		}
+	}
+	if filter.Header != "" {
+		name, value, hasValue := strings.Cut(filter.Header, "=")
+		if name == "" {
+			return nil, invalid("Invalid header filter '%s', want NAME or NAME=VALUE", filter.Header)
+		}
+		matcher.headerName = name
+		if hasValue {
+			matcher.headerValue = &value
+		}
+	}
+	return matcher, nil
+}
+
+// parseJSONPath splits a path such as $.items[0].sku into field names and array indexes
+func parseJSONPath(path string) ([]any, error) {
+	rest := strings.TrimPrefix(strings.TrimSpace(path), "$")
+	var steps []any
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, errors.New("missing ]")
+			}
+			index, err := strconv.Atoi(rest[1:end])
+			if err != nil || index < 0 {
+				return nil, fmt.Errorf("invalid array index '%s'", rest[1:end])
+			}
+			steps = append(steps, index)
+			rest = rest[end+1:]
+		default:
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			steps = append(steps, rest[:end])
+			rest = rest[end:]
+		}
+	}
+	if len(steps) == 0 {
+		return nil, errors.New("the path selects no field")
+	}
+	return steps, nil
+}
+
+func (m *searchMatcher) matches(message *sarama.ConsumerMessage) bool {
+	if m.key != nil && (message.Key == nil || string(message.Key) != *m.key) {
+		return false
+	}
+	if m.contains != nil && !bytes.Contains(message.Value, m.contains) {
+		return false
+	}
+	if m.regex != nil && !m.regex.Match(message.Value) {
+		return false
+	}
+	if m.jsonPath != nil && !m.matchesJSON(message.Value) {
+		return false
+	}
+	if m.headerName != "" && !m.matchesHeader(message.Headers) {
+		return false
+	}
+	return true
+}
+
+func (m *searchMatcher) matchesJSON(data []byte) bool {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return false
+	}
+	for _, step := range m.jsonPath {
+		switch step := step.(type) {
+		case string:
+			object, ok := value.(map[string]any)
+			if !ok {
+				return false
+			}
+			if value, ok = object[step]; !ok {
+				return false
+			}
+		case int:
+			array, ok := value.([]any)
+			if !ok || step >= len(array) {
+				return false
+			}
+			value = array[step]
+		}
+	}
+	if m.jsonValue == nil {
+		return true
+	}
+	if text, ok := value.(string); ok {
+		return text == *m.jsonValue
+	}
+	encoded, err := json.Marshal(value)
+	return err == nil && string(encoded) == *m.jsonValue
+}
+
+func (m *searchMatcher) matchesHeader(headers []*sarama.RecordHeader) bool {
+	for _, header := range headers {
+		if header != nil && string(header.Key) == m.headerName && (m.headerValue == nil || string(header.Value) == *m.headerValue) {
+			return true
+		}
+	}
+	return false
+}
+
+// SearchTopic scans the partitions of a topic in parallel and calls emit with every record
+// that matches the filter, as soon as it is found, until the limit is reached. emit is never
+// called concurrently; an error from it ends the search with that error.
+func SearchTopic(ctx context.Context, h *cluster.Handle, topicName string, options SearchOptions, emit func(*Record) error) (*SearchSummary, *Failure) {
+	if failure := contextFailure(ctx); failure != nil {
+		return nil, failure
+	}
+	if options.Limit < 0 {
+		return nil, NewFailure("The limit cannot be negative", http.StatusBadRequest).WithCode(CodeValidationFailed)
+	}
+	matcher, failure := compileSearchFilter(options.Filter)
+	if failure != nil {
+		return nil, failure
+	}
+
+	partitions, failure := topicPartitions(ctx, h, topicName)
+	if failure != nil {
+		return nil, failure
+	}
+	type partitionRange struct {
+		partition  int32
+		start, end int64
+	}
+	ranges := make([]partitionRange, 0, len(partitions))
+	for _, partition := range partitions {
+		start, end, failure := resolveRange(ctx, h, topicName, partition, options.OffsetRange)
+		if failure != nil {
+			return nil, failure
+		}
+		if start < end {
+			ranges = append(ranges, partitionRange{partition, start, end})
+		}
+	}
+
+	consumer, err := sarama.NewConsumerFromClient(h.Client)
+	if err != nil {
+		return nil, NewKafkaFailure("Failed to open Kafka consumer", err)
+	}
+	defer func() { _ = consumer.Close() }()
+
+	searchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	summary := &SearchSummary{}
+	var scanned, skipped atomic.Int64
+	idleTimeout := rangeIdleTimeout(h.Client.Config())
+	var mu sync.Mutex
+	var firstErr error
+	var emitErr bool
+	fail := func(err error, fromEmit bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		if firstErr == nil {
+			firstErr, emitErr = err, fromEmit
+			cancel()
+		}
+	}
+
+	var wg sync.WaitGroup
+	for _, r := range ranges {
+		wg.Add(1)
+		go func(r partitionRange) {
+			defer wg.Done()
+			reached, err := consumeRange(searchCtx, consumer, idleTimeout, topicName, r.partition, r.start, r.end, func(messages []*sarama.ConsumerMessage) error {
+				scanned.Add(int64(len(messages)))
+				for _, message := range messages {
+					if !matcher.matches(message) {
+						continue
+					}
+					mu.Lock()
+					if summary.LimitReached || firstErr != nil {
+						mu.Unlock()
+						return context.Canceled
+					}
+					summary.Matches++
+					err := emit(NewRecord(message))
+					if options.Limit > 0 && summary.Matches >= options.Limit {
+						summary.LimitReached = true
+						cancel()
+					}
+					mu.Unlock()
+					if err != nil {
+						fail(err, true)
+						return err
+					}
+				}
+				return nil
+			})
+			if err != nil && searchCtx.Err() == nil {
+				fail(fmt.Errorf("partition %d: %w", r.partition, err), false)
+			}
+			if err == nil {
+				skipped.Add(r.end - reached)
+			}
+		}(r)
+	}
+	wg.Wait()
+
+	summary.Scanned = scanned.Load()
+	summary.Skipped = skipped.Load()
+	switch {
+	case firstErr != nil && emitErr:
+		return summary, NewFailure(firstErr.Error(), http.StatusInternalServerError)
+	case firstErr != nil:
+		return summary, NewKafkaFailure("Error reading messages", firstErr)
+	case ctx.Err() != nil:
+		return summary, contextFailure(ctx)
+	}
+	return summary, nil
+}
@@ -0,0 +1,93 @@
+package commands
+
+import (
+	"context"
+	"testing"
+
+	"github.com/IBM/sarama"
+)
+
+func TestSearchFilter(t *testing.T) {
+	message := &sarama.ConsumerMessage{
+		Key:     []byte("order-42"),
+		Value:   []byte(`{"customer":{"id":"c-7","vip":true},"items":[{"sku":"A-1","qty":2}]}`),
+		Headers: []*sarama.RecordHeader{{Key: []byte("source"), Value: []byte("web")}},
+	}
+
+	tests := []struct {
+		filter SearchFilter
+		want   bool
+	}{
+		{SearchFilter{}, true},
+		{SearchFilter{Key: "order-42"}, true},
+		{SearchFilter{Key: "order-4"}, false},
+		{SearchFilter{Contains: `"sku":"A-1"`}, true},
+		{SearchFilter{Regex: `"qty":\d+`}, true},
+		{SearchFilter{Regex: `^order`}, false},
+		{SearchFilter{JSONPath: "$.customer.id=c-7"}, true},
+		{SearchFilter{JSONPath: "customer.vip=true"}, true},
+		{SearchFilter{JSONPath: "$.items[0].qty=2"}, true},
+		{SearchFilter{JSONPath: "$.items[1]"}, false},
+		{SearchFilter{JSONPath: "$.customer"}, true},
+		{SearchFilter{JSONPath: "$.customer.name"}, false},
+		{SearchFilter{Header: "source"}, true},
+		{SearchFilter{Header: "source=web"}, true},
+		{SearchFilter{Header: "source=app"}, false},
+		{SearchFilter{Key: "order-42", Header: "trace"}, false},
+	}
+	for _, test := range tests {
+		matcher, failure := compileSearchFilter(test.filter)
+		if failure != nil {
+			t.Fatalf("%+v: %v", test.filter, failure.Err)
+		}
+		if got := matcher.matches(message); got != test.want {
+			t.Errorf("%+v matches = %v, want %v", test.filter, got, test.want)
+		}
+	}
+
+	for _, invalid := range []SearchFilter{{Regex: "("}, {JSONPath: "$"}, {JSONPath: "items[x]"}, {Header: "=web"}} {
+		if _, failure := compileSearchFilter(invalid); failure == nil {
+			t.Errorf("%+v compiled, want an error", invalid)
+		}
+	}
+}
+
+func TestSearchTopic(t *testing.T) {
+	broker := sarama.NewMockBroker(t, 1)
+	h := openMockCluster(t, broker, map[string]sarama.MockResponse{
+		"OffsetRequest": sarama.NewMockOffsetResponse(t).
+			SetOffset("orders", 0, sarama.OffsetOldest, 0).
+			SetOffset("orders", 0, sarama.OffsetNewest, 4),
+		"FetchRequest": sarama.NewMockFetchResponse(t, 10).
+			SetMessage("orders", 0, 0, sarama.StringEncoder(`{"status":"paid"}`)).
+			SetMessage("orders", 0, 1, sarama.StringEncoder(`{"status":"open"}`)).
+			SetMessage("orders", 0, 2, sarama.StringEncoder(`{"status":"paid"}`)).
+			SetMessage("orders", 0, 3, sarama.StringEncoder(`{"status":"paid"}`)).
+			SetHighWaterMark("orders", 0, 4),
+	}, "orders")
+
+	options := SearchOptions{OffsetRange: OffsetRange{StartOffset: -1, EndOffset: -1}, Filter: SearchFilter{JSONPath: "status=paid"}}
+	var offsets []int64
+	emit := func(record *Record) error {
+		offsets = append(offsets, record.Offset)
+		return nil
+	}
+
+	summary, failure := SearchTopic(context.Background(), h, "orders", options, emit)
+	if failure != nil {
+		t.Fatal(failure.Err)
+	}
+	if summary.Matches != 3 || summary.Scanned != 4 || summary.LimitReached || len(offsets) != 3 || offsets[1] != 2 {
+		t.Errorf("summary = %+v, offsets = %v, want offsets 0, 2 and 3 of 4", summary, offsets)
+	}
+
+	offsets = nil
+	options.Limit = 1
+	summary, failure = SearchTopic(context.Background(), h, "orders", options, emit)
+	if failure != nil {
+		t.Fatal(failure.Err)
+	}
+	if summary.Matches != 1 || !summary.LimitReached || len(offsets) != 1 || offsets[0] != 0 {
+		t.Errorf("limited summary = %+v, offsets = %v, want offset 0 only", summary, offsets)
+	}
+}
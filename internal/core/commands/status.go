@@ -1,50 +1,85 @@
 package commands
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
 
+	"github.com/IBM/openkommander/pkg/cluster"
 	"github.com/IBM/openkommander/pkg/session"
-	"github.com/IBM/sarama"
 )
 
 type Failure struct {
 	Err      error
 	HttpCode int
+	Code     string
 }
 
 func NewFailure(err string, httpCode int) *Failure {
 	return &Failure{
 		Err:      errors.New(err),
 		HttpCode: httpCode,
+		Code:     CodeForStatus(httpCode),
 	}
 }
 
-func GetAdminClient() (sarama.ClusterAdmin, *Failure) {
-	currentSession := session.GetCurrentSession()
-	if !currentSession.IsAuthenticated() {
-		return nil, NewFailure("No active session found", http.StatusUnauthorized)
+// WithCode replaces the generic code derived from the HTTP status with a specific one
+func (f *Failure) WithCode(code string) *Failure {
+	f.Code = code
+	return f
+}
+
+// CurrentCluster returns a handle on the active cluster of a session. The session keeps
+// its connections open for reuse, so the handle must not be closed.
+func CurrentCluster(ctx context.Context, sessions *session.SessionManager) (*cluster.Handle, *Failure) {
+	if failure := contextFailure(ctx); failure != nil {
+		return nil, failure
+	}
+
+	if !sessions.IsAuthenticated() {
+		return nil, NewFailure("No active session found", http.StatusUnauthorized).WithCode(CodeNoActiveSession)
 	}
 
-	client, err := currentSession.GetAdminClient()
+	h, err := sessions.ActiveHandle(ctx)
 	if err != nil {
-		return nil, NewFailure(fmt.Sprintf("Error connecting to cluster: %v", err), http.StatusInternalServerError)
+		return nil, NewKafkaFailure("Error connecting to cluster", err)
 	}
+	return h, nil
+}
+
+// readOnlyKey marks a context in which commands must not change any cluster
+type readOnlyKey struct{}
 
-	return client, nil
+// WithReadOnly returns a context in which every command that changes a cluster fails, as
+// set by the global --read-only flag and the REST server's read-only mode
+func WithReadOnly(ctx context.Context) context.Context {
+	return context.WithValue(ctx, readOnlyKey{}, true)
 }
 
-func GetClient() (sarama.Client, *Failure) {
-	currentSession := session.GetCurrentSession()
-	if !currentSession.IsAuthenticated() {
-		return nil, NewFailure("No active session found", http.StatusUnauthorized)
-	}
+// IsReadOnly reports whether the context was marked by WithReadOnly
+func IsReadOnly(ctx context.Context) bool {
+	readOnly, _ := ctx.Value(readOnlyKey{}).(bool)
+	return readOnly
+}
 
-	client, err := currentSession.GetClient()
-	if err != nil {
-		return nil, NewFailure(fmt.Sprintf("Error connecting to cluster: %v", err), http.StatusInternalServerError)
+// CheckWritable refuses an operation that would change the cluster when read-only mode
+// is enabled or the cluster's profile is read-only. Every mutating command calls it before
+// contacting Kafka; front ends call it to fail before prompting for confirmation.
+func CheckWritable(ctx context.Context, h *cluster.Handle) *Failure {
+	switch {
+	case IsReadOnly(ctx):
+		return NewFailure("Operation refused: read-only mode is enabled", http.StatusForbidden).WithCode(CodeReadOnly)
+	case h.ReadOnly:
+		return NewFailure(fmt.Sprintf("Operation refused: cluster '%s' is read-only", h.Name), http.StatusForbidden).WithCode(CodeReadOnly)
 	}
+	return nil
+}
 
-	return client, nil
+// contextFailure reports a cancelled or expired context before work is sent to Kafka
+func contextFailure(ctx context.Context) *Failure {
+	if err := ctx.Err(); err != nil {
+		return NewKafkaFailure("Operation cancelled", err)
+	}
+	return nil
 }
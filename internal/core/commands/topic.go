@@ -1,44 +1,76 @@
 package commands
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
-	"strings"
+	"regexp"
 
+	"github.com/IBM/openkommander/pkg/cluster"
 	"github.com/IBM/sarama"
 )
 
-func CreateTopic(topicName string, numPartitions, replicationFactor int) (successMessage string, f *Failure) {
-	client, validateFailure := GetClient()
-	if validateFailure != nil {
-		return "", validateFailure
+// maxTopicNameLength is the longest topic name Kafka accepts
+const maxTopicNameLength = 249
+
+var topicNamePattern = regexp.MustCompile(`^[a-zA-Z0-9._-]+$`)
+
+// ValidateTopicName applies Kafka's topic naming rules so both front ends reject invalid
+// names before contacting the cluster
+func ValidateTopicName(topicName string) *Failure {
+	switch {
+	case topicName == "":
+		return NewFailure("Topic name cannot be empty", http.StatusBadRequest).WithCode(CodeValidationFailed)
+	case topicName == "." || topicName == "..":
+		return NewFailure(fmt.Sprintf("Topic name '%s' is not allowed", topicName), http.StatusBadRequest).WithCode(CodeValidationFailed)
+	case len(topicName) > maxTopicNameLength:
+		return NewFailure(fmt.Sprintf("Topic name cannot be longer than %d characters", maxTopicNameLength), http.StatusBadRequest).WithCode(CodeValidationFailed)
+	case !topicNamePattern.MatchString(topicName):
+		return NewFailure(fmt.Sprintf("Topic name '%s' may only contain letters, digits, '.', '_' and '-'", topicName), http.StatusBadRequest).WithCode(CodeValidationFailed)
+	}
+	return nil
+}
+
+func CreateTopic(ctx context.Context, h *cluster.Handle, topicName string, numPartitions, replicationFactor int) (successMessage string, f *Failure) {
+	return CreateTopicWithConfig(ctx, h, topicName, numPartitions, replicationFactor, nil)
+}
+
+// CreateTopicWithConfig creates a topic whose configs override the broker defaults
+func CreateTopicWithConfig(ctx context.Context, h *cluster.Handle, topicName string, numPartitions, replicationFactor int, configs map[string]string) (successMessage string, f *Failure) {
+	if failure := contextFailure(ctx); failure != nil {
+		return "", failure
+	}
+	if failure := CheckWritable(ctx, h); failure != nil {
+		return "", failure
 	}
 
-	adminClient, validateFailure := GetAdminClient()
-	if validateFailure != nil {
-		return "", validateFailure
+	if failure := ValidateTopicName(topicName); failure != nil {
+		return "", failure
 	}
 
 	if numPartitions < 1 || replicationFactor < 1 {
-		return "", NewFailure("Partitions and replication factor must be greater than 1", http.StatusBadRequest)
+		return "", NewFailure("Partitions and replication factor must be at least 1", http.StatusBadRequest).WithCode(CodeValidationFailed)
 	}
 
-	if replicationFactor > len(client.Brokers()) {
-		return "", NewFailure("Replication factor cannot be greater than the number of brokers", http.StatusBadRequest)
+	if replicationFactor > len(h.Client.Brokers()) {
+		return "", NewFailure("Replication factor cannot be greater than the number of brokers", http.StatusBadRequest).WithCode(CodeValidationFailed)
 	}
 
 	topicDetail := &sarama.TopicDetail{
 		NumPartitions:     int32(numPartitions),
 		ReplicationFactor: int16(replicationFactor),
+		ConfigEntries:     configEntries(configs),
 	}
 
-	err := adminClient.CreateTopic(topicName, topicDetail, false)
+	err := cluster.Run(ctx, func() error {
+		return h.Admin.CreateTopic(topicName, topicDetail, false)
+	})
 	if err != nil {
-		if strings.Contains(err.Error(), "Topic with this name already exists") {
-			return "", NewFailure(fmt.Sprintf("Topic '%s' already exists", topicName), http.StatusInternalServerError)
-		} else {
-			return "", NewFailure(fmt.Sprintf("Error creating topic: %v", topicName), http.StatusInternalServerError)
+		if errors.Is(err, sarama.ErrTopicAlreadyExists) {
+			return "", NewFailure(fmt.Sprintf("Topic '%s' already exists", topicName), http.StatusConflict).WithCode(CodeTopicAlreadyExists)
 		}
+		return "", NewKafkaFailure(fmt.Sprintf("Error creating topic '%s'", topicName), err)
 	}
 
 	return fmt.Sprintf("Successfully created topic '%s' with %d partitions and replication factor %d",
@@ -46,95 +78,154 @@ func CreateTopic(topicName string, numPartitions, replicationFactor int) (succes
 }
 
 // When successful, returns a success message
-func DeleteTopic(topicName string) (successMessage string, f *Failure) {
-	client, validateFailure := GetAdminClient()
-	if validateFailure != nil {
-		return "", validateFailure
+func DeleteTopic(ctx context.Context, h *cluster.Handle, topicName string) (successMessage string, f *Failure) {
+	if failure := contextFailure(ctx); failure != nil {
+		return "", failure
+	}
+	if failure := CheckWritable(ctx, h); failure != nil {
+		return "", failure
 	}
 
 	if topicName == "" {
-		return "", NewFailure("Topic name cannot be empty", http.StatusInternalServerError)
+		return "", NewFailure("Topic name cannot be empty", http.StatusBadRequest).WithCode(CodeValidationFailed)
 	}
 
-	err := client.DeleteTopic(topicName)
+	err := cluster.Run(ctx, func() error {
+		return h.Admin.DeleteTopic(topicName)
+	})
 	if err != nil {
-		return "", NewFailure(fmt.Sprintf("Error deleting topic: %v", err), http.StatusInternalServerError)
+		if errors.Is(err, sarama.ErrUnknownTopicOrPartition) {
+			return "", NewFailure(fmt.Sprintf("Topic '%s' not found", topicName), http.StatusNotFound).WithCode(CodeTopicNotFound)
+		}
+		return "", NewKafkaFailure(fmt.Sprintf("Error deleting topic '%s'", topicName), err)
 	}
 
 	return fmt.Sprintf("Successfully deleted topic '%s'", topicName), nil
 }
 
-// When successful, returns a map of topic names to their details
-func ListTopics() (topicMap map[string]sarama.TopicDetail, f *Failure) {
-	client, validateFailure := GetAdminClient()
-	if validateFailure != nil {
-		return nil, validateFailure
+// When successful, returns a map of topic names to their details, empty when the cluster
+// has no topics
+func ListTopics(ctx context.Context, h *cluster.Handle) (topicMap map[string]sarama.TopicDetail, f *Failure) {
+	if failure := contextFailure(ctx); failure != nil {
+		return nil, failure
 	}
 
-	topics, err := client.ListTopics()
+	topics, err := cluster.Await(ctx, h.Admin.ListTopics)
 	if err != nil {
-		return nil, NewFailure(fmt.Sprintf("Error listing topics: %v", err), http.StatusInternalServerError)
-	}
-
-	if len(topics) == 0 {
-		return nil, NewFailure("No topics found", http.StatusInternalServerError)
+		return nil, NewKafkaFailure("Error listing topics", err)
 	}
 
 	return topics, nil
 }
 
-func DescribeTopic(topicName string) (*sarama.TopicMetadata, *Failure) {
-	client, validateFailure := GetAdminClient()
-	if validateFailure != nil {
-		return nil, validateFailure
+func DescribeTopic(ctx context.Context, h *cluster.Handle, topicName string) (*sarama.TopicMetadata, *Failure) {
+	if failure := contextFailure(ctx); failure != nil {
+		return nil, failure
 	}
 
-	metadata, err := client.DescribeTopics([]string{topicName})
-	if err != nil || len(metadata) == 0 {
-		return nil, NewFailure(fmt.Sprintf("Error describing topic '%s': %v", topicName, err), http.StatusInternalServerError)
+	metadata, err := cluster.Await(ctx, func() ([]*sarama.TopicMetadata, error) {
+		return h.Admin.DescribeTopics([]string{topicName})
+	})
+	if err != nil {
+		return nil, NewKafkaFailure(fmt.Sprintf("Error describing topic '%s'", topicName), err)
+	}
+	if len(metadata) == 0 || errors.Is(metadata[0].Err, sarama.ErrUnknownTopicOrPartition) {
+		return nil, NewFailure(fmt.Sprintf("Topic '%s' not found", topicName), http.StatusNotFound).WithCode(CodeTopicNotFound)
+	}
+	if metadata[0].Err != sarama.ErrNoError {
+		return nil, NewKafkaFailure(fmt.Sprintf("Error describing topic '%s'", topicName), metadata[0].Err)
 	}
 
 	return metadata[0], nil
 }
 
-func DescribeTopicConfig(topicName string) ([]sarama.ConfigEntry, *Failure) {
-	client, validateFailure := GetAdminClient()
-	if validateFailure != nil {
-		return nil, validateFailure
+func DescribeTopicConfig(ctx context.Context, h *cluster.Handle, topicName string) ([]sarama.ConfigEntry, *Failure) {
+	if failure := contextFailure(ctx); failure != nil {
+		return nil, failure
 	}
 
-	configs, err := client.DescribeConfig(sarama.ConfigResource{Type: sarama.TopicResource, Name: topicName})
+	configs, err := cluster.Await(ctx, func() ([]sarama.ConfigEntry, error) {
+		return h.Admin.DescribeConfig(sarama.ConfigResource{Type: sarama.TopicResource, Name: topicName})
+	})
 	if err != nil {
-		return nil, NewFailure(fmt.Sprintf("Error describing configs for topic '%s': %v", topicName, err), http.StatusInternalServerError)
+		return nil, NewKafkaFailure(fmt.Sprintf("Error describing configs for topic '%s'", topicName), err)
 	}
 
 	return configs, nil
 }
 
-func UpdateTopic(topicName string, newPartitions int) (successMessage string, f *Failure) {
-	client, validateFailure := GetAdminClient()
-	if validateFailure != nil {
-		return "", validateFailure
+// TopicConfigOverrides returns the configs set on the topic itself, leaving out those
+// inherited from the broker. Sensitive values are not returned by Kafka and are left out.
+func TopicConfigOverrides(entries []sarama.ConfigEntry) map[string]string {
+	overrides := map[string]string{}
+	for _, entry := range entries {
+		// DescribeConfigs v0 cannot tell topic overrides from broker settings
+		if entry.Sensitive || (entry.Source != sarama.SourceTopic && (entry.Source != sarama.SourceUnknown || entry.Default)) {
+			continue
+		}
+		overrides[entry.Name] = entry.Value
+	}
+	return overrides
+}
+
+// UpdateTopicConfig replaces the configs set on the topic. Configs that are not given are
+// reset to the broker default.
+func UpdateTopicConfig(ctx context.Context, h *cluster.Handle, topicName string, configs map[string]string) (successMessage string, f *Failure) {
+	if failure := contextFailure(ctx); failure != nil {
+		return "", failure
+	}
+	if failure := CheckWritable(ctx, h); failure != nil {
+		return "", failure
+	}
+
+	err := cluster.Run(ctx, func() error {
+		return h.Admin.AlterConfig(sarama.TopicResource, topicName, configEntries(configs), false)
+	})
+	if err != nil {
+		if errors.Is(err, sarama.ErrUnknownTopicOrPartition) {
+			return "", NewFailure(fmt.Sprintf("Topic '%s' not found", topicName), http.StatusNotFound).WithCode(CodeTopicNotFound)
+		}
+		return "", NewKafkaFailure(fmt.Sprintf("Error updating configs for topic '%s'", topicName), err)
+	}
+
+	return fmt.Sprintf("Successfully updated %d configs of topic '%s'", len(configs), topicName), nil
+}
+
+func configEntries(configs map[string]string) map[string]*string {
+	if len(configs) == 0 {
+		return nil
+	}
+	entries := make(map[string]*string, len(configs))
+	for name, value := range configs {
+		entries[name] = &value
+	}
+	return entries
+}
+
+func UpdateTopic(ctx context.Context, h *cluster.Handle, topicName string, newPartitions int) (successMessage string, f *Failure) {
+	if failure := CheckWritable(ctx, h); failure != nil {
+		return "", failure
 	}
 
 	if topicName == "" {
-		return "", NewFailure("Topic name cannot be empty", http.StatusInternalServerError)
+		return "", NewFailure("Topic name cannot be empty", http.StatusBadRequest).WithCode(CodeValidationFailed)
 	}
 
-	topicMetadata, err := client.DescribeTopics([]string{topicName})
-	if err != nil || len(topicMetadata) == 0 {
-		return "", NewFailure(fmt.Sprintf("Error describing topic '%s': %v", topicName, err), http.StatusInternalServerError)
+	topic, failure := DescribeTopic(ctx, h, topicName)
+	if failure != nil {
+		return "", failure
 	}
 
-	topic := topicMetadata[0]
 	existingPartitions := len(topic.Partitions)
 	if newPartitions <= existingPartitions {
-		return "", NewFailure("New partition count must be greater than the existing partitions", http.StatusBadRequest)
+		return "", NewFailure("New partition count must be greater than the existing partitions", http.StatusBadRequest).WithCode(CodeValidationFailed)
 	}
 
-	err = client.CreatePartitions(topicName, int32(newPartitions), nil, false)
+	err := cluster.Run(ctx, func() error {
+		return h.Admin.CreatePartitions(topicName, int32(newPartitions), nil, false)
+	})
 	if err != nil {
-		return "", NewFailure(fmt.Sprintf("Error updating partitions for topic '%s': %v", topicName, err), http.StatusInternalServerError)
+		return "", NewKafkaFailure(fmt.Sprintf("Error updating partitions for topic '%s'", topicName), err)
 	}
 
 	return fmt.Sprintf("Successfully updated topic '%s' to %d partitions.", topicName, newPartitions), nil
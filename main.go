@@ -1,7 +1,10 @@
 package main
 
 import (
+	"context"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/IBM/openkommander/pkg/cli"
 	"github.com/IBM/openkommander/pkg/logger"
@@ -18,7 +21,17 @@ func main() {
 
 	var rootCmd = cli.Init()
 
-	if err := rootCmd.Execute(); err != nil {
+	// Interrupting the CLI cancels the command's context and with it any pending Kafka call.
+	// The default signal behaviour is restored afterwards, so a second interrupt still
+	// terminates a command that is blocked elsewhere, e.g. on an interactive prompt.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	if err := rootCmd.ExecuteContext(ctx); err != nil {
 		logger.Error("Command execution failed", "error")
 		os.Exit(1)
 	}
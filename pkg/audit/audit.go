@@ -0,0 +1,374 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/user"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/IBM/openkommander/pkg/constants"
+	"github.com/IBM/openkommander/pkg/logger"
+)
+
+// Operation identifies the kind of mutating action being audited
+type Operation string
+
+const (
+	OpTopicCreate  Operation = "topic.create"
+	OpTopicDelete  Operation = "topic.delete"
+	OpTopicUpdate  Operation = "topic.update"
+	OpTopicCopy    Operation = "topic.copy"
+	OpTopicRestore Operation = "topic.restore"
+	OpConfigUpdate Operation = "config.update"
+)
+
+// Source identifies the front end an operation came from
+const (
+	SourceCLI  = "cli"
+	SourceREST = "rest"
+)
+
+// Outcome of an audited operation
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+const (
+	defaultMaxSize    int64 = 10 * 1024 * 1024
+	defaultMaxBackups       = 5
+)
+
+// Entry is a single audit record, written as one JSON line
+type Entry struct {
+	Time      time.Time      `json:"time"`
+	Actor     string         `json:"actor"`
+	Source    string         `json:"source"`
+	Cluster   string         `json:"cluster"`
+	Operation Operation      `json:"operation"`
+	Target    string         `json:"target"`
+	Outcome   string         `json:"outcome"`
+	Error     string         `json:"error,omitempty"`
+	Details   map[string]any `json:"details,omitempty"`
+}
+
+// Log appends entries to a JSON lines file and rotates it once it grows past MaxSize.
+// Rotated files are kept as <path>.1 (newest) through <path>.<MaxBackups> (oldest).
+// Processes writing the same log take an advisory lock on <path>.lock.
+type Log struct {
+	mu         sync.Mutex
+	path       string
+	MaxSize    int64
+	MaxBackups int
+}
+
+func NewLog(path string) *Log {
+	return &Log{
+		path:       path,
+		MaxSize:    defaultMaxSize,
+		MaxBackups: defaultMaxBackups,
+	}
+}
+
+func (l *Log) Path() string {
+	return l.path
+}
+
+// Write appends an entry to the log, rotating first if needed
+func (l *Log) Write(entry Entry) error {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now().UTC()
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("error encoding audit entry: %w", err)
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Other ok processes append to and rotate the same files
+	unlock, err := lockFile(l.path, true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := l.rotateIfNeeded(int64(len(line))); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("error opening audit log %s: %w", l.path, err)
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			logger.Error("Error closing audit log", "error", err)
+		}
+	}()
+
+	if _, err := file.Write(line); err != nil {
+		return fmt.Errorf("error writing audit log %s: %w", l.path, err)
+	}
+	return nil
+}
+
+func (l *Log) rotateIfNeeded(incoming int64) error {
+	info, err := os.Stat(l.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error reading audit log %s: %w", l.path, err)
+	}
+	if l.MaxSize <= 0 || info.Size()+incoming <= l.MaxSize {
+		return nil
+	}
+
+	if l.MaxBackups <= 0 {
+		return os.Remove(l.path)
+	}
+
+	// Shift <path>.N-1 -> <path>.N, dropping the oldest
+	oldest := l.backupPath(l.MaxBackups)
+	if err := os.Remove(oldest); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("error removing old audit log %s: %w", oldest, err)
+	}
+	for i := l.MaxBackups - 1; i >= 1; i-- {
+		if err := os.Rename(l.backupPath(i), l.backupPath(i+1)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("error rotating audit log: %w", err)
+		}
+	}
+	if err := os.Rename(l.path, l.backupPath(1)); err != nil {
+		return fmt.Errorf("error rotating audit log: %w", err)
+	}
+	return nil
+}
+
+func (l *Log) backupPath(n int) string {
+	return fmt.Sprintf("%s.%d", l.path, n)
+}
+
+// Filter narrows the entries returned by Query. Zero values match everything.
+type Filter struct {
+	Cluster   string
+	Actor     string
+	Operation string
+	Outcome   string
+	Target    string
+	Since     time.Time
+	Limit     int
+}
+
+func (f Filter) matches(entry Entry) bool {
+	if f.Cluster != "" && entry.Cluster != f.Cluster {
+		return false
+	}
+	if f.Actor != "" && entry.Actor != f.Actor {
+		return false
+	}
+	// Operation filter matches a full name ("topic.delete") or a prefix ("topic")
+	if f.Operation != "" && string(entry.Operation) != f.Operation &&
+		!strings.HasPrefix(string(entry.Operation), f.Operation+".") {
+		return false
+	}
+	if f.Outcome != "" && entry.Outcome != f.Outcome {
+		return false
+	}
+	if f.Target != "" && entry.Target != f.Target {
+		return false
+	}
+	if !f.Since.IsZero() && entry.Time.Before(f.Since) {
+		return false
+	}
+	return true
+}
+
+// Query reads the current and rotated log files and returns matching entries,
+// newest first. Lines that cannot be decoded are skipped.
+func (l *Log) Query(filter Filter) ([]Entry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	unlock, err := lockFile(l.path, false)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	files := []string{l.path}
+	for i := 1; i <= l.MaxBackups; i++ {
+		files = append(files, l.backupPath(i))
+	}
+
+	entries := []Entry{}
+	for _, path := range files {
+		fileEntries, err := readEntries(path, filter)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, fileEntries...)
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Time.After(entries[j].Time)
+	})
+
+	if filter.Limit > 0 && len(entries) > filter.Limit {
+		entries = entries[:filter.Limit]
+	}
+	return entries, nil
+}
+
+func readEntries(path string, filter Filter) ([]Entry, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error opening audit log %s: %w", path, err)
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			logger.Error("Error closing audit log", "error", err)
+		}
+	}()
+
+	entries := []Entry{}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			logger.Warn("Skipping malformed audit entry", "file", path, "error", err)
+			continue
+		}
+		if filter.matches(entry) {
+			entries = append(entries, entry)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading audit log %s: %w", path, err)
+	}
+	return entries, nil
+}
+
+var defaultLog = NewLog(constants.OpenKommanderAuditFilename)
+
+// Default returns the audit log stored under the OpenKommander folder
+func Default() *Log {
+	return defaultLog
+}
+
+// SetDefault replaces the log written by Record, so tests can keep entries out of the
+// user's audit log
+func SetDefault(log *Log) {
+	defaultLog = log
+}
+
+// Record writes an entry to the default audit log. Failing to audit never fails the
+// operation itself, so errors are logged rather than returned.
+func Record(entry Entry) {
+	if err := defaultLog.Write(entry); err != nil {
+		logger.Error("Error writing audit entry", "operation", entry.Operation, "target", entry.Target, "error", err)
+	}
+}
+
+// Outcome builds the outcome and error fields from an operation result
+func Outcome(err error) (outcome string, errMessage string) {
+	if err != nil {
+		return OutcomeFailure, err.Error()
+	}
+	return OutcomeSuccess, ""
+}
+
+// LocalActor identifies the user running the CLI
+func LocalActor() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	if name := os.Getenv("USER"); name != "" {
+		return name
+	}
+	return "unknown"
+}
+
+// TrustedProxies are the networks of proxies in front of the REST server whose forwarded
+// user and address headers are believed
+type TrustedProxies []*net.IPNet
+
+// ParseTrustedProxies parses IP addresses and CIDR ranges such as 10.0.0.0/8
+func ParseTrustedProxies(values []string) (TrustedProxies, error) {
+	proxies := make(TrustedProxies, 0, len(values))
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy '%s', want an IP address or CIDR range", value)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			proxies = append(proxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy '%s', want an IP address or CIDR range", value)
+		}
+		proxies = append(proxies, network)
+	}
+	return proxies, nil
+}
+
+// Contains reports whether a remote address such as 10.0.0.5:41234 belongs to a trusted proxy
+func (p TrustedProxies) Contains(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, network := range p {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// RequestActor identifies the caller of a REST request. The user name or client address
+// forwarded by a proxy is only used when the request comes from one of the trusted proxies,
+// since any client can set those headers; otherwise the remote address is recorded.
+func RequestActor(r *http.Request, trusted TrustedProxies) string {
+	if !trusted.Contains(r.RemoteAddr) {
+		return r.RemoteAddr
+	}
+	for _, header := range []string{"X-Forwarded-User", "X-Remote-User"} {
+		if name := r.Header.Get(header); name != "" {
+			return name
+		}
+	}
+	if username, _, ok := r.BasicAuth(); ok && username != "" {
+		return username
+	}
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		return strings.TrimSpace(strings.Split(forwarded, ",")[0])
+	}
+	return r.RemoteAddr
+}
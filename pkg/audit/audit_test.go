@@ -0,0 +1,156 @@
+package audit
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLog_WriteAndQuery(t *testing.T) {
+	log := NewLog(filepath.Join(t.TempDir(), "audit.log"))
+
+	now := time.Now().UTC()
+	entries := []Entry{
+		{Time: now.Add(-2 * time.Hour), Actor: "alice", Cluster: "dev", Operation: OpTopicCreate, Target: "orders", Outcome: OutcomeSuccess},
+		{Time: now.Add(-1 * time.Hour), Actor: "bob", Cluster: "prod", Operation: OpTopicDelete, Target: "orders", Outcome: OutcomeFailure},
+		{Time: now, Actor: "alice", Cluster: "prod", Operation: OpConfigUpdate, Target: "billing", Outcome: OutcomeSuccess},
+	}
+	for _, entry := range entries {
+		if err := log.Write(entry); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+
+	testCases := []struct {
+		name     string
+		filter   Filter
+		expected []string
+	}{
+		{"no filter returns newest first", Filter{}, []string{"billing", "orders", "orders"}},
+		{"by cluster", Filter{Cluster: "prod"}, []string{"billing", "orders"}},
+		{"by operation prefix", Filter{Operation: "topic"}, []string{"orders", "orders"}},
+		{"by full operation", Filter{Operation: string(OpTopicDelete)}, []string{"orders"}},
+		{"by outcome", Filter{Outcome: OutcomeFailure}, []string{"orders"}},
+		{"since", Filter{Since: now.Add(-90 * time.Minute)}, []string{"billing", "orders"}},
+		{"limit", Filter{Limit: 1}, []string{"billing"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := log.Query(tc.filter)
+			if err != nil {
+				t.Fatalf("Query() error = %v", err)
+			}
+			if len(result) != len(tc.expected) {
+				t.Fatalf("Query() returned %d entries, want %d", len(result), len(tc.expected))
+			}
+			for i, entry := range result {
+				if entry.Target != tc.expected[i] {
+					t.Errorf("entry %d target = %s, want %s", i, entry.Target, tc.expected[i])
+				}
+			}
+		})
+	}
+}
+
+func TestLog_Rotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	log := NewLog(path)
+	log.MaxSize = 200
+	log.MaxBackups = 2
+
+	for i := 0; i < 10; i++ {
+		if err := log.Write(Entry{Actor: "alice", Operation: OpTopicCreate, Target: "orders", Outcome: OutcomeSuccess}); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+
+	for _, name := range []string{path, path + ".1", path + ".2"} {
+		info, err := os.Stat(name)
+		if err != nil {
+			t.Fatalf("expected %s to exist: %v", name, err)
+		}
+		if info.Size() > log.MaxSize {
+			t.Errorf("%s is %d bytes, larger than MaxSize %d", name, info.Size(), log.MaxSize)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("expected no more than %d backups", log.MaxBackups)
+	}
+}
+
+func TestLog_RotationAcrossProcesses(t *testing.T) {
+	// Two logs on one path stand in for two ok processes, which do not share Log.mu
+	path := filepath.Join(t.TempDir(), "audit.log")
+	logs := []*Log{NewLog(path), NewLog(path)}
+	for _, log := range logs {
+		log.MaxSize = 500
+		log.MaxBackups = 100
+	}
+
+	const perLog = 50
+	var wg sync.WaitGroup
+	for _, log := range logs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perLog; i++ {
+				if err := log.Write(Entry{Operation: OpTopicCreate, Target: fmt.Sprintf("topic-%d", i)}); err != nil {
+					t.Errorf("Write() error = %v", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	entries, err := logs[0].Query(Filter{})
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if len(entries) != len(logs)*perLog {
+		t.Errorf("Query() returned %d entries, want %d", len(entries), len(logs)*perLog)
+	}
+}
+
+func TestRequestActor(t *testing.T) {
+	trusted, err := ParseTrustedProxies([]string{"10.0.0.0/8", "192.168.1.7"})
+	if err != nil {
+		t.Fatalf("ParseTrustedProxies() error = %v", err)
+	}
+
+	testCases := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		expected   string
+	}{
+		{"direct client", "203.0.113.9:5000", nil, "203.0.113.9:5000"},
+		{"spoofed user from untrusted client", "203.0.113.9:5000", map[string]string{"X-Forwarded-User": "admin", "X-Forwarded-For": "10.1.1.1"}, "203.0.113.9:5000"},
+		{"user from trusted range", "10.2.3.4:5000", map[string]string{"X-Forwarded-User": "alice"}, "alice"},
+		{"user from trusted address", "192.168.1.7:5000", map[string]string{"X-Remote-User": "bob"}, "bob"},
+		{"forwarded address from trusted proxy", "10.2.3.4:5000", map[string]string{"X-Forwarded-For": "198.51.100.1, 10.2.3.4"}, "198.51.100.1"},
+		{"neighbour of trusted address", "192.168.1.8:5000", map[string]string{"X-Remote-User": "bob"}, "192.168.1.8:5000"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/api/v1/localhost:9092/topics", nil)
+			r.RemoteAddr = tc.remoteAddr
+			for name, value := range tc.headers {
+				r.Header.Set(name, value)
+			}
+			if actor := RequestActor(r, trusted); actor != tc.expected {
+				t.Errorf("RequestActor() = %s, want %s", actor, tc.expected)
+			}
+		})
+	}
+
+	if _, err := ParseTrustedProxies([]string{"proxy.local"}); err == nil {
+		t.Error("ParseTrustedProxies() accepted a host name")
+	}
+}
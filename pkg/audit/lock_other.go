@@ -0,0 +1,9 @@
+//go:build !unix
+
+package audit
+
+// lockFile is a no-op where flock is unavailable; entries from one process are still
+// serialized by Log.mu
+func lockFile(path string, exclusive bool) (unlock func(), err error) {
+	return func() {}, nil
+}
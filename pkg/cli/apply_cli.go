@@ -0,0 +1,223 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/IBM/openkommander/internal/core/commands"
+	"github.com/IBM/openkommander/pkg/audit"
+	"github.com/IBM/openkommander/pkg/cluster"
+	"github.com/IBM/openkommander/pkg/output"
+	"github.com/IBM/openkommander/pkg/session"
+)
+
+func specFlags() []OkFlag {
+	return []OkFlag{
+		NewOkFlag(OkFlagString, "file", "f", "YAML or JSON file listing the desired topics, - for standard input"),
+		NewOkFlag(OkFlagString, "format", "", "[optional] yaml or json, guessed from the file extension (default yaml)"),
+		NewOkFlag(OkFlagBool, "prune", "", "[optional] also delete topics that are not in the file, except internal topics"),
+	}
+}
+
+// planFromFlags reads the spec file and compares it with the active cluster
+func planFromFlags(cmd cobraCmd) (*cluster.Handle, *commands.TopicPlan) {
+	path, _ := cmd.Flags().GetString("file")
+	format, _ := cmd.Flags().GetString("format")
+	if format == "" {
+		format = output.FormatForPath(path)
+	}
+	if format == "" {
+		format = output.YAML
+	}
+	prune, _ := cmd.Flags().GetBool("prune")
+
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		fmt.Println("Error reading topic spec:", err)
+		os.Exit(1)
+	}
+	specs, err := commands.ParseTopicSpecs(data, format)
+	if err != nil {
+		fmt.Println("Error in topic spec:", err)
+		os.Exit(1)
+	}
+
+	h, ok := currentCluster(cmd)
+	if !ok {
+		os.Exit(1)
+	}
+	plan, failure := commands.PlanTopics(cmd.Context(), h, specs, prune)
+	if failure != nil {
+		fmt.Println("Error:", failure.Err)
+		os.Exit(1)
+	}
+	return h, plan
+}
+
+// renderPlan prints the plan as a table, or in the selected structured format
+func renderPlan(cmd cobraCmd, plan *commands.TopicPlan) {
+	if renderOutput(cmd, plan) {
+		return
+	}
+
+	for _, warning := range plan.Warnings {
+		fmt.Println("Warning:", warning)
+	}
+	if len(plan.Changes) == 0 {
+		fmt.Println("No changes. The cluster matches the topic spec.")
+		return
+	}
+
+	rows := [][]interface{}{}
+	for _, change := range plan.Changes {
+		rows = append(rows, []interface{}{planSymbol(change.Kind), change.Topic, change.Description})
+	}
+	RenderTable(fmt.Sprintf("Plan (%d changes):", len(plan.Changes)), []string{"", "Topic", "Change"}, rows)
+}
+
+func planSymbol(kind string) string {
+	switch kind {
+	case commands.ChangeCreate:
+		return "+"
+	case commands.ChangeDelete:
+		return "-"
+	default:
+		return "~"
+	}
+}
+
+// Diff
+
+func diffTopics(cmd cobraCmd, args cobraArgs) {
+	_, plan := planFromFlags(cmd)
+	renderPlan(cmd, plan)
+
+	exitCode, _ := cmd.Flags().GetBool("exit-code")
+	if exitCode && len(plan.Changes) > 0 {
+		os.Exit(1)
+	}
+}
+
+// Apply
+
+// applyReport is the structured output of ok apply, a single document with the plan and
+// the result of each change that was applied
+type applyReport struct {
+	Plan    *commands.TopicPlan    `json:"plan"`
+	Results []commands.TopicResult `json:"results"`
+}
+
+func applyTopics(cmd cobraCmd, args cobraArgs) {
+	format, err := outputFormat(cmd)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	structured := format != session.OutputTable
+
+	h, plan := planFromFlags(cmd)
+	report := applyReport{Plan: plan, Results: []commands.TopicResult{}}
+	if !structured {
+		renderPlan(cmd, plan)
+	}
+	if len(plan.Changes) == 0 {
+		if structured {
+			renderOutput(cmd, report)
+		}
+		return
+	}
+
+	if failure := commands.CheckWritable(cmd.Context(), h); failure != nil {
+		fmt.Println("Error:", failure.Err)
+		os.Exit(1)
+	}
+	yes, _ := cmd.Flags().GetBool("yes")
+	production := isProduction(h)
+	if structured && (production && !cmd.Flags().Changed("confirm") || !production && !yes) {
+		// A prompt would end up in the middle of the document
+		fmt.Printf("Error: --output %s applies without prompting; confirm with --yes, or with --confirm <cluster name> on a production cluster\n", format)
+		os.Exit(1)
+	}
+	if production {
+		prompt := fmt.Sprintf("Cluster '%s' is a production cluster. Type the cluster name to apply %d changes: ", h.Name, len(plan.Changes))
+		if !confirmTyped(cmd, prompt, h.Name, "the cluster name") {
+			if structured {
+				os.Exit(1)
+			}
+			return
+		}
+	} else if !yes {
+		fmt.Printf("Apply %d changes? [y/N]: ", len(plan.Changes))
+		if answer := strings.ToLower(readLine()); answer != "y" && answer != "yes" {
+			fmt.Println("Nothing was changed.")
+			return
+		}
+	}
+
+	results, failure := commands.ApplyTopicPlan(cmd.Context(), h, plan)
+	if failure != nil {
+		fmt.Println("Error:", failure.Err)
+		os.Exit(1)
+	}
+	report.Results = results
+
+	rows := [][]interface{}{}
+	for i, result := range results {
+		change := plan.Changes[i]
+		recordAudit(changeOperation(change.Kind), change.Topic, result.Failure, changeDetails(change))
+
+		status, message := "OK", result.Message
+		if result.Failure != nil {
+			status, message = "FAILED", result.Failure.Err.Error()
+		}
+		rows = append(rows, []interface{}{planSymbol(change.Kind), change.Topic, status, message})
+	}
+	failed := commands.CountFailures(results)
+	if structured {
+		renderOutput(cmd, report)
+	} else {
+		RenderTable("Results:", []string{"", "Topic", "Result", "Message"}, rows)
+		fmt.Printf("%d applied, %d failed\n", len(results)-failed, failed)
+	}
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+func changeOperation(kind string) audit.Operation {
+	switch kind {
+	case commands.ChangeCreate:
+		return audit.OpTopicCreate
+	case commands.ChangeDelete:
+		return audit.OpTopicDelete
+	case commands.ChangeConfig:
+		return audit.OpConfigUpdate
+	default:
+		return audit.OpTopicUpdate
+	}
+}
+
+func changeDetails(change commands.TopicChange) map[string]any {
+	switch change.Kind {
+	case commands.ChangeCreate:
+		return map[string]any{
+			"partitions":         change.Partitions,
+			"replication_factor": change.ReplicationFactor,
+			"configs":            change.Configs,
+		}
+	case commands.ChangePartitions:
+		return map[string]any{"partitions": change.Partitions}
+	case commands.ChangeConfig:
+		return map[string]any{"configs": change.Configs}
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,117 @@
+package cli
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/IBM/openkommander/internal/core/commands"
+	"github.com/IBM/openkommander/pkg/audit"
+	"github.com/IBM/openkommander/pkg/session"
+)
+
+type AuditCommandList struct{}
+
+func (AuditCommandList) GetParentCommand() *OkParentCmd {
+	return &OkParentCmd{
+		Use:   "audit <command>",
+		Short: "Audit log commands",
+	}
+}
+
+func (AuditCommandList) GetCommands() []*OkCmd {
+	return []*OkCmd{
+		{ // Show audit entries
+			Use:   "show",
+			Short: "Show recorded mutating operations",
+			Run:   showAuditLog,
+			Flags: []OkFlag{
+				NewOkFlag(OkFlagString, "cluster", "c", "[optional] only show entries for this cluster"),
+				NewOkFlag(OkFlagString, "actor", "a", "[optional] only show entries by this actor"),
+				NewOkFlag(OkFlagString, "operation", "o", "[optional] only show this operation, e.g. topic.delete or topic"),
+				NewOkFlag(OkFlagString, "outcome", "", "[optional] only show entries with this outcome (success or failure)"),
+				NewOkFlag(OkFlagString, "target", "t", "[optional] only show entries for this target"),
+				NewOkFlag(OkFlagString, "since", "s", "[optional] only show entries newer than this duration, e.g. 24h"),
+				NewOkFlag(OkFlagInt, "limit", "n", "[optional] maximum number of entries to show", 50),
+			},
+		},
+	}
+}
+
+func (AuditCommandList) GetSubcommands() []CommandList {
+	return nil
+}
+
+func showAuditLog(cmd cobraCmd, args cobraArgs) {
+	filter := audit.Filter{}
+	filter.Cluster, _ = cmd.Flags().GetString("cluster")
+	filter.Actor, _ = cmd.Flags().GetString("actor")
+	filter.Operation, _ = cmd.Flags().GetString("operation")
+	filter.Outcome, _ = cmd.Flags().GetString("outcome")
+	filter.Target, _ = cmd.Flags().GetString("target")
+	filter.Limit, _ = cmd.Flags().GetInt("limit")
+
+	since, _ := cmd.Flags().GetString("since")
+	if since != "" {
+		window, err := time.ParseDuration(since)
+		if err != nil {
+			fmt.Printf("Error: invalid --since duration '%s': %v\n", since, err)
+			return
+		}
+		filter.Since = time.Now().Add(-window)
+	}
+
+	entries, err := audit.Default().Query(filter)
+	if err != nil {
+		fmt.Println("Error reading audit log:", err)
+		return
+	}
+
+	if renderOutput(cmd, entries) {
+		return
+	}
+	if len(entries) == 0 {
+		fmt.Println("No audit entries found.")
+		return
+	}
+
+	auditHeaders := []string{"Time", "Actor", "Source", "Cluster", "Operation", "Target", "Outcome", "Error"}
+	auditRows := [][]interface{}{}
+	for _, entry := range entries {
+		auditRows = append(auditRows, []interface{}{
+			entry.Time.Local().Format(time.RFC3339),
+			entry.Actor,
+			entry.Source,
+			entry.Cluster,
+			entry.Operation,
+			entry.Target,
+			entry.Outcome,
+			entry.Error,
+		})
+	}
+	RenderTable("Audit Log:", auditHeaders, auditRows)
+}
+
+// recordAudit writes an audit entry for a mutating operation run against the active cluster
+func recordAudit(operation audit.Operation, target string, failure *commands.Failure, details map[string]any) {
+	recordClusterAudit(session.Default().ActiveClusterName(), operation, target, failure, details)
+}
+
+// recordClusterAudit records an operation on a cluster other than the active one
+func recordClusterAudit(clusterName string, operation audit.Operation, target string, failure *commands.Failure, details map[string]any) {
+	var err error
+	if failure != nil {
+		err = failure.Err
+	}
+	outcome, errMessage := audit.Outcome(err)
+
+	audit.Record(audit.Entry{
+		Actor:     audit.LocalActor(),
+		Source:    audit.SourceCLI,
+		Cluster:   clusterName,
+		Operation: operation,
+		Target:    target,
+		Outcome:   outcome,
+		Error:     errMessage,
+		Details:   details,
+	})
+}
@@ -1,12 +1,5 @@
 package cli
 
-import (
-	"fmt"
-
-	"github.com/IBM/openkommander/internal/core/commands"
-	// "github.com/spf13/cobra"
-)
-
 type BrokerCommandList struct{}
 
 func (BrokerCommandList) GetParentCommand() *OkParentCmd {
@@ -33,13 +26,11 @@ func (BrokerCommandList) GetSubcommands() []CommandList {
 
 // List Broker info
 func getBrokerInfo(cmd cobraCmd, args cobraArgs) {
-	client, failure := commands.GetBrokerClient()
-	brokers := client.Brokers()
-
-	if failure != nil {
-		fmt.Println(failure.Err)
+	h, ok := currentCluster(cmd)
+	if !ok {
 		return
 	}
+	brokers := h.Client.Brokers()
 
 	brokerHeaders := []string{"ID", "Address", "Rack", "Connected", "ResponseSize"}
 	brokerRows := [][]interface{}{}
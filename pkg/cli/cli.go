@@ -1,6 +1,8 @@
 package cli
 
 import (
+	"time"
+
 	"github.com/spf13/cobra"
 )
 
@@ -20,8 +22,10 @@ type OkFlag struct {
 type OkFlagType string
 
 const (
-	OkFlagString OkFlagType = "string"
-	OkFlagInt    OkFlagType = "int"
+	OkFlagString   OkFlagType = "string"
+	OkFlagInt      OkFlagType = "int"
+	OkFlagBool     OkFlagType = "bool"
+	OkFlagDuration OkFlagType = "duration"
 )
 
 func NewOkFlag(flagType OkFlagType, name, shortName, usage string, defaultVal ...any) OkFlag {
@@ -45,6 +49,11 @@ type OkCmd struct {
 	Aliases       []string
 	RequiredFlags []string
 	Args          cobra.PositionalArgs
+
+	// Persistent flags and hooks apply to the command and all of its subcommands
+	PersistentFlags   []OkFlag
+	PersistentPreRun  func(cmd cobraCmd, args cobraArgs)
+	PersistentPostRun func(cmd cobraCmd, args cobraArgs)
 }
 
 type OkParentCmd = OkCmd
@@ -82,32 +91,18 @@ func RegisterCommands(commandList CommandList) cobraCmd {
 
 func cobraCmdFromOkCmd(command *OkCmd) cobraCmd {
 	cmd := &cobra.Command{
-		Use:     command.Use,
-		Short:   command.Short,
-		Long:    command.Long,
-		Run:     command.Run,
-		Aliases: command.Aliases,
-		Args:    command.Args,
+		Use:               command.Use,
+		Short:             command.Short,
+		Long:              command.Long,
+		Run:               command.Run,
+		Aliases:           command.Aliases,
+		Args:              command.Args,
+		PersistentPreRun:  command.PersistentPreRun,
+		PersistentPostRun: command.PersistentPostRun,
 	}
 
-	if command.Flags != nil {
-		for _, flag := range command.Flags {
-			switch flag.ValueType {
-			case "string":
-				defaultVal := ""
-				if len(flag.Default) > 0 {
-					defaultVal = flag.Default[0].(string)
-				}
-				cmd.Flags().StringP(flag.Name, flag.ShortName, defaultVal, flag.Usage)
-			case "int":
-				defaultVal := 0
-				if len(flag.Default) > 0 {
-					defaultVal = flag.Default[0].(int)
-				}
-				cmd.Flags().IntP(flag.Name, flag.ShortName, defaultVal, flag.Usage)
-			}
-		}
-	}
+	addFlags(cmd, false, command.Flags)
+	addFlags(cmd, true, command.PersistentFlags)
 
 	if len(command.RequiredFlags) > 0 {
 		cmd.MarkFlagsRequiredTogether(command.RequiredFlags...)
@@ -121,3 +116,39 @@ func cobraCmdFromOkCmd(command *OkCmd) cobraCmd {
 
 	return cmd
 }
+
+func addFlags(cmd cobraCmd, persistent bool, flags []OkFlag) {
+	flagSet := cmd.Flags()
+	if persistent {
+		flagSet = cmd.PersistentFlags()
+	}
+
+	for _, flag := range flags {
+		switch flag.ValueType {
+		case "string":
+			defaultVal := ""
+			if len(flag.Default) > 0 {
+				defaultVal = flag.Default[0].(string)
+			}
+			flagSet.StringP(flag.Name, flag.ShortName, defaultVal, flag.Usage)
+		case "int":
+			defaultVal := 0
+			if len(flag.Default) > 0 {
+				defaultVal = flag.Default[0].(int)
+			}
+			flagSet.IntP(flag.Name, flag.ShortName, defaultVal, flag.Usage)
+		case "bool":
+			defaultVal := false
+			if len(flag.Default) > 0 {
+				defaultVal = flag.Default[0].(bool)
+			}
+			flagSet.BoolP(flag.Name, flag.ShortName, defaultVal, flag.Usage)
+		case "duration":
+			defaultVal := time.Duration(0)
+			if len(flag.Default) > 0 {
+				defaultVal = flag.Default[0].(time.Duration)
+			}
+			flagSet.DurationP(flag.Name, flag.ShortName, defaultVal, flag.Usage)
+		}
+	}
+}
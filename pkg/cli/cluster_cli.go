@@ -1,10 +1,18 @@
 package cli
 
 import (
+	"bytes"
 	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
 	"strings"
 
+	"github.com/IBM/openkommander/internal/core/commands"
+	"github.com/IBM/openkommander/pkg/output"
 	"github.com/IBM/openkommander/pkg/session"
+	"github.com/jedib0t/go-pretty/v6/text"
+	"github.com/spf13/cobra"
 )
 
 type ClusterCommandList struct{}
@@ -23,11 +31,118 @@ func (m ClusterCommandList) GetCommands() []*OkCmd {
 			Short: "List all cluster connections",
 			Run:   listClusterConnections,
 		},
+		{ // Add cluster profile
+			Use:   "add <cluster-name>",
+			Short: "Save a cluster connection profile without connecting",
+			Long: `Save a cluster connection profile without the interactive login prompts.
+
+SASL passwords are never stored; point --sasl-password-env or --sasl-password-file at
+where the password can be read when connecting.`,
+			Run:           addClusterProfile,
+			Args:          cobra.ExactArgs(1),
+			Flags:         append(clusterProfileFlags(), NewOkFlag(OkFlagBool, "select", "", "[optional] select the cluster after adding it (default when no cluster is selected)")),
+			RequiredFlags: []string{"brokers"},
+		},
+		{ // Edit cluster profile
+			Use:   "edit <cluster-name>",
+			Short: "Change settings of a cluster connection profile",
+			Long: `Change settings of a cluster connection profile. Only the flags given are changed.
+
+Use --label to add or replace labels, --remove-label to drop them, and --no-sasl or
+--no-tls to remove the SASL or TLS settings.`,
+			Run:  editClusterProfile,
+			Args: cobra.ExactArgs(1),
+			Flags: append(clusterProfileFlags(),
+				NewOkFlag(OkFlagString, "remove-label", "", "[optional] comma separated label keys to remove"),
+				NewOkFlag(OkFlagBool, "no-sasl", "", "[optional] remove the SASL settings"),
+				NewOkFlag(OkFlagBool, "no-tls", "", "[optional] remove the TLS settings"),
+			),
+		},
+		{ // Rename cluster profile
+			Use:   "rename <cluster-name> <new-name>",
+			Short: "Rename a cluster connection profile",
+			Run:   renameClusterProfile,
+			Args:  cobra.ExactArgs(2),
+		},
+		{ // Remove cluster profile
+			Use:     "remove <cluster-name>",
+			Short:   "Remove a cluster connection profile",
+			Run:     removeClusterProfile,
+			Args:    cobra.ExactArgs(1),
+			Aliases: []string{"rm"},
+		},
+		{ // Export cluster profiles
+			Use:   "export [cluster-name...]",
+			Short: "Write cluster connection profiles to a YAML or JSON file",
+			Long: `Write cluster connection profiles, all of them or the ones named, as YAML or JSON
+so they can be shared and loaded with 'ok cluster import'.
+
+Profiles only refer to SASL passwords through an environment variable or a file, so the
+export holds no secrets. Use --include-secrets to add the passwords themselves.`,
+			Run: exportClusterProfiles,
+			Flags: []OkFlag{
+				NewOkFlag(OkFlagString, "file", "f", "[optional] file to write, standard output when not set"),
+				NewOkFlag(OkFlagString, "format", "", "[optional] yaml or json, guessed from the file extension (default yaml)"),
+				NewOkFlag(OkFlagBool, "include-secrets", "", "[optional] add the SASL passwords to the export"),
+			},
+		},
+		{ // Import cluster profiles
+			Use:   "import <file>",
+			Short: "Load cluster connection profiles from a YAML, JSON or client.properties file",
+			Long: `Load cluster connection profiles written by 'ok cluster export', or a single profile
+from a Kafka client configuration file such as client.properties.
+
+Profiles are merged with existing ones by name: the settings in the file replace the
+current ones, settings it leaves out are kept and labels are added. Passwords in the file
+are ignored unless --include-secrets is set; they are then written to files readable only
+by you under the ok configuration directory, never to the session file.`,
+			Run:  importClusterProfiles,
+			Args: cobra.ExactArgs(1),
+			Flags: []OkFlag{
+				NewOkFlag(OkFlagString, "format", "", "[optional] yaml, json or properties, guessed from the file extension"),
+				NewOkFlag(OkFlagString, "name", "", "[optional] cluster name for a properties file (default the file name)"),
+				NewOkFlag(OkFlagString, "kafka-version", "", "[optional] Kafka version of a cluster from a properties file (default detected on first connect)"),
+				NewOkFlag(OkFlagBool, "include-secrets", "", "[optional] import the passwords in the file"),
+			},
+		},
 		{ // Select cluster
 			Use:   "select <cluster-name>",
 			Short: "Select active cluster",
 			Run:   selectCluster,
 		},
+		{ // Cluster health
+			Use:   "health",
+			Short: "Report on cluster health, exiting non-zero when problems are found",
+			Long: `Report offline, leaderless, under-replicated and under-min-ISR partitions, leader skew
+per broker, unreachable brokers and the controller of the active cluster.
+
+Exits with status 1 when problems are found and 2 when the report could not be built,
+so it can be used in cron jobs and CI checks.`,
+			Run: clusterHealth,
+			Flags: []OkFlag{
+				NewOkFlag(OkFlagInt, "max-leader-skew", "", "[optional] leader skew in percent above which a broker is reported", int(commands.DefaultMaxLeaderSkew)),
+			},
+		},
+		{ // Compare clusters
+			Use:   "compare <cluster-a> <cluster-b>",
+			Short: "Show how the topics, topic configs and ACLs of two saved clusters differ",
+			Long: `Compare two saved clusters: topics that exist on only one of them, partition counts,
+replication factors and topic configs that differ, and ACLs that exist on only one of them.
+Configs are compared as set on the topics; a config missing on one side takes the broker
+default there.
+
+Use --output json for automation. Exits with status 1 when the clusters differ and 2 when
+they could not be compared.`,
+			Run:  compareClusters,
+			Args: cobra.ExactArgs(2),
+			Flags: []OkFlag{
+				NewOkFlag(OkFlagString, "match", "m", "[optional] only compare topics matching a glob such as 'orders-*'"),
+				NewOkFlag(OkFlagBool, "regex", "", "[optional] treat --match as a regular expression that must match the whole topic name"),
+				NewOkFlag(OkFlagBool, "include-internal", "", "[optional] also compare internal topics such as __consumer_offsets"),
+				NewOkFlag(OkFlagBool, "skip-acls", "", "[optional] do not compare ACLs"),
+				NewOkFlag(OkFlagBool, "no-color", "", "[optional] print the differences without colors"),
+			},
+		},
 	}
 }
 
@@ -36,8 +151,12 @@ func (ClusterCommandList) GetSubcommands() []CommandList {
 }
 
 func listClusterConnections(cmd cobraCmd, args cobraArgs) {
-	clusters := session.GetClusterConnections()
-	activeCluster := session.GetActiveClusterName()
+	clusters := session.Default().Clusters()
+	activeCluster := session.Default().ActiveClusterName()
+
+	if renderOutput(cmd, clusters) {
+		return
+	}
 
 	if len(clusters) == 0 {
 		fmt.Println("No cluster connections found.")
@@ -45,7 +164,7 @@ func listClusterConnections(cmd cobraCmd, args cobraArgs) {
 	}
 
 	// Prepare table headers and rows
-	connectionHeaders := []string{"Name", "Status", "Brokers", "Version", "Active"}
+	connectionHeaders := []string{"Name", "Status", "Brokers", "Version", "Labels", "Read Only", "Active"}
 	connectionRows := [][]interface{}{}
 
 	for _, cluster := range clusters {
@@ -66,6 +185,8 @@ func listClusterConnections(cmd cobraCmd, args cobraArgs) {
 			status,
 			brokersStr,
 			cluster.Version,
+			formatLabels(cluster.Labels),
+			cluster.ReadOnly,
 			active,
 		})
 	}
@@ -80,5 +201,532 @@ func selectCluster(cmd cobraCmd, args cobraArgs) {
 	}
 
 	clusterName := args[0]
-	session.SelectCluster(clusterName)
+	session.Default().SelectCluster(clusterName)
+}
+
+func clusterHealth(cmd cobraCmd, args cobraArgs) {
+	maxLeaderSkew, _ := cmd.Flags().GetInt("max-leader-skew")
+
+	h, failure := commands.CurrentCluster(cmd.Context(), session.Default())
+	if failure != nil {
+		fmt.Println(failure.Err)
+		os.Exit(2)
+	}
+
+	report, failure := commands.BuildHealthReport(cmd.Context(), h, float64(maxLeaderSkew))
+	if failure != nil {
+		fmt.Println(failure.Err)
+		os.Exit(2)
+	}
+
+	controller := "none"
+	if report.ControllerID >= 0 {
+		controller = fmt.Sprintf("%d (%s)", report.ControllerID, report.ControllerAddress)
+	}
+	summaryHeaders := []string{"Property", "Value"}
+	summaryRows := [][]interface{}{
+		{"Controller", controller},
+		{"Brokers", len(report.Brokers)},
+		{"Topics", report.TopicCount},
+		{"Partitions", report.PartitionCount},
+		{"Offline Partitions", len(report.OfflinePartitions)},
+		{"Leaderless Partitions", len(report.LeaderlessPartitions)},
+		{"Under-Replicated Partitions", len(report.UnderReplicatedPartitions)},
+		{"Under-Min-ISR Partitions", len(report.UnderMinIsrPartitions)},
+	}
+	if renderOutput(cmd, report) {
+		if !report.Healthy {
+			os.Exit(1)
+		}
+		return
+	}
+
+	RenderTable("Cluster Health:", summaryHeaders, summaryRows)
+
+	brokerHeaders := []string{"ID", "Address", "Reachable", "Controller", "Leaders", "Replicas", "Leader Skew"}
+	brokerRows := [][]interface{}{}
+	for _, broker := range report.Brokers {
+		brokerRows = append(brokerRows, []interface{}{
+			broker.ID,
+			broker.Address,
+			broker.Reachable,
+			broker.Controller,
+			broker.Leaders,
+			broker.Replicas,
+			fmt.Sprintf("%+.1f%%", broker.LeaderSkew),
+		})
+	}
+	RenderTable("Brokers:", brokerHeaders, brokerRows)
+
+	renderPartitionIssues("Offline Partitions:", report.OfflinePartitions)
+	renderPartitionIssues("Leaderless Partitions:", report.LeaderlessPartitions)
+	renderPartitionIssues("Under-Replicated Partitions:", report.UnderReplicatedPartitions)
+	renderPartitionIssues("Under-Min-ISR Partitions:", report.UnderMinIsrPartitions)
+
+	if report.Healthy {
+		fmt.Println("\nCluster is healthy.")
+		return
+	}
+
+	fmt.Println("\nProblems found:")
+	for _, problem := range report.Problems {
+		fmt.Printf("  - %s\n", problem)
+	}
+	os.Exit(1)
+}
+
+func renderPartitionIssues(title string, issues []commands.PartitionIssue) {
+	if len(issues) == 0 {
+		return
+	}
+
+	issueHeaders := []string{"Topic", "Partition", "Leader", "Replicas", "ISR", "Min ISR"}
+	issueRows := [][]interface{}{}
+	for _, issue := range issues {
+		minIsr := ""
+		if issue.MinIsr > 0 {
+			minIsr = fmt.Sprint(issue.MinIsr)
+		}
+		issueRows = append(issueRows, []interface{}{
+			issue.Topic,
+			issue.Partition,
+			issue.Leader,
+			fmt.Sprintf("%v", issue.Replicas),
+			fmt.Sprintf("%v", issue.Isr),
+			minIsr,
+		})
+	}
+	RenderTable(title, issueHeaders, issueRows)
+}
+
+// Cluster profiles
+
+func clusterProfileFlags() []OkFlag {
+	return []OkFlag{
+		NewOkFlag(OkFlagString, "brokers", "b", "comma separated broker addresses"),
+		NewOkFlag(OkFlagString, "kafka-version", "", "[optional] Kafka version of the cluster, or auto to detect it on the next connect (default auto)"),
+		NewOkFlag(OkFlagString, "client-id", "", "[optional] client ID sent to the brokers"),
+		NewOkFlag(OkFlagDuration, "dial-timeout", "", "[optional] timeout for connecting to a broker, e.g. 10s"),
+		NewOkFlag(OkFlagDuration, "request-timeout", "", "[optional] timeout for broker and admin requests, e.g. 30s"),
+		NewOkFlag(OkFlagDuration, "metadata-refresh", "", "[optional] interval between background metadata refreshes, e.g. 5m"),
+		NewOkFlag(OkFlagString, "sasl-mechanism", "", "[optional] SASL mechanism: PLAIN, SCRAM-SHA-256 or SCRAM-SHA-512"),
+		NewOkFlag(OkFlagString, "sasl-username", "", "[optional] SASL username"),
+		NewOkFlag(OkFlagString, "sasl-password-env", "", "[optional] environment variable holding the SASL password"),
+		NewOkFlag(OkFlagString, "sasl-password-file", "", "[optional] file holding the SASL password"),
+		NewOkFlag(OkFlagBool, "tls", "", "[optional] connect to the brokers over TLS"),
+		NewOkFlag(OkFlagString, "tls-ca", "", "[optional] CA certificate file for TLS, implies --tls"),
+		NewOkFlag(OkFlagString, "tls-cert", "", "[optional] client certificate file for TLS, implies --tls"),
+		NewOkFlag(OkFlagString, "tls-key", "", "[optional] client key file for TLS, implies --tls"),
+		NewOkFlag(OkFlagBool, "tls-insecure", "", "[optional] skip verification of the broker certificates, implies --tls"),
+		NewOkFlag(OkFlagString, "output-format", "", "[optional] default output format of commands: table, json or yaml"),
+		NewOkFlag(OkFlagBool, "read-only", "", "[optional] refuse commands that change the cluster"),
+		NewOkFlag(OkFlagString, "label", "l", "[optional] comma separated key=value labels, e.g. env=prod"),
+	}
+}
+
+// applyClusterProfileFlags copies the flags set on the command line into the profile
+func applyClusterProfileFlags(cmd cobraCmd, connection *session.ClusterConnection) error {
+	flags := cmd.Flags()
+
+	if flags.Changed("brokers") {
+		brokers, _ := flags.GetString("brokers")
+		connection.Brokers = splitList(brokers)
+	}
+	if flags.Changed("kafka-version") {
+		connection.Version, _ = flags.GetString("kafka-version")
+		if strings.EqualFold(connection.Version, "auto") {
+			connection.Version = ""
+		}
+	}
+	if flags.Changed("client-id") {
+		connection.ClientID, _ = flags.GetString("client-id")
+	}
+
+	durationFlags := map[string]*session.Duration{
+		"dial-timeout":     &connection.DialTimeout,
+		"request-timeout":  &connection.RequestTimeout,
+		"metadata-refresh": &connection.MetadataRefresh,
+	}
+	for name, target := range durationFlags {
+		if flags.Changed(name) {
+			value, _ := flags.GetDuration(name)
+			*target = session.Duration(value)
+		}
+	}
+
+	if noSASL, _ := flags.GetBool("no-sasl"); noSASL {
+		connection.SASL = nil
+	}
+	saslFlags := []string{"sasl-mechanism", "sasl-username", "sasl-password-env", "sasl-password-file"}
+	if slices.ContainsFunc(saslFlags, flags.Changed) {
+		if connection.SASL == nil {
+			connection.SASL = &session.SASLProfile{Mechanism: "PLAIN"}
+		}
+		targets := []*string{&connection.SASL.Mechanism, &connection.SASL.Username, &connection.SASL.PasswordEnv, &connection.SASL.PasswordFile}
+		for i, name := range saslFlags {
+			if flags.Changed(name) {
+				*targets[i], _ = flags.GetString(name)
+			}
+		}
+		connection.SASL.Mechanism = strings.ToUpper(connection.SASL.Mechanism)
+	}
+
+	if noTLS, _ := flags.GetBool("no-tls"); noTLS {
+		connection.TLS = nil
+	}
+	tlsFlags := []string{"tls", "tls-ca", "tls-cert", "tls-key", "tls-insecure"}
+	if slices.ContainsFunc(tlsFlags, flags.Changed) {
+		enabled := true
+		if flags.Changed("tls") {
+			enabled, _ = flags.GetBool("tls")
+		}
+		if !enabled {
+			connection.TLS = nil
+		} else {
+			if connection.TLS == nil {
+				connection.TLS = &session.TLSProfile{}
+			}
+			for name, target := range map[string]*string{"tls-ca": &connection.TLS.CAFile, "tls-cert": &connection.TLS.CertFile, "tls-key": &connection.TLS.KeyFile} {
+				if flags.Changed(name) {
+					*target, _ = flags.GetString(name)
+				}
+			}
+			if flags.Changed("tls-insecure") {
+				connection.TLS.InsecureSkipVerify, _ = flags.GetBool("tls-insecure")
+			}
+		}
+	}
+
+	if flags.Changed("output-format") {
+		connection.OutputFormat, _ = flags.GetString("output-format")
+	}
+	if flags.Changed("read-only") {
+		connection.ReadOnly, _ = flags.GetBool("read-only")
+	}
+
+	if flags.Changed("label") {
+		value, _ := flags.GetString("label")
+		labels, err := parseLabels(value)
+		if err != nil {
+			return err
+		}
+		if connection.Labels == nil {
+			connection.Labels = map[string]string{}
+		}
+		for key, value := range labels {
+			connection.Labels[key] = value
+		}
+	}
+	if flags.Changed("remove-label") {
+		keys, _ := flags.GetString("remove-label")
+		for _, key := range splitList(keys) {
+			delete(connection.Labels, key)
+		}
+	}
+	if len(connection.Labels) == 0 {
+		connection.Labels = nil
+	}
+	return nil
+}
+
+func addClusterProfile(cmd cobraCmd, args cobraArgs) {
+	connection := session.ClusterConnection{
+		Name: args[0],
+		// Profiles carry their own credentials, so there is no separate login step
+		IsAuthenticated: true,
+	}
+	if err := applyClusterProfileFlags(cmd, &connection); err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+
+	sessions := session.Default()
+	selectIt, _ := cmd.Flags().GetBool("select")
+	selectIt = selectIt || sessions.ActiveClusterName() == ""
+
+	if err := sessions.AddCluster(connection, selectIt); err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+
+	fmt.Printf("Added cluster connection: %s\n", connection.Name)
+	if selectIt {
+		fmt.Printf("Selected cluster: %s\n", connection.Name)
+	}
+}
+
+func editClusterProfile(cmd cobraCmd, args cobraArgs) {
+	clusterName := args[0]
+	err := session.Default().UpdateCluster(clusterName, func(connection *session.ClusterConnection) error {
+		return applyClusterProfileFlags(cmd, connection)
+	})
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	fmt.Printf("Updated cluster connection: %s\n", clusterName)
+}
+
+func renameClusterProfile(cmd cobraCmd, args cobraArgs) {
+	if err := session.Default().RenameCluster(args[0], args[1]); err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	fmt.Printf("Renamed cluster connection %s to %s\n", args[0], args[1])
+}
+
+func removeClusterProfile(cmd cobraCmd, args cobraArgs) {
+	if err := session.Default().RemoveCluster(args[0]); err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	fmt.Printf("Removed cluster connection: %s\n", args[0])
+}
+
+func exportClusterProfiles(cmd cobraCmd, args cobraArgs) {
+	path, _ := cmd.Flags().GetString("file")
+	format, _ := cmd.Flags().GetString("format")
+	if format == "" {
+		format = output.FormatForPath(path)
+	}
+	if format == "" {
+		format = output.YAML
+	}
+	includeSecrets, _ := cmd.Flags().GetBool("include-secrets")
+
+	document, err := session.Default().ExportClusters(args, includeSecrets)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+
+	if path == "" {
+		if err := output.Encode(os.Stdout, format, document); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	var buffer bytes.Buffer
+	if err := output.Encode(&buffer, format, document); err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	mode := os.FileMode(0644)
+	if len(document.Secrets) > 0 {
+		mode = 0600
+	}
+	if err := os.WriteFile(path, buffer.Bytes(), mode); err != nil {
+		fmt.Println("Error writing export:", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Exported %d cluster profile(s) to %s\n", len(document.Clusters), path)
+	if len(document.Secrets) > 0 {
+		fmt.Println("Warning: the export contains passwords; share it only over a secure channel")
+	}
+}
+
+func importClusterProfiles(cmd cobraCmd, args cobraArgs) {
+	path := args[0]
+	format, _ := cmd.Flags().GetString("format")
+	if format == "" {
+		format = output.FormatForPath(path)
+	}
+	if format == "" && strings.EqualFold(filepath.Ext(path), ".properties") {
+		format = "properties"
+	}
+	if format == "" {
+		fmt.Println("Error: cannot tell the format from the file name, use --format yaml, json or properties")
+		os.Exit(1)
+	}
+	includeSecrets, _ := cmd.Flags().GetBool("include-secrets")
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Println("Error reading import:", err)
+		os.Exit(1)
+	}
+
+	sessions := session.Default()
+	var document session.ProfileDocument
+	if format == "properties" {
+		name, _ := cmd.Flags().GetString("name")
+		if name == "" {
+			name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		}
+		properties, err := session.ParseProperties(bytes.NewReader(data))
+		if err != nil {
+			fmt.Println("Error reading properties:", err)
+			os.Exit(1)
+		}
+		connection, password, warnings, err := session.ProfileFromClientProperties(name, properties)
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		for _, warning := range warnings {
+			fmt.Println("Warning:", warning)
+		}
+		connection.Version, _ = cmd.Flags().GetString("kafka-version")
+		document.Clusters = []session.ClusterConnection{connection}
+		if password != "" {
+			document.Secrets = map[string]session.ProfileSecret{name: {SASLPassword: password}}
+		}
+	} else {
+		if err := output.Decode(data, format, &document); err != nil {
+			fmt.Println("Error decoding import:", err)
+			os.Exit(1)
+		}
+		if document.Version > session.ProfileDocumentVersion {
+			fmt.Printf("Error: the file has version %d, but this build only supports up to %d; upgrade ok\n",
+				document.Version, session.ProfileDocumentVersion)
+			os.Exit(1)
+		}
+	}
+
+	if len(document.Secrets) > 0 && !includeSecrets {
+		fmt.Println("Warning: ignoring the passwords in the file, use --include-secrets to import them")
+		document.Secrets = nil
+	}
+
+	result, err := sessions.ImportClusters(document.Clusters, document.Secrets)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	for _, name := range result.Added {
+		fmt.Printf("Added cluster connection: %s\n", name)
+	}
+	for _, name := range result.Updated {
+		fmt.Printf("Updated cluster connection: %s\n", name)
+	}
+	if sessions.ActiveClusterName() == "" && len(result.Added) > 0 {
+		sessions.SelectCluster(result.Added[0])
+	}
+}
+
+// parseLabels parses comma separated key=value pairs
+func parseLabels(value string) (map[string]string, error) {
+	labels := map[string]string{}
+	for _, pair := range splitList(value) {
+		key, val, ok := strings.Cut(pair, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid label '%s', use key=value", pair)
+		}
+		labels[key] = strings.TrimSpace(val)
+	}
+	return labels, nil
+}
+
+func formatLabels(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for key, value := range labels {
+		pairs = append(pairs, key+"="+value)
+	}
+	slices.Sort(pairs)
+	return strings.Join(pairs, "\n")
+}
+
+// splitList splits a comma separated flag value, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// Compare clusters
+
+func compareClusters(cmd cobraCmd, args cobraArgs) {
+	match, _ := cmd.Flags().GetString("match")
+	regex, _ := cmd.Flags().GetBool("regex")
+	includeInternal, _ := cmd.Flags().GetBool("include-internal")
+	skipACLs, _ := cmd.Flags().GetBool("skip-acls")
+	options := commands.ExportOptions{
+		Topics:     commands.TopicSelector{Pattern: match, Regex: regex, IncludeInternal: includeInternal},
+		SkipACLs:   skipACLs,
+		SkipGroups: true,
+	}
+
+	snapshots := make([]*commands.ClusterSnapshot, len(args))
+	for i, name := range args {
+		h, err := session.Default().Handle(cmd.Context(), name)
+		if err != nil {
+			fmt.Printf("Error connecting to cluster '%s': %v\n", name, err)
+			os.Exit(2)
+		}
+		snapshot, failure := commands.ExportCluster(cmd.Context(), h, options)
+		if failure != nil {
+			fmt.Printf("Error reading cluster '%s': %v\n", name, failure.Err)
+			os.Exit(2)
+		}
+		snapshots[i] = snapshot
+	}
+
+	comparison := commands.CompareSnapshots(snapshots[0], snapshots[1])
+	if !renderOutput(cmd, comparison) {
+		noColor, _ := cmd.Flags().GetBool("no-color")
+		if info, err := os.Stdout.Stat(); noColor || err != nil || info.Mode()&os.ModeCharDevice == 0 {
+			text.DisableColors()
+		}
+		printComparison(comparison)
+	}
+	if !comparison.InSync {
+		os.Exit(1)
+	}
+}
+
+// printComparison prints the differences like a unified diff of the left cluster against
+// the right one: - for what only the left has, + for what only the right has
+func printComparison(comparison *commands.ClusterComparison) {
+	removed, added, changed := text.Colors{text.FgRed}, text.Colors{text.FgGreen}, text.Colors{text.FgYellow}
+
+	for _, warning := range comparison.Warnings {
+		fmt.Println("Warning:", warning)
+	}
+	fmt.Println(removed.Sprintf("--- %s", comparison.Left))
+	fmt.Println(added.Sprintf("+++ %s", comparison.Right))
+	if comparison.InSync {
+		fmt.Println("\nThe clusters are in sync.")
+		return
+	}
+
+	if len(comparison.Topics) > 0 {
+		fmt.Println(text.Bold.Sprint("\nTopics:"))
+	}
+	for _, topic := range comparison.Topics {
+		switch topic.Presence {
+		case commands.PresenceLeft:
+			fmt.Println(removed.Sprintf("- %s (only in %s)", topic.Topic, comparison.Left))
+		case commands.PresenceRight:
+			fmt.Println(added.Sprintf("+ %s (only in %s)", topic.Topic, comparison.Right))
+		default:
+			fmt.Println(changed.Sprintf("~ %s", topic.Topic))
+			for _, field := range topic.Fields {
+				fmt.Printf("    %s: %s -> %s\n", field.Field, removed.Sprint(fieldValue(field.Left)), added.Sprint(fieldValue(field.Right)))
+			}
+		}
+	}
+
+	if len(comparison.ACLsLeft) > 0 || len(comparison.ACLsRight) > 0 {
+		fmt.Println(text.Bold.Sprint("\nACLs:"))
+	}
+	for _, acl := range comparison.ACLsLeft {
+		fmt.Println(removed.Sprintf("- %s", acl))
+	}
+	for _, acl := range comparison.ACLsRight {
+		fmt.Println(added.Sprintf("+ %s", acl))
+	}
+}
+
+func fieldValue(value *string) string {
+	if value == nil {
+		return "(default)"
+	}
+	return *value
 }
@@ -0,0 +1,196 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/IBM/openkommander/internal/core/commands"
+	"github.com/IBM/openkommander/pkg/audit"
+	"github.com/IBM/openkommander/pkg/cluster"
+	"github.com/IBM/openkommander/pkg/session"
+)
+
+// copyProgressInterval is how often a running copy prints how far it got
+const copyProgressInterval = 5 * time.Second
+
+func copyTopic(cmd cobraCmd, args cobraArgs) {
+	options, ok := copyOptions(cmd)
+	if !ok {
+		os.Exit(1)
+	}
+
+	var handles [2]*cluster.Handle
+	var topics [2]string
+	for i, ref := range args {
+		clusterName, topicName, ok := strings.Cut(ref, "/")
+		if !ok || clusterName == "" || topicName == "" {
+			fmt.Printf("Error: '%s' is not in the form CLUSTER/TOPIC\n", ref)
+			os.Exit(1)
+		}
+		h, err := session.Default().Handle(cmd.Context(), clusterName)
+		if err != nil {
+			fmt.Printf("Error connecting to cluster '%s': %v\n", clusterName, err)
+			os.Exit(1)
+		}
+		handles[i], topics[i] = h, topicName
+	}
+	source, target := handles[0], handles[1]
+
+	if failure := commands.CheckWritable(cmd.Context(), target); failure != nil {
+		fmt.Println("Error:", failure.Err)
+		os.Exit(1)
+	}
+	if isProduction(target) && !confirmTyped(cmd,
+		fmt.Sprintf("Cluster '%s' is a production cluster. Type the topic name to copy messages into '%s': ", target.Name, topics[1]),
+		topics[1], "the topic name") {
+		os.Exit(1)
+	}
+
+	format, err := outputFormat(cmd)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	structured := format != session.OutputTable
+	if !structured {
+		last := time.Now()
+		options.Progress = func(copied int64) {
+			if time.Since(last) >= copyProgressInterval {
+				last = time.Now()
+				fmt.Printf("Copied %d messages...\n", copied)
+			}
+		}
+	}
+
+	report, failure := commands.CopyTopic(cmd.Context(), source, topics[0], target, topics[1], options)
+	recordClusterAudit(target.Name, audit.OpTopicCopy, topics[1], failure, map[string]any{
+		"source": args[0],
+		"copied": copiedCount(report),
+	})
+	if report != nil && !renderOutput(cmd, report) {
+		printCopyReport(report)
+	}
+	if failure != nil {
+		// Keep the structured report on stdout parseable
+		out := os.Stdout
+		if structured {
+			out = os.Stderr
+		}
+		fmt.Fprintln(out, "Error:", failure.Err)
+		if options.Checkpoint != "" && report != nil {
+			fmt.Fprintf(out, "Run the command again with --checkpoint %s to resume.\n", options.Checkpoint)
+		}
+		os.Exit(1)
+	}
+	if !structured {
+		fmt.Printf("Copied %d messages from %s to %s\n", report.Copied, args[0], args[1])
+	}
+}
+
+// copyOptions reads the copy flags, printing the error when they are invalid
+func copyOptions(cmd cobraCmd) (commands.CopyOptions, bool) {
+	options := commands.CopyOptions{}
+	flags := cmd.Flags()
+	var ok bool
+
+	if value, _ := flags.GetString("partition-map"); value != "" {
+		mapping, err := commands.ParsePartitionMap(value)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return options, false
+		}
+		options.PartitionMap = mapping
+	}
+	options.Repartition, _ = flags.GetBool("repartition")
+	if options.Repartition && options.PartitionMap != nil {
+		fmt.Println("Error: --partition-map and --repartition cannot be combined")
+		return options, false
+	}
+
+	if options.OffsetRange, ok = offsetRange(cmd); !ok {
+		return options, false
+	}
+	if options.RateLimit, ok = rateLimit(cmd); !ok {
+		return options, false
+	}
+	options.Checkpoint, _ = flags.GetString("checkpoint")
+	return options, true
+}
+
+// rangeFlags select the messages read from every partition of a topic
+func rangeFlags(verb string) []OkFlag {
+	return []OkFlag{
+		NewOkFlag(OkFlagInt, "start-offset", "", fmt.Sprintf("[optional] first offset to %s from every partition, -1 for the oldest", verb), -1),
+		NewOkFlag(OkFlagInt, "end-offset", "", "[optional] offset at which to stop in every partition, exclusive, -1 for the newest", -1),
+		NewOkFlag(OkFlagString, "start-time", "", fmt.Sprintf("[optional] %s messages from this RFC 3339 time, such as 2024-05-01T12:00:00Z", verb)),
+		NewOkFlag(OkFlagString, "end-time", "", fmt.Sprintf("[optional] %s messages older than this RFC 3339 time", verb)),
+	}
+}
+
+// offsetRange reads the rangeFlags, printing the error when they are invalid
+func offsetRange(cmd cobraCmd) (commands.OffsetRange, bool) {
+	r := commands.OffsetRange{}
+	flags := cmd.Flags()
+	startOffset, _ := flags.GetInt("start-offset")
+	endOffset, _ := flags.GetInt("end-offset")
+	r.StartOffset, r.EndOffset = int64(startOffset), int64(endOffset)
+	for _, bound := range []struct {
+		flag, offsetFlag string
+		t                *time.Time
+	}{{"start-time", "start-offset", &r.StartTime}, {"end-time", "end-offset", &r.EndTime}} {
+		value, _ := flags.GetString(bound.flag)
+		if value == "" {
+			continue
+		}
+		if flags.Changed(bound.offsetFlag) {
+			fmt.Printf("Error: --%s and --%s cannot be combined\n", bound.flag, bound.offsetFlag)
+			return r, false
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			fmt.Printf("Error: --%s must be an RFC 3339 time such as 2024-05-01T12:00:00Z: %v\n", bound.flag, err)
+			return r, false
+		}
+		*bound.t = t
+	}
+	return r, true
+}
+
+// rateLimit reads the --rate flag, printing the error when it is invalid
+func rateLimit(cmd cobraCmd) (float64, bool) {
+	rate, _ := cmd.Flags().GetString("rate")
+	if rate == "" {
+		return 0, true
+	}
+	perSecond, err := strconv.ParseFloat(rate, 64)
+	if err != nil || perSecond <= 0 {
+		fmt.Printf("Error: --rate must be a positive number of messages per second, got '%s'\n", rate)
+		return 0, false
+	}
+	return perSecond, true
+}
+
+func copiedCount(report *commands.CopyReport) int64 {
+	if report == nil {
+		return 0
+	}
+	return report.Copied
+}
+
+func printCopyReport(report *commands.CopyReport) {
+	if report.Resumed {
+		fmt.Println("Resumed from checkpoint.")
+	}
+	rows := make([][]interface{}, 0, len(report.Partitions))
+	for _, partition := range report.Partitions {
+		target := "by key"
+		if partition.TargetPartition >= 0 {
+			target = strconv.Itoa(int(partition.TargetPartition))
+		}
+		rows = append(rows, []interface{}{partition.Partition, target, partition.StartOffset, partition.EndOffset, partition.Copied, partition.Skipped})
+	}
+	RenderTable("Copied Partitions:", []string{"Partition", "Target Partition", "Start Offset", "End Offset", "Copied", "Skipped"}, rows)
+}
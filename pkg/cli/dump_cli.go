@@ -0,0 +1,150 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/IBM/openkommander/internal/core/commands"
+	"github.com/IBM/openkommander/pkg/audit"
+	"github.com/IBM/openkommander/pkg/cluster"
+)
+
+func dumpTopic(cmd cobraCmd, args cobraArgs) {
+	topicName := args[0]
+	path, _ := cmd.Flags().GetString("file")
+	format, _ := cmd.Flags().GetString("format")
+	if format == "" {
+		format = commands.DumpFormatForPath(path)
+	}
+	noCompress, _ := cmd.Flags().GetBool("no-compress")
+	r, ok := offsetRange(cmd)
+	if !ok {
+		os.Exit(1)
+	}
+
+	h, ok := currentCluster(cmd)
+	if !ok {
+		os.Exit(1)
+	}
+	options := commands.DumpOptions{OffsetRange: r, Format: format, Uncompressed: noCompress}
+
+	if path == "" || path == "-" {
+		if _, failure := commands.DumpTopic(cmd.Context(), h, topicName, os.Stdout, options); failure != nil {
+			fmt.Fprintln(os.Stderr, "Error:", failure.Err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	report, err := dumpToFile(cmd, h, topicName, path, options)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+
+	if !renderOutput(cmd, report) {
+		fmt.Printf("Dumped %d records of topic '%s' to %s\n", report.Records, topicName, path)
+		var skipped int64
+		for _, partition := range report.Partitions {
+			skipped += partition.Skipped
+		}
+		printSkipped(skipped)
+	}
+}
+
+// dumpToFile writes the dump next to path and renames it into place, so a failed dump
+// leaves no partial file behind. It returns instead of exiting so the temporary file is
+// always removed.
+func dumpToFile(cmd cobraCmd, h *cluster.Handle, topicName, path string, options commands.DumpOptions) (*commands.DumpReport, error) {
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return nil, fmt.Errorf("could not create the dump file: %w", err)
+	}
+	defer func() { _ = os.Remove(file.Name()) }()
+
+	report, failure := commands.DumpTopic(cmd.Context(), h, topicName, file, options)
+	if closeErr := file.Close(); failure == nil && closeErr != nil {
+		return nil, fmt.Errorf("could not write the dump file: %w", closeErr)
+	}
+	if failure != nil {
+		return nil, failure.Err
+	}
+	if err := os.Rename(file.Name(), path); err != nil {
+		return nil, fmt.Errorf("could not write the dump file: %w", err)
+	}
+	return report, nil
+}
+
+func restoreTopic(cmd cobraCmd, args cobraArgs) {
+	path := args[0]
+	topicName := cmd.Flags().Arg(1)
+	repartition, _ := cmd.Flags().GetBool("repartition")
+	rate, ok := rateLimit(cmd)
+	if !ok {
+		os.Exit(1)
+	}
+
+	var input io.Reader = os.Stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			fmt.Println("Error reading dump file:", err)
+			os.Exit(1)
+		}
+		defer func() { _ = file.Close() }()
+		input = file
+	}
+
+	if topicName == "" {
+		if path == "-" {
+			fmt.Println("Error: the topic to restore into is required when reading standard input")
+			os.Exit(1)
+		}
+		header, err := commands.ReadDumpHeader(input)
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		topicName = header.Topic
+		if _, err := input.(*os.File).Seek(0, io.SeekStart); err != nil {
+			fmt.Println("Error reading dump file:", err)
+			os.Exit(1)
+		}
+	}
+
+	h, ok := currentCluster(cmd)
+	if !ok {
+		os.Exit(1)
+	}
+	if path == "-" && isProduction(h) && !cmd.Flags().Changed("confirm") {
+		// Standard input is the dump, so it cannot also answer the prompt
+		fmt.Printf("Error: cluster '%s' is a production cluster; confirm a restore from standard input with --confirm %s\n", h.Name, topicName)
+		os.Exit(1)
+	}
+	if !confirmOnProduction(cmd, h, "restore records into", topicName) {
+		os.Exit(1)
+	}
+
+	report, failure := commands.RestoreTopic(cmd.Context(), h, topicName, input, commands.RestoreOptions{Repartition: repartition, RateLimit: rate})
+	var restored int64
+	if report != nil {
+		restored = report.Records
+	}
+	recordAudit(audit.OpTopicRestore, topicName, failure, map[string]any{
+		"file":    path,
+		"records": restored,
+	})
+	if failure != nil {
+		if restored > 0 {
+			fmt.Printf("Restored %d records before the error.\n", restored)
+		}
+		fmt.Println("Error:", failure.Err)
+		os.Exit(1)
+	}
+
+	if !renderOutput(cmd, report) {
+		fmt.Printf("Restored %d records from %s into topic '%s'\n", report.Records, report.Source, report.Topic)
+	}
+}
@@ -0,0 +1,64 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"github.com/IBM/openkommander/internal/core/commands"
+	"github.com/IBM/openkommander/pkg/output"
+)
+
+func exportCluster(cmd cobraCmd, args cobraArgs) {
+	path, _ := cmd.Flags().GetString("file")
+	format, _ := cmd.Flags().GetString("format")
+	if format == "" {
+		format = output.FormatForPath(path)
+	}
+	if format == "" {
+		format = output.YAML
+	}
+	match, _ := cmd.Flags().GetString("match")
+	regex, _ := cmd.Flags().GetBool("regex")
+	includeInternal, _ := cmd.Flags().GetBool("include-internal")
+	skipACLs, _ := cmd.Flags().GetBool("skip-acls")
+	skipGroups, _ := cmd.Flags().GetBool("skip-groups")
+
+	h, ok := currentCluster(cmd)
+	if !ok {
+		os.Exit(1)
+	}
+
+	snapshot, failure := commands.ExportCluster(cmd.Context(), h, commands.ExportOptions{
+		Topics:     commands.TopicSelector{Pattern: match, Regex: regex, IncludeInternal: includeInternal},
+		SkipACLs:   skipACLs,
+		SkipGroups: skipGroups,
+	})
+	if failure != nil {
+		fmt.Println("Error:", failure.Err)
+		os.Exit(1)
+	}
+
+	if path == "" {
+		if err := output.Encode(os.Stdout, format, snapshot); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	var buffer bytes.Buffer
+	if err := output.Encode(&buffer, format, snapshot); err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	if err := os.WriteFile(path, buffer.Bytes(), 0644); err != nil {
+		fmt.Println("Error writing snapshot:", err)
+		os.Exit(1)
+	}
+	for _, warning := range snapshot.Warnings {
+		fmt.Println("Warning:", warning)
+	}
+	fmt.Printf("Exported %d topics, %d ACLs and %d consumer groups of cluster '%s' to %s\n",
+		len(snapshot.Topics), len(snapshot.ACLs), len(snapshot.ConsumerGroups), h.Name, path)
+}
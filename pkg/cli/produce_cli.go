@@ -40,7 +40,12 @@ func produceMessage(cmd cobraCmd, args cobraArgs) {
 	msg, _ := cmd.Flags().GetString("msg")
 	key, _ := cmd.Flags().GetString("key")
 
-	successMessage, failure := commands.ProduceMessage(topic, key, msg, partition, acks)
+	h, ok := currentCluster(cmd)
+	if !ok {
+		return
+	}
+
+	successMessage, failure := commands.ProduceMessage(cmd.Context(), h, topic, key, msg, partition, acks)
 	if failure != nil {
 		fmt.Println(failure.Err)
 		return
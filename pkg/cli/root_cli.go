@@ -1,9 +1,11 @@
 package cli
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/IBM/openkommander/internal/core/commands"
+	"github.com/IBM/openkommander/pkg/cluster"
 	"github.com/IBM/openkommander/pkg/session"
 	"github.com/IBM/sarama"
 )
@@ -16,6 +18,13 @@ func (RootCommandList) GetParentCommand() *OkParentCmd {
 		Short: "OpenKommander - A CLI tool for Apache Kafka management",
 		Long: `OpenKommander is a command line utility for Apache Kafka compatible brokers.
 				Complete documentation is available at https://github.com/IBM/openkommander`,
+		PersistentFlags: []OkFlag{
+			NewOkFlag(OkFlagDuration, "timeout", "", "[optional] abort the command's Kafka operations after this long, e.g. 30s (default no limit)"),
+			NewOkFlag(OkFlagString, "output", "", "[optional] output format: table, json or yaml (default from the cluster profile, else table)"),
+			NewOkFlag(OkFlagBool, "read-only", "", "[optional] refuse every operation that would change a cluster"),
+		},
+		PersistentPreRun:  prepareContext,
+		PersistentPostRun: releaseTimeout,
 	}
 }
 
@@ -45,6 +54,72 @@ func (RootCommandList) GetCommands() []*OkCmd {
 			Short: "Display cluster information",
 			Run:   getClusterMetadata,
 		},
+		{ // Diff topics against a spec
+			Use:   "diff -f <file>",
+			Short: "Show how the topics of the cluster differ from a YAML or JSON spec",
+			Long: `Compare the topics listed in a YAML or JSON file with the active cluster and show the
+changes 'ok apply' would make: topics to create, partition counts to raise and configs to
+set or reset. Differences that cannot be applied, such as fewer partitions or another
+replication factor, are reported as warnings.
+
+The file lists the desired topics:
+
+  topics:
+    - name: orders
+      partitions: 12
+      replication_factor: 3
+      configs:
+        retention.ms: 604800000
+        cleanup.policy: delete
+
+The configs of a topic are the complete set of its overrides; configs set on the cluster
+but missing from the file are reset to the broker default.`,
+			Run: diffTopics,
+			Flags: append(specFlags(),
+				NewOkFlag(OkFlagBool, "exit-code", "", "[optional] exit with status 1 when there are changes"),
+			),
+			RequiredFlags: []string{"file"},
+		},
+		{ // Apply a topic spec
+			Use:   "apply -f <file>",
+			Short: "Create and update topics to match a YAML or JSON spec",
+			Long: `Bring the topics of the active cluster in line with a YAML or JSON file, as shown by
+'ok diff': create missing topics, raise partition counts and replace topic configs. With
+--prune, topics that are not in the file are deleted; internal topics are never deleted.
+
+The plan is shown and must be confirmed first. On clusters labelled env=prod the cluster
+name must be typed to confirm, or given with --confirm. With --output json or yaml there is no
+prompt: --yes or --confirm is required, and the plan and the results are printed as one
+document.`,
+			Run: applyTopics,
+			Flags: append(specFlags(),
+				NewOkFlag(OkFlagBool, "yes", "y", "[optional] skip the confirmation prompt, except on production clusters"),
+				NewOkFlag(OkFlagString, "confirm", "", "[optional] cluster name, confirming the changes on a production cluster without a prompt"),
+			),
+			RequiredFlags: []string{"file"},
+		},
+		{ // Export a cluster snapshot
+			Use:   "export",
+			Short: "Write the topics, ACLs and consumer group offsets of the cluster to a YAML or JSON snapshot",
+			Long: `Capture the state of the active cluster: every topic with its partition count,
+replication factor and non-default configs, the ACLs, and the committed offsets of the
+consumer groups in the exported topics.
+
+The topics use the format of 'ok apply', so 'ok apply -f snapshot.yaml' re-creates them
+on another cluster. ACLs that cannot be read, for example because the cluster has no
+authorizer, are left out with a warning. Internal topics are only exported with
+--include-internal.`,
+			Run: exportCluster,
+			Flags: []OkFlag{
+				NewOkFlag(OkFlagString, "file", "f", "[optional] file to write, standard output when not set"),
+				NewOkFlag(OkFlagString, "format", "", "[optional] yaml or json, guessed from the file extension (default yaml)"),
+				NewOkFlag(OkFlagString, "match", "m", "[optional] only export topics matching a glob such as 'orders-*'"),
+				NewOkFlag(OkFlagBool, "regex", "", "[optional] treat --match as a regular expression that must match the whole topic name"),
+				NewOkFlag(OkFlagBool, "include-internal", "", "[optional] also export internal topics such as __consumer_offsets"),
+				NewOkFlag(OkFlagBool, "skip-acls", "", "[optional] leave the ACLs out of the snapshot"),
+				NewOkFlag(OkFlagBool, "skip-groups", "", "[optional] leave the consumer group offsets out of the snapshot"),
+			},
+		},
 	}
 }
 
@@ -55,11 +130,12 @@ func (RootCommandList) GetSubcommands() []CommandList {
 		&BrokerCommandList{},
 		&ProduceCommandList{},
 		&ClusterCommandList{},
+		&AuditCommandList{},
 	}
 }
 
 func login(cmd cobraCmd, args cobraArgs) {
-	session.Login()
+	session.Default().Login(cmd.Context())
 }
 
 func logout(cmd cobraCmd, args cobraArgs) {
@@ -67,19 +143,19 @@ func logout(cmd cobraCmd, args cobraArgs) {
 	if len(args) > 0 {
 		clusterName = args[0]
 	}
-	session.Logout(clusterName)
+	session.Default().Logout(clusterName)
 }
 
 func getSessionInfo(cmd cobraCmd, args cobraArgs) {
-	session.DisplaySession()
+	session.Default().DisplaySession()
 }
 
 func getClusterMetadata(cmd cobraCmd, args cobraArgs) {
-	client, validateFailure := commands.GetClient()
-	if validateFailure != nil {
-		fmt.Print(validateFailure.Err)
+	h, ok := currentCluster(cmd)
+	if !ok {
 		return
 	}
+	client := h.Client
 
 	brokers := client.Brokers()
 
@@ -98,3 +174,42 @@ func getClusterMetadata(cmd cobraCmd, args cobraArgs) {
 	}
 	RenderTable("Cluster Brokers:", brokerHeaders, brokerRows)
 }
+
+// prepareContext sets up the context every command passes to the command layer: bounded
+// by --timeout and marked read-only by --read-only
+func prepareContext(cmd cobraCmd, args cobraArgs) {
+	applyTimeout(cmd, args)
+	if readOnly, _ := cmd.Flags().GetBool("read-only"); readOnly {
+		cmd.SetContext(commands.WithReadOnly(cmd.Context()))
+	}
+}
+
+// cancelTimeout releases the deadline set by applyTimeout
+var cancelTimeout context.CancelFunc = func() {}
+
+// applyTimeout bounds the context of the running command by --timeout. Commands pass
+// cmd.Context() down to every Kafka call, so the deadline and Ctrl-C both abort them.
+func applyTimeout(cmd cobraCmd, args cobraArgs) {
+	timeout, _ := cmd.Flags().GetDuration("timeout")
+	if timeout <= 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(cmd.Context(), timeout)
+	cmd.SetContext(ctx)
+	cancelTimeout = cancel
+}
+
+func releaseTimeout(cmd cobraCmd, args cobraArgs) {
+	cancelTimeout()
+}
+
+// currentCluster returns a handle on the active cluster of the session, printing the
+// failure when there is none
+func currentCluster(cmd cobraCmd) (*cluster.Handle, bool) {
+	h, failure := commands.CurrentCluster(cmd.Context(), session.Default())
+	if failure != nil {
+		fmt.Println(failure.Err)
+		return nil, false
+	}
+	return h, true
+}
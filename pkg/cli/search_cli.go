@@ -0,0 +1,96 @@
+package cli
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/IBM/openkommander/internal/core/commands"
+	"github.com/IBM/openkommander/pkg/session"
+)
+
+// defaultSearchLimit is how many matches a search returns unless told otherwise
+const defaultSearchLimit = 100
+
+func searchTopic(cmd cobraCmd, args cobraArgs) {
+	topicName := args[0]
+	flags := cmd.Flags()
+	options := commands.SearchOptions{}
+	options.Filter.Key, _ = flags.GetString("key")
+	options.Filter.Contains, _ = flags.GetString("contains")
+	options.Filter.Regex, _ = flags.GetString("regex")
+	options.Filter.JSONPath, _ = flags.GetString("json-path")
+	options.Filter.Header, _ = flags.GetString("header")
+	options.Limit, _ = flags.GetInt("limit")
+	var ok bool
+	if options.OffsetRange, ok = offsetRange(cmd); !ok {
+		os.Exit(1)
+	}
+
+	format, err := outputFormat(cmd)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	h, ok := currentCluster(cmd)
+	if !ok {
+		os.Exit(1)
+	}
+
+	// Print matches as they are found, unless they are rendered together as JSON or YAML
+	result := &commands.SearchResult{Records: []*commands.Record{}}
+	emit := func(record *commands.Record) error {
+		if format != session.OutputTable {
+			result.Records = append(result.Records, record)
+			return nil
+		}
+		printRecord(record)
+		return nil
+	}
+
+	summary, failure := commands.SearchTopic(cmd.Context(), h, topicName, options, emit)
+	if failure != nil {
+		fmt.Println("Error:", failure.Err)
+		os.Exit(1)
+	}
+	result.SearchSummary = *summary
+	if renderOutput(cmd, result) {
+		return
+	}
+	fmt.Printf("Found %d matches in %d records scanned\n", summary.Matches, summary.Scanned)
+	if summary.LimitReached {
+		fmt.Printf("Stopped after %d matches; raise --limit for more.\n", options.Limit)
+	}
+	printSkipped(summary.Skipped)
+}
+
+// printSkipped warns about offsets at the end of a range no message arrived for
+func printSkipped(skipped int64) {
+	if skipped > 0 {
+		fmt.Printf("Warning: no message arrived for the last %d offsets of the range; they are taken as compacted or transaction markers.\n", skipped)
+	}
+}
+
+func printRecord(record *commands.Record) {
+	line := fmt.Sprintf("partition %d offset %d at %s key=%s", record.Partition, record.Offset,
+		record.Timestamp.UTC().Format(time.RFC3339Nano), recordText(record.Key, record.KeyBase64))
+	for _, header := range record.Headers {
+		line += fmt.Sprintf(" %s=%s", header.Key, recordText(header.Value, header.ValueBase64))
+	}
+	fmt.Println(line)
+	fmt.Println("  " + strings.ReplaceAll(recordText(record.Value, record.ValueBase64), "\n", "\n  "))
+}
+
+// recordText shows a key or value as text, in base64 when it is not text, or as <null>
+func recordText(text *string, data []byte) string {
+	switch {
+	case text != nil:
+		return *text
+	case data != nil:
+		return "base64:" + base64.StdEncoding.EncodeToString(data)
+	default:
+		return "<null>"
+	}
+}
@@ -2,8 +2,10 @@ package cli
 
 import (
 	"fmt"
-	"strconv"
+	"strings"
+	"time"
 
+	"github.com/IBM/openkommander/pkg/constants"
 	"github.com/IBM/openkommander/pkg/logger"
 	"github.com/IBM/openkommander/pkg/rest"
 	"github.com/spf13/cobra"
@@ -23,9 +25,29 @@ func (ServerCommandList) GetCommands() []*OkCmd {
 		{
 			Use:   "start",
 			Short: "Start the REST server",
-			Run:   startRESTServer,
+			Long: `Start the REST server.
+
+Settings are read from the server config file (default ~/.ok/server.json) and any flag given
+on the command line overrides the value from the file. On SIGINT or SIGTERM the server stops
+accepting connections and drains in-flight requests for up to the shutdown timeout.`,
+			Run: startRESTServer,
 			Flags: []OkFlag{
-				NewOkFlag(OkFlagString, "port", "p", "Specify the port for the REST server"),
+				NewOkFlag(OkFlagString, "config", "c", "[optional] path to the server config file", constants.OpenKommanderServerFilename),
+				NewOkFlag(OkFlagString, "port", "p", "[optional] port for the REST server (default 8081)"),
+				NewOkFlag(OkFlagString, "bind", "b", "[optional] address to bind to (default all interfaces)"),
+				NewOkFlag(OkFlagString, "tls-cert", "", "[optional] TLS certificate file, enables HTTPS together with --tls-key"),
+				NewOkFlag(OkFlagString, "tls-key", "", "[optional] TLS private key file"),
+				NewOkFlag(OkFlagString, "read-timeout", "", "[optional] maximum duration for reading a request, e.g. 30s"),
+				NewOkFlag(OkFlagString, "write-timeout", "", "[optional] maximum duration for writing a response, e.g. 60s"),
+				NewOkFlag(OkFlagString, "idle-timeout", "", "[optional] maximum time to keep idle connections open, e.g. 120s"),
+				NewOkFlag(OkFlagString, "shutdown-timeout", "", "[optional] maximum time to drain in-flight requests on shutdown, e.g. 15s"),
+				NewOkFlag(OkFlagInt, "max-body-bytes", "", "[optional] maximum request body size in bytes"),
+				NewOkFlag(OkFlagString, "cors-origins", "", "[optional] comma separated origins allowed to call the API, or *"),
+				NewOkFlag(OkFlagString, "trusted-proxies", "", "[optional] comma separated IP addresses or CIDR ranges of proxies trusted to name the caller in the audit log"),
+				NewOkFlag(OkFlagString, "frontend-dir", "", "[optional] directory to serve the frontend from"),
+				NewOkFlag(OkFlagBool, "persist-samples", "", "[optional] persist throughput samples so rate history survives restarts"),
+				NewOkFlag(OkFlagBool, "validate-requests", "", "[optional] reject API requests that do not match the OpenAPI spec (default true)"),
+				NewOkFlag(OkFlagBool, "validate-responses", "", "[optional] log API responses that do not match the OpenAPI spec"),
 			},
 		},
 	}
@@ -36,37 +58,98 @@ func (ServerCommandList) GetSubcommands() []CommandList {
 }
 
 func startRESTServer(cmd *cobra.Command, args []string) {
-	port, _ := cmd.Flags().GetString("port")
+	configPath, _ := cmd.Flags().GetString("config")
+	config, err := rest.LoadServerConfig(configPath)
+	if err != nil {
+		logger.Error("Invalid server config", "error", err)
+		return
+	}
 
-	if port == "" {
-		fmt.Print("Enter port for the REST server: ")
-		if _, err := fmt.Scanln(&port); err != nil {
-			fmt.Println("Error reading port number:", err)
-			return
-		}
+	if err := applyServerFlags(cmd, config); err != nil {
+		logger.Error("Invalid server flag", "error", err)
+		return
 	}
 
-	if err := validatePort(port); err != nil {
-		logger.Error("Invalid port", "error", err)
+	if err := config.Validate(); err != nil {
+		logger.Error("Invalid server config", "error", err)
 		return
 	}
 
-	rest.StartRESTServer(port)
+	rest.StartRESTServer(config)
 }
 
-func validatePort(port string) error {
-	if port == "" || port == "0" {
-		return fmt.Errorf("port number is required and cannot be 0")
+// applyServerFlags overrides config values with the flags set on the command line
+func applyServerFlags(cmd *cobra.Command, config *rest.ServerConfig) error {
+	flags := cmd.Flags()
+
+	stringFlags := map[string]*string{
+		"port":         &config.Port,
+		"bind":         &config.BindAddress,
+		"tls-cert":     &config.TLSCertFile,
+		"tls-key":      &config.TLSKeyFile,
+		"frontend-dir": &config.FrontendDir,
+	}
+	for name, target := range stringFlags {
+		if flags.Changed(name) {
+			*target, _ = flags.GetString(name)
+		}
 	}
 
-	portNumber, err := strconv.Atoi(port)
-	if err != nil {
-		return fmt.Errorf("invalid port number: %s", port)
+	durationFlags := map[string]*rest.Duration{
+		"read-timeout":     &config.ReadTimeout,
+		"write-timeout":    &config.WriteTimeout,
+		"idle-timeout":     &config.IdleTimeout,
+		"shutdown-timeout": &config.ShutdownTimeout,
+	}
+	for name, target := range durationFlags {
+		if !flags.Changed(name) {
+			continue
+		}
+		value, _ := flags.GetString(name)
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid --%s '%s': %w", name, value, err)
+		}
+		target.Duration = parsed
+	}
+
+	if flags.Changed("max-body-bytes") {
+		maxBodyBytes, _ := flags.GetInt("max-body-bytes")
+		config.MaxBodyBytes = int64(maxBodyBytes)
 	}
 
-	if portNumber < 1 || portNumber > 65535 {
-		return fmt.Errorf("port number must be between 1 and 65535")
+	if flags.Changed("cors-origins") {
+		origins, _ := flags.GetString("cors-origins")
+		config.CORSOrigins = nil
+		for _, origin := range strings.Split(origins, ",") {
+			if origin = strings.TrimSpace(origin); origin != "" {
+				config.CORSOrigins = append(config.CORSOrigins, origin)
+			}
+		}
 	}
 
+	if flags.Changed("trusted-proxies") {
+		proxies, _ := flags.GetString("trusted-proxies")
+		config.TrustedProxies = nil
+		for _, proxy := range strings.Split(proxies, ",") {
+			if proxy = strings.TrimSpace(proxy); proxy != "" {
+				config.TrustedProxies = append(config.TrustedProxies, proxy)
+			}
+		}
+	}
+
+	if flags.Changed("persist-samples") {
+		config.PersistSamples, _ = flags.GetBool("persist-samples")
+	}
+	if flags.Changed("validate-requests") {
+		config.ValidateRequests, _ = flags.GetBool("validate-requests")
+	}
+	if flags.Changed("validate-responses") {
+		config.ValidateResponses, _ = flags.GetBool("validate-responses")
+	}
+	// The global --read-only flag also puts the server in read-only mode
+	if flags.Changed("read-only") {
+		config.ReadOnly, _ = flags.GetBool("read-only")
+	}
 	return nil
 }
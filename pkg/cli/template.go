@@ -3,7 +3,11 @@ package cli
 import (
 	"fmt"
 	"os"
+	"slices"
+	"strings"
 
+	"github.com/IBM/openkommander/pkg/output"
+	"github.com/IBM/openkommander/pkg/session"
 	"github.com/jedib0t/go-pretty/v6/table"
 )
 
@@ -30,3 +34,43 @@ func RenderTable(title string, headers []string, rows [][]interface{}) {
 	t.SetStyle(table.StyleLight)
 	t.Render()
 }
+
+// outputFormat returns the format selected with --output, falling back to the default
+// output format of the active cluster profile and then to tables
+func outputFormat(cmd cobraCmd) (string, error) {
+	format, _ := cmd.Flags().GetString("output")
+	if format == "" {
+		if connection, ok := session.Default().ClusterByName(session.Default().ActiveClusterName()); ok {
+			format = connection.OutputFormat
+		}
+	}
+	if format == "" {
+		return session.OutputTable, nil
+	}
+	if !slices.Contains(session.OutputFormats, format) {
+		return "", fmt.Errorf("invalid output format '%s', use one of %s", format, strings.Join(session.OutputFormats, ", "))
+	}
+	return format, nil
+}
+
+// RenderStructured prints value as JSON or YAML, for scripts that consume command output
+func RenderStructured(format string, value any) error {
+	return output.Encode(os.Stdout, format, value)
+}
+
+// renderOutput prints value in the selected structured format and reports whether it did.
+// When it returns false the caller renders its tables.
+func renderOutput(cmd cobraCmd, value any) bool {
+	format, err := outputFormat(cmd)
+	if err != nil {
+		fmt.Println("Error:", err)
+		return true
+	}
+	if format == session.OutputTable {
+		return false
+	}
+	if err := RenderStructured(format, value); err != nil {
+		fmt.Println("Error rendering output:", err)
+	}
+	return true
+}
@@ -1,10 +1,17 @@
 package cli
 
 import (
+	"bufio"
 	"fmt"
+	"os"
 	"sort"
+	"strings"
+	"time"
 
 	"github.com/IBM/openkommander/internal/core/commands"
+	"github.com/IBM/openkommander/pkg/audit"
+	"github.com/IBM/openkommander/pkg/cluster"
+	"github.com/IBM/openkommander/pkg/session"
 	"github.com/spf13/cobra"
 )
 
@@ -31,9 +38,18 @@ func (m TopicCommandList) GetCommands() []*OkCmd {
 		},
 		{ // Delete topic
 			Use:   "delete [TOPIC NAME]",
-			Short: "Delete a topic",
+			Short: "Delete a topic, or every topic matching --match",
+			Long: `Delete a topic, or every topic matching --match.
+
+With --match the matching topics are listed and must be confirmed before they are deleted
+concurrently. Internal topics such as __consumer_offsets are only matched with
+--include-internal.
+
+On clusters labelled env=prod the topic name, or the --match pattern, must be typed to
+confirm, or given with --confirm.`,
 			Run:   deleteTopic,
-			Args:  cobra.ExactArgs(1),
+			Args:  cobra.MaximumNArgs(1),
+			Flags: append(bulkFlags(), confirmFlag()),
 		},
 		{ // List topics
 			Use:   "list",
@@ -46,15 +62,122 @@ func (m TopicCommandList) GetCommands() []*OkCmd {
 			Run:   describeTopic,
 			Args:  cobra.ExactArgs(1),
 		},
+		{ // Topic offsets
+			Use:   "offsets [TOPIC NAME]",
+			Short: "Show the earliest and latest offset and message count of every partition",
+			Long: `Show the earliest and latest offset of every partition of a topic and the number of
+messages between them. Compacted and transactional topics hold fewer messages than counted.
+
+With --at the offset of the first message written at or after that time is shown for every
+partition, or the latest offset when there is none, for example to find where to start
+reading or resetting a consumer group.`,
+			Run:  topicOffsets,
+			Args: cobra.ExactArgs(1),
+			Flags: []OkFlag{
+				NewOkFlag(OkFlagString, "at", "", "[optional] RFC 3339 time to find the offset of, e.g. 2024-05-01T12:00:00Z"),
+			},
+		},
 		{ // Update topic
 			Use:   "update [TOPIC NAME]",
-			Short: "Update an existing topic to create new partitions",
+			Short: "Update an existing topic, or every topic matching --match, to create new partitions",
 			Run:   updateTopic,
-			Flags: []OkFlag{
+			Long: `Update an existing topic to create new partitions. Partitions cannot be removed again.
+
+With --match every matching topic is updated concurrently after the list has been confirmed.
+Internal topics are only matched with --include-internal.
+
+On clusters labelled env=prod the topic name, or the --match pattern, must be typed to
+confirm, or given with --confirm.`,
+			Flags: append([]OkFlag{
 				NewOkFlag(OkFlagInt, "new-partitions", "p", "Specify the new partition count for the topic"),
-			},
+				confirmFlag(),
+			}, bulkFlags()...),
 			RequiredFlags: []string{"new-partitions"},
-			Args:          cobra.ExactArgs(1),
+			Args:          cobra.MaximumNArgs(1),
+		},
+		{ // Copy topic
+			Use:   "copy <src-cluster>/<topic> <dst-cluster>/<topic>",
+			Short: "Copy the messages of a topic to a topic of another saved cluster",
+			Long: `Copy the messages of a topic to an existing topic of another saved cluster, or of the same
+cluster, keeping their keys, headers and timestamps.
+
+Messages go to the partition with the same number unless --partition-map maps source to
+target partitions, such as '0:1,1:0', or --repartition places them by key. The copy stops at
+the end offsets the partitions had when it started; --start-offset, --end-offset,
+--start-time and --end-time narrow the range further.
+
+With --checkpoint the progress is saved to a file, and running the same command again
+resumes where an interrupted copy stopped. Messages are copied at least once, so a resumed
+copy may repeat a few.
+
+On clusters labelled env=prod the target topic name must be typed to confirm, or given
+with --confirm.`,
+			Run:  copyTopic,
+			Args: cobra.ExactArgs(2),
+			Flags: append([]OkFlag{
+				NewOkFlag(OkFlagString, "partition-map", "", "[optional] SOURCE:TARGET partition pairs such as '0:1,1:0'; unmapped partitions are skipped"),
+				NewOkFlag(OkFlagBool, "repartition", "", "[optional] let the target place messages by key instead of keeping partition numbers"),
+				NewOkFlag(OkFlagString, "rate", "", "[optional] most messages copied per second (default unlimited)"),
+				NewOkFlag(OkFlagString, "checkpoint", "", "[optional] file to save the progress to and resume from"),
+				NewOkFlag(OkFlagString, "confirm", "", "[optional] target topic name confirming the copy into a production cluster without a prompt"),
+			}, rangeFlags("copy")...),
+		},
+		{ // Dump topic
+			Use:   "dump [TOPIC NAME]",
+			Short: "Write the records of a topic to a compressed JSON-lines or binary file",
+			Long: `Write the records of a topic, with their partitions, offsets, timestamps, keys, values and
+headers, to a gzip-compressed file that ok topic restore can replay, for example to keep
+test fixtures.
+
+The jsonl format writes one JSON record per line, with keys and values as text when they
+are valid UTF-8 and in base64 otherwise. The binary format is smaller for binary payloads.
+The format is taken from the file extension (.jsonl.gz or .bin.gz) unless --format is given.`,
+			Run:  dumpTopic,
+			Args: cobra.ExactArgs(1),
+			Flags: append([]OkFlag{
+				NewOkFlag(OkFlagString, "file", "f", "[optional] file to write, - for standard output (default standard output)"),
+				NewOkFlag(OkFlagString, "format", "", "[optional] jsonl or binary (default from the file extension, else jsonl)"),
+				NewOkFlag(OkFlagBool, "no-compress", "", "[optional] write the file without gzip compression"),
+			}, rangeFlags("dump")...),
+		},
+		{ // Search topic
+			Use:   "search [TOPIC NAME]",
+			Short: "Find the records of a topic matching a key, value, JSON path or header",
+			Long: `Scan the partitions of a topic in parallel and print the records that match every filter
+given, as soon as they are found. The search covers the records present when it started,
+narrowed by --start-offset, --end-offset, --start-time and --end-time, and stops after
+--limit matches.
+
+JSON path filters select a field of JSON values, such as '$.customer.id' or
+'items[0].sku', and match when it exists, or with =VALUE when it has that value.`,
+			Run:  searchTopic,
+			Args: cobra.ExactArgs(1),
+			Flags: append([]OkFlag{
+				NewOkFlag(OkFlagString, "key", "k", "[optional] match records with exactly this key"),
+				NewOkFlag(OkFlagString, "contains", "c", "[optional] match records whose value contains this text"),
+				NewOkFlag(OkFlagString, "regex", "", "[optional] match records whose value matches this regular expression"),
+				NewOkFlag(OkFlagString, "json-path", "j", "[optional] match JSON values with this field, e.g. '$.order.id' or '$.order.id=A-123'"),
+				NewOkFlag(OkFlagString, "header", "", "[optional] match records with this header, NAME or NAME=VALUE"),
+				NewOkFlag(OkFlagInt, "limit", "n", "[optional] stop after this many matches, 0 for no limit", defaultSearchLimit),
+			}, rangeFlags("search")...),
+		},
+		{ // Restore topic
+			Use:   "restore <file> [TOPIC NAME]",
+			Short: "Produce the records of a dump file to a topic",
+			Long: `Produce the records of a file written by ok topic dump to an existing topic of the active
+cluster, by default the topic they were dumped from. Records keep their keys, values,
+headers, timestamps and partitions; use --repartition to place them by key when the topic
+has fewer partitions. Use - to read the file from standard input.
+
+On clusters labelled env=prod the topic name must be typed to confirm, or given with
+--confirm; a restore from standard input always needs --confirm there.`,
+			Run:  restoreTopic,
+			Args: cobra.RangeArgs(1, 2),
+			Flags: []OkFlag{
+				NewOkFlag(OkFlagBool, "repartition", "", "[optional] let the topic place records by key instead of keeping their partitions"),
+				NewOkFlag(OkFlagString, "rate", "", "[optional] most records produced per second (default unlimited)"),
+				confirmFlag(),
+			},
 		},
 	}
 }
@@ -102,7 +225,16 @@ func createTopic(cmd cobraCmd, args cobraArgs) {
 		return
 	}
 
-	successMessage, failure := commands.CreateTopic(name, numPartitions, replicationFactor)
+	h, ok := currentCluster(cmd)
+	if !ok {
+		return
+	}
+
+	successMessage, failure := commands.CreateTopic(cmd.Context(), h, name, numPartitions, replicationFactor)
+	recordAudit(audit.OpTopicCreate, name, failure, map[string]any{
+		"partitions":         numPartitions,
+		"replication_factor": replicationFactor,
+	})
 	if failure != nil {
 		fmt.Println(failure.Err)
 		return
@@ -116,12 +248,26 @@ func createTopic(cmd cobraCmd, args cobraArgs) {
 func deleteTopic(cmd cobraCmd, args cobraArgs) {
 	name := cmd.Flags().Arg(0)
 
-	if name == "" {
-		fmt.Println("Error: Topic name is required.")
+	if bulk, ok := bulkSelection(cmd, name); bulk || !ok {
+		if ok {
+			runBulk(cmd, "delete", audit.OpTopicDelete, nil, nil,
+				func(h *cluster.Handle, topics []string, concurrency int) ([]commands.TopicResult, *commands.Failure) {
+					return commands.DeleteTopics(cmd.Context(), h, topics, concurrency)
+				})
+		}
 		return
 	}
 
-	successMessage, failure := commands.DeleteTopic(name)
+	h, ok := currentCluster(cmd)
+	if !ok {
+		return
+	}
+	if !confirmOnProduction(cmd, h, "delete", name) {
+		return
+	}
+
+	successMessage, failure := commands.DeleteTopic(cmd.Context(), h, name)
+	recordAudit(audit.OpTopicDelete, name, failure, nil)
 	if failure != nil {
 		fmt.Println(failure.Err)
 		return
@@ -133,18 +279,35 @@ func deleteTopic(cmd cobraCmd, args cobraArgs) {
 // List topics
 
 func listTopics(cmd cobraCmd, args cobraArgs) {
-	topics, failure := commands.ListTopics()
+	h, ok := currentCluster(cmd)
+	if !ok {
+		return
+	}
+
+	topics, failure := commands.ListTopics(cmd.Context(), h)
 	if failure != nil {
 		fmt.Println(failure.Err)
 		return
 	}
-
 	sortedTopicNames := make([]string, 0, len(topics))
 	for name := range topics {
 		sortedTopicNames = append(sortedTopicNames, name)
 	}
 	sort.Strings(sortedTopicNames)
 
+	summaries := make([]commands.TopicSummary, 0, len(topics))
+	for _, name := range sortedTopicNames {
+		summaries = append(summaries, commands.TopicSummary{Name: name, Partitions: topics[name].NumPartitions, ReplicationFactor: topics[name].ReplicationFactor})
+	}
+	if renderOutput(cmd, summaries) {
+		return
+	}
+
+	if len(topics) == 0 {
+		fmt.Println("No topics found")
+		return
+	}
+
 	topicHeaders := []string{"Name", "Partitions", "Replication Factor"}
 	topicRows := [][]interface{}{}
 	for _, name := range sortedTopicNames {
@@ -167,7 +330,12 @@ func describeTopic(cmd cobraCmd, args cobraArgs) {
 		return
 	}
 
-	metadata, failure := commands.DescribeTopic(topicName)
+	h, ok := currentCluster(cmd)
+	if !ok {
+		return
+	}
+
+	metadata, failure := commands.DescribeTopic(cmd.Context(), h, topicName)
 	if failure != nil {
 		fmt.Println(failure.Err)
 		return
@@ -196,7 +364,7 @@ func describeTopic(cmd cobraCmd, args cobraArgs) {
 	}
 	RenderTable("Topic Partitions:", partitionHeaders, partitionRows)
 
-	configs, failure := commands.DescribeTopicConfig(topicName)
+	configs, failure := commands.DescribeTopicConfig(cmd.Context(), h, topicName)
 	if failure != nil {
 		fmt.Printf("Error describing configs for topic: %v\n", failure.Err)
 		return
@@ -210,13 +378,58 @@ func describeTopic(cmd cobraCmd, args cobraArgs) {
 	RenderTable("Topic Configurations:", configHeaders, configRows)
 }
 
+// Show the offsets of a topic
+func topicOffsets(cmd cobraCmd, args cobraArgs) {
+	topicName := args[0]
+	var at time.Time
+	if value, _ := cmd.Flags().GetString("at"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			fmt.Printf("Error: --at must be an RFC 3339 time such as 2024-05-01T12:00:00Z: %v\n", err)
+			os.Exit(1)
+		}
+		at = parsed
+	}
+
+	h, ok := currentCluster(cmd)
+	if !ok {
+		os.Exit(1)
+	}
+
+	offsets, failure := commands.TopicOffsets(cmd.Context(), h, topicName, at)
+	if failure != nil {
+		fmt.Println("Error:", failure.Err)
+		os.Exit(1)
+	}
+	if renderOutput(cmd, offsets) {
+		return
+	}
+
+	headers := []string{"Partition", "Earliest", "Latest", "Messages"}
+	if !at.IsZero() {
+		headers = append(headers, "Offset At "+at.UTC().Format(time.RFC3339))
+	}
+	rows := [][]interface{}{}
+	var total int64
+	for _, partition := range offsets {
+		row := []interface{}{partition.Partition, partition.Earliest, partition.Latest, partition.Count}
+		if partition.At != nil {
+			row = append(row, *partition.At)
+		}
+		rows = append(rows, row)
+		total += partition.Count
+	}
+	RenderTable(fmt.Sprintf("Offsets of topic '%s':", topicName), headers, rows)
+	fmt.Printf("%d messages in %d partitions\n", total, len(offsets))
+}
+
 // Update topic
 func updateTopic(cmd cobraCmd, args cobraArgs) {
 	topicName := cmd.Flags().Arg(0)
 	newPartitions, _ := cmd.Flags().GetInt("new-partitions")
 
-	if topicName == "" {
-		fmt.Println("Error: Topic name is required.")
+	bulk, ok := bulkSelection(cmd, topicName)
+	if !ok {
 		return
 	}
 
@@ -225,10 +438,231 @@ func updateTopic(cmd cobraCmd, args cobraArgs) {
 		return
 	}
 
-	successMessage, failure := commands.UpdateTopic(topicName, newPartitions)
+	if bulk {
+		runBulk(cmd, "add partitions to", audit.OpTopicUpdate, map[string]any{"partitions": newPartitions}, &newPartitions,
+			func(h *cluster.Handle, topics []string, concurrency int) ([]commands.TopicResult, *commands.Failure) {
+				return commands.UpdateTopics(cmd.Context(), h, topics, newPartitions, concurrency)
+			})
+		return
+	}
+
+	h, ok := currentCluster(cmd)
+	if !ok {
+		return
+	}
+	if !confirmOnProduction(cmd, h, "add partitions to", topicName) {
+		return
+	}
+
+	successMessage, failure := commands.UpdateTopic(cmd.Context(), h, topicName, newPartitions)
+	recordAudit(audit.OpTopicUpdate, topicName, failure, map[string]any{
+		"partitions": newPartitions,
+	})
 	if failure != nil {
 		fmt.Println(failure.Err)
 		return
 	}
 	fmt.Println(successMessage)
 }
+
+// Production safeguards
+
+func confirmFlag() OkFlag {
+	return NewOkFlag(OkFlagString, "confirm", "", "[optional] topic name, or the --match pattern, confirming the operation on a production cluster without a prompt")
+}
+
+// confirmOnProduction asks for the topic name to be typed before a destructive operation
+// on a cluster labelled production. A read-only cluster is refused before prompting.
+func confirmOnProduction(cmd cobraCmd, h *cluster.Handle, action, topicName string) bool {
+	if failure := commands.CheckWritable(cmd.Context(), h); failure != nil {
+		fmt.Println(failure.Err)
+		return false
+	}
+	if !isProduction(h) {
+		return true
+	}
+	return confirmTyped(cmd, fmt.Sprintf("Cluster '%s' is a production cluster. Type the topic name to %s '%s': ", h.Name, action, topicName), topicName, "the topic name")
+}
+
+func isProduction(h *cluster.Handle) bool {
+	profile, ok := session.Default().ClusterByName(h.Name)
+	return ok && profile.IsProduction()
+}
+
+// confirmTyped reports whether --confirm, or the answer to prompt, is exactly expected
+func confirmTyped(cmd cobraCmd, prompt, expected, what string) bool {
+	answer, _ := cmd.Flags().GetString("confirm")
+	if !cmd.Flags().Changed("confirm") {
+		fmt.Print(prompt)
+		answer = readLine()
+	}
+	if answer != expected {
+		fmt.Printf("Confirmation does not match %s; nothing was changed.\n", what)
+		return false
+	}
+	return true
+}
+
+// stdin is shared by every prompt, so input buffered while reading one answer is kept
+// for the next
+var stdin = bufio.NewReader(os.Stdin)
+
+func readLine() string {
+	line, _ := stdin.ReadString('\n')
+	return strings.TrimSpace(line)
+}
+
+// Bulk operations
+
+func bulkFlags() []OkFlag {
+	return []OkFlag{
+		NewOkFlag(OkFlagString, "match", "m", "[optional] select every topic matching a glob such as 'orders-*' instead of a single topic"),
+		NewOkFlag(OkFlagBool, "regex", "", "[optional] treat --match as a regular expression that must match the whole topic name"),
+		NewOkFlag(OkFlagBool, "include-internal", "", "[optional] let --match select internal topics such as __consumer_offsets"),
+		NewOkFlag(OkFlagInt, "concurrency", "", "[optional] number of topics changed at once with --match", commands.DefaultBulkConcurrency),
+		NewOkFlag(OkFlagBool, "dry-run", "", "[optional] only list the topics --match selects"),
+		NewOkFlag(OkFlagBool, "yes", "y", "[optional] skip the confirmation prompt for --match, except on production clusters"),
+	}
+}
+
+// bulkSelection reports whether the command selects topics with --match rather than by
+// name, and whether exactly one of the two was given
+func bulkSelection(cmd cobraCmd, topicName string) (bulk bool, ok bool) {
+	match, _ := cmd.Flags().GetString("match")
+	switch {
+	case match != "" && topicName != "":
+		fmt.Println("Error: Give either a topic name or --match, not both.")
+		return false, false
+	case match == "" && topicName == "":
+		fmt.Println("Error: Topic name or --match is required.")
+		return false, false
+	}
+	return match != "", true
+}
+
+// bulkReport is the structured output of a bulk operation, a single document with the
+// selected topics and the result for each of them unless it was a dry run
+type bulkReport struct {
+	Topics  []commands.TopicSummary `json:"topics"`
+	Results []commands.TopicResult  `json:"results"`
+}
+
+// runBulk previews the topics selected by --match, asks for confirmation and applies the
+// operation to them, printing one result per topic. newPartitions adds a column to the
+// preview for updates. With a structured --output there is no preview or prompt: --yes,
+// or --confirm on production clusters, is required and the topics and results are printed
+// as one document. Exits with status 1 if any topic failed.
+func runBulk(cmd cobraCmd, action string, operation audit.Operation, details map[string]any, newPartitions *int,
+	apply func(h *cluster.Handle, topics []string, concurrency int) ([]commands.TopicResult, *commands.Failure)) {
+	match, _ := cmd.Flags().GetString("match")
+	regex, _ := cmd.Flags().GetBool("regex")
+	includeInternal, _ := cmd.Flags().GetBool("include-internal")
+	concurrency, _ := cmd.Flags().GetInt("concurrency")
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+	yes, _ := cmd.Flags().GetBool("yes")
+
+	format, err := outputFormat(cmd)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	structured := format != session.OutputTable
+
+	h, ok := currentCluster(cmd)
+	if !ok {
+		return
+	}
+
+	selected, failure := commands.SelectTopics(cmd.Context(), h, commands.TopicSelector{Pattern: match, Regex: regex, IncludeInternal: includeInternal})
+	if failure != nil {
+		fmt.Println("Error:", failure.Err)
+		os.Exit(1)
+	}
+	report := bulkReport{Topics: selected, Results: []commands.TopicResult{}}
+	if structured && (dryRun || len(selected) == 0) {
+		renderOutput(cmd, report)
+		return
+	}
+	if len(selected) == 0 {
+		fmt.Printf("No topics match '%s'.\n", match)
+		return
+	}
+
+	names := make([]string, 0, len(selected))
+	for _, topic := range selected {
+		names = append(names, topic.Name)
+	}
+	if !structured {
+		headers := []string{"Topic", "Partitions", "Replication Factor"}
+		if newPartitions != nil {
+			headers = append(headers, "New Partitions")
+		}
+		rows := [][]interface{}{}
+		for _, topic := range selected {
+			row := []interface{}{topic.Name, topic.Partitions, topic.ReplicationFactor}
+			if newPartitions != nil {
+				row = append(row, *newPartitions)
+			}
+			rows = append(rows, row)
+		}
+		RenderTable(fmt.Sprintf("Topics to %s (%d):", action, len(selected)), headers, rows)
+		if dryRun {
+			return
+		}
+	}
+
+	if failure := commands.CheckWritable(cmd.Context(), h); failure != nil {
+		fmt.Println("Error:", failure.Err)
+		os.Exit(1)
+	}
+	production := isProduction(h)
+	if structured && (production && !cmd.Flags().Changed("confirm") || !production && !yes) {
+		// A prompt would end up in the middle of the document
+		fmt.Printf("Error: --output %s runs without prompting; confirm with --yes, or with --confirm <pattern> on a production cluster\n", format)
+		os.Exit(1)
+	}
+	if production {
+		prompt := fmt.Sprintf("Cluster '%s' is a production cluster. Type the pattern to %s %d topics: ", h.Name, action, len(selected))
+		if !confirmTyped(cmd, prompt, match, "the pattern") {
+			if structured {
+				os.Exit(1)
+			}
+			return
+		}
+	} else if !yes {
+		fmt.Printf("%s %d topics? [y/N]: ", strings.ToUpper(action[:1])+action[1:], len(selected))
+		if answer := strings.ToLower(readLine()); answer != "y" && answer != "yes" {
+			fmt.Println("Nothing was changed.")
+			return
+		}
+	}
+
+	results, failure := apply(h, names, concurrency)
+	if failure != nil {
+		fmt.Println("Error:", failure.Err)
+		os.Exit(1)
+	}
+	for _, result := range results {
+		recordAudit(operation, result.Topic, result.Failure, details)
+	}
+	report.Results = results
+
+	failed := commands.CountFailures(results)
+	if structured {
+		renderOutput(cmd, report)
+	} else {
+		resultRows := [][]interface{}{}
+		for _, result := range results {
+			status, message := "OK", result.Message
+			if result.Failure != nil {
+				status, message = "FAILED", result.Failure.Err.Error()
+			}
+			resultRows = append(resultRows, []interface{}{result.Topic, status, message})
+		}
+		RenderTable("Results:", []string{"Topic", "Result", "Message"}, resultRows)
+		fmt.Printf("%d succeeded, %d failed\n", len(results)-failed, failed)
+	}
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
@@ -3,6 +3,7 @@ package cluster
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/IBM/sarama"
 )
@@ -21,18 +22,141 @@ func NewCluster(brokers []string, version sarama.KafkaVersion) *Cluster {
 	}
 }
 
+// Connect creates a client for the cluster. Sarama dials without a context, so the dial
+// timeout is capped by the context's deadline and Connect returns as soon as the context
+// is done; a client that connects after that is closed.
 func (c *Cluster) Connect(ctx context.Context) (sarama.Client, error) {
-	client, err := sarama.NewClient(c.Brokers, c.Config)
+	config := c.configFor(ctx)
+	client, err := await(ctx, func() (sarama.Client, error) {
+		return sarama.NewClient(c.Brokers, config)
+	}, func(client sarama.Client) { _ = client.Close() })
 	if err != nil {
 		return nil, fmt.Errorf("error creating sarama client (brokers: %v): %w", c.Brokers, err)
 	}
 	return client, nil
 }
 
+// ConnectAdmin creates a cluster admin, honouring the context like Connect
 func (c *Cluster) ConnectAdmin(ctx context.Context) (sarama.ClusterAdmin, error) {
-	admin, err := sarama.NewClusterAdmin(c.Brokers, c.Config)
+	config := c.configFor(ctx)
+	admin, err := await(ctx, func() (sarama.ClusterAdmin, error) {
+		return sarama.NewClusterAdmin(c.Brokers, config)
+	}, func(admin sarama.ClusterAdmin) { _ = admin.Close() })
 	if err != nil {
 		return nil, fmt.Errorf("error creating sarama cluster admin (brokers: %v): %w", c.Brokers, err)
 	}
 	return admin, nil
 }
+
+// configFor returns the cluster config with network timeouts no longer than the time left
+// before the context's deadline
+func (c *Cluster) configFor(ctx context.Context) *sarama.Config {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return c.Config
+	}
+	remaining := time.Until(deadline)
+	if remaining <= 0 {
+		return c.Config
+	}
+
+	config := *c.Config
+	if config.Net.DialTimeout > remaining {
+		config.Net.DialTimeout = remaining
+	}
+	if config.Net.ReadTimeout > remaining {
+		config.Net.ReadTimeout = remaining
+	}
+	if config.Net.WriteTimeout > remaining {
+		config.Net.WriteTimeout = remaining
+	}
+	return &config
+}
+
+// Await runs a blocking Kafka call and returns its result, or the context's error as soon
+// as the context is done. Sarama calls cannot be interrupted, so a cancelled call keeps
+// running in the background until the client's own timeouts end it.
+func Await[T any](ctx context.Context, call func() (T, error)) (T, error) {
+	return await(ctx, call, nil)
+}
+
+// Run is Await for calls that only return an error
+func Run(ctx context.Context, call func() error) error {
+	_, err := Await(ctx, func() (struct{}, error) {
+		return struct{}{}, call()
+	})
+	return err
+}
+
+// await is Await with a release function applied to results that arrive after the
+// context is done, so late connections are not leaked
+func await[T any](ctx context.Context, call func() (T, error), release func(T)) (T, error) {
+	var zero T
+	if err := ctx.Err(); err != nil {
+		return zero, err
+	}
+
+	type result struct {
+		value T
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		value, err := call()
+		done <- result{value, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.value, r.err
+	case <-ctx.Done():
+		if release != nil {
+			go func() {
+				if r := <-done; r.err == nil {
+					release(r.value)
+				}
+			}()
+		}
+		return zero, ctx.Err()
+	}
+}
+
+// Handle is an open connection to a named cluster that the command layer operates on.
+// Whoever opens a handle owns it; command functions never close it. Command functions
+// refuse to change a cluster whose handle is marked read-only.
+type Handle struct {
+	Name     string
+	Brokers  []string
+	Client   sarama.Client
+	Admin    sarama.ClusterAdmin
+	ReadOnly bool
+}
+
+// Open connects to the cluster and returns a handle whose admin client shares the
+// client's connections. Close the handle to release both.
+func (c *Cluster) Open(ctx context.Context, name string) (*Handle, error) {
+	client, err := c.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	admin, err := Await(ctx, func() (sarama.ClusterAdmin, error) {
+		return sarama.NewClusterAdminFromClient(client)
+	})
+	if err != nil {
+		_ = client.Close()
+		return nil, fmt.Errorf("error creating sarama cluster admin (brokers: %v): %w", c.Brokers, err)
+	}
+
+	return &Handle{
+		Name:    name,
+		Brokers: c.Brokers,
+		Client:  client,
+		Admin:   admin,
+	}, nil
+}
+
+// Close closes the admin client, which also closes the client it was created from
+func (h *Handle) Close() error {
+	return h.Admin.Close()
+}
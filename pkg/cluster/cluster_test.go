@@ -0,0 +1,200 @@
+package cluster
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+func TestAwaitReturnsWhenContextIsDone(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	unblock := make(chan struct{})
+	defer close(unblock)
+
+	start := time.Now()
+	_, err := Await(ctx, func() (int, error) {
+		<-unblock
+		return 1, nil
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Await returned after %v, want it to return at the deadline", elapsed)
+	}
+}
+
+func TestConnectHonoursCancellation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// Nothing listens on this address; without the context the dial retries for minutes
+	_, err := NewCluster([]string{"127.0.0.1:1"}, sarama.V2_1_0_0).Connect(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestConfigForCapsTimeoutsAtDeadline(t *testing.T) {
+	c := NewCluster([]string{"127.0.0.1:1"}, sarama.V2_1_0_0)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	config := c.configFor(ctx)
+	if config.Net.DialTimeout > time.Second {
+		t.Errorf("dial timeout = %v, want at most 1s", config.Net.DialTimeout)
+	}
+	if c.Config.Net.DialTimeout != 30*time.Second {
+		t.Errorf("cluster config was modified: dial timeout = %v", c.Config.Net.DialTimeout)
+	}
+}
+
+// Test vector from RFC 7677, section 3
+func TestSCRAMSHA256(t *testing.T) {
+	client := newSCRAMClient(sha256Hash)
+	client.nonce = "rOprNGfwEbeRWgbNEkqO"
+	if err := client.Begin("user", "pencil", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct{ challenge, want string }{
+		{"", "n,,n=user,r=rOprNGfwEbeRWgbNEkqO"},
+		{"r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096",
+			"c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,p=dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ="},
+		{"v=6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4=", ""},
+	}
+	for i, step := range steps {
+		got, err := client.Step(step.challenge)
+		if err != nil {
+			t.Fatalf("step %d: %v", i+1, err)
+		}
+		if got != step.want {
+			t.Fatalf("step %d = %q, want %q", i+1, got, step.want)
+		}
+	}
+	if !client.Done() {
+		t.Error("client is not done after the server final message")
+	}
+}
+
+func TestVersionFromAPIs(t *testing.T) {
+	kafka21 := []sarama.ApiVersionsResponseKey{
+		{ApiKey: 0, MinVersion: 0, MaxVersion: 7},
+		{ApiKey: 19, MaxVersion: 3},
+		{ApiKey: 21, MaxVersion: 1},
+		{ApiKey: 37, MaxVersion: 1},
+		{ApiKey: 42, MaxVersion: 1},
+	}
+	if got := VersionFromAPIs(kafka21); got != sarama.V2_1_0_0 {
+		t.Errorf("VersionFromAPIs(2.1 APIs) = %v, want 2.1.0", got)
+	}
+	if got := VersionFromAPIs(kafka21[:2]); got != sarama.V0_10_1_0 {
+		t.Errorf("VersionFromAPIs(0.10.1 APIs) = %v, want 0.10.1", got)
+	}
+
+	if !VersionMatches(sarama.V2_1_0_0, sarama.V2_1_0_0) || !VersionMatches(sarama.V3_9_0_0, sarama.V3_8_0_0) {
+		t.Error("versions between release markers should match the older marker")
+	}
+	if VersionMatches(sarama.V3_9_0_0, sarama.V4_0_0_0) {
+		t.Error("3.9.0 should not match a cluster detected as 4.0")
+	}
+}
+
+func TestParseVersion(t *testing.T) {
+	for input, want := range map[string]sarama.KafkaVersion{
+		"3.9":      sarama.V3_9_0_0,
+		"v3.9.0":   sarama.V3_9_0_0,
+		"2.1.0.0":  sarama.V2_1_0_0,
+		"0.10.2":   sarama.V0_10_2_0,
+		"0.10.2.0": sarama.V0_10_2_0,
+	} {
+		got, err := ParseVersion(input)
+		if err != nil || got != want {
+			t.Errorf("ParseVersion(%q) = %v, %v, want %v", input, got, err, want)
+		}
+	}
+	if _, err := ParseVersion("latest"); err == nil {
+		t.Error("ParseVersion(latest) succeeded")
+	}
+}
+
+// newTestCertificate issues a certificate for host, signed by parent, or self-signed when
+// parent is nil
+func newTestCertificate(t *testing.T, host string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: host},
+		DNSNames:     []string{host},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return certificate, key
+}
+
+func TestSkipHostnameVerificationStillVerifiesTheChain(t *testing.T) {
+	ca, caKey := newTestCertificate(t, "test CA", nil, nil)
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	tlsConfig, err := newTLSConfig(&TLS{CAFile: caFile, SkipHostnameVerification: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tlsConfig.VerifyConnection == nil {
+		t.Fatal("no chain verification when skipping the host name check")
+	}
+
+	// Issued for another host than the one dialled
+	trusted, _ := newTestCertificate(t, "broker.internal", ca, caKey)
+	state := tls.ConnectionState{ServerName: "kafka.example.com", PeerCertificates: []*x509.Certificate{trusted}}
+	if err := tlsConfig.VerifyConnection(state); err != nil {
+		t.Errorf("certificate of a trusted CA for another host: %v, want accepted", err)
+	}
+
+	otherCA, otherKey := newTestCertificate(t, "other CA", nil, nil)
+	untrusted, _ := newTestCertificate(t, "kafka.example.com", otherCA, otherKey)
+	state.PeerCertificates = []*x509.Certificate{untrusted}
+	if err := tlsConfig.VerifyConnection(state); err == nil {
+		t.Error("certificate of an untrusted CA was accepted")
+	}
+	state.PeerCertificates = nil
+	if err := tlsConfig.VerifyConnection(state); err == nil {
+		t.Error("a connection without certificates was accepted")
+	}
+}
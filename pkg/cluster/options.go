@@ -0,0 +1,161 @@
+package cluster
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// SASL mechanisms supported for cluster profiles
+const (
+	SASLMechanismPlain       = "PLAIN"
+	SASLMechanismSCRAMSHA256 = "SCRAM-SHA-256"
+	SASLMechanismSCRAMSHA512 = "SCRAM-SHA-512"
+)
+
+// Options are connection settings applied on top of sarama's defaults. Zero values keep
+// the defaults.
+type Options struct {
+	ClientID        string
+	DialTimeout     time.Duration
+	RequestTimeout  time.Duration
+	MetadataRefresh time.Duration
+	SASL            *SASL
+	TLS             *TLS
+}
+
+// SASL holds resolved SASL credentials
+type SASL struct {
+	Mechanism string
+	Username  string
+	Password  string
+}
+
+// TLS holds the files used to secure broker connections
+type TLS struct {
+	CAFile             string
+	CertFile           string
+	KeyFile            string
+	InsecureSkipVerify bool
+	// SkipHostnameVerification still verifies the broker certificates against the trusted
+	// CAs, but accepts certificates issued for another host name
+	SkipHostnameVerification bool
+}
+
+// Apply configures the cluster's sarama config with the given options
+func (c *Cluster) Apply(options Options) error {
+	config := c.Config
+
+	if options.ClientID != "" {
+		config.ClientID = options.ClientID
+	}
+	if options.DialTimeout > 0 {
+		config.Net.DialTimeout = options.DialTimeout
+	}
+	if options.RequestTimeout > 0 {
+		config.Net.ReadTimeout = options.RequestTimeout
+		config.Net.WriteTimeout = options.RequestTimeout
+		config.Admin.Timeout = options.RequestTimeout
+	}
+	if options.MetadataRefresh > 0 {
+		config.Metadata.RefreshFrequency = options.MetadataRefresh
+	}
+
+	if options.SASL != nil {
+		if err := applySASL(config, options.SASL); err != nil {
+			return err
+		}
+	}
+
+	if options.TLS != nil {
+		tlsConfig, err := newTLSConfig(options.TLS)
+		if err != nil {
+			return err
+		}
+		config.Net.TLS.Enable = true
+		config.Net.TLS.Config = tlsConfig
+	}
+
+	return config.Validate()
+}
+
+func applySASL(config *sarama.Config, options *SASL) error {
+	config.Net.SASL.Enable = true
+	config.Net.SASL.User = options.Username
+	config.Net.SASL.Password = options.Password
+
+	switch options.Mechanism {
+	case "", SASLMechanismPlain:
+		config.Net.SASL.Mechanism = sarama.SASLTypePlaintext
+	case SASLMechanismSCRAMSHA256:
+		config.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA256
+		config.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient { return newSCRAMClient(sha256Hash) }
+	case SASLMechanismSCRAMSHA512:
+		config.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA512
+		config.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient { return newSCRAMClient(sha512Hash) }
+	default:
+		return fmt.Errorf("unsupported SASL mechanism '%s', use %s, %s or %s",
+			options.Mechanism, SASLMechanismPlain, SASLMechanismSCRAMSHA256, SASLMechanismSCRAMSHA512)
+	}
+	return nil
+}
+
+func newTLSConfig(options *TLS) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: options.InsecureSkipVerify,
+	}
+
+	if options.CAFile != "" {
+		pem, err := os.ReadFile(options.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading TLS CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("TLS CA file %s contains no PEM certificates", options.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if options.CertFile != "" || options.KeyFile != "" {
+		if options.CertFile == "" || options.KeyFile == "" {
+			return nil, fmt.Errorf("TLS client certificate and key must be set together")
+		}
+		certificate, err := tls.LoadX509KeyPair(options.CertFile, options.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error loading TLS client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+
+	if options.SkipHostnameVerification && !options.InsecureSkipVerify {
+		// Go verifies the chain and the host name together, so turn both off and verify
+		// the chain against the same roots once the handshake is done
+		roots := tlsConfig.RootCAs
+		tlsConfig.InsecureSkipVerify = true
+		tlsConfig.VerifyConnection = func(state tls.ConnectionState) error {
+			return verifyChain(state.PeerCertificates, roots)
+		}
+	}
+
+	return tlsConfig, nil
+}
+
+// verifyChain verifies the certificates a broker presented against the roots, or the system
+// roots when nil, without checking the host name
+func verifyChain(certificates []*x509.Certificate, roots *x509.CertPool) error {
+	if len(certificates) == 0 {
+		return fmt.Errorf("broker presented no TLS certificate")
+	}
+	intermediates := x509.NewCertPool()
+	for _, certificate := range certificates[1:] {
+		intermediates.AddCert(certificate)
+	}
+	_, err := certificates[0].Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates})
+	return err
+}
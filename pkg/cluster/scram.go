@@ -0,0 +1,150 @@
+package cluster
+
+import (
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"strconv"
+	"strings"
+)
+
+var (
+	sha256Hash = sha256.New
+	sha512Hash = sha512.New
+)
+
+// scramClient implements the client side of SCRAM (RFC 5802) for sarama, without
+// channel binding
+type scramClient struct {
+	hash func() hash.Hash
+
+	step            int
+	nonce           string
+	gs2Header       string
+	password        string
+	clientFirstBare string
+	serverSignature []byte
+	done            bool
+}
+
+func newSCRAMClient(hashFunc func() hash.Hash) *scramClient {
+	return &scramClient{hash: hashFunc}
+}
+
+func (c *scramClient) Begin(userName, password, authzID string) error {
+	if c.nonce == "" {
+		raw := make([]byte, 24)
+		if _, err := rand.Read(raw); err != nil {
+			return fmt.Errorf("error generating SCRAM nonce: %w", err)
+		}
+		c.nonce = base64.RawStdEncoding.EncodeToString(raw)
+	}
+
+	c.gs2Header = "n,,"
+	if authzID != "" {
+		c.gs2Header = "n,a=" + escapeSCRAMName(authzID) + ","
+	}
+	c.password = password
+	c.clientFirstBare = "n=" + escapeSCRAMName(userName) + ",r=" + c.nonce
+	c.step = 0
+	c.done = false
+	return nil
+}
+
+func (c *scramClient) Step(challenge string) (string, error) {
+	c.step++
+	switch c.step {
+	case 1:
+		return c.gs2Header + c.clientFirstBare, nil
+	case 2:
+		return c.clientFinal(challenge)
+	case 3:
+		c.done = true
+		return "", c.verifyServerFinal(challenge)
+	default:
+		return "", errors.New("SCRAM exchange already finished")
+	}
+}
+
+func (c *scramClient) Done() bool {
+	return c.done
+}
+
+func (c *scramClient) clientFinal(serverFirst string) (string, error) {
+	attributes := parseSCRAMAttributes(serverFirst)
+	serverNonce, salt64, iterations := attributes["r"], attributes["s"], attributes["i"]
+	if !strings.HasPrefix(serverNonce, c.nonce) || len(serverNonce) == len(c.nonce) {
+		return "", errors.New("SCRAM server nonce does not extend the client nonce")
+	}
+	salt, err := base64.StdEncoding.DecodeString(salt64)
+	if err != nil {
+		return "", fmt.Errorf("invalid SCRAM salt: %w", err)
+	}
+	iterationCount, err := strconv.Atoi(iterations)
+	if err != nil || iterationCount < 1 {
+		return "", fmt.Errorf("invalid SCRAM iteration count '%s'", iterations)
+	}
+
+	saltedPassword, err := pbkdf2.Key(c.hash, c.password, salt, iterationCount, c.hash().Size())
+	if err != nil {
+		return "", fmt.Errorf("error deriving SCRAM key: %w", err)
+	}
+	clientKey := c.hmac(saltedPassword, "Client Key")
+	storedKey := c.hash()
+	storedKey.Write(clientKey)
+
+	clientFinalWithoutProof := "c=" + base64.StdEncoding.EncodeToString([]byte(c.gs2Header)) + ",r=" + serverNonce
+	authMessage := c.clientFirstBare + "," + serverFirst + "," + clientFinalWithoutProof
+
+	clientSignature := c.hmac(storedKey.Sum(nil), authMessage)
+	proof := make([]byte, len(clientKey))
+	for i := range clientKey {
+		proof[i] = clientKey[i] ^ clientSignature[i]
+	}
+	c.serverSignature = c.hmac(c.hmac(saltedPassword, "Server Key"), authMessage)
+
+	return clientFinalWithoutProof + ",p=" + base64.StdEncoding.EncodeToString(proof), nil
+}
+
+func (c *scramClient) verifyServerFinal(serverFinal string) error {
+	attributes := parseSCRAMAttributes(serverFinal)
+	if message, ok := attributes["e"]; ok {
+		return fmt.Errorf("SCRAM authentication failed: %s", message)
+	}
+	signature, err := base64.StdEncoding.DecodeString(attributes["v"])
+	if err != nil {
+		return fmt.Errorf("invalid SCRAM server signature: %w", err)
+	}
+	if subtle.ConstantTimeCompare(signature, c.serverSignature) != 1 {
+		return errors.New("SCRAM server signature does not match")
+	}
+	return nil
+}
+
+func (c *scramClient) hmac(key []byte, message string) []byte {
+	mac := hmac.New(c.hash, key)
+	mac.Write([]byte(message))
+	return mac.Sum(nil)
+}
+
+func parseSCRAMAttributes(message string) map[string]string {
+	attributes := map[string]string{}
+	for _, part := range strings.Split(message, ",") {
+		if key, value, ok := strings.Cut(part, "="); ok {
+			attributes[key] = value
+		}
+	}
+	return attributes
+}
+
+// escapeSCRAMName escapes ',' and '=' in user names as RFC 5802 requires
+func escapeSCRAMName(name string) string {
+	return strings.NewReplacer("=", "=3D", ",", "=2C").Replace(name)
+}
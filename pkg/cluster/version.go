@@ -0,0 +1,179 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/IBM/sarama"
+)
+
+// Kafka API keys used to recognise releases
+const (
+	apiProduce                    = 0
+	apiCreateTopics               = 19
+	apiDeleteRecords              = 21
+	apiCreatePartitions           = 37
+	apiDeleteGroups               = 42
+	apiElectLeaders               = 43
+	apiIncrementalAlterConfigs    = 44
+	apiAlterPartitionReassignment = 45
+	apiDescribeClientQuotas       = 48
+	apiDescribeUserScram          = 50
+	apiDescribeCluster            = 60
+	apiDescribeTransactions       = 65
+	apiGetTelemetrySubscriptions  = 71
+	apiDescribeTopicPartitions    = 75
+)
+
+// releaseMarkers lists, oldest first, a protocol change introduced by each release that
+// can be recognised from an ApiVersions response. Releases between markers are
+// indistinguishable and are reported as the older marker, which is always safe for
+// sarama: it only uses protocol versions the reported release supports.
+var releaseMarkers = []struct {
+	version   sarama.KafkaVersion
+	supported func(apis map[int16]sarama.ApiVersionsResponseKey) bool
+}{
+	{sarama.V0_10_1_0, hasAPI(apiCreateTopics, 0)},
+	{sarama.V0_11_0_0, hasAPI(apiDeleteRecords, 0)},
+	{sarama.V1_0_0_0, hasAPI(apiCreatePartitions, 0)},
+	{sarama.V1_1_0_0, hasAPI(apiDeleteGroups, 0)},
+	{sarama.V2_0_0_0, hasAPI(apiProduce, 6)},
+	{sarama.V2_1_0_0, hasAPI(apiProduce, 7)},
+	{sarama.V2_2_0_0, hasAPI(apiElectLeaders, 0)},
+	{sarama.V2_3_0_0, hasAPI(apiIncrementalAlterConfigs, 0)},
+	{sarama.V2_4_0_0, hasAPI(apiAlterPartitionReassignment, 0)},
+	{sarama.V2_6_0_0, hasAPI(apiDescribeClientQuotas, 0)},
+	{sarama.V2_7_0_0, hasAPI(apiDescribeUserScram, 0)},
+	{sarama.V2_8_0_0, hasAPI(apiDescribeCluster, 0)},
+	{sarama.V3_0_0_0, hasAPI(apiDescribeTransactions, 0)},
+	{sarama.V3_7_0_0, hasAPI(apiGetTelemetrySubscriptions, 0)},
+	{sarama.V3_8_0_0, hasAPI(apiDescribeTopicPartitions, 0)},
+	// 4.0 removed the protocol versions older than 2.1 (KIP-896)
+	{sarama.V4_0_0_0, func(apis map[int16]sarama.ApiVersionsResponseKey) bool {
+		produce, ok := apis[apiProduce]
+		return ok && produce.MinVersion >= 3
+	}},
+}
+
+func hasAPI(key int16, maxVersion int16) func(map[int16]sarama.ApiVersionsResponseKey) bool {
+	return func(apis map[int16]sarama.ApiVersionsResponseKey) bool {
+		api, ok := apis[key]
+		return ok && api.MaxVersion >= maxVersion
+	}
+}
+
+// VersionFromAPIs returns the newest Kafka release whose protocol the advertised APIs
+// cover. Brokers that answer ApiVersions are at least 0.10.0.
+func VersionFromAPIs(keys []sarama.ApiVersionsResponseKey) sarama.KafkaVersion {
+	apis := make(map[int16]sarama.ApiVersionsResponseKey, len(keys))
+	for _, key := range keys {
+		apis[key.ApiKey] = key
+	}
+
+	version := sarama.V0_10_0_0
+	for _, marker := range releaseMarkers {
+		if !marker.supported(apis) {
+			break
+		}
+		version = marker.version
+	}
+	return version
+}
+
+// ReleaseFloor returns the newest recognisable release not newer than version: the
+// version VersionFromAPIs reports for a cluster running that release
+func ReleaseFloor(version sarama.KafkaVersion) sarama.KafkaVersion {
+	floor := sarama.V0_10_0_0
+	for _, marker := range releaseMarkers {
+		if !version.IsAtLeast(marker.version) {
+			break
+		}
+		floor = marker.version
+	}
+	return floor
+}
+
+// VersionMatches reports whether a configured version agrees with the version detected
+// from the cluster, given that releases between markers cannot be told apart
+func VersionMatches(configured, detected sarama.KafkaVersion) bool {
+	return ReleaseFloor(configured) == detected
+}
+
+// BrokerVersion asks one of the client's brokers for its supported APIs and returns the
+// Kafka release they correspond to
+func BrokerVersion(client sarama.Client) (sarama.KafkaVersion, error) {
+	broker := client.LeastLoadedBroker()
+	if broker == nil {
+		return sarama.KafkaVersion{}, errors.New("no broker available to detect the Kafka version")
+	}
+	if err := broker.Open(client.Config()); err != nil && !errors.Is(err, sarama.ErrAlreadyConnected) {
+		return sarama.KafkaVersion{}, err
+	}
+
+	response, err := broker.ApiVersions(&sarama.ApiVersionsRequest{})
+	if err != nil {
+		return sarama.KafkaVersion{}, fmt.Errorf("error requesting API versions from broker %s: %w", broker.Addr(), err)
+	}
+	if kerr := sarama.KError(response.ErrorCode); kerr != sarama.ErrNoError {
+		return sarama.KafkaVersion{}, fmt.Errorf("error requesting API versions from broker %s: %w", broker.Addr(), kerr)
+	}
+	return VersionFromAPIs(response.ApiKeys), nil
+}
+
+// DetectVersion connects to the cluster and returns the Kafka release its brokers
+// support. The connection uses the configured version only for the handshake.
+func (c *Cluster) DetectVersion(ctx context.Context) (sarama.KafkaVersion, error) {
+	client, err := c.Connect(ctx)
+	if err != nil {
+		return sarama.KafkaVersion{}, err
+	}
+	defer func() { _ = client.Close() }()
+
+	return Await(ctx, func() (sarama.KafkaVersion, error) {
+		return BrokerVersion(client)
+	})
+}
+
+// detectedVersions caches DetectedCluster results by broker list
+var detectedVersions sync.Map
+
+// DetectedCluster returns a cluster configured with the Kafka version its brokers support.
+// The version is detected on first use and remembered for the life of the process, for
+// callers that connect by broker address rather than through a saved profile.
+func DetectedCluster(ctx context.Context, brokers []string) (*Cluster, error) {
+	key := strings.Join(brokers, ",")
+	if version, ok := detectedVersions.Load(key); ok {
+		return NewCluster(brokers, version.(sarama.KafkaVersion)), nil
+	}
+
+	version, err := NewCluster(brokers, sarama.DefaultVersion).DetectVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	detectedVersions.Store(key, version)
+	return NewCluster(brokers, version), nil
+}
+
+// ParseVersion parses a Kafka version leniently: "3.9", "v3.9.0", "2.1.0.0" and "0.10.2"
+// are all accepted, where sarama only understands the exact form of each release line
+func ParseVersion(value string) (sarama.KafkaVersion, error) {
+	value = strings.TrimPrefix(strings.TrimSpace(value), "v")
+	parts := strings.Split(value, ".")
+	if parts[0] != "0" {
+		if len(parts) == 4 {
+			// "2.1.0.0": releases since 1.0 have three parts
+			parts = parts[:3]
+		}
+		for len(parts) < 3 {
+			parts = append(parts, "0")
+		}
+	} else {
+		for len(parts) < 4 {
+			parts = append(parts, "0")
+		}
+	}
+	return sarama.ParseKafkaVersion(strings.Join(parts, "."))
+}
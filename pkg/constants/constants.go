@@ -3,16 +3,15 @@ package constants
 import (
 	"os"
 	"path/filepath"
-
-	"github.com/IBM/sarama"
 )
 
 var (
-	OpenKommanderFolder         string
-	OpenKommanderConfigFilename string
-	KafkaVersion                                    = "3.9.0"
-	SaramaKafkaVersion          sarama.KafkaVersion = sarama.V4_1_0_0
-	KafkaBroker                                     = "localhost:9092"
+	OpenKommanderFolder          string
+	OpenKommanderConfigFilename  string
+	OpenKommanderAuditFilename   string
+	OpenKommanderSamplesFilename string
+	OpenKommanderServerFilename  string
+	KafkaBroker                  = "localhost:9092"
 )
 
 func init() {
@@ -24,4 +23,7 @@ func init() {
 
 	OpenKommanderFolder = filepath.Join(homeDir, ".ok")
 	OpenKommanderConfigFilename = filepath.Join(homeDir, ".ok", ".ok_config")
+	OpenKommanderAuditFilename = filepath.Join(homeDir, ".ok", "audit", "audit.log")
+	OpenKommanderSamplesFilename = filepath.Join(homeDir, ".ok", "metrics", "samples.json")
+	OpenKommanderServerFilename = filepath.Join(homeDir, ".ok", "server.json")
 }
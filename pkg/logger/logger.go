@@ -7,10 +7,15 @@ import (
 	"log/slog"
 	"os"
 	"strings"
+	"sync"
+	"sync/atomic"
 )
 
 var (
-	Logger *slog.Logger
+	// current is the logger set by Init. Logging calls read it from many goroutines, so it
+	// is only accessed atomically.
+	current     atomic.Pointer[slog.Logger]
+	defaultOnce sync.Once
 )
 
 type LogLevel string
@@ -239,15 +244,22 @@ func Init(config *Config) {
 		handler = NewPrettyHandler(os.Stdout, opts, config.AddColors)
 	}
 
-	Logger = slog.New(handler)
-	slog.SetDefault(Logger)
+	logger := slog.New(handler)
+	current.Store(logger)
+	slog.SetDefault(logger)
 }
 
+// GetLogger returns the logger set by Init, initialising the default one on first use
 func GetLogger() *slog.Logger {
-	if Logger == nil {
-		Init(DefaultConfig())
+	if logger := current.Load(); logger != nil {
+		return logger
 	}
-	return Logger
+	defaultOnce.Do(func() {
+		if current.Load() == nil {
+			Init(DefaultConfig())
+		}
+	})
+	return current.Load()
 }
 
 func Debug(msg string, args ...any) {
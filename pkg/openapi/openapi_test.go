@@ -0,0 +1,119 @@
+package openapi
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+const testSpec = `
+openapi: 3.0.0
+paths:
+  /items/{id}:
+    parameters:
+      - $ref: '#/components/parameters/ID'
+    get:
+      parameters:
+        - name: limit
+          in: query
+          schema:
+            type: integer
+            minimum: 1
+      responses:
+        '200':
+          description: An item
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Item'
+        default:
+          description: An error
+  /items/latest:
+    get:
+      responses:
+        '200':
+          description: The latest item
+components:
+  parameters:
+    ID:
+      name: id
+      in: path
+      required: true
+      schema:
+        type: string
+  schemas:
+    Item:
+      type: object
+      required: [name]
+      additionalProperties: false
+      properties:
+        name:
+          type: string
+          minLength: 1
+        tags:
+          type: array
+          items:
+            type: string
+            enum: [a, b]
+`
+
+func TestFindRoutePrefersLiteralSegments(t *testing.T) {
+	spec, err := Load([]byte(testSpec))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	route, params, _ := spec.FindRoute(http.MethodGet, "/items/latest")
+	if route == nil || route.Path != "/items/latest" {
+		t.Fatalf("route = %+v, want /items/latest", route)
+	}
+	if len(params) != 0 {
+		t.Errorf("params = %v, want none", params)
+	}
+
+	route, params, _ = spec.FindRoute(http.MethodGet, "/items/42")
+	if route == nil || params["id"] != "42" {
+		t.Fatalf("route = %+v, params = %v, want /items/{id} with id 42", route, params)
+	}
+
+	route, _, pathFound := spec.FindRoute(http.MethodPost, "/items/42")
+	if route != nil || !pathFound {
+		t.Errorf("POST /items/42: route = %+v, pathFound = %v, want nil and true", route, pathFound)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	spec, err := Load([]byte(testSpec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	route, params, _ := spec.FindRoute(http.MethodGet, "/items/42")
+	header := http.Header{"Content-Type": []string{"application/json"}}
+
+	if err := route.ValidateRequest(params, url.Values{"limit": {"0"}}, header, nil); err == nil {
+		t.Error("limit=0 was accepted, want a minimum violation")
+	}
+	if err := route.ValidateRequest(params, url.Values{"limit": {"5"}}, header, nil); err != nil {
+		t.Errorf("limit=5: %v", err)
+	}
+
+	tests := []struct {
+		status int
+		body   string
+		valid  bool
+	}{
+		{http.StatusOK, `{"name":"x","tags":["a"]}`, true},
+		{http.StatusOK, `{"name":""}`, false},
+		{http.StatusOK, `{"tags":["a"]}`, false},
+		{http.StatusOK, `{"name":"x","tags":["c"]}`, false},
+		{http.StatusOK, `{"name":"x","extra":1}`, false},
+		{http.StatusCreated, `{"name":"x"}`, false},
+		{http.StatusNotFound, ``, true},
+	}
+	for _, test := range tests {
+		err := route.ValidateResponse(test.status, header, []byte(test.body))
+		if (err == nil) != test.valid {
+			t.Errorf("%d %s: err = %v, want valid = %v", test.status, test.body, err, test.valid)
+		}
+	}
+}
@@ -0,0 +1,280 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Schema is the supported subset of an OpenAPI schema object
+type Schema struct {
+	Ref                  string                `yaml:"$ref"`
+	Type                 string                `yaml:"type"`
+	Format               string                `yaml:"format"`
+	Nullable             bool                  `yaml:"nullable"`
+	Enum                 []interface{}         `yaml:"enum"`
+	Required             []string              `yaml:"required"`
+	Properties           map[string]*Schema    `yaml:"properties"`
+	AdditionalProperties *AdditionalProperties `yaml:"additionalProperties"`
+	Items                *Schema               `yaml:"items"`
+	AllOf                []*Schema             `yaml:"allOf"`
+	OneOf                []*Schema             `yaml:"oneOf"`
+	Minimum              *float64              `yaml:"minimum"`
+	Maximum              *float64              `yaml:"maximum"`
+	MinLength            *int                  `yaml:"minLength"`
+	MaxLength            *int                  `yaml:"maxLength"`
+	Pattern              string                `yaml:"pattern"`
+
+	resolved    *Schema
+	patternOnce sync.Once
+	pattern     *regexp.Regexp
+	patternErr  error
+}
+
+// AdditionalProperties is either a boolean or a schema for undeclared properties
+type AdditionalProperties struct {
+	Allowed bool
+	Schema  *Schema
+}
+
+// UnmarshalYAML accepts both forms of additionalProperties
+func (a *AdditionalProperties) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		return node.Decode(&a.Allowed)
+	}
+	a.Allowed = true
+	a.Schema = &Schema{}
+	return node.Decode(a.Schema)
+}
+
+// Violation is a single validation failure. Path locates the value, e.g. body.name or
+// query.window.
+type Violation struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists every violation found while validating a request or response
+type ValidationError struct {
+	Violations []Violation
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, 0, len(e.Violations))
+	for _, violation := range e.Violations {
+		messages = append(messages, fmt.Sprintf("%s: %s", violation.Path, violation.Message))
+	}
+	return strings.Join(messages, "; ")
+}
+
+func (e *ValidationError) add(path, format string, args ...interface{}) {
+	e.Violations = append(e.Violations, Violation{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+func (e *ValidationError) errOrNil() error {
+	if len(e.Violations) == 0 {
+		return nil
+	}
+	return e
+}
+
+// Validate checks a value decoded from JSON with json.Decoder.UseNumber against the schema
+func (s *Schema) Validate(path string, value interface{}) error {
+	result := &ValidationError{}
+	s.validate(path, value, result)
+	return result.errOrNil()
+}
+
+func (s *Schema) target() *Schema {
+	if s.resolved != nil {
+		return s.resolved
+	}
+	return s
+}
+
+func (s *Schema) validate(path string, value interface{}, result *ValidationError) {
+	if s == nil {
+		return
+	}
+	s = s.target()
+
+	for _, part := range s.AllOf {
+		part.validate(path, value, result)
+	}
+	if len(s.OneOf) > 0 {
+		matches := 0
+		for _, option := range s.OneOf {
+			if option.Validate(path, value) == nil {
+				matches++
+			}
+		}
+		if matches != 1 {
+			result.add(path, "must match exactly one schema, matched %d", matches)
+		}
+	}
+
+	if value == nil {
+		if s.Type != "" && !s.Nullable {
+			result.add(path, "must not be null")
+		}
+		return
+	}
+
+	if len(s.Enum) > 0 && !enumContains(s.Enum, value) {
+		result.add(path, "must be one of %s", formatEnum(s.Enum))
+	}
+
+	switch s.Type {
+	case "":
+		// Untyped schemas only carry composition keywords
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			result.add(path, "must be an object")
+			return
+		}
+		s.validateObject(path, object, result)
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			result.add(path, "must be an array")
+			return
+		}
+		for i, item := range items {
+			s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item, result)
+		}
+	case "string":
+		text, ok := value.(string)
+		if !ok {
+			result.add(path, "must be a string")
+			return
+		}
+		s.validateString(path, text, result)
+	case "integer", "number":
+		number, ok := toFloat(value)
+		if !ok {
+			result.add(path, "must be a %s", s.Type)
+			return
+		}
+		if s.Type == "integer" && number != math.Trunc(number) {
+			result.add(path, "must be an integer")
+			return
+		}
+		s.validateNumber(path, number, result)
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			result.add(path, "must be a boolean")
+		}
+	default:
+		result.add(path, "has unsupported schema type %s", s.Type)
+	}
+}
+
+func (s *Schema) validateObject(path string, object map[string]interface{}, result *ValidationError) {
+	for _, name := range s.Required {
+		if _, ok := object[name]; !ok {
+			result.add(joinPath(path, name), "is required")
+		}
+	}
+
+	names := make([]string, 0, len(object))
+	for name := range object {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if property, ok := s.Properties[name]; ok {
+			property.validate(joinPath(path, name), object[name], result)
+			continue
+		}
+		if s.AdditionalProperties == nil {
+			continue
+		}
+		if !s.AdditionalProperties.Allowed {
+			result.add(joinPath(path, name), "is not an allowed property")
+			continue
+		}
+		s.AdditionalProperties.Schema.validate(joinPath(path, name), object[name], result)
+	}
+}
+
+func (s *Schema) validateString(path, text string, result *ValidationError) {
+	length := utf8.RuneCountInString(text)
+	if s.MinLength != nil && length < *s.MinLength {
+		result.add(path, "must be at least %d characters", *s.MinLength)
+	}
+	if s.MaxLength != nil && length > *s.MaxLength {
+		result.add(path, "must be at most %d characters", *s.MaxLength)
+	}
+	if s.Pattern == "" {
+		return
+	}
+
+	s.patternOnce.Do(func() {
+		s.pattern, s.patternErr = regexp.Compile(s.Pattern)
+	})
+	if s.patternErr != nil {
+		result.add(path, "has invalid pattern %s in the schema: %v", s.Pattern, s.patternErr)
+		return
+	}
+	if !s.pattern.MatchString(text) {
+		result.add(path, "must match %s", s.Pattern)
+	}
+}
+
+func (s *Schema) validateNumber(path string, number float64, result *ValidationError) {
+	if s.Minimum != nil && number < *s.Minimum {
+		result.add(path, "must be at least %v", *s.Minimum)
+	}
+	if s.Maximum != nil && number > *s.Maximum {
+		result.add(path, "must be at most %v", *s.Maximum)
+	}
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	switch number := value.(type) {
+	case json.Number:
+		parsed, err := number.Float64()
+		return parsed, err == nil
+	case float64:
+		return number, true
+	case int:
+		return float64(number), true
+	case int64:
+		return float64(number), true
+	default:
+		return 0, false
+	}
+}
+
+func enumContains(enum []interface{}, value interface{}) bool {
+	for _, candidate := range enum {
+		if fmt.Sprint(candidate) == fmt.Sprint(value) {
+			return true
+		}
+	}
+	return false
+}
+
+func formatEnum(enum []interface{}) string {
+	values := make([]string, 0, len(enum))
+	for _, value := range enum {
+		values = append(values, fmt.Sprint(value))
+	}
+	return strings.Join(values, ", ")
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
@@ -0,0 +1,348 @@
+// Package openapi loads the subset of OpenAPI 3 used by docs/openapi.yaml and validates
+// HTTP requests and responses against it. Supported schema keywords are type, format,
+// nullable, enum, required, properties, additionalProperties, items, allOf, oneOf,
+// minimum, maximum, minLength, maxLength and pattern; local $refs to components are
+// resolved when the document is loaded.
+package openapi
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Spec is a loaded OpenAPI document
+type Spec struct {
+	Paths      map[string]*PathItem `yaml:"paths"`
+	Components Components           `yaml:"components"`
+
+	routes []*Route
+}
+
+// Components holds the reusable objects that $refs point to
+type Components struct {
+	Schemas    map[string]*Schema    `yaml:"schemas"`
+	Parameters map[string]*Parameter `yaml:"parameters"`
+	Responses  map[string]*Response  `yaml:"responses"`
+}
+
+// PathItem is the set of operations available on a path
+type PathItem struct {
+	Parameters []*Parameter `yaml:"parameters"`
+	Get        *Operation   `yaml:"get"`
+	Put        *Operation   `yaml:"put"`
+	Post       *Operation   `yaml:"post"`
+	Delete     *Operation   `yaml:"delete"`
+	Patch      *Operation   `yaml:"patch"`
+	Head       *Operation   `yaml:"head"`
+}
+
+// Operations returns the operations of the path item keyed by HTTP method
+func (p *PathItem) Operations() map[string]*Operation {
+	operations := map[string]*Operation{}
+	for method, operation := range map[string]*Operation{
+		http.MethodGet:    p.Get,
+		http.MethodPut:    p.Put,
+		http.MethodPost:   p.Post,
+		http.MethodDelete: p.Delete,
+		http.MethodPatch:  p.Patch,
+		http.MethodHead:   p.Head,
+	} {
+		if operation != nil {
+			operations[method] = operation
+		}
+	}
+	return operations
+}
+
+// Operation describes a single API operation on a path
+type Operation struct {
+	OperationID string               `yaml:"operationId"`
+	Summary     string               `yaml:"summary"`
+	Parameters  []*Parameter         `yaml:"parameters"`
+	RequestBody *RequestBody         `yaml:"requestBody"`
+	Responses   map[string]*Response `yaml:"responses"`
+}
+
+// Parameter is a path, query or header parameter
+type Parameter struct {
+	Ref      string  `yaml:"$ref"`
+	Name     string  `yaml:"name"`
+	In       string  `yaml:"in"`
+	Required bool    `yaml:"required"`
+	Schema   *Schema `yaml:"schema"`
+}
+
+// RequestBody describes the accepted request bodies by media type
+type RequestBody struct {
+	Required bool                  `yaml:"required"`
+	Content  map[string]*MediaType `yaml:"content"`
+}
+
+// Response describes a response by media type
+type Response struct {
+	Ref         string                `yaml:"$ref"`
+	Description string                `yaml:"description"`
+	Content     map[string]*MediaType `yaml:"content"`
+}
+
+// MediaType holds the schema of a body
+type MediaType struct {
+	Schema *Schema `yaml:"schema"`
+}
+
+// Route is a documented path and method
+type Route struct {
+	Path       string
+	Method     string
+	Operation  *Operation
+	Parameters []*Parameter
+
+	segments []string
+}
+
+// Load parses an OpenAPI document and resolves its $refs
+func Load(data []byte) (*Spec, error) {
+	var spec Spec
+	if err := yaml.Unmarshal(data, &spec); err != nil {
+		return nil, fmt.Errorf("error parsing OpenAPI document: %w", err)
+	}
+	if err := spec.resolve(); err != nil {
+		return nil, err
+	}
+	return &spec, nil
+}
+
+// Routes returns every documented operation sorted by path and method
+func (s *Spec) Routes() []*Route {
+	return s.routes
+}
+
+// FindRoute returns the route matching the request path and method along with the path
+// parameter values. When the path is documented but the method is not, route is nil and
+// pathFound is true.
+func (s *Spec) FindRoute(method, path string) (route *Route, params map[string]string, pathFound bool) {
+	segments := splitPath(path)
+
+	var best *Route
+	bestLiterals := -1
+	for _, candidate := range s.routes {
+		values, literals, ok := matchSegments(candidate.segments, segments)
+		if !ok {
+			continue
+		}
+		pathFound = true
+		if candidate.Method != method {
+			continue
+		}
+		if literals > bestLiterals {
+			best, params, bestLiterals = candidate, values, literals
+		}
+	}
+	return best, params, pathFound
+}
+
+func (s *Spec) resolve() error {
+	for name, schema := range s.Components.Schemas {
+		if err := s.resolveSchema(schema, map[*Schema]bool{}); err != nil {
+			return fmt.Errorf("schema %s: %w", name, err)
+		}
+	}
+	for name, parameter := range s.Components.Parameters {
+		if err := s.resolveSchema(parameter.Schema, map[*Schema]bool{}); err != nil {
+			return fmt.Errorf("parameter %s: %w", name, err)
+		}
+	}
+	for name, response := range s.Components.Responses {
+		if err := s.resolveContent(response.Content); err != nil {
+			return fmt.Errorf("response %s: %w", name, err)
+		}
+	}
+
+	for path, item := range s.Paths {
+		pathParameters, err := s.resolveParameters(item.Parameters)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+
+		for method, operation := range item.Operations() {
+			parameters, err := s.resolveParameters(operation.Parameters)
+			if err != nil {
+				return fmt.Errorf("%s %s: %w", method, path, err)
+			}
+			operation.Parameters = parameters
+
+			if operation.RequestBody != nil {
+				if err := s.resolveContent(operation.RequestBody.Content); err != nil {
+					return fmt.Errorf("%s %s: request body: %w", method, path, err)
+				}
+			}
+			for status, response := range operation.Responses {
+				resolved, err := s.resolveResponse(response)
+				if err != nil {
+					return fmt.Errorf("%s %s: response %s: %w", method, path, status, err)
+				}
+				operation.Responses[status] = resolved
+			}
+
+			s.routes = append(s.routes, &Route{
+				Path:       path,
+				Method:     method,
+				Operation:  operation,
+				Parameters: mergeParameters(pathParameters, parameters),
+				segments:   splitPath(path),
+			})
+		}
+	}
+
+	sort.Slice(s.routes, func(i, j int) bool {
+		if s.routes[i].Path != s.routes[j].Path {
+			return s.routes[i].Path < s.routes[j].Path
+		}
+		return s.routes[i].Method < s.routes[j].Method
+	})
+	return nil
+}
+
+func (s *Spec) resolveParameters(parameters []*Parameter) ([]*Parameter, error) {
+	resolved := make([]*Parameter, 0, len(parameters))
+	for _, parameter := range parameters {
+		if parameter.Ref != "" {
+			name, err := refName(parameter.Ref, "parameters")
+			if err != nil {
+				return nil, err
+			}
+			target, ok := s.Components.Parameters[name]
+			if !ok {
+				return nil, fmt.Errorf("unknown parameter %s", parameter.Ref)
+			}
+			parameter = target
+		}
+		if err := s.resolveSchema(parameter.Schema, map[*Schema]bool{}); err != nil {
+			return nil, fmt.Errorf("parameter %s: %w", parameter.Name, err)
+		}
+		resolved = append(resolved, parameter)
+	}
+	return resolved, nil
+}
+
+func (s *Spec) resolveResponse(response *Response) (*Response, error) {
+	if response.Ref == "" {
+		return response, s.resolveContent(response.Content)
+	}
+	name, err := refName(response.Ref, "responses")
+	if err != nil {
+		return nil, err
+	}
+	target, ok := s.Components.Responses[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown response %s", response.Ref)
+	}
+	return target, nil
+}
+
+func (s *Spec) resolveContent(content map[string]*MediaType) error {
+	for mediaType, media := range content {
+		if media == nil {
+			continue
+		}
+		if err := s.resolveSchema(media.Schema, map[*Schema]bool{}); err != nil {
+			return fmt.Errorf("%s: %w", mediaType, err)
+		}
+	}
+	return nil
+}
+
+// resolveSchema points every $ref in the schema tree at its component schema. Component
+// schemas are shared, so visited guards against cycles.
+func (s *Spec) resolveSchema(schema *Schema, visited map[*Schema]bool) error {
+	if schema == nil || visited[schema] {
+		return nil
+	}
+	visited[schema] = true
+
+	if schema.Ref != "" {
+		name, err := refName(schema.Ref, "schemas")
+		if err != nil {
+			return err
+		}
+		target, ok := s.Components.Schemas[name]
+		if !ok {
+			return fmt.Errorf("unknown schema %s", schema.Ref)
+		}
+		schema.resolved = target
+		return s.resolveSchema(target, visited)
+	}
+
+	children := []*Schema{schema.Items}
+	children = append(children, schema.AllOf...)
+	children = append(children, schema.OneOf...)
+	for _, property := range schema.Properties {
+		children = append(children, property)
+	}
+	if schema.AdditionalProperties != nil {
+		children = append(children, schema.AdditionalProperties.Schema)
+	}
+	for _, child := range children {
+		if err := s.resolveSchema(child, visited); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func refName(ref, kind string) (string, error) {
+	prefix := "#/components/" + kind + "/"
+	if !strings.HasPrefix(ref, prefix) {
+		return "", fmt.Errorf("unsupported $ref %s, expected %s<name>", ref, prefix)
+	}
+	return strings.TrimPrefix(ref, prefix), nil
+}
+
+// mergeParameters lets operation parameters override path level ones with the same name
+func mergeParameters(pathParameters, operationParameters []*Parameter) []*Parameter {
+	merged := append([]*Parameter{}, operationParameters...)
+	for _, parameter := range pathParameters {
+		overridden := false
+		for _, own := range operationParameters {
+			if own.Name == parameter.Name && own.In == parameter.In {
+				overridden = true
+				break
+			}
+		}
+		if !overridden {
+			merged = append(merged, parameter)
+		}
+	}
+	return merged
+}
+
+func splitPath(path string) []string {
+	return strings.Split(strings.Trim(path, "/"), "/")
+}
+
+// matchSegments matches a request path against a templated path and counts the literal
+// segments so the most specific route wins
+func matchSegments(template, segments []string) (values map[string]string, literals int, ok bool) {
+	if len(template) != len(segments) {
+		return nil, 0, false
+	}
+	values = map[string]string{}
+	for i, part := range template {
+		if strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}") {
+			if segments[i] == "" {
+				return nil, 0, false
+			}
+			values[part[1:len(part)-1]] = segments[i]
+			continue
+		}
+		if part != segments[i] {
+			return nil, 0, false
+		}
+		literals++
+	}
+	return values, literals, true
+}
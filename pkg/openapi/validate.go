@@ -0,0 +1,173 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+const jsonMediaType = "application/json"
+
+// ValidateRequest checks the path and query parameters and the body of a request for the
+// route. params are the path values returned by FindRoute.
+func (route *Route) ValidateRequest(params map[string]string, query url.Values, header http.Header, body []byte) error {
+	result := &ValidationError{}
+
+	for _, parameter := range route.Parameters {
+		var values []string
+		switch parameter.In {
+		case "path":
+			if value, ok := params[parameter.Name]; ok {
+				values = []string{value}
+			}
+		case "query":
+			values = query[parameter.Name]
+		case "header":
+			values = header.Values(parameter.Name)
+		default:
+			continue
+		}
+
+		path := parameter.In + "." + parameter.Name
+		if len(values) == 0 {
+			if parameter.Required {
+				result.add(path, "is required")
+			}
+			continue
+		}
+		for _, value := range values {
+			validateParameter(path, parameter.Schema, value, result)
+		}
+	}
+
+	requestBody := route.Operation.RequestBody
+	if requestBody == nil {
+		return result.errOrNil()
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		if requestBody.Required {
+			result.add("body", "is required")
+		}
+		return result.errOrNil()
+	}
+
+	// Handlers decode JSON whatever the declared type, so clients such as curl that send
+	// form content types by default are validated as JSON
+	mediaType := mediaTypeOf(header.Get("Content-Type"), jsonMediaType)
+	media, ok := requestBody.Content[mediaType]
+	if !ok {
+		media, ok = requestBody.Content[jsonMediaType]
+		mediaType = jsonMediaType
+	}
+	if !ok {
+		result.add("body", "content type %s is not accepted", header.Get("Content-Type"))
+		return result.errOrNil()
+	}
+	validateBody("body", mediaType, media, body, result)
+	return result.errOrNil()
+}
+
+// ValidateResponse checks that the status is documented for the route and that the body
+// matches the documented schema. Responses without a documented body are not inspected.
+func (route *Route) ValidateResponse(status int, header http.Header, body []byte) error {
+	result := &ValidationError{}
+
+	response := route.Operation.response(status)
+	if response == nil {
+		result.add("status", "%d is not documented for %s %s", status, route.Method, route.Path)
+		return result
+	}
+	if len(response.Content) == 0 || route.Method == http.MethodHead {
+		return nil
+	}
+
+	mediaType := mediaTypeOf(header.Get("Content-Type"), "")
+	media, ok := response.Content[mediaType]
+	if !ok {
+		result.add("header.Content-Type", "%q is not documented for status %d", header.Get("Content-Type"), status)
+		return result
+	}
+	validateBody("response", mediaType, media, body, result)
+	return result.errOrNil()
+}
+
+// response finds the documented response for a status: an exact match, then a range such
+// as 4XX, then default, which only covers error statuses
+func (o *Operation) response(status int) *Response {
+	if response, ok := o.Responses[strconv.Itoa(status)]; ok {
+		return response
+	}
+	if response, ok := o.Responses[fmt.Sprintf("%dXX", status/100)]; ok {
+		return response
+	}
+	if status >= http.StatusBadRequest {
+		return o.Responses["default"]
+	}
+	return nil
+}
+
+func validateBody(path, mediaType string, media *MediaType, body []byte, result *ValidationError) {
+	if media == nil || media.Schema == nil {
+		return
+	}
+	if mediaType != jsonMediaType {
+		media.Schema.validate(path, string(body), result)
+		return
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		result.add(path, "is not valid JSON: %v", err)
+		return
+	}
+	if _, err := decoder.Token(); !errors.Is(err, io.EOF) {
+		result.add(path, "has trailing data after the JSON value")
+		return
+	}
+	media.Schema.validate(path, value, result)
+}
+
+// validateParameter converts a raw parameter string to the schema type before validating
+func validateParameter(path string, schema *Schema, raw string, result *ValidationError) {
+	if schema == nil {
+		return
+	}
+
+	var value interface{} = raw
+	switch schema.target().Type {
+	case "integer", "number":
+		number, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			result.add(path, "must be a %s", schema.target().Type)
+			return
+		}
+		value = number
+	case "boolean":
+		parsed, err := strconv.ParseBool(raw)
+		if err != nil {
+			result.add(path, "must be a boolean")
+			return
+		}
+		value = parsed
+	}
+	schema.validate(path, value, result)
+}
+
+func mediaTypeOf(contentType, fallback string) string {
+	if contentType == "" {
+		return fallback
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return contentType
+	}
+	return mediaType
+}
@@ -0,0 +1,96 @@
+// Package output encodes and decodes the JSON and YAML documents read and written by
+// commands. YAML goes through the JSON encoding, so both formats share field names,
+// field order and custom marshalers.
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	JSON = "json"
+	YAML = "yaml"
+)
+
+// Encode writes value to w as indented JSON or as YAML
+func Encode(w io.Writer, format string, value any) error {
+	switch format {
+	case JSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(value)
+	case YAML:
+		node, err := jsonToYAML(value)
+		if err != nil {
+			return err
+		}
+		encoder := yaml.NewEncoder(w)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(node); err != nil {
+			return err
+		}
+		return encoder.Close()
+	default:
+		return fmt.Errorf("unsupported format '%s', use %s or %s", format, JSON, YAML)
+	}
+}
+
+// Decode parses JSON or YAML data into value using its JSON field names
+func Decode(data []byte, format string, value any) error {
+	switch format {
+	case JSON:
+		return json.Unmarshal(data, value)
+	case YAML:
+		var generic any
+		if err := yaml.Unmarshal(data, &generic); err != nil {
+			return err
+		}
+		encoded, err := json.Marshal(generic)
+		if err != nil {
+			return fmt.Errorf("YAML document cannot be represented as JSON: %w", err)
+		}
+		return json.Unmarshal(encoded, value)
+	default:
+		return fmt.Errorf("unsupported format '%s', use %s or %s", format, JSON, YAML)
+	}
+}
+
+// FormatForPath guesses the format from a file extension, returning "" when unknown
+func FormatForPath(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return JSON
+	case ".yaml", ".yml":
+		return YAML
+	default:
+		return ""
+	}
+}
+
+// jsonToYAML converts value through its JSON encoding. JSON is valid YAML; only the flow
+// and quoting styles are reset so the result reads as plain block YAML.
+func jsonToYAML(value any) (*yaml.Node, error) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var node yaml.Node
+	if err := yaml.Unmarshal(encoded, &node); err != nil {
+		return nil, err
+	}
+	var blockStyle func(n *yaml.Node)
+	blockStyle = func(n *yaml.Node) {
+		n.Style = 0
+		for _, child := range n.Content {
+			blockStyle(child)
+		}
+	}
+	blockStyle(&node)
+	return &node, nil
+}
@@ -0,0 +1,137 @@
+package rest
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/IBM/openkommander/internal/core/commands"
+	"github.com/IBM/openkommander/pkg/audit"
+	"github.com/IBM/openkommander/pkg/cluster"
+	"github.com/IBM/openkommander/pkg/logger"
+)
+
+// maxBulkConcurrency caps how many topics one request changes at once
+const maxBulkConcurrency = 64
+
+// BulkTopicRequest selects topics by pattern and the operation to apply to them
+type BulkTopicRequest struct {
+	Action          string `json:"action"`
+	Match           string `json:"match"`
+	Regex           bool   `json:"regex"`
+	IncludeInternal bool   `json:"include_internal"`
+	NewPartitions   int    `json:"new_partitions"`
+	Concurrency     int    `json:"concurrency"`
+	DryRun          bool   `json:"dry_run"`
+	// Confirm must repeat Match for a delete that is not a dry run, so a single request
+	// cannot delete topics by accident
+	Confirm string `json:"confirm"`
+}
+
+// BulkTopicReport lists the selected topics and, unless the request was a dry run, the
+// result for each of them
+type BulkTopicReport struct {
+	Topics    []commands.TopicSummary `json:"topics"`
+	Results   []commands.TopicResult  `json:"results,omitempty"`
+	Succeeded int                     `json:"succeeded"`
+	Failed    int                     `json:"failed"`
+}
+
+func (s *Server) handleBulkTopics(w http.ResponseWriter, r *http.Request) {
+	if !enforceMethod(w, r, []string{http.MethodPost}) {
+		return
+	}
+	broker := r.PathValue("broker")
+
+	var req BulkTopicRequest
+	if failure := decodeJSONBody(r, &req); failure != nil {
+		logger.Error("Invalid request body for bulk topic operation", "broker", broker, "error", failure.Err)
+		sendFailure(w, r, "Invalid request body", failure)
+		return
+	}
+
+	var operation audit.Operation
+	var details map[string]any
+	switch req.Action {
+	case "delete":
+		if !req.DryRun && req.Confirm != req.Match {
+			sendErrorStatus(w, r, http.StatusBadRequest, commands.CodeValidationFailed,
+				"confirm must repeat match to delete topics", map[string]interface{}{"field": "confirm"})
+			return
+		}
+		operation = audit.OpTopicDelete
+	case "update":
+		if req.NewPartitions <= 0 {
+			sendErrorStatus(w, r, http.StatusBadRequest, commands.CodeValidationFailed,
+				"new_partitions must be at least 1 for the update action", map[string]interface{}{"field": "new_partitions"})
+			return
+		}
+		operation = audit.OpTopicUpdate
+		details = map[string]any{"partitions": req.NewPartitions}
+	default:
+		sendErrorStatus(w, r, http.StatusBadRequest, commands.CodeValidationFailed,
+			fmt.Sprintf("Unknown action '%s', use delete or update", req.Action), map[string]interface{}{"field": "action"})
+		return
+	}
+	if req.Concurrency < 0 || req.Concurrency > maxBulkConcurrency {
+		sendErrorStatus(w, r, http.StatusBadRequest, commands.CodeValidationFailed,
+			fmt.Sprintf("concurrency must be between 1 and %d", maxBulkConcurrency), map[string]interface{}{"field": "concurrency"})
+		return
+	}
+
+	h, release, failure := s.openCluster(r)
+	if failure != nil {
+		logger.Error("Failed to create Kafka client for bulk topic operation", "broker", broker, "error", failure.Err)
+		sendFailure(w, r, "Failed to connect to Kafka", failure)
+		return
+	}
+	defer release()
+
+	s.bulkTopics(w, r, h, req, operation, details)
+}
+
+func (s *Server) bulkTopics(w http.ResponseWriter, r *http.Request, h *cluster.Handle, req BulkTopicRequest, operation audit.Operation, details map[string]any) {
+	broker := r.PathValue("broker")
+
+	selector := commands.TopicSelector{Pattern: req.Match, Regex: req.Regex, IncludeInternal: req.IncludeInternal}
+	selected, failure := commands.SelectTopics(r.Context(), h, selector)
+	if failure != nil {
+		sendFailure(w, r, "Failed to select topics", failure)
+		return
+	}
+
+	report := BulkTopicReport{Topics: selected}
+	if req.DryRun || len(selected) == 0 {
+		sendJSON(w, http.StatusOK, Response{Status: "ok", Message: fmt.Sprintf("%d topics match '%s'", len(selected), req.Match), Data: report})
+		return
+	}
+
+	names := make([]string, 0, len(selected))
+	for _, topic := range selected {
+		names = append(names, topic.Name)
+	}
+	logger.Info("Bulk topic operation request details", "broker", broker, "action", req.Action, "match", req.Match, "topic_count", len(names))
+
+	var results []commands.TopicResult
+	if req.Action == "delete" {
+		results, failure = commands.DeleteTopics(r.Context(), h, names, req.Concurrency)
+	} else {
+		results, failure = commands.UpdateTopics(r.Context(), h, names, req.NewPartitions, req.Concurrency)
+	}
+	if failure != nil {
+		sendFailure(w, r, "Failed to "+req.Action+" topics", failure)
+		return
+	}
+	for _, result := range results {
+		s.recordAudit(r, operation, result.Topic, result.Failure, details)
+	}
+
+	report.Results = results
+	report.Failed = commands.CountFailures(results)
+	report.Succeeded = len(results) - report.Failed
+	logger.Info("Bulk topic operation finished", "broker", broker, "action", req.Action, "succeeded", report.Succeeded, "failed", report.Failed)
+	sendJSON(w, http.StatusOK, Response{
+		Status:  "ok",
+		Message: fmt.Sprintf("%d succeeded, %d failed", report.Succeeded, report.Failed),
+		Data:    report,
+	})
+}
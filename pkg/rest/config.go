@@ -0,0 +1,145 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/IBM/openkommander/pkg/audit"
+)
+
+// Duration is a time.Duration that is written to and read from JSON as a string like "30s"
+type Duration struct {
+	time.Duration
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("duration must be a string like \"30s\": %w", err)
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	d.Duration = parsed
+	return nil
+}
+
+// ServerConfig holds the REST server settings. It is read from a JSON file and can be
+// overridden by flags of `ok server start`.
+type ServerConfig struct {
+	BindAddress       string   `json:"bindAddress"`
+	Port              string   `json:"port"`
+	TLSCertFile       string   `json:"tlsCertFile,omitempty"`
+	TLSKeyFile        string   `json:"tlsKeyFile,omitempty"`
+	ReadTimeout       Duration `json:"readTimeout"`
+	ReadHeaderTimeout Duration `json:"readHeaderTimeout"`
+	WriteTimeout      Duration `json:"writeTimeout"`
+	IdleTimeout       Duration `json:"idleTimeout"`
+	ShutdownTimeout   Duration `json:"shutdownTimeout"`
+	MaxBodyBytes      int64    `json:"maxBodyBytes"`
+	CORSOrigins       []string `json:"corsOrigins,omitempty"`
+	// FrontendDir overrides where the UI is served from. When empty the UI embedded in the
+	// binary is used, falling back to ~/.ok/frontend for builds without it.
+	FrontendDir    string `json:"frontendDir,omitempty"`
+	PersistSamples bool   `json:"persistSamples"`
+	// ValidateRequests rejects API requests that do not match docs/openapi.yaml with a 400.
+	// ValidateResponses logs a warning for every API response that does not match it.
+	ValidateRequests  bool `json:"validateRequests"`
+	ValidateResponses bool `json:"validateResponses"`
+	// ReadOnly refuses every API request that could change a cluster with a 403
+	ReadOnly bool `json:"readOnly"`
+	// TrustedProxies are the IP addresses or CIDR ranges of proxies whose X-Forwarded-User,
+	// X-Remote-User and X-Forwarded-For headers name the caller in the audit log
+	TrustedProxies []string `json:"trustedProxies,omitempty"`
+}
+
+func DefaultServerConfig() *ServerConfig {
+	return &ServerConfig{
+		BindAddress:       "",
+		Port:              "8081",
+		ReadTimeout:       Duration{30 * time.Second},
+		ReadHeaderTimeout: Duration{10 * time.Second},
+		WriteTimeout:      Duration{60 * time.Second},
+		IdleTimeout:       Duration{120 * time.Second},
+		ShutdownTimeout:   Duration{15 * time.Second},
+		MaxBodyBytes:      1 << 20,
+		ValidateRequests:  true,
+	}
+}
+
+// LoadServerConfig reads the config file at path on top of the defaults. A missing file
+// is not an error and yields the defaults.
+func LoadServerConfig(path string) (*ServerConfig, error) {
+	config := DefaultServerConfig()
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return config, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading server config %s: %w", path, err)
+	}
+
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("error decoding server config %s: %w", path, err)
+	}
+	return config, nil
+}
+
+func (c *ServerConfig) Validate() error {
+	if c.Port == "" || c.Port == "0" {
+		return fmt.Errorf("port number is required and cannot be 0")
+	}
+
+	portNumber, err := strconv.Atoi(c.Port)
+	if err != nil {
+		return fmt.Errorf("invalid port number: %s", c.Port)
+	}
+
+	if portNumber < 1 || portNumber > 65535 {
+		return fmt.Errorf("port number must be between 1 and 65535")
+	}
+
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		return fmt.Errorf("both a TLS certificate and key are required to serve HTTPS")
+	}
+
+	for name, d := range map[string]Duration{
+		"read timeout":        c.ReadTimeout,
+		"read header timeout": c.ReadHeaderTimeout,
+		"write timeout":       c.WriteTimeout,
+		"idle timeout":        c.IdleTimeout,
+		"shutdown timeout":    c.ShutdownTimeout,
+	} {
+		if d.Duration < 0 {
+			return fmt.Errorf("%s cannot be negative", name)
+		}
+	}
+
+	if c.MaxBodyBytes < 0 {
+		return fmt.Errorf("max body size cannot be negative")
+	}
+
+	if _, err := audit.ParseTrustedProxies(c.TrustedProxies); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (c *ServerConfig) Addr() string {
+	return net.JoinHostPort(c.BindAddress, c.Port)
+}
+
+func (c *ServerConfig) TLSEnabled() bool {
+	return c.TLSCertFile != "" && c.TLSKeyFile != ""
+}
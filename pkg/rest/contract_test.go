@@ -0,0 +1,318 @@
+package rest
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/IBM/openkommander/internal/core/commands"
+	"github.com/IBM/openkommander/pkg/audit"
+	"github.com/IBM/openkommander/pkg/session"
+	"github.com/IBM/sarama"
+)
+
+// contractCase is a request against the in-process server. The server runs with a session
+// that saves the mock broker but has no cluster logged in, so routes that need a logged-in
+// cluster answer 401.
+type contractCase struct {
+	name   string
+	method string
+	path   string
+	body   string
+	status int
+}
+
+func contractCases(broker string) []contractCase {
+	api := "/api/v1/" + broker
+	return []contractCase{
+		{"list topics", http.MethodGet, api + "/topics", "", http.StatusOK},
+		{"create topic", http.MethodPost, api + "/topics", `{"name":"payments","partitions":3,"replication_factor":1}`, http.StatusCreated},
+		{"create topic without name", http.MethodPost, api + "/topics", `{"partitions":3}`, http.StatusBadRequest},
+		{"create topic with invalid name", http.MethodPost, api + "/topics", `{"name":"bad name"}`, http.StatusBadRequest},
+		{"create topic with more replicas than brokers", http.MethodPost, api + "/topics", `{"name":"payments","partitions":3,"replication_factor":3}`, http.StatusBadRequest},
+		{"create topic with malformed body", http.MethodPost, api + "/topics", `{"name":`, http.StatusBadRequest},
+		{"delete topic", http.MethodDelete, api + "/topics", `{"name":"orders"}`, http.StatusOK},
+		{"delete topic without body", http.MethodDelete, api + "/topics", "", http.StatusBadRequest},
+		{"bulk delete topics", http.MethodPost, api + "/topics/bulk", `{"action":"delete","match":"ord*","confirm":"ord*"}`, http.StatusOK},
+		{"bulk delete topics without confirm", http.MethodPost, api + "/topics/bulk", `{"action":"delete","match":"*"}`, http.StatusBadRequest},
+		{"bulk delete topics with another confirm", http.MethodPost, api + "/topics/bulk", `{"action":"delete","match":"*","confirm":"ord*"}`, http.StatusBadRequest},
+		{"bulk delete dry run without confirm", http.MethodPost, api + "/topics/bulk", `{"action":"delete","match":"*","dry_run":true}`, http.StatusOK},
+		{"bulk update dry run", http.MethodPost, api + "/topics/bulk", `{"action":"update","match":"o.*","regex":true,"new_partitions":6,"dry_run":true}`, http.StatusOK},
+		{"bulk update without partitions", http.MethodPost, api + "/topics/bulk", `{"action":"update","match":"orders"}`, http.StatusBadRequest},
+		{"bulk with invalid regex", http.MethodPost, api + "/topics/bulk", `{"action":"delete","match":"(","regex":true}`, http.StatusBadRequest},
+		{"topics method not allowed", http.MethodPut, api + "/topics", "", http.StatusMethodNotAllowed},
+		{"search topic", http.MethodGet, api + "/topics/orders/search?json_path=status%3Dpaid&limit=2", "", http.StatusOK},
+		{"search topic with invalid limit", http.MethodGet, api + "/topics/orders/search?limit=0", "", http.StatusBadRequest},
+		{"search topic with invalid regex", http.MethodGet, api + "/topics/orders/search?regex=(", "", http.StatusBadRequest},
+		{"list brokers", http.MethodGet, api + "/brokers", "", http.StatusOK},
+		{"create broker", http.MethodPost, api + "/brokers", "", http.StatusNotImplemented},
+		{"message rates", http.MethodGet, api + "/metrics/messages/minute", "", http.StatusOK},
+		{"message rates over 5m", http.MethodGet, api + "/metrics/messages/minute?window=5m", "", http.StatusOK},
+		{"message rates with invalid window", http.MethodGet, api + "/metrics/messages/minute?window=2m", "", http.StatusBadRequest},
+		{"message rates of an unsaved broker", http.MethodGet, "/api/v1/unsaved:9092/metrics/messages/minute", "", http.StatusNotFound},
+		{"status", http.MethodGet, api + "/status", "", http.StatusOK},
+		{"health", http.MethodGet, api + "/health", "", http.StatusOK},
+		{"cluster health", http.MethodGet, api + "/cluster/health", "", http.StatusOK},
+		{"cluster health with skew", http.MethodGet, api + "/cluster/health?max_leader_skew=25", "", http.StatusOK},
+		{"cluster health with negative skew", http.MethodGet, api + "/cluster/health?max_leader_skew=-1", "", http.StatusBadRequest},
+		{"list clusters", http.MethodGet, "/api/v1/clusters", "", http.StatusUnauthorized},
+		{"cluster metadata", http.MethodGet, "/api/v1/clusters/local/metadata", "", http.StatusUnauthorized},
+		{"prometheus metrics", http.MethodGet, "/metrics", "", http.StatusOK},
+		{"prometheus metrics head", http.MethodHead, "/metrics", "", http.StatusOK},
+		{"liveness", http.MethodGet, "/healthz", "", http.StatusOK},
+		{"liveness head", http.MethodHead, "/healthz", "", http.StatusOK},
+		{"readiness", http.MethodGet, "/readyz?timeout=1s", "", http.StatusOK},
+		{"readiness head", http.MethodHead, "/readyz?timeout=1s", "", http.StatusOK},
+		{"readiness with invalid timeout", http.MethodGet, "/readyz?timeout=soon", "", http.StatusBadRequest},
+	}
+}
+
+func newContractServer(t *testing.T) (*Server, *sarama.MockBroker) {
+	t.Helper()
+
+	previousAudit := audit.Default()
+	audit.SetDefault(audit.NewLog(filepath.Join(t.TempDir(), "audit.log")))
+	t.Cleanup(func() { audit.SetDefault(previousAudit) })
+
+	sessions, err := session.OpenSessionManager(filepath.Join(t.TempDir(), ".ok_config"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	session.SetDefault(sessions)
+	t.Cleanup(func() { session.SetDefault(nil) })
+
+	broker := sarama.NewMockBroker(t, 1)
+	// A saved profile for the broker, not selected, so its message rates are sampled
+	if err := sessions.AddCluster(session.ClusterConnection{Name: "local", Brokers: []string{broker.Addr()}}, false); err != nil {
+		t.Fatal(err)
+	}
+	fetch := sarama.NewMockFetchResponse(t, 10).SetHighWaterMark("orders", 0, 10)
+	for offset := int64(0); offset < 10; offset++ {
+		status := "open"
+		if offset%2 == 0 {
+			status = "paid"
+		}
+		fetch.SetMessageWithKey("orders", 0, offset, sarama.StringEncoder(fmt.Sprintf("order-%d", offset)), sarama.StringEncoder(`{"status":"`+status+`"}`))
+	}
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		// Advertise the APIs of Kafka 2.1, which the server detects as the cluster version.
+		// The mock cannot encode CreateTopics v5 responses, so advertise v4 at most.
+		"ApiVersionsRequest": sarama.NewMockApiVersionsResponse(t).SetApiKeys([]sarama.ApiVersionsResponseKey{
+			{ApiKey: 0, MinVersion: 0, MaxVersion: 7},
+			{ApiKey: 1, MinVersion: 0, MaxVersion: 10},
+			{ApiKey: 19, MinVersion: 0, MaxVersion: 4},
+			{ApiKey: 21, MinVersion: 0, MaxVersion: 1},
+			{ApiKey: 37, MinVersion: 0, MaxVersion: 1},
+			{ApiKey: 42, MinVersion: 0, MaxVersion: 1},
+		}),
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetController(broker.BrokerID()).
+			SetLeader("orders", 0, broker.BrokerID()),
+		"DescribeConfigsRequest": sarama.NewMockDescribeConfigsResponse(t),
+		"CreateTopicsRequest":    sarama.NewMockCreateTopicsResponse(t),
+		"DeleteTopicsRequest":    sarama.NewMockDeleteTopicsResponse(t),
+		"ListGroupsRequest":      sarama.NewMockListGroupsResponse(t),
+		"OffsetRequest": sarama.NewMockOffsetResponse(t).
+			SetOffset("orders", 0, sarama.OffsetOldest, 0).
+			SetOffset("orders", 0, sarama.OffsetNewest, 10),
+		"FetchRequest": fetch,
+	})
+
+	frontendDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(frontendDir, "index.html"), []byte("<html></html>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config := DefaultServerConfig()
+	config.FrontendDir = frontendDir
+	s, err := NewServer(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := s.Stop(context.Background()); err != nil {
+			t.Errorf("stopping server: %v", err)
+		}
+		broker.Close()
+	})
+	return s, broker
+}
+
+func TestContractRoutesMatchSpec(t *testing.T) {
+	s, _ := newContractServer(t)
+
+	served := map[string]bool{}
+	for _, route := range s.apiRoutes() {
+		served[route.pattern] = true
+		if _, ok := apiSpec.Paths[route.pattern]; !ok {
+			t.Errorf("route %s is served but not documented in docs/openapi.yaml", route.pattern)
+		}
+	}
+	for path := range apiSpec.Paths {
+		if !served[path] {
+			t.Errorf("path %s is documented in docs/openapi.yaml but not served", path)
+		}
+	}
+}
+
+func TestContractCoversEveryOperation(t *testing.T) {
+	covered := map[string]bool{}
+	for _, c := range contractCases("localhost:9092") {
+		route, _, _ := apiSpec.FindRoute(c.method, strings.SplitN(c.path, "?", 2)[0])
+		if route != nil {
+			covered[route.Method+" "+route.Path] = true
+		}
+	}
+	for _, route := range apiSpec.Routes() {
+		if !covered[route.Method+" "+route.Path] {
+			t.Errorf("%s %s is documented but has no contract case", route.Method, route.Path)
+		}
+	}
+}
+
+func TestContract(t *testing.T) {
+	s, broker := newContractServer(t)
+
+	for _, c := range contractCases(broker.Addr()) {
+		t.Run(c.name, func(t *testing.T) {
+			request := httptest.NewRequest(c.method, c.path, strings.NewReader(c.body))
+			if c.body != "" {
+				request.Header.Set("Content-Type", "application/json")
+			}
+			recorder := httptest.NewRecorder()
+			s.httpServer.Handler.ServeHTTP(recorder, request)
+
+			if recorder.Header().Get(requestIDHeader) == "" {
+				t.Errorf("response has no %s header", requestIDHeader)
+			}
+			if recorder.Code != c.status {
+				t.Fatalf("status = %d, want %d, body: %s", recorder.Code, c.status, recorder.Body.String())
+			}
+
+			route, _, pathFound := apiSpec.FindRoute(c.method, request.URL.Path)
+			if route == nil {
+				if pathFound && recorder.Code == http.StatusMethodNotAllowed {
+					return
+				}
+				t.Fatalf("%s %s is not documented", c.method, request.URL.Path)
+			}
+			if err := route.ValidateResponse(recorder.Code, recorder.Header(), recorder.Body.Bytes()); err != nil {
+				t.Errorf("response does not match docs/openapi.yaml: %v\nbody: %s", err, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestReadOnlyRefusesChanges(t *testing.T) {
+	s, broker := newContractServer(t)
+	topics := "/api/v1/" + broker.Addr() + "/topics"
+
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, path, strings.NewReader(body))
+		request.Header.Set("Content-Type", "application/json")
+		recorder := httptest.NewRecorder()
+		s.httpServer.Handler.ServeHTTP(recorder, request)
+
+		route, _, _ := apiSpec.FindRoute(method, request.URL.Path)
+		if err := route.ValidateResponse(recorder.Code, recorder.Header(), recorder.Body.Bytes()); err != nil {
+			t.Errorf("%s %s: response does not match docs/openapi.yaml: %v", method, path, err)
+		}
+		return recorder
+	}
+
+	// A read-only profile listing the broker protects it from the REST API too
+	if err := session.Default().AddCluster(session.ClusterConnection{Name: "prod", Brokers: []string{broker.Addr()}, ReadOnly: true}, false); err != nil {
+		t.Fatal(err)
+	}
+	if r := serve(http.MethodDelete, topics, `{"name":"orders"}`); r.Code != http.StatusForbidden || !strings.Contains(r.Body.String(), commands.CodeReadOnly) {
+		t.Errorf("delete on a read-only cluster: status = %d, body: %s", r.Code, r.Body.String())
+	}
+
+	// The profile protects the cluster whichever address reaches it
+	_, port, _ := strings.Cut(broker.Addr(), ":")
+	alias := "localhost:" + port
+	if r := serve(http.MethodDelete, "/api/v1/"+alias+"/topics", `{"name":"orders"}`); r.Code != http.StatusForbidden || !strings.Contains(r.Body.String(), commands.CodeReadOnly) {
+		t.Errorf("delete through an alias of a read-only cluster: status = %d, body: %s", r.Code, r.Body.String())
+	}
+	if err := session.Default().UpdateCluster("prod", func(connection *session.ClusterConnection) error {
+		connection.Brokers = []string{alias}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if r := serve(http.MethodDelete, topics, `{"name":"orders"}`); r.Code != http.StatusForbidden || !strings.Contains(r.Body.String(), commands.CodeReadOnly) {
+		t.Errorf("delete on a cluster whose read-only profile lists an alias: status = %d, body: %s", r.Code, r.Body.String())
+	}
+
+	if err := session.Default().RemoveCluster("prod"); err != nil {
+		t.Fatal(err)
+	}
+	if r := serve(http.MethodDelete, "/api/v1/"+alias+"/topics", `{"name":"orders"}`); r.Code != http.StatusOK {
+		t.Errorf("delete through an alias once the read-only profile is removed: status = %d, body: %s", r.Code, r.Body.String())
+	}
+
+	// A read-only profile that cannot be reached may be the same cluster, so changes are
+	// refused while reads are not slowed down by it
+	if err := session.Default().AddCluster(session.ClusterConnection{Name: "offline", Brokers: []string{"127.0.0.1:1"}, Version: "2.1.0", ReadOnly: true}, false); err != nil {
+		t.Fatal(err)
+	}
+	if r := serve(http.MethodGet, topics, ""); r.Code != http.StatusOK {
+		t.Errorf("list with an unreachable read-only profile: status = %d, want 200", r.Code)
+	}
+	if r := serve(http.MethodDelete, topics, `{"name":"orders"}`); r.Code != http.StatusServiceUnavailable || !strings.Contains(r.Body.String(), "offline") {
+		t.Errorf("delete with an unreachable read-only profile: status = %d, body: %s", r.Code, r.Body.String())
+	}
+	if err := session.Default().RemoveCluster("offline"); err != nil {
+		t.Fatal(err)
+	}
+
+	s.config.ReadOnly = true
+	if r := serve(http.MethodPost, topics, `{"name":"payments","partitions":3,"replication_factor":1}`); r.Code != http.StatusForbidden {
+		t.Errorf("create in read-only mode: status = %d, want 403", r.Code)
+	}
+	if r := serve(http.MethodGet, topics, ""); r.Code != http.StatusOK {
+		t.Errorf("list in read-only mode: status = %d, want 200", r.Code)
+	}
+}
+
+func TestSearchStreamsMatches(t *testing.T) {
+	s, broker := newContractServer(t)
+
+	request := httptest.NewRequest(http.MethodGet, "/api/v1/"+broker.Addr()+"/topics/orders/search?json_path=status%3Dpaid&limit=3", nil)
+	request.Header.Set("Accept", "application/x-ndjson")
+	recorder := httptest.NewRecorder()
+	s.httpServer.Handler.ServeHTTP(recorder, request)
+
+	if recorder.Code != http.StatusOK || recorder.Header().Get("Content-Type") != "application/x-ndjson" {
+		t.Fatalf("status = %d, content type = %s, body: %s", recorder.Code, recorder.Header().Get("Content-Type"), recorder.Body.String())
+	}
+	var events []SearchEvent
+	scanner := bufio.NewScanner(recorder.Body)
+	for scanner.Scan() {
+		var event SearchEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatalf("line %q: %v", scanner.Text(), err)
+		}
+		events = append(events, event)
+	}
+
+	if len(events) != 4 {
+		t.Fatalf("got %d events, want 3 matches and a summary: %s", len(events), recorder.Body.String())
+	}
+	for i, event := range events[:3] {
+		if event.Match == nil || event.Match.Offset != int64(2*i) || *event.Match.Key != fmt.Sprintf("order-%d", 2*i) {
+			t.Errorf("event %d = %+v, want the match at offset %d", i, event, 2*i)
+		}
+	}
+	if summary := events[3].Summary; summary == nil || summary.Matches != 3 || !summary.LimitReached {
+		t.Errorf("last event = %+v, want a summary of 3 matches at the limit", events[3])
+	}
+}
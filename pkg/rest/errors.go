@@ -0,0 +1,113 @@
+package rest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/IBM/openkommander/internal/core/commands"
+	"github.com/IBM/openkommander/pkg/logger"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+// ErrorBody is the structured error returned by every API handler. The top level
+// Response.Message repeats Message for clients that only read that field.
+type ErrorBody struct {
+	Code      string      `json:"code"`
+	Message   string      `json:"message"`
+	Details   interface{} `json:"details,omitempty"`
+	RequestID string      `json:"request_id,omitempty"`
+}
+
+// ensureRequestID reuses the caller's X-Request-ID or generates one, and echoes it on the response
+func ensureRequestID(w http.ResponseWriter, r *http.Request) {
+	id := r.Header.Get(requestIDHeader)
+	if id == "" || len(id) > 128 {
+		buf := make([]byte, 16)
+		if _, err := rand.Read(buf); err != nil {
+			return
+		}
+		id = hex.EncodeToString(buf)
+		r.Header.Set(requestIDHeader, id)
+	}
+	w.Header().Set(requestIDHeader, id)
+}
+
+func requestID(r *http.Request) string {
+	return r.Header.Get(requestIDHeader)
+}
+
+// sendErrorStatus writes the error envelope with an explicit status and code
+func sendErrorStatus(w http.ResponseWriter, r *http.Request, status int, code, message string, details interface{}) {
+	if status >= http.StatusInternalServerError {
+		logger.Error(message, "code", code, "request_id", requestID(r), "path", r.URL.Path)
+	} else {
+		logger.Warn(message, "code", code, "request_id", requestID(r), "path", r.URL.Path)
+	}
+
+	sendJSON(w, status, Response{
+		Status:  "error",
+		Message: message,
+		Error: &ErrorBody{
+			Code:      code,
+			Message:   message,
+			Details:   details,
+			RequestID: requestID(r),
+		},
+	})
+}
+
+// sendError writes the error envelope for err, deriving the status and code from it
+func sendError(w http.ResponseWriter, r *http.Request, message string, err error) {
+	status, code := commands.ClassifyError(err)
+	if err == nil {
+		status, code = http.StatusInternalServerError, commands.CodeInternal
+	} else {
+		message = fmt.Sprintf("%s: %v", message, err)
+	}
+	sendErrorStatus(w, r, status, code, message, nil)
+}
+
+// sendFailure writes the error envelope for a failure returned by the commands layer
+func sendFailure(w http.ResponseWriter, r *http.Request, message string, failure *commands.Failure) {
+	status := failure.HttpCode
+	if status == 0 {
+		status = http.StatusInternalServerError
+	}
+	code := failure.Code
+	if code == "" {
+		code = commands.CodeForStatus(status)
+	}
+	sendErrorStatus(w, r, status, code, fmt.Sprintf("%s: %v", message, failure.Err), nil)
+}
+
+func sendMethodNotAllowed(w http.ResponseWriter, r *http.Request, allowedMethods ...string) {
+	w.Header().Set("Allow", strings.Join(allowedMethods, ", "))
+	sendErrorStatus(w, r, http.StatusMethodNotAllowed, commands.CodeMethodNotAllowed,
+		fmt.Sprintf("Method %s not allowed", r.Method), map[string]interface{}{"allowed": allowedMethods})
+}
+
+// decodeJSONBody decodes the request body into dst, reporting oversized and malformed
+// bodies as client errors
+func decodeJSONBody(r *http.Request, dst interface{}) *commands.Failure {
+	err := json.NewDecoder(r.Body).Decode(dst)
+	if err == nil {
+		return nil
+	}
+
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &maxBytesErr):
+		return commands.NewFailure(fmt.Sprintf("request body exceeds %d bytes", maxBytesErr.Limit), http.StatusRequestEntityTooLarge)
+	case errors.Is(err, io.EOF):
+		return commands.NewFailure("request body is empty", http.StatusBadRequest)
+	default:
+		return commands.NewFailure(err.Error(), http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,100 @@
+package rest
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/IBM/openkommander/frontend"
+	"github.com/IBM/openkommander/internal/core/commands"
+	"github.com/IBM/openkommander/pkg/constants"
+)
+
+const (
+	// Vite fingerprints everything under assets/, so those files never change
+	immutableCacheControl = "public, max-age=31536000, immutable"
+	// Everything else, index.html in particular, must be revalidated so new builds are picked up
+	revalidateCacheControl = "no-cache"
+)
+
+// resolveFrontend picks where the UI is served from: the configured directory when one is
+// given, otherwise the embedded build, otherwise the default directory under ~/.ok
+func resolveFrontend(frontendDir string) (fsys fs.FS, source string) {
+	if frontendDir != "" {
+		return os.DirFS(frontendDir), frontendDir
+	}
+	if embedded, ok := frontend.FS(); ok {
+		return embedded, "embedded"
+	}
+	defaultDir := path.Join(constants.OpenKommanderFolder, "frontend")
+	return os.DirFS(defaultDir), defaultDir
+}
+
+// frontendHandler serves the single page app: existing files are served with cache headers,
+// and any other path without a file extension falls back to index.html so the frontend
+// router can handle it
+func frontendHandler(fsys fs.FS) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Block unmatched API routes
+		if strings.HasPrefix(r.URL.Path, "/api") {
+			sendErrorStatus(w, r, http.StatusNotFound, commands.CodeNotFound, fmt.Sprintf("No API route matches %s", r.URL.Path), nil)
+			return
+		}
+
+		if !enforceMethod(w, r, []string{http.MethodGet, http.MethodHead}) {
+			return
+		}
+
+		name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+		if name == "" {
+			name = "index.html"
+		}
+
+		if isFile(fsys, name) {
+			serveFrontendFile(w, r, fsys, name)
+			return
+		}
+
+		// Missing assets are a real 404 rather than the app shell
+		if path.Ext(name) != "" || !isFile(fsys, "index.html") {
+			http.Error(w, "404 Not Found", http.StatusNotFound)
+			return
+		}
+		serveFrontendFile(w, r, fsys, "index.html")
+	})
+}
+
+func serveFrontendFile(w http.ResponseWriter, r *http.Request, fsys fs.FS, name string) {
+	if strings.HasPrefix(name, "assets/") {
+		w.Header().Set("Cache-Control", immutableCacheControl)
+	} else {
+		w.Header().Set("Cache-Control", revalidateCacheControl)
+	}
+	if name == "index.html" {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	}
+	http.ServeFileFS(w, r, fsys, name)
+}
+
+func isFile(fsys fs.FS, name string) bool {
+	info, err := fs.Stat(fsys, name)
+	if err != nil {
+		return false
+	}
+	return !info.IsDir()
+}
+
+func hasFrontendIndex(fsys fs.FS) error {
+	info, err := fs.Stat(fsys, "index.html")
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return errors.New("index.html is a directory")
+	}
+	return nil
+}
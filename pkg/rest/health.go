@@ -0,0 +1,154 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/IBM/openkommander/internal/core/commands"
+	"github.com/IBM/openkommander/pkg/logger"
+	"github.com/IBM/openkommander/pkg/session"
+)
+
+const (
+	defaultReadyTimeout = 3 * time.Second
+	maxReadyTimeout     = 30 * time.Second
+)
+
+// DependencyCheck is the result of checking one dependency for readiness
+type DependencyCheck struct {
+	Name       string `json:"name"`
+	Status     string `json:"status"`
+	Target     string `json:"target,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+}
+
+// ReadinessReport lists every dependency check; Status is "ok" only when all checks pass
+type ReadinessReport struct {
+	Status string            `json:"status"`
+	Checks []DependencyCheck `json:"checks"`
+}
+
+// handleHealthz reports that the process is alive. It never touches Kafka so it is safe
+// to use as a liveness probe.
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	if !enforceMethod(w, r, []string{http.MethodGet, http.MethodHead}) {
+		return
+	}
+
+	sendJSON(w, http.StatusOK, Response{
+		Status: "ok",
+		Data: map[string]interface{}{
+			"uptime_seconds": time.Since(s.startTime).Seconds(),
+		},
+	})
+}
+
+// handleReadyz reports whether every configured cluster can be reached within the deadline
+// and the frontend assets are present. It responds 503 when any check fails. The optional
+// timeout query parameter (e.g. 2s) overrides the per-check deadline.
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	if !enforceMethod(w, r, []string{http.MethodGet, http.MethodHead}) {
+		return
+	}
+
+	timeout := defaultReadyTimeout
+	if value := r.URL.Query().Get("timeout"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 || parsed > maxReadyTimeout {
+			sendErrorStatus(w, r, http.StatusBadRequest, commands.CodeValidationFailed,
+				fmt.Sprintf("Invalid timeout '%s', expected a duration up to %s", value, maxReadyTimeout),
+				map[string]interface{}{"parameter": "timeout"})
+			return
+		}
+		timeout = parsed
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+
+	report := s.checkReadiness(ctx)
+
+	statusCode := http.StatusOK
+	if report.Status != "ok" {
+		statusCode = http.StatusServiceUnavailable
+		logger.Warn("Readiness check failed", "checks", len(report.Checks))
+	}
+	sendJSON(w, statusCode, Response{Status: report.Status, Data: report})
+}
+
+func (s *Server) checkReadiness(ctx context.Context) ReadinessReport {
+	connections := s.sessions.Clusters()
+	checks := make([]DependencyCheck, len(connections)+1)
+
+	var wg sync.WaitGroup
+	for i, connection := range connections {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			checks[i] = checkClusterReachable(ctx, connection)
+		}()
+	}
+	checks[len(connections)] = checkFrontendAssets(s.frontend, s.frontendSource)
+	wg.Wait()
+
+	report := ReadinessReport{Status: "ok", Checks: checks}
+	for _, check := range checks {
+		if check.Status != "ok" {
+			report.Status = "unavailable"
+		}
+	}
+	return report
+}
+
+// checkClusterReachable dials the cluster's brokers in turn and succeeds on the first one
+// that accepts a connection before the context deadline
+func checkClusterReachable(ctx context.Context, connection session.ClusterConnection) DependencyCheck {
+	start := time.Now()
+	check := DependencyCheck{Name: "cluster:" + connection.Name, Status: "ok"}
+
+	var dialer net.Dialer
+	errs := []error{}
+	for _, broker := range connection.Brokers {
+		conn, err := dialer.DialContext(ctx, "tcp", broker)
+		if err == nil {
+			check.Target = broker
+			if closeErr := conn.Close(); closeErr != nil {
+				logger.Debug("Failed to close readiness connection", "broker", broker, "error", closeErr)
+			}
+			check.DurationMs = time.Since(start).Milliseconds()
+			return check
+		}
+		errs = append(errs, err)
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	check.Status = "unavailable"
+	check.DurationMs = time.Since(start).Milliseconds()
+	if len(errs) == 0 {
+		check.Error = "no brokers configured"
+	} else {
+		check.Error = errors.Join(errs...).Error()
+	}
+	return check
+}
+
+func checkFrontendAssets(fsys fs.FS, source string) DependencyCheck {
+	start := time.Now()
+	check := DependencyCheck{Name: "frontend", Status: "ok", Target: source}
+
+	if err := hasFrontendIndex(fsys); err != nil {
+		check.Status = "unavailable"
+		check.Error = err.Error()
+	}
+	check.DurationMs = time.Since(start).Milliseconds()
+	return check
+}
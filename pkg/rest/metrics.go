@@ -0,0 +1,119 @@
+package rest
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/IBM/openkommander/pkg/logger"
+	"github.com/IBM/openkommander/pkg/sampler"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	httpRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "openkommander_http_requests_total",
+		Help: "Total HTTP requests handled by the REST server.",
+	}, []string{"method", "route", "code"})
+	httpRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "openkommander_http_request_duration_seconds",
+		Help:    "HTTP request latencies in seconds.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	clusterUpDesc = prometheus.NewDesc("openkommander_cluster_up",
+		"Whether the last sample of the cluster succeeded (1) or failed (0).", []string{"cluster"}, nil)
+	clusterLastCollectDesc = prometheus.NewDesc("openkommander_cluster_last_collect_timestamp_seconds",
+		"Unix time of the last successful sample of the cluster.", []string{"cluster"}, nil)
+	clusterBrokersDesc = prometheus.NewDesc("openkommander_cluster_brokers",
+		"Number of brokers in the cluster.", []string{"cluster"}, nil)
+	clusterUnderReplicatedDesc = prometheus.NewDesc("openkommander_cluster_under_replicated_partitions",
+		"Number of partitions whose in-sync replica set is smaller than the replica set.", []string{"cluster"}, nil)
+	topicPartitionsDesc = prometheus.NewDesc("openkommander_topic_partitions",
+		"Number of partitions of the topic.", []string{"cluster", "topic"}, nil)
+	topicLogEndOffsetDesc = prometheus.NewDesc("openkommander_topic_log_end_offset",
+		"Sum of the log-end offsets of all partitions of the topic.", []string{"cluster", "topic"}, nil)
+	consumerGroupLagDesc = prometheus.NewDesc("openkommander_consumer_group_lag",
+		"Sum of the lag of the consumer group over all partitions of the topic.", []string{"cluster", "group", "topic"}, nil)
+)
+
+// observeRequest records a finished request for the HTTP metrics. The route label uses the
+// matched ServeMux pattern rather than the raw path to keep cardinality bounded.
+func observeRequest(r *http.Request, statusCode int, duration time.Duration) {
+	route := r.Pattern
+	if route == "" {
+		route = "unmatched"
+	}
+	httpRequestsTotal.WithLabelValues(r.Method, route, strconv.Itoa(statusCode)).Inc()
+	httpRequestDuration.WithLabelValues(r.Method, route).Observe(duration.Seconds())
+}
+
+// newMetricsHandler serves the HTTP metrics, the Go runtime and process metrics and the
+// Kafka metrics of the server's samplers in the Prometheus formats
+func newMetricsHandler(samplers *sampler.Manager) http.Handler {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequestsTotal,
+		httpRequestDuration,
+		kafkaCollector{samplers: samplers},
+	)
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{ErrorLog: promErrorLog{}})
+}
+
+// kafkaCollector exports what the samplers last recorded, so scrapes never touch the brokers
+// and every cluster is polled by its sampler only
+type kafkaCollector struct {
+	samplers *sampler.Manager
+}
+
+func (c kafkaCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{
+		clusterUpDesc, clusterLastCollectDesc, clusterBrokersDesc, clusterUnderReplicatedDesc,
+		topicPartitionsDesc, topicLogEndOffsetDesc, consumerGroupLagDesc,
+	} {
+		ch <- desc
+	}
+}
+
+func (c kafkaCollector) Collect(ch chan<- prometheus.Metric) {
+	gauge := func(desc *prometheus.Desc, value float64, labels ...string) {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value, labels...)
+	}
+
+	for _, cluster := range c.samplers.Snapshots() {
+		up := 0.0
+		if cluster.Up {
+			up = 1
+		}
+		gauge(clusterUpDesc, up, cluster.Cluster)
+		if cluster.Snapshot == nil {
+			continue
+		}
+
+		gauge(clusterLastCollectDesc, float64(cluster.Time.Unix()), cluster.Cluster)
+		gauge(clusterBrokersDesc, float64(cluster.Brokers), cluster.Cluster)
+		gauge(clusterUnderReplicatedDesc, float64(cluster.UnderReplicated), cluster.Cluster)
+		for topic, count := range cluster.Partitions {
+			gauge(topicPartitionsDesc, float64(count), cluster.Cluster, topic)
+		}
+		for topic, offset := range cluster.LogEndOffsets {
+			gauge(topicLogEndOffsetDesc, float64(offset), cluster.Cluster, topic)
+		}
+		for group, topics := range cluster.GroupLag {
+			for topic, lag := range topics {
+				gauge(consumerGroupLagDesc, float64(lag), cluster.Cluster, group, topic)
+			}
+		}
+	}
+}
+
+// promErrorLog sends errors of the metrics handler to the server log
+type promErrorLog struct{}
+
+func (promErrorLog) Println(v ...interface{}) {
+	logger.Warn("Failed to serve metrics", "error", v)
+}
@@ -0,0 +1,95 @@
+package rest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/IBM/openkommander/internal/core/commands"
+)
+
+// serverMiddleware wraps the router with the server wide request handling configured in
+// ServerConfig: request IDs, request body limits, CORS, read-only mode and shutdown notification for streaming requests
+func (s *Server) serverMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ensureRequestID(w, r)
+
+		if s.config.MaxBodyBytes > 0 && r.Body != nil {
+			r.Body = http.MaxBytesReader(w, r.Body, s.config.MaxBodyBytes)
+		}
+
+		if !s.handleCORS(w, r) {
+			return
+		}
+
+		if s.config.ReadOnly {
+			if isMutatingAPIRequest(r) {
+				sendErrorStatus(w, r, http.StatusForbidden, commands.CodeReadOnly,
+					fmt.Sprintf("%s %s refused: the server is in read-only mode", r.Method, r.URL.Path), nil)
+				return
+			}
+			// Commands check the context too, so nothing reaches Kafka through a route
+			// that is not recognised as mutating
+			r = r.WithContext(commands.WithReadOnly(r.Context()))
+		}
+
+		// Streaming responses keep their connection busy, so Shutdown would wait on them until
+		// its deadline. Cancel their context as soon as shutdown starts so they can finish cleanly.
+		if isStreamingRequest(r) {
+			ctx, cancel := context.WithCancel(r.Context())
+			defer cancel()
+			stop := context.AfterFunc(s.shutdownCtx, cancel)
+			defer stop()
+			r = r.WithContext(ctx)
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isMutatingAPIRequest reports whether a request may change a cluster. Every API route
+// that changes something uses a method other than GET or HEAD.
+func isMutatingAPIRequest(r *http.Request) bool {
+	if !strings.HasPrefix(r.URL.Path, "/api/") {
+		return false
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	default:
+		return true
+	}
+}
+
+// handleCORS sets the CORS headers for allowed origins and answers preflight requests.
+// It returns false when the request has been fully handled.
+func (s *Server) handleCORS(w http.ResponseWriter, r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || len(s.config.CORSOrigins) == 0 {
+		return true
+	}
+
+	allowed := slices.Contains(s.config.CORSOrigins, "*") || slices.Contains(s.config.CORSOrigins, origin)
+	if !allowed {
+		return true
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", origin)
+	w.Header().Add("Vary", "Origin")
+
+	if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Request-ID")
+		w.Header().Set("Access-Control-Max-Age", "600")
+		w.WriteHeader(http.StatusNoContent)
+		return false
+	}
+	return true
+}
+
+func isStreamingRequest(r *http.Request) bool {
+	accept := r.Header.Get("Accept")
+	return strings.Contains(accept, "text/event-stream") || strings.Contains(accept, "application/x-ndjson")
+}
@@ -0,0 +1,170 @@
+package rest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/IBM/openkommander/internal/core/commands"
+	"github.com/IBM/openkommander/pkg/cluster"
+	"github.com/IBM/openkommander/pkg/logger"
+)
+
+const (
+	// defaultSearchLimit is how many matches a search returns without a limit parameter
+	defaultSearchLimit = 100
+	// maxSearchLimit caps the matches of one search
+	maxSearchLimit = 10000
+)
+
+// SearchEvent is one line of a streamed search: a match, the final summary, or an error
+// that ended the search
+type SearchEvent struct {
+	Match   *commands.Record        `json:"match,omitempty"`
+	Summary *commands.SearchSummary `json:"summary,omitempty"`
+	Error   *ErrorBody              `json:"error,omitempty"`
+}
+
+// Handler for topic searches. Clients that accept application/x-ndjson get every match as
+// soon as it is found, one SearchEvent per line; others get all matches in one response.
+func (s *Server) handleSearchTopic(w http.ResponseWriter, r *http.Request) {
+	if !enforceMethod(w, r, []string{http.MethodGet}) {
+		return
+	}
+	broker := r.PathValue("broker")
+	topicName := r.PathValue("topic")
+
+	options, parameter, err := searchOptions(r)
+	if err != nil {
+		sendErrorStatus(w, r, http.StatusBadRequest, commands.CodeValidationFailed,
+			fmt.Sprintf("Invalid %s: %v", parameter, err), map[string]interface{}{"parameter": parameter})
+		return
+	}
+
+	h, release, failure := s.openCluster(r)
+	if failure != nil {
+		logger.Error("Failed to create Kafka client for topic search", "broker", broker, "error", failure.Err)
+		sendFailure(w, r, "Failed to connect to Kafka", failure)
+		return
+	}
+	defer release()
+
+	if isStreamingRequest(r) {
+		streamSearch(w, r, h, topicName, options)
+		return
+	}
+
+	result := commands.SearchResult{Records: []*commands.Record{}}
+	summary, failure := commands.SearchTopic(r.Context(), h, topicName, options, func(record *commands.Record) error {
+		result.Records = append(result.Records, record)
+		return nil
+	})
+	if failure != nil {
+		sendFailure(w, r, "Failed to search topic", failure)
+		return
+	}
+	result.SearchSummary = *summary
+	logger.Info("Topic search completed", "broker", broker, "topic", topicName, "matches", summary.Matches, "scanned", summary.Scanned)
+	sendJSON(w, http.StatusOK, Response{
+		Status:  "ok",
+		Message: fmt.Sprintf("%d matches in %d records", summary.Matches, summary.Scanned),
+		Data:    result,
+	})
+}
+
+// streamSearch writes the matches of a search as newline-delimited JSON. Errors found
+// before the first match are sent as a normal error response; later ones end the stream
+// with an error event.
+func streamSearch(w http.ResponseWriter, r *http.Request, h *cluster.Handle, topicName string, options commands.SearchOptions) {
+	broker := r.PathValue("broker")
+	controller := http.NewResponseController(w)
+	encoder := json.NewEncoder(w)
+	started := false
+	start := func() {
+		if started {
+			return
+		}
+		started = true
+		// A search can outlast the server's write timeout
+		_ = controller.SetWriteDeadline(time.Time{})
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.WriteHeader(http.StatusOK)
+	}
+	write := func(event SearchEvent) error {
+		start()
+		if err := encoder.Encode(event); err != nil {
+			return err
+		}
+		return controller.Flush()
+	}
+
+	summary, failure := commands.SearchTopic(r.Context(), h, topicName, options, func(record *commands.Record) error {
+		return write(SearchEvent{Match: record})
+	})
+	if failure != nil {
+		if !started {
+			sendFailure(w, r, "Failed to search topic", failure)
+			return
+		}
+		logger.Warn("Topic search ended with an error", "broker", broker, "topic", topicName, "error", failure.Err)
+		code := failure.Code
+		if code == "" {
+			code = commands.CodeForStatus(failure.HttpCode)
+		}
+		_ = write(SearchEvent{Error: &ErrorBody{Code: code, Message: failure.Err.Error(), RequestID: requestID(r)}})
+		return
+	}
+	logger.Info("Topic search completed", "broker", broker, "topic", topicName, "matches", summary.Matches, "scanned", summary.Scanned)
+	_ = write(SearchEvent{Summary: summary})
+}
+
+// searchOptions reads the search query parameters, returning the name of the first invalid one
+func searchOptions(r *http.Request) (commands.SearchOptions, string, error) {
+	query := r.URL.Query()
+	options := commands.SearchOptions{
+		OffsetRange: commands.OffsetRange{StartOffset: -1, EndOffset: -1},
+		Filter: commands.SearchFilter{
+			Key:      query.Get("key"),
+			Contains: query.Get("contains"),
+			Regex:    query.Get("regex"),
+			JSONPath: query.Get("json_path"),
+			Header:   query.Get("header"),
+		},
+		Limit: defaultSearchLimit,
+	}
+
+	for _, offset := range []struct {
+		parameter string
+		value     *int64
+	}{{"start_offset", &options.StartOffset}, {"end_offset", &options.EndOffset}} {
+		if value := query.Get(offset.parameter); value != "" {
+			parsed, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || parsed < 0 {
+				return options, offset.parameter, fmt.Errorf("'%s' is not an offset", value)
+			}
+			*offset.value = parsed
+		}
+	}
+	for _, bound := range []struct {
+		parameter string
+		value     *time.Time
+	}{{"start_time", &options.StartTime}, {"end_time", &options.EndTime}} {
+		if value := query.Get(bound.parameter); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return options, bound.parameter, fmt.Errorf("'%s' is not an RFC 3339 time", value)
+			}
+			*bound.value = parsed
+		}
+	}
+	if value := query.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxSearchLimit {
+			return options, "limit", fmt.Errorf("must be between 1 and %d", maxSearchLimit)
+		}
+		options.Limit = parsed
+	}
+	return options, "", nil
+}
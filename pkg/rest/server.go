@@ -4,18 +4,21 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io/fs"
 	"net/http"
 	"os"
 	"os/signal"
-	"slices"
-	"strings"
+	"strconv"
 	"syscall"
 	"time"
 
 	"github.com/IBM/openkommander/internal/core/commands"
+	"github.com/IBM/openkommander/pkg/audit"
+	"github.com/IBM/openkommander/pkg/cluster"
 	"github.com/IBM/openkommander/pkg/constants"
 	"github.com/IBM/openkommander/pkg/logger"
-	"github.com/IBM/sarama"
+	"github.com/IBM/openkommander/pkg/sampler"
+	"github.com/IBM/openkommander/pkg/session"
 )
 
 func wrapWithLogging(fn http.HandlerFunc) http.HandlerFunc {
@@ -25,15 +28,28 @@ func wrapWithLogging(fn http.HandlerFunc) http.HandlerFunc {
 }
 
 type Server struct {
-	httpServer  *http.Server
-	kafkaClient sarama.Client
-	startTime   time.Time
+	httpServer *http.Server
+	startTime  time.Time
+	samplers   *sampler.Manager
+	metrics    http.Handler
+	sessions   *session.SessionManager
+	config     *ServerConfig
+	// trustedProxies name the caller in audit entries through forwarded headers
+	trustedProxies audit.TrustedProxies
+
+	frontend       fs.FS
+	frontendSource string
+
+	// shutdownCtx is cancelled when shutdown starts, to end streaming requests
+	shutdownCtx    context.Context
+	signalShutdown context.CancelFunc
 }
 
 type Response struct {
 	Status  string      `json:"status"`
 	Message string      `json:"message,omitempty"`
 	Data    interface{} `json:"data,omitempty"`
+	Error   *ErrorBody  `json:"error,omitempty"`
 }
 
 type TopicRequest struct {
@@ -79,6 +95,7 @@ func LoggingMiddleware(next http.Handler) http.Handler {
 		next.ServeHTTP(wrapped, r)
 
 		duration := time.Since(start)
+		observeRequest(r, wrapped.statusCode, duration)
 		if isAPIRequest {
 			logger.HTTP("API request completed",
 				r.Method,
@@ -109,6 +126,11 @@ func (rw *responseWriter) WriteHeader(code int) {
 	rw.ResponseWriter.WriteHeader(code)
 }
 
+// Unwrap lets http.ResponseController flush streaming responses through the wrapper
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
 func enforceMethod(w http.ResponseWriter, r *http.Request, allowedMethods []string) bool {
 	for _, method := range allowedMethods {
 		if r.Method == method {
@@ -116,9 +138,7 @@ func enforceMethod(w http.ResponseWriter, r *http.Request, allowedMethods []stri
 		}
 	}
 
-	// Join allowed methods for header
-	w.Header().Set("Allow", strings.Join(allowedMethods, ", "))
-	http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	sendMethodNotAllowed(w, r, allowedMethods...)
 
 	logger.Info("Method Not Allowed",
 		"path", r.URL.Path,
@@ -128,180 +148,251 @@ func enforceMethod(w http.ResponseWriter, r *http.Request, allowedMethods []stri
 	return false
 }
 
-func NewServer(port string) (*Server, error) {
-	s := &Server{
-		kafkaClient: nil,
-		startTime:   time.Now(),
-	}
+// apiRoute is a route served outside the frontend. Every one of them is documented in
+// docs/openapi.yaml, which the contract tests enforce.
+type apiRoute struct {
+	pattern string
+	handler http.HandlerFunc
+}
 
-	router := http.NewServeMux()
+func (s *Server) apiRoutes() []apiRoute {
+	return []apiRoute{
+		// Topics endpoint supports GET, POST, DELETE
+		{"/api/v1/{broker}/topics", s.handleTopics},
 
-	// Topics endpoint supports GET, POST, DELETE
-	router.HandleFunc("/api/v1/{broker}/topics", wrapWithLogging(s.handleTopics))
+		// Bulk topics endpoint supports POST only
+		{"/api/v1/{broker}/topics/bulk", s.handleBulkTopics},
 
-	// Brokers endpoint supports GET, POST
-	router.HandleFunc("/api/v1/{broker}/brokers", wrapWithLogging(s.handleBrokers))
+		// Topic search endpoint supports GET only
+		{"/api/v1/{broker}/topics/{topic}/search", s.handleSearchTopic},
 
-	// Metrics/messages/minute endpoint supports GET only
-	router.HandleFunc("/api/v1/{broker}/metrics/messages/minute", wrapWithLogging(s.handleMessagesPerMinute))
+		// Brokers endpoint supports GET, POST
+		{"/api/v1/{broker}/brokers", s.handleBrokers},
 
-	// Status endpoint supports GET only
-	router.HandleFunc("/api/v1/{broker}/status", wrapWithLogging(s.handleStatus))
+		// Metrics/messages/minute endpoint supports GET only
+		{"/api/v1/{broker}/metrics/messages/minute", s.handleMessagesPerMinute},
 
-	// Health endpoint supports GET only
-	router.HandleFunc("/api/v1/{broker}/health", wrapWithLogging(s.handleHealth))
+		// Status endpoint supports GET only
+		{"/api/v1/{broker}/status", s.handleStatus},
 
-	// Clusters endpoint supports GET only
-	router.HandleFunc("/api/v1/clusters", wrapWithLogging(s.handleClusters))
+		// Health endpoint supports GET only
+		{"/api/v1/{broker}/health", s.handleHealth},
 
-	// Cluster metadata endpoint supports GET only
-	router.HandleFunc("/api/v1/clusters/{clusterId}/metadata", wrapWithLogging(s.handleClusterMetadata))
+		// Cluster health report endpoint supports GET only
+		{"/api/v1/{broker}/cluster/health", s.handleClusterHealth},
 
-	frontendDir := constants.OpenKommanderFolder + "/frontend"
-	fileServer := http.FileServer(http.Dir(frontendDir))
-	router.Handle("/static/", http.StripPrefix("/static/", fileServer))
+		// Clusters endpoint supports GET only
+		{"/api/v1/clusters", s.handleClusters},
 
-	router.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		filePath := frontendDir + r.URL.Path
+		// Cluster metadata endpoint supports GET only
+		{"/api/v1/clusters/{clusterId}/metadata", s.handleClusterMetadata},
 
-		// Serve static files directly if they exist
-		if _, err := os.Stat(filePath); err == nil {
-			if !enforceMethod(w, r, []string{http.MethodGet}) {
-				return
-			}
-			http.ServeFile(w, r, filePath)
-			return
-		}
+		// Prometheus metrics endpoint supports GET only
+		{"/metrics", s.metrics.ServeHTTP},
 
-		// Block unmatched API/static routes
-		if strings.HasPrefix(r.URL.Path, "/api") || strings.HasPrefix(r.URL.Path, "/static") {
-			http.Error(w, "404 Not Found", http.StatusNotFound)
-			return
-		}
+		// Liveness and readiness probes support GET and HEAD
+		{"/healthz", s.handleHealthz},
+		{"/readyz", s.handleReadyz},
+	}
+}
 
-		// Serve index.html for all other frontend GET requests and let frontend handle routing
-		indexPath := frontendDir + "/index.html"
-		if _, err := os.Stat(indexPath); err == nil {
-			if !enforceMethod(w, r, []string{http.MethodGet}) {
-				return
-			}
-			w.Header().Set("Content-Type", "text/html; charset=utf-8")
-			http.ServeFile(w, r, indexPath)
-			return
-		}
+func NewServer(config *ServerConfig) (*Server, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
 
-		// Fallback in case index.html missing
-		http.Error(w, "404 Not Found", http.StatusNotFound)
-	})
+	trustedProxies, err := audit.ParseTrustedProxies(config.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+
+	samplesFile := ""
+	if config.PersistSamples {
+		samplesFile = constants.OpenKommanderSamplesFilename
+	}
+
+	sessions := session.Default()
+	shutdownCtx, signalShutdown := context.WithCancel(context.Background())
+	s := &Server{
+		startTime:      time.Now(),
+		config:         config,
+		trustedProxies: trustedProxies,
+		sessions:       sessions,
+		samplers:       sampler.NewManager(sampler.DefaultInterval, sampler.DefaultRetention, samplesFile),
+		shutdownCtx:    shutdownCtx,
+		signalShutdown: signalShutdown,
+	}
+	s.metrics = newMetricsHandler(s.samplers)
+
+	router := http.NewServeMux()
+	for _, route := range s.apiRoutes() {
+		router.HandleFunc(route.pattern, wrapWithLogging(route.handler))
+	}
+
+	s.frontend, s.frontendSource = resolveFrontend(config.FrontendDir)
+	router.Handle("/static/", http.StripPrefix("/static/", frontendHandler(s.frontend)))
+	router.Handle("/", frontendHandler(s.frontend))
 
-	logger.Info("Serving frontend", "directory", frontendDir)
+	logger.Info("Serving frontend", "source", s.frontendSource)
 
 	s.httpServer = &http.Server{
-		Addr:    ":" + port,
-		Handler: router,
+		Addr:              config.Addr(),
+		Handler:           s.serverMiddleware(s.validationMiddleware(router)),
+		ReadTimeout:       config.ReadTimeout.Duration,
+		ReadHeaderTimeout: config.ReadHeaderTimeout.Duration,
+		WriteTimeout:      config.WriteTimeout.Duration,
+		IdleTimeout:       config.IdleTimeout.Duration,
 	}
+	s.httpServer.RegisterOnShutdown(s.signalShutdown)
 
 	return s, nil
 }
 
 func (s *Server) Start() error {
+	for _, connection := range s.sessions.Clusters() {
+		s.samplers.Start(connection.Name, s.samplerConnect(connection.Name))
+	}
+	if s.config.TLSEnabled() {
+		return s.httpServer.ListenAndServeTLS(s.config.TLSCertFile, s.config.TLSKeyFile)
+	}
 	return s.httpServer.ListenAndServe()
 }
 
+// Stop stops accepting connections and waits for in-flight requests to finish until ctx
+// expires, after which remaining connections are closed. Streaming requests are notified
+// through their context as soon as shutdown starts. Background Kafka clients are closed
+// last so draining requests can still use them.
 func (s *Server) Stop(ctx context.Context) error {
-	if s.kafkaClient != nil {
-		brokers := s.kafkaClient.Brokers()
-		if len(brokers) > 0 {
-			if err := s.kafkaClient.Close(); err != nil {
-				logger.Warn("Failed to close Kafka client during server shutdown", "error", err)
-			} else {
-				logger.Info("Kafka client closed successfully")
-			}
-		} else {
-			logger.Info("Kafka client was already disconnected")
+	err := s.httpServer.Shutdown(ctx)
+	if err != nil {
+		logger.Warn("Graceful shutdown did not complete, closing remaining connections", "error", err)
+		if closeErr := s.httpServer.Close(); closeErr != nil {
+			logger.Warn("Failed to close remaining connections", "error", closeErr)
 		}
-		s.kafkaClient = nil
 	}
-	return s.httpServer.Shutdown(ctx)
+
+	s.samplers.Stop()
+	s.sessions.Close()
+	return err
 }
 
-func StartRESTServer(port string) {
-	s, err := NewServer(port)
+func StartRESTServer(config *ServerConfig) {
+	s, err := NewServer(config)
 	if err != nil {
 		logger.Error("Failed to start server", "error", err)
 		os.Exit(1)
 	}
 
 	// Set up shutdown handler
+	stopped := make(chan struct{})
 	go func() {
+		defer close(stopped)
 		sigCh := make(chan os.Signal, 1)
 		signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM, os.Interrupt)
-		<-sigCh
+		sig := <-sigCh
+		logger.Info("Shutting down REST API server", "signal", sig.String(), "timeout", config.ShutdownTimeout.String())
 
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		ctx, cancel := context.WithTimeout(context.Background(), config.ShutdownTimeout.Duration)
 		defer cancel()
 		if err := s.Stop(ctx); err != nil {
 			logger.Error("Error during server shutdown", "error", err)
 		}
 	}()
-	logger.Info("REST API server running on port", "port", port)
+
+	logger.Info("REST API server running", "address", config.Addr(), "tls", config.TLSEnabled())
 	if err := s.Start(); err != http.ErrServerClosed {
 		logger.Error("Server error", "error", err)
 		os.Exit(1)
 	}
+
+	// Wait for in-flight requests to drain before the process exits
+	<-stopped
+	logger.Info("REST API server stopped")
 }
 
-func createNewClient(w http.ResponseWriter, r *http.Request, s *Server) (status bool, err error) {
+// openCluster returns a connection to the broker named in the request path and a function
+// the request must call when done with it. A broker of a saved cluster profile uses the
+// profile's cached connection, which the server shares between requests and samplers; any
+// other broker is dialled for the request and closed on release. For requests that may
+// change the cluster, the connection is read-only when it reaches the cluster of a
+// read-only profile, by any of its addresses.
+func (s *Server) openCluster(r *http.Request) (*cluster.Handle, func(), *commands.Failure) {
 	broker := r.PathValue("broker")
 
-	logger.Kafka("Creating new Kafka client", broker, "connect", "client_addr", r.RemoteAddr)
-
 	if broker == "" {
 		logger.Warn("Broker not specified in request", "url", r.URL.String())
-		return false, fmt.Errorf("broker not specified")
+		return nil, nil, commands.NewFailure("broker not specified", http.StatusBadRequest)
 	}
-	config := sarama.NewConfig()
-	config.Version = constants.SaramaKafkaVersion
-	client, err := sarama.NewClient([]string{broker}, config)
-	if err != nil {
-		logger.Error("Failed to create Kafka client", "broker", broker, "error", err)
-		return false, fmt.Errorf("failed to create Kafka client: %w", err)
+
+	var h *cluster.Handle
+	var release func()
+	if connection, ok := s.sessions.ClusterForBroker(broker); ok {
+		shared, releaseShared, err := s.sessions.Acquire(r.Context(), connection.Name)
+		if err != nil {
+			logger.Error("Failed to connect to cluster", "cluster", connection.Name, "broker", broker, "error", err)
+			return nil, nil, commands.NewKafkaFailure("failed to create Kafka client", err)
+		}
+		// The handle is shared, so a request marks its own copy read-only
+		copied := *shared
+		h, release = &copied, releaseShared
+	} else {
+		logger.Kafka("Creating new Kafka client", broker, "connect", "client_addr", r.RemoteAddr)
+
+		kafkaCluster, err := cluster.DetectedCluster(r.Context(), []string{broker})
+		if err != nil {
+			logger.Error("Failed to create Kafka client", "broker", broker, "error", err)
+			return nil, nil, commands.NewKafkaFailure("failed to create Kafka client", err)
+		}
+		if h, err = kafkaCluster.Open(r.Context(), broker); err != nil {
+			logger.Error("Failed to create Kafka client", "broker", broker, "error", err)
+			return nil, nil, commands.NewKafkaFailure("failed to create Kafka client", err)
+		}
+		release = func() { closeCluster(h) }
+		logger.Kafka("Successfully created Kafka client", broker, "connect")
+	}
+
+	if !h.ReadOnly && isMutatingAPIRequest(r) {
+		readOnly, err := s.sessions.IsReadOnlyCluster(r.Context(), h)
+		if err != nil {
+			release()
+			logger.Error("Refusing a change that may reach a read-only cluster", "broker", broker, "error", err)
+			return nil, nil, commands.NewFailure(err.Error()+"; refusing the change", http.StatusServiceUnavailable).WithCode(commands.CodeUnavailable)
+		}
+		h.ReadOnly = readOnly
+	}
+	return h, release, nil
+}
+
+// samplerConnect lets the sampler of a saved cluster share its cached connection
+func (s *Server) samplerConnect(clusterName string) sampler.Connect {
+	return func(ctx context.Context) (*cluster.Handle, func(), error) {
+		return s.sessions.Acquire(ctx, clusterName)
 	}
+}
 
-	s.kafkaClient = client
-	logger.Kafka("Successfully created Kafka client", broker, "connect")
-	return true, nil
+func closeCluster(h *cluster.Handle) {
+	if err := h.Close(); err != nil {
+		logger.Warn("Failed to close Kafka client", "broker", h.Name, "error", err)
+	}
 }
 
 func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		w.WriteHeader(http.StatusMethodNotAllowed)
-		sendJSON(w, http.StatusMethodNotAllowed, Response{
-			Status:  "error",
-			Message: fmt.Sprintf("Method %s not allowed", r.Method),
-		})
+		sendMethodNotAllowed(w, r, http.MethodGet)
 		return
 	}
 
 	broker := r.PathValue("broker")
 
-	status, err := createNewClient(w, r, s)
-	if err != nil {
-		logger.Error("Failed to create Kafka client for status check", "broker", broker, "error", err)
-		sendError(w, "Failed to create Kafka client", nil)
-		return
-	}
-	if !status {
-		logger.Error("Client creation failed for status check", "broker", broker)
-		sendError(w, "Failed to create Kafka client", fmt.Errorf("client creation failed"))
+	h, release, failure := s.openCluster(r)
+	if failure != nil {
+		logger.Error("Failed to create Kafka client for status check", "broker", broker, "error", failure.Err)
+		sendFailure(w, r, "Failed to connect to Kafka", failure)
 		return
 	}
+	defer release()
 
-	if s.kafkaClient == nil {
-		sendError(w, "Kafka client not initialized", fmt.Errorf("kafka client is nil"))
-		return
-	}
-	brokers := s.kafkaClient.Brokers()
+	brokers := h.Client.Brokers()
 	kafkaStatus := "disconnected"
 	if len(brokers) > 0 {
 		kafkaStatus = "connected"
@@ -325,39 +416,29 @@ func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
 func (s *Server) handleTopics(w http.ResponseWriter, r *http.Request) {
 	broker := r.PathValue("broker")
 
-	status, err := createNewClient(w, r, s)
-	if err != nil {
-		logger.Error("Failed to create Kafka client for topics operation", "broker", broker, "method", r.Method, "error", err)
-		sendError(w, "Failed to create Kafka client", err)
-		return
-	}
-	if !status {
-		logger.Error("Client creation failed for topics operation", "broker", broker, "method", r.Method)
-		sendError(w, "Failed to create Kafka client", fmt.Errorf("client creation failed"))
-		return
-	}
-
-	if s.kafkaClient == nil {
-		logger.Error("Kafka client not initialized for topics operation", "broker", broker)
-		sendError(w, "Kafka client not initialized", fmt.Errorf("kafka client is nil"))
-		return
-	}
-
+	var handler func(http.ResponseWriter, *http.Request, *cluster.Handle)
 	switch r.Method {
 	case http.MethodGet:
-		s.listTopics(w, r)
+		handler = s.listTopics
 	case http.MethodPost:
-		s.createTopic(w, r)
+		handler = s.createTopic
 	case http.MethodDelete:
-		s.deleteTopic(w, r)
+		handler = s.deleteTopic
 	default:
 		logger.Warn("Method not allowed for topics endpoint", "method", r.Method, "broker", broker)
-		w.WriteHeader(http.StatusMethodNotAllowed)
-		sendJSON(w, http.StatusMethodNotAllowed, Response{
-			Status:  "error",
-			Message: fmt.Sprintf("Method %s not allowed", r.Method),
-		})
+		sendMethodNotAllowed(w, r, http.MethodGet, http.MethodPost, http.MethodDelete)
+		return
+	}
+
+	h, release, failure := s.openCluster(r)
+	if failure != nil {
+		logger.Error("Failed to create Kafka client for topics operation", "broker", broker, "method", r.Method, "error", failure.Err)
+		sendFailure(w, r, "Failed to connect to Kafka", failure)
+		return
 	}
+	defer release()
+
+	handler(w, r, h)
 }
 
 func (s *Server) handleBrokers(w http.ResponseWriter, r *http.Request) {
@@ -369,46 +450,26 @@ func (s *Server) handleBrokers(w http.ResponseWriter, r *http.Request) {
 		s.getBrokers(w, r)
 	default:
 		logger.Warn("Method not allowed for brokers endpoint", "method", r.Method, "broker", broker)
-		w.WriteHeader(http.StatusMethodNotAllowed)
-		sendJSON(w, http.StatusMethodNotAllowed, Response{
-			Status:  "error",
-			Message: fmt.Sprintf("Method %s not allowed", r.Method),
-		})
+		sendMethodNotAllowed(w, r, http.MethodGet, http.MethodPost)
 	}
 }
 
 func (s *Server) createBroker(w http.ResponseWriter, r *http.Request) {
-	_ = r // Not used in this stub implementation
-	response := Response{
-		Status:  "ok",
-		Message: "Broker creation is not implemented yet",
-	}
-
-	sendJSON(w, http.StatusNotImplemented, response)
+	sendErrorStatus(w, r, http.StatusNotImplemented, commands.CodeNotImplemented, "Broker creation is not implemented yet", nil)
 }
 
 func (s *Server) getBrokers(w http.ResponseWriter, r *http.Request) {
 	broker := r.PathValue("broker")
 
-	status, err := createNewClient(w, r, s)
-	if err != nil {
-		logger.Error("Failed to create Kafka client for brokers operation", "broker", broker, "error", err)
-		sendError(w, "Failed to create Kafka client", err)
-		return
-	}
-	if !status {
-		logger.Error("Client creation failed for brokers operation", "broker", broker)
-		sendError(w, "Failed to create Kafka client", fmt.Errorf("client creation failed"))
-		return
-	}
-
-	if s.kafkaClient == nil {
-		logger.Error("Kafka client not initialized for brokers operation", "broker", broker)
-		sendError(w, "Kafka client not initialized", fmt.Errorf("kafka client is nil"))
+	h, release, failure := s.openCluster(r)
+	if failure != nil {
+		logger.Error("Failed to create Kafka client for brokers operation", "broker", broker, "error", failure.Err)
+		sendFailure(w, r, "Failed to connect to Kafka", failure)
 		return
 	}
+	defer release()
 
-	brokers := s.kafkaClient.Brokers()
+	brokers := h.Client.Brokers()
 	brokerList := make([]map[string]interface{}, 0)
 
 	for _, brokerInfo := range brokers {
@@ -433,26 +494,13 @@ func (s *Server) getBrokers(w http.ResponseWriter, r *http.Request) {
 	sendJSON(w, http.StatusOK, Response{Status: "ok", Data: brokerList})
 }
 
-func (s *Server) listTopics(w http.ResponseWriter, r *http.Request) {
+func (s *Server) listTopics(w http.ResponseWriter, r *http.Request, h *cluster.Handle) {
 	broker := r.PathValue("broker")
-	admin, err := sarama.NewClusterAdminFromClient(s.kafkaClient)
-
-	if err != nil {
-		logger.Error("Failed to create admin client for listing topics", "broker", broker, "error", err)
-		sendError(w, "Failed to create admin client", err)
-		return
-	}
-	defer func() {
-		if closeErr := admin.Close(); closeErr != nil {
-			logger.Warn("Failed to close admin client", "error", closeErr)
-		}
-	}()
 
-	topics, err := admin.ListTopics()
-
-	if err != nil {
-		logger.Error("Failed to list topics from Kafka", "broker", broker, "error", err)
-		sendError(w, "Failed to list topics", err)
+	topics, failure := commands.ListTopics(r.Context(), h)
+	if failure != nil {
+		logger.Error("Failed to list topics from Kafka", "broker", broker, "error", failure.Err)
+		sendFailure(w, r, "Failed to list topics", failure)
 		return
 	}
 
@@ -474,13 +522,13 @@ func (s *Server) listTopics(w http.ResponseWriter, r *http.Request) {
 	sendJSON(w, http.StatusOK, Response{Status: "ok", Data: topicList})
 }
 
-func (s *Server) createTopic(w http.ResponseWriter, r *http.Request) {
+func (s *Server) createTopic(w http.ResponseWriter, r *http.Request, h *cluster.Handle) {
 	broker := r.PathValue("broker")
 
 	var req TopicRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		logger.Error("Invalid request body for topic creation", "broker", broker, "error", err)
-		sendError(w, "Invalid request body", err)
+	if failure := decodeJSONBody(r, &req); failure != nil {
+		logger.Error("Invalid request body for topic creation", "broker", broker, "error", failure.Err)
+		sendFailure(w, r, "Invalid request body", failure)
 		return
 	}
 
@@ -489,69 +537,45 @@ func (s *Server) createTopic(w http.ResponseWriter, r *http.Request) {
 		"topic_name", req.Name,
 		"partitions", req.Partitions,
 		"replication_factor", req.ReplicationFactor)
-	admin, err := sarama.NewClusterAdminFromClient(s.kafkaClient)
-	if err != nil {
-		logger.Error("Failed to create admin client for topic creation", "broker", broker, "topic_name", req.Name, "error", err)
-		sendError(w, "Failed to create admin client", err)
-		return
-	}
-	defer func() {
-		if closeErr := admin.Close(); closeErr != nil {
-			logger.Warn("Failed to close admin client", "error", closeErr)
-		}
-	}()
-	err = admin.CreateTopic(req.Name, &sarama.TopicDetail{
-		NumPartitions:     req.Partitions,
-		ReplicationFactor: req.ReplicationFactor,
-	}, false)
-	if err != nil {
-		logger.Error("Failed to create topic in Kafka", "broker", broker, "topic_name", req.Name, "error", err)
-		sendError(w, "Failed to create topic", err)
+
+	successMessage, failure := commands.CreateTopic(r.Context(), h, req.Name, int(req.Partitions), int(req.ReplicationFactor))
+	s.recordAudit(r, audit.OpTopicCreate, req.Name, failure, map[string]any{
+		"partitions":         req.Partitions,
+		"replication_factor": req.ReplicationFactor,
+	})
+	if failure != nil {
+		logger.Error("Failed to create topic in Kafka", "broker", broker, "topic_name", req.Name, "error", failure.Err)
+		sendFailure(w, r, "Failed to create topic", failure)
 		return
 	}
 
 	logger.Info("Topic created successfully", "broker", broker, "topic_name", req.Name, "partitions", req.Partitions, "replication_factor", req.ReplicationFactor)
-	sendJSON(w, http.StatusCreated, Response{Status: "ok", Message: fmt.Sprintf("Topic '%s' created successfully", req.Name)})
+	sendJSON(w, http.StatusCreated, Response{Status: "ok", Message: successMessage})
 }
 
-func (s *Server) deleteTopic(w http.ResponseWriter, r *http.Request) {
+func (s *Server) deleteTopic(w http.ResponseWriter, r *http.Request, h *cluster.Handle) {
 	broker := r.PathValue("broker")
 
 	var req TopicRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		logger.Error("Invalid request body for topic deletion", "broker", broker, "error", err)
-		sendError(w, "Invalid request body", err)
+	if failure := decodeJSONBody(r, &req); failure != nil {
+		logger.Error("Invalid request body for topic deletion", "broker", broker, "error", failure.Err)
+		sendFailure(w, r, "Invalid request body", failure)
 		return
 	}
 	topicName := req.Name
-	if topicName == "" {
-		logger.Warn("Topic name is required for deletion", "broker", broker)
-		sendError(w, "Topic name is required", nil)
-		return
-	}
 
 	logger.Info("Topic deletion request details", "broker", broker, "topic_name", topicName)
-	admin, err := sarama.NewClusterAdminFromClient(s.kafkaClient)
-	if err != nil {
-		logger.Error("Failed to create admin client for topic deletion", "broker", broker, "topic_name", topicName, "error", err)
-		sendError(w, "Failed to create admin client", err)
-		return
-	}
-	defer func() {
-		if closeErr := admin.Close(); closeErr != nil {
-			logger.Warn("Failed to close admin client", "error", closeErr)
-		}
-	}()
 
-	err = admin.DeleteTopic(topicName)
-	if err != nil {
-		logger.Error("Failed to delete topic from Kafka", "broker", broker, "topic_name", topicName, "error", err)
-		sendError(w, "Failed to delete topic", err)
+	successMessage, failure := commands.DeleteTopic(r.Context(), h, topicName)
+	s.recordAudit(r, audit.OpTopicDelete, topicName, failure, nil)
+	if failure != nil {
+		logger.Error("Failed to delete topic from Kafka", "broker", broker, "topic_name", topicName, "error", failure.Err)
+		sendFailure(w, r, "Failed to delete topic", failure)
 		return
 	}
 
 	logger.Info("Topic deleted successfully", "broker", broker, "topic_name", topicName)
-	sendJSON(w, http.StatusOK, Response{Status: "ok", Message: fmt.Sprintf("Topic '%s' deleted successfully", topicName)})
+	sendJSON(w, http.StatusOK, Response{Status: "ok", Message: successMessage})
 }
 
 func sendJSON(w http.ResponseWriter, status int, payload interface{}) {
@@ -562,200 +586,72 @@ func sendJSON(w http.ResponseWriter, status int, payload interface{}) {
 	}
 }
 
-func sendError(w http.ResponseWriter, message string, err error) {
-	logger.Error(message, "error", err)
-	sendJSON(w, http.StatusInternalServerError, Response{
-		Status:  "error",
-		Message: fmt.Sprintf("%s: %v", message, err),
+// recordAudit writes an audit entry for a mutating operation against the request's broker
+func (s *Server) recordAudit(r *http.Request, operation audit.Operation, target string, failure *commands.Failure, details map[string]any) {
+	var err error
+	if failure != nil {
+		err = failure.Err
+	}
+	outcome, errMessage := audit.Outcome(err)
+	audit.Record(audit.Entry{
+		Actor:     audit.RequestActor(r, s.trustedProxies),
+		Source:    audit.SourceREST,
+		Cluster:   r.PathValue("broker"),
+		Operation: operation,
+		Target:    target,
+		Outcome:   outcome,
+		Error:     errMessage,
+		Details:   details,
 	})
 }
 
-// MessagesLastMinute holds the count of produced and consumed messages in the last minute and last second
-type MessagesLastMinute struct {
-	Topic          string `json:"topic"`
-	ProducedCount  int64  `json:"produced_count"`
-	ConsumedCount  int64  `json:"consumed_count"`
-	ProducedPerSec int64  `json:"produced_per_sec"`
-	ConsumedPerSec int64  `json:"consumed_per_sec"`
-}
-
-// OffsetHistoryEntry stores offset and timestamp
-type OffsetHistoryEntry struct {
-	Offset    int64
-	Timestamp time.Time
-}
-
-// In-memory rolling window for offsets (not production safe)
-var producedHistory = make(map[string][]OffsetHistoryEntry)
-var consumedHistory = make(map[string][]OffsetHistoryEntry)
-
-// In-memory store for last offsets and timestamps (for demo purposes, not production safe)
-
-// Handler for messages per minute
+// Handler for messages per minute. Rates are served from the background sampler of the
+// saved cluster listing the requested broker; the window query parameter selects 1m
+// (default), 5m or 1h.
 func (s *Server) handleMessagesPerMinute(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		w.WriteHeader(http.StatusMethodNotAllowed)
-		sendJSON(w, http.StatusMethodNotAllowed, Response{
-			Status:  "error",
-			Message: fmt.Sprintf("Method %s not allowed", r.Method),
-		})
+		sendMethodNotAllowed(w, r, http.MethodGet)
 		return
 	}
 
 	broker := r.PathValue("broker")
-
-	status, err := createNewClient(w, r, s)
-	if err != nil {
-		logger.Error("Failed to create Kafka client for messages per minute", "broker", broker, "error", err)
-		sendError(w, "Failed to create Kafka client", err)
-		return
-	}
-	if !status {
-		logger.Error("Client creation failed for messages per minute", "broker", broker)
-		sendError(w, "Failed to create Kafka client", fmt.Errorf("client creation failed"))
+	if broker == "" {
+		logger.Warn("Broker not specified in request", "url", r.URL.String())
+		sendErrorStatus(w, r, http.StatusBadRequest, commands.CodeBadRequest, "Broker not specified", nil)
 		return
 	}
 
-	if s.kafkaClient == nil {
-		logger.Error("Kafka client not initialized for messages per minute", "broker", broker)
-		sendError(w, "Kafka client not initialized", fmt.Errorf("kafka client is nil"))
-		return
+	windowName := r.URL.Query().Get("window")
+	if windowName == "" {
+		windowName = "1m"
 	}
-
-	admin, err := sarama.NewClusterAdminFromClient(s.kafkaClient)
-	if err != nil {
-		logger.Error("Failed to create admin client for messages per minute", "broker", broker, "error", err)
-		sendError(w, "Failed to create admin client", nil)
+	window, ok := sampler.Windows[windowName]
+	if !ok {
+		sendErrorStatus(w, r, http.StatusBadRequest, commands.CodeValidationFailed,
+			fmt.Sprintf("Invalid window '%s', expected one of 1m, 5m, 1h", windowName),
+			map[string]interface{}{"parameter": "window", "allowed": []string{"1m", "5m", "1h"}})
 		return
 	}
 
-	defer func() {
-		if closeErr := admin.Close(); closeErr != nil {
-			logger.Warn("Failed to close admin client", "error", closeErr)
-		}
-	}()
-
-	topics, err := admin.ListTopics()
-
-	if err != nil {
-		logger.Error("Failed to list topics for messages per minute", "broker", broker, "error", err)
-		sendError(w, "Failed to list topics", nil)
+	// Only saved clusters are sampled, so arbitrary addresses cannot start samplers
+	connection, ok := s.sessions.ClusterForBroker(broker)
+	if !ok {
+		sendErrorStatus(w, r, http.StatusNotFound, commands.CodeClusterNotConfigured,
+			fmt.Sprintf("No saved cluster has broker '%s'; message rates are sampled for saved clusters only", broker),
+			map[string]interface{}{"broker": broker})
 		return
 	}
+	// A cluster saved since the server started is sampled from its first request
+	counts := s.samplers.Start(connection.Name, s.samplerConnect(connection.Name)).Rates(window)
+	total := counts[len(counts)-1]
 
-	logger.Debug("Processing message metrics", "broker", broker, "topic_count", len(topics))
-
-	// Calculate produced and consumed message counts in the last minute for each topic
-	counts := []MessagesLastMinute{}
-	now := time.Now()
-	totalAllProduced := int64(0)
-	totalAllConsumed := int64(0)
-	totalAllProducedSec := int64(0)
-	totalAllConsumedSec := int64(0)
-
-	for name := range topics { // Produced: sum latest offsets across all partitions
-		partitions, err := s.kafkaClient.Partitions(name)
-		if err != nil {
-			logger.Warn("Failed to get partitions for topic", "broker", broker, "topic", name, "error", err)
-		}
-		var totalProduced int64 = 0
-		for _, partition := range partitions {
-			offset, err := s.kafkaClient.GetOffset(name, partition, sarama.OffsetNewest)
-			if err == nil {
-				totalProduced += offset
-			}
-		}
-		// Consumed: sum committed offsets for all consumer groups
-		var totalConsumed int64 = 0
-		groups, err := admin.ListConsumerGroups()
-		if err != nil {
-			logger.Warn("Failed to list consumer groups", "broker", broker, "error", err)
-		}
-
-		for group := range groups {
-			offsets, err := admin.ListConsumerGroupOffsets(group, map[string][]int32{name: partitions})
-			if err == nil && offsets.Blocks != nil {
-				for _, partition := range partitions {
-					block := offsets.GetBlock(name, partition)
-					if block != nil && block.Offset > 0 {
-						totalConsumed += block.Offset
-					}
-				}
-			}
-		} // Store offset history for rolling window
-		producedHistory[name] = append(producedHistory[name], OffsetHistoryEntry{Offset: totalProduced, Timestamp: now})
-		consumedHistory[name] = append(consumedHistory[name], OffsetHistoryEntry{Offset: totalConsumed, Timestamp: now})
-
-		// Remove entries older than 1 minute using slices.DeleteFunc
-		pruneMinute := now.Add(-1 * time.Minute)
-		producedHistory[name] = slices.DeleteFunc(producedHistory[name], func(entry OffsetHistoryEntry) bool {
-			return entry.Timestamp.Before(pruneMinute)
-		})
-		consumedHistory[name] = slices.DeleteFunc(consumedHistory[name], func(entry OffsetHistoryEntry) bool {
-			return entry.Timestamp.Before(pruneMinute)
-		})
-
-		// Create filtered copies for second-based calculations
-		pruneSecond := now.Add(-1 * time.Second)
-		producedHistorySec := slices.DeleteFunc(slices.Clone(producedHistory[name]), func(entry OffsetHistoryEntry) bool {
-			return entry.Timestamp.Before(pruneSecond)
-		})
-		consumedHistorySec := slices.DeleteFunc(slices.Clone(consumedHistory[name]), func(entry OffsetHistoryEntry) bool {
-			return entry.Timestamp.Before(pruneSecond)
-		})
-
-		// Calculate produced/consumed in last minute
-		producedCount := int64(0)
-		consumedCount := int64(0)
-		if len(producedHistory[name]) > 1 {
-			producedCount = producedHistory[name][len(producedHistory[name])-1].Offset - producedHistory[name][0].Offset
-		}
-		if len(consumedHistory[name]) > 1 {
-			consumedCount = consumedHistory[name][len(consumedHistory[name])-1].Offset - consumedHistory[name][0].Offset
-		}
-
-		// Calculate produced/consumed in last second
-		producedPerSec := int64(0)
-		consumedPerSec := int64(0)
-		if len(producedHistorySec) > 1 {
-			producedPerSec = producedHistorySec[len(producedHistorySec)-1].Offset - producedHistorySec[0].Offset
-		}
-		if len(consumedHistorySec) > 1 {
-			consumedPerSec = consumedHistorySec[len(consumedHistorySec)-1].Offset - consumedHistorySec[0].Offset
-		}
-
-		totalAllProduced += producedCount
-		totalAllConsumed += consumedCount
-		totalAllProducedSec += producedPerSec
-		totalAllConsumedSec += consumedPerSec
-
-		counts = append(counts, MessagesLastMinute{
-			Topic:          name,
-			ProducedCount:  producedCount,
-			ConsumedCount:  consumedCount,
-			ProducedPerSec: producedPerSec,
-			ConsumedPerSec: consumedPerSec,
-		})
-	}
-
-	counts = append(counts, MessagesLastMinute{
-		Topic:          "total",
-		ProducedCount:  totalAllProduced,
-		ConsumedCount:  totalAllConsumed,
-		ProducedPerSec: totalAllProducedSec,
-		ConsumedPerSec: totalAllConsumedSec,
-	})
-	logger.Info("Successfully calculated message metrics", "broker", broker, "total_topics", len(counts)-1, "total_produced", totalAllProduced, "total_consumed", totalAllConsumed)
+	logger.Info("Successfully calculated message metrics", "broker", broker, "window", windowName, "total_topics", len(counts)-1, "total_produced", total.ProducedCount, "total_consumed", total.ConsumedCount)
 	sendJSON(w, http.StatusOK, Response{Status: "ok", Data: counts})
 }
 
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		w.WriteHeader(http.StatusMethodNotAllowed)
-		sendJSON(w, http.StatusMethodNotAllowed, Response{
-			Status:  "error",
-			Message: fmt.Sprintf("Method %s not allowed", r.Method),
-		})
+		sendMethodNotAllowed(w, r, http.MethodGet)
 		return
 	}
 
@@ -766,22 +662,64 @@ func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 	sendJSON(w, http.StatusOK, response)
 }
 
+// Handler for the cluster health report. The optional max_leader_skew query parameter sets
+// the leader skew in percent above which a broker is reported.
+func (s *Server) handleClusterHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		sendMethodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+
+	broker := r.PathValue("broker")
+
+	maxLeaderSkew := commands.DefaultMaxLeaderSkew
+	if value := r.URL.Query().Get("max_leader_skew"); value != "" {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil || parsed < 0 {
+			sendErrorStatus(w, r, http.StatusBadRequest, commands.CodeValidationFailed,
+				fmt.Sprintf("Invalid max_leader_skew '%s'", value), map[string]interface{}{"parameter": "max_leader_skew"})
+			return
+		}
+		maxLeaderSkew = parsed
+	}
+
+	h, release, failure := s.openCluster(r)
+	if failure != nil {
+		logger.Error("Failed to create Kafka client for cluster health", "broker", broker, "error", failure.Err)
+		sendFailure(w, r, "Failed to connect to Kafka", failure)
+		return
+	}
+	defer release()
+
+	report, failure := commands.BuildHealthReport(r.Context(), h, maxLeaderSkew)
+	if failure != nil {
+		logger.Error("Failed to build cluster health report", "broker", broker, "error", failure.Err)
+		sendFailure(w, r, "Failed to build cluster health report", failure)
+		return
+	}
+
+	logger.Info("Cluster health report completed", "broker", broker, "healthy", report.Healthy, "problems", len(report.Problems))
+	sendJSON(w, http.StatusOK, Response{Status: "ok", Data: report})
+}
+
 // Handler for clusters endpoint
 func (s *Server) handleClusters(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		w.WriteHeader(http.StatusMethodNotAllowed)
-		sendJSON(w, http.StatusMethodNotAllowed, Response{
-			Status:  "error",
-			Message: fmt.Sprintf("Method %s not allowed", r.Method),
-		})
+		sendMethodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+
+	h, failure := commands.CurrentCluster(r.Context(), s.sessions)
+	if failure != nil {
+		logger.Error("Failed to connect to the active cluster", "error", failure.Err)
+		sendFailure(w, r, "Failed to list clusters", failure)
 		return
 	}
 
-	// Use the command from internal/core/commands
-	clusters, failure := commands.ListClusters()
+	clusters, failure := commands.ListClusters(r.Context(), h)
 	if failure != nil {
 		logger.Error("Failed to list clusters", "error", failure.Err)
-		sendError(w, "Failed to list clusters", failure.Err)
+		sendFailure(w, r, "Failed to list clusters", failure)
 		return
 	}
 
@@ -792,33 +730,23 @@ func (s *Server) handleClusters(w http.ResponseWriter, r *http.Request) {
 // Handler for cluster metadata endpoint
 func (s *Server) handleClusterMetadata(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		w.WriteHeader(http.StatusMethodNotAllowed)
-		sendJSON(w, http.StatusMethodNotAllowed, Response{
-			Status:  "error",
-			Message: fmt.Sprintf("Method %s not allowed", r.Method),
-		})
+		sendMethodNotAllowed(w, r, http.MethodGet)
 		return
 	}
 
 	clusterId := r.PathValue("clusterId")
 
-	status, err := createNewClient(w, r, s)
-	if err != nil {
-		logger.Error("Failed to create Kafka client for cluster metadata operation", "clusterId", clusterId, "error", err)
-		sendError(w, "Failed to create Kafka client", err)
-		return
-	}
-	if !status {
-		logger.Error("Client creation failed for cluster metadata operation", "clusterId", clusterId)
-		sendError(w, "Failed to create Kafka client", fmt.Errorf("client creation failed"))
+	h, failure := commands.CurrentCluster(r.Context(), s.sessions)
+	if failure != nil {
+		logger.Error("Failed to connect to the active cluster", "clusterId", clusterId, "error", failure.Err)
+		sendFailure(w, r, "Failed to get cluster metadata", failure)
 		return
 	}
 
-	// Use the command from internal/core/commands
-	metadata, failure := commands.GetClusterMetadata()
+	metadata, failure := commands.GetClusterMetadata(r.Context(), h)
 	if failure != nil {
 		logger.Error("Failed to get cluster metadata", "clusterId", clusterId, "error", failure.Err)
-		sendError(w, "Failed to get cluster metadata", failure.Err)
+		sendFailure(w, r, "Failed to get cluster metadata", failure)
 		return
 	}
 
@@ -0,0 +1,131 @@
+package rest
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/IBM/openkommander/docs"
+	"github.com/IBM/openkommander/internal/core/commands"
+	"github.com/IBM/openkommander/pkg/logger"
+	"github.com/IBM/openkommander/pkg/openapi"
+)
+
+// apiSpec is the OpenAPI document embedded from docs/openapi.yaml. It is parsed once at
+// startup; a broken spec is a build error, caught by the contract tests.
+var apiSpec = mustLoadSpec()
+
+func mustLoadSpec() *openapi.Spec {
+	spec, err := openapi.Load(docs.OpenAPI)
+	if err != nil {
+		panic(err)
+	}
+	return spec
+}
+
+// validationMiddleware checks requests to documented routes against the OpenAPI spec
+// before they reach the handlers and, when enabled, checks their responses afterwards.
+// Undocumented paths and methods are passed through so the router answers them.
+func (s *Server) validationMiddleware(next http.Handler) http.Handler {
+	if !s.config.ValidateRequests && !s.config.ValidateResponses {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route, params, _ := apiSpec.FindRoute(r.Method, r.URL.Path)
+		if route == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if s.config.ValidateRequests {
+			body, err := readBody(r)
+			if err != nil {
+				var maxBytesErr *http.MaxBytesError
+				if errors.As(err, &maxBytesErr) {
+					sendErrorStatus(w, r, http.StatusRequestEntityTooLarge, commands.CodePayloadTooLarge, "Request body too large", nil)
+				} else {
+					sendError(w, r, "Failed to read request body", err)
+				}
+				return
+			}
+
+			if err := route.ValidateRequest(params, r.URL.Query(), r.Header, body); err != nil {
+				details := map[string]interface{}{"operation": route.Operation.OperationID}
+				var validationErr *openapi.ValidationError
+				if errors.As(err, &validationErr) {
+					details["violations"] = validationErr.Violations
+				}
+				sendErrorStatus(w, r, http.StatusBadRequest, commands.CodeValidationFailed, "Request does not match the API specification: "+err.Error(), details)
+				return
+			}
+		}
+
+		if !s.config.ValidateResponses || isStreamingRequest(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		recorder := &bufferedResponse{header: http.Header{}, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		if err := route.ValidateResponse(recorder.status, recorder.header, recorder.body.Bytes()); err != nil {
+			logger.Warn("Response does not match the API specification",
+				"method", r.Method,
+				"route", route.Path,
+				"status", recorder.status,
+				"request_id", requestID(r),
+				"error", err)
+		}
+		recorder.flushTo(w)
+	})
+}
+
+// readBody reads the whole request body and replaces it so handlers can read it again
+func readBody(r *http.Request) ([]byte, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, nil
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// bufferedResponse holds a response until it has been validated
+type bufferedResponse struct {
+	header      http.Header
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (b *bufferedResponse) Header() http.Header {
+	return b.header
+}
+
+func (b *bufferedResponse) WriteHeader(status int) {
+	if b.wroteHeader {
+		return
+	}
+	b.status = status
+	b.wroteHeader = true
+}
+
+func (b *bufferedResponse) Write(data []byte) (int, error) {
+	b.wroteHeader = true
+	return b.body.Write(data)
+}
+
+func (b *bufferedResponse) flushTo(w http.ResponseWriter) {
+	for name, values := range b.header {
+		w.Header()[name] = values
+	}
+	w.WriteHeader(b.status)
+	if _, err := w.Write(b.body.Bytes()); err != nil {
+		logger.Debug("Failed to write buffered response", "error", err)
+	}
+}
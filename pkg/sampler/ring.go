@@ -0,0 +1,65 @@
+package sampler
+
+import (
+	"sync"
+	"time"
+)
+
+// Sample is the total produced (sum of log-end offsets) and consumed (sum of committed
+// offsets over all consumer groups) message counts of a topic at a point in time
+type Sample struct {
+	Time     time.Time `json:"time"`
+	Produced int64     `json:"produced"`
+	Consumed int64     `json:"consumed"`
+}
+
+// Ring is a fixed size, mutex-protected buffer of samples that overwrites the oldest
+// sample once full
+type Ring struct {
+	mu      sync.RWMutex
+	samples []Sample
+	next    int
+	full    bool
+}
+
+func NewRing(capacity int) *Ring {
+	if capacity < 2 {
+		capacity = 2
+	}
+	return &Ring{samples: make([]Sample, capacity)}
+}
+
+func (r *Ring) Add(sample Sample) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.samples[r.next] = sample
+	r.next = (r.next + 1) % len(r.samples)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// Samples returns a copy of the buffered samples, oldest first
+func (r *Ring) Samples() []Sample {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if !r.full {
+		return append([]Sample(nil), r.samples[:r.next]...)
+	}
+	ordered := make([]Sample, 0, len(r.samples))
+	ordered = append(ordered, r.samples[r.next:]...)
+	return append(ordered, r.samples[:r.next]...)
+}
+
+// Since returns the samples taken at or after the given time, oldest first
+func (r *Ring) Since(since time.Time) []Sample {
+	samples := r.Samples()
+	for i, sample := range samples {
+		if !sample.Time.Before(since) {
+			return samples[i:]
+		}
+	}
+	return nil
+}
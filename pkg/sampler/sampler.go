@@ -0,0 +1,480 @@
+package sampler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/IBM/openkommander/pkg/cluster"
+	"github.com/IBM/openkommander/pkg/logger"
+	"github.com/IBM/sarama"
+)
+
+const (
+	DefaultInterval  = 5 * time.Second
+	DefaultRetention = time.Hour
+
+	// Samples are written to disk every persistEvery ticks when persistence is enabled
+	persistEvery = 12
+)
+
+// Windows are the rate windows that can be requested from a sampler
+var Windows = map[string]time.Duration{
+	"1m": time.Minute,
+	"5m": 5 * time.Minute,
+	"1h": time.Hour,
+}
+
+// TopicRate is the number of messages produced and consumed on a topic over a window
+type TopicRate struct {
+	Topic          string  `json:"topic"`
+	ProducedCount  int64   `json:"produced_count"`
+	ConsumedCount  int64   `json:"consumed_count"`
+	ProducedPerSec float64 `json:"produced_per_sec"`
+	ConsumedPerSec float64 `json:"consumed_per_sec"`
+}
+
+// Snapshot is the state of a cluster at a successful sample
+type Snapshot struct {
+	Time            time.Time
+	Brokers         int
+	UnderReplicated int
+	// Partitions is the partition count and LogEndOffsets the sum of the log-end offsets
+	// of every topic
+	Partitions    map[string]int
+	LogEndOffsets map[string]int64
+	// GroupLag is the lag of every consumer group on every topic it committed offsets for
+	GroupLag map[string]map[string]int64
+}
+
+// ClusterSnapshot is what the sampler of a cluster last recorded
+type ClusterSnapshot struct {
+	Cluster string
+	// Up reports whether the last sample succeeded
+	Up bool
+	// Snapshot is the last successful sample, nil before the first one
+	*Snapshot
+}
+
+// Connect opens the cluster a sampler records and returns a function releasing the handle
+type Connect func(ctx context.Context) (h *cluster.Handle, release func(), err error)
+
+// Sampler records per-topic offsets of one cluster on a fixed interval
+type Sampler struct {
+	key      string
+	connect  Connect
+	interval time.Duration
+	capacity int
+
+	mu     sync.RWMutex
+	topics map[string]*Ring
+	latest *Snapshot
+	up     bool
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newSampler(key string, interval, retention time.Duration) *Sampler {
+	return &Sampler{
+		key:      key,
+		interval: interval,
+		capacity: int(retention/interval) + 1,
+		topics:   map[string]*Ring{},
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// sampleOnce connects, records one sample and releases the handle
+func (s *Sampler) sampleOnce() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	h, release, err := s.connect(ctx)
+	cancel()
+	if err != nil {
+		logger.Warn("Sampler failed to connect", "cluster", s.key, "error", err)
+		s.setDown()
+		return
+	}
+	defer release()
+
+	if err := s.sample(h.Client, h.Admin, time.Now()); err != nil {
+		logger.Warn("Sampler failed to record offsets", "cluster", s.key, "error", err)
+		s.setDown()
+	}
+}
+
+func (s *Sampler) run(persist func()) {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for tick := 1; ; tick++ {
+		// Acquire the handle for each sample only, so a connection whose cluster profile
+		// changed is released and the next sample uses the new settings
+		s.sampleOnce()
+
+		if persist != nil && tick%persistEvery == 0 {
+			persist()
+		}
+
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Sampler) sample(client sarama.Client, admin sarama.ClusterAdmin, now time.Time) error {
+	if err := client.RefreshMetadata(); err != nil {
+		return err
+	}
+	topics, err := client.Topics()
+	if err != nil {
+		return err
+	}
+
+	snapshot := &Snapshot{
+		Time:          now,
+		Brokers:       len(client.Brokers()),
+		Partitions:    make(map[string]int, len(topics)),
+		LogEndOffsets: make(map[string]int64, len(topics)),
+		GroupLag:      map[string]map[string]int64{},
+	}
+	logEndOffsets := make(map[string]map[int32]int64, len(topics))
+	for _, topic := range topics {
+		partitions, err := client.Partitions(topic)
+		if err != nil {
+			logger.Warn("Failed to get partitions for topic", "cluster", s.key, "topic", topic, "error", err)
+			continue
+		}
+		snapshot.Partitions[topic] = len(partitions)
+		logEndOffsets[topic] = make(map[int32]int64, len(partitions))
+		var total int64
+		for _, partition := range partitions {
+			if offset, err := client.GetOffset(topic, partition, sarama.OffsetNewest); err == nil {
+				logEndOffsets[topic][partition] = offset
+				total += offset
+			}
+			replicas, _ := client.Replicas(topic, partition)
+			isr, _ := client.InSyncReplicas(topic, partition)
+			if len(isr) < len(replicas) {
+				snapshot.UnderReplicated++
+			}
+		}
+		snapshot.LogEndOffsets[topic] = total
+	}
+
+	consumed := make(map[string]int64, len(topics))
+	groups, err := admin.ListConsumerGroups()
+	if err != nil {
+		logger.Warn("Failed to list consumer groups", "cluster", s.key, "error", err)
+	}
+	for group := range groups {
+		offsets, err := admin.ListConsumerGroupOffsets(group, nil)
+		if err != nil || offsets == nil {
+			continue
+		}
+		for topic, blocks := range offsets.Blocks {
+			for partition, block := range blocks {
+				if block == nil || block.Offset < 0 {
+					continue
+				}
+				consumed[topic] += block.Offset
+				if logEndOffset, ok := logEndOffsets[topic][partition]; ok {
+					if snapshot.GroupLag[group] == nil {
+						snapshot.GroupLag[group] = map[string]int64{}
+					}
+					snapshot.GroupLag[group][topic] += max(0, logEndOffset-block.Offset)
+				}
+			}
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for topic, total := range snapshot.LogEndOffsets {
+		ring, ok := s.topics[topic]
+		if !ok {
+			ring = NewRing(s.capacity)
+			s.topics[topic] = ring
+		}
+		ring.Add(Sample{Time: now, Produced: total, Consumed: consumed[topic]})
+	}
+	// Forget topics that no longer exist
+	for topic := range s.topics {
+		if _, ok := snapshot.LogEndOffsets[topic]; !ok {
+			delete(s.topics, topic)
+		}
+	}
+	s.latest, s.up = snapshot, true
+	return nil
+}
+
+// setDown records that the last sample failed
+func (s *Sampler) setDown() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.up = false
+}
+
+// Rates returns the per-topic produced and consumed counts over the window, sorted by
+// topic name, followed by a "total" entry summing all topics
+func (s *Sampler) Rates(window time.Duration) []TopicRate {
+	since := time.Now().Add(-window)
+
+	s.mu.RLock()
+	rates := make([]TopicRate, 0, len(s.topics)+1)
+	for topic, ring := range s.topics {
+		rates = append(rates, rate(topic, ring.Since(since)))
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(rates, func(i, j int) bool {
+		return rates[i].Topic < rates[j].Topic
+	})
+
+	total := TopicRate{Topic: "total"}
+	for _, r := range rates {
+		total.ProducedCount += r.ProducedCount
+		total.ConsumedCount += r.ConsumedCount
+		total.ProducedPerSec += r.ProducedPerSec
+		total.ConsumedPerSec += r.ConsumedPerSec
+	}
+	return append(rates, total)
+}
+
+func rate(topic string, samples []Sample) TopicRate {
+	result := TopicRate{Topic: topic}
+	if len(samples) < 2 {
+		return result
+	}
+
+	first, last := samples[0], samples[len(samples)-1]
+	// Offsets go backwards when a topic is recreated or a group is reset; report no traffic
+	result.ProducedCount = max(0, last.Produced-first.Produced)
+	result.ConsumedCount = max(0, last.Consumed-first.Consumed)
+
+	if elapsed := last.Time.Sub(first.Time).Seconds(); elapsed > 0 {
+		result.ProducedPerSec = float64(result.ProducedCount) / elapsed
+		result.ConsumedPerSec = float64(result.ConsumedCount) / elapsed
+	}
+	return result
+}
+
+// Manager owns one sampler per saved cluster, keyed by the cluster name
+type Manager struct {
+	interval    time.Duration
+	retention   time.Duration
+	persistPath string
+
+	mu       sync.Mutex
+	samplers map[string]*Sampler
+	// saveMu serialises Save, which every sampler calls from its own goroutine
+	saveMu sync.Mutex
+	// history holds persisted samples of clusters whose sampler has not started
+	history map[string]*Sampler
+	stopped bool
+}
+
+// NewManager creates a sampler manager. When persistPath is set, samples are loaded from
+// it for the samplers started later, and samples are saved back periodically.
+func NewManager(interval, retention time.Duration, persistPath string) *Manager {
+	m := &Manager{
+		interval:    interval,
+		retention:   retention,
+		persistPath: persistPath,
+		samplers:    map[string]*Sampler{},
+		history:     map[string]*Sampler{},
+	}
+
+	if persistPath != "" {
+		if err := m.load(); err != nil {
+			logger.Warn("Failed to load persisted samples", "file", persistPath, "error", err)
+		}
+	}
+	return m
+}
+
+// Start starts sampling the named cluster in the background, keeping the persisted samples
+// of the cluster. Starting a cluster that is already sampled returns its sampler.
+func (m *Manager) Start(name string, connect Connect) *Sampler {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if s, ok := m.samplers[name]; ok {
+		return s
+	}
+	s, ok := m.history[name]
+	if ok {
+		delete(m.history, name)
+	} else {
+		s = newSampler(name, m.interval, m.retention)
+	}
+	s.connect = connect
+	m.samplers[name] = s
+	if !m.stopped {
+		m.start(s)
+	}
+	return s
+}
+
+// Get returns the sampler of a cluster that has been started
+func (m *Manager) Get(name string) (*Sampler, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.samplers[name]
+	return s, ok
+}
+
+// Snapshots returns what every started sampler last recorded, sorted by cluster name
+func (m *Manager) Snapshots() []ClusterSnapshot {
+	m.mu.Lock()
+	samplers := make([]*Sampler, 0, len(m.samplers))
+	for _, s := range m.samplers {
+		samplers = append(samplers, s)
+	}
+	m.mu.Unlock()
+
+	snapshots := make([]ClusterSnapshot, 0, len(samplers))
+	for _, s := range samplers {
+		s.mu.RLock()
+		snapshots = append(snapshots, ClusterSnapshot{Cluster: s.key, Up: s.up, Snapshot: s.latest})
+		s.mu.RUnlock()
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].Cluster < snapshots[j].Cluster
+	})
+	return snapshots
+}
+
+func (m *Manager) start(s *Sampler) {
+	var persist func()
+	if m.persistPath != "" {
+		persist = func() {
+			if err := m.Save(); err != nil {
+				logger.Warn("Failed to persist samples", "file", m.persistPath, "error", err)
+			}
+		}
+	}
+	logger.Info("Starting metrics sampler", "cluster", s.key, "interval", s.interval)
+	go s.run(persist)
+}
+
+// Stop stops every sampler and persists their samples
+func (m *Manager) Stop() {
+	m.mu.Lock()
+	if m.stopped {
+		m.mu.Unlock()
+		return
+	}
+	m.stopped = true
+	samplers := make([]*Sampler, 0, len(m.samplers))
+	for _, s := range m.samplers {
+		samplers = append(samplers, s)
+	}
+	m.mu.Unlock()
+
+	for _, s := range samplers {
+		close(s.stop)
+		<-s.done
+	}
+
+	if m.persistPath != "" {
+		if err := m.Save(); err != nil {
+			logger.Warn("Failed to persist samples", "file", m.persistPath, "error", err)
+		}
+	}
+}
+
+// persistedSamples maps cluster name -> topic -> samples, oldest first
+type persistedSamples map[string]map[string][]Sample
+
+// Save writes the samples of every sampler to the persist file. The file is replaced
+// atomically, so readers never see a partial file.
+func (m *Manager) Save() error {
+	if m.persistPath == "" {
+		return nil
+	}
+	m.saveMu.Lock()
+	defer m.saveMu.Unlock()
+
+	m.mu.Lock()
+	data := make(persistedSamples, len(m.samplers))
+	for key, s := range m.samplers {
+		s.mu.RLock()
+		topics := make(map[string][]Sample, len(s.topics))
+		for topic, ring := range s.topics {
+			topics[topic] = ring.Samples()
+		}
+		s.mu.RUnlock()
+		data[key] = topics
+	}
+	m.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(m.persistPath), 0755); err != nil {
+		return fmt.Errorf("error creating directory for %s: %w", m.persistPath, err)
+	}
+
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("error encoding samples: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(m.persistPath), filepath.Base(m.persistPath)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("error writing samples file %s: %w", m.persistPath, err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	if _, err := tmp.Write(encoded); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("error writing samples file %s: %w", m.persistPath, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing samples file %s: %w", m.persistPath, err)
+	}
+	if err := os.Rename(tmp.Name(), m.persistPath); err != nil {
+		return fmt.Errorf("error writing samples file %s: %w", m.persistPath, err)
+	}
+	return nil
+}
+
+func (m *Manager) load() error {
+	encoded, err := os.ReadFile(m.persistPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var data persistedSamples
+	if err := json.Unmarshal(encoded, &data); err != nil {
+		return fmt.Errorf("error decoding samples file %s: %w", m.persistPath, err)
+	}
+
+	cutoff := time.Now().Add(-m.retention)
+	for key, topics := range data {
+		s := newSampler(key, m.interval, m.retention)
+		for topic, samples := range topics {
+			ring := NewRing(s.capacity)
+			for _, sample := range samples {
+				if !sample.Time.Before(cutoff) {
+					ring.Add(sample)
+				}
+			}
+			s.topics[topic] = ring
+		}
+		m.history[key] = s
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+package sampler
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/IBM/openkommander/pkg/cluster"
+	"github.com/IBM/sarama"
+)
+
+func TestRing_WrapsAndKeepsOrder(t *testing.T) {
+	ring := NewRing(3)
+	base := time.Now()
+	for i := 0; i < 5; i++ {
+		ring.Add(Sample{Time: base.Add(time.Duration(i) * time.Second), Produced: int64(i)})
+	}
+
+	samples := ring.Samples()
+	if len(samples) != 3 {
+		t.Fatalf("Samples() returned %d samples, want 3", len(samples))
+	}
+	for i, expected := range []int64{2, 3, 4} {
+		if samples[i].Produced != expected {
+			t.Errorf("sample %d produced = %d, want %d", i, samples[i].Produced, expected)
+		}
+	}
+
+	since := ring.Since(base.Add(3 * time.Second))
+	if len(since) != 2 || since[0].Produced != 3 {
+		t.Errorf("Since() = %+v, want samples 3 and 4", since)
+	}
+}
+
+func TestRate(t *testing.T) {
+	base := time.Now()
+	testCases := []struct {
+		name            string
+		samples         []Sample
+		expectedCount   int64
+		expectedPerSec  float64
+		expectedConsume int64
+	}{
+		{"no samples", nil, 0, 0, 0},
+		{"single sample", []Sample{{Time: base, Produced: 10}}, 0, 0, 0},
+		{"steady traffic", []Sample{
+			{Time: base, Produced: 100, Consumed: 50},
+			{Time: base.Add(5 * time.Second), Produced: 150, Consumed: 60},
+			{Time: base.Add(10 * time.Second), Produced: 200, Consumed: 70},
+		}, 100, 10, 20},
+		{"offsets reset", []Sample{
+			{Time: base, Produced: 100},
+			{Time: base.Add(10 * time.Second), Produced: 5},
+		}, 0, 0, 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result := rate("orders", tc.samples)
+			if result.ProducedCount != tc.expectedCount {
+				t.Errorf("ProducedCount = %d, want %d", result.ProducedCount, tc.expectedCount)
+			}
+			if result.ProducedPerSec != tc.expectedPerSec {
+				t.Errorf("ProducedPerSec = %v, want %v", result.ProducedPerSec, tc.expectedPerSec)
+			}
+			if result.ConsumedCount != tc.expectedConsume {
+				t.Errorf("ConsumedCount = %d, want %d", result.ConsumedCount, tc.expectedConsume)
+			}
+		})
+	}
+}
+
+func TestManager_SaveAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "samples.json")
+
+	m := NewManager(time.Hour, DefaultRetention, path)
+	s := newSampler("local", time.Hour, DefaultRetention)
+	s.topics["orders"] = NewRing(s.capacity)
+	s.topics["orders"].Add(Sample{Time: time.Now().Add(-time.Minute), Produced: 10})
+	s.topics["orders"].Add(Sample{Time: time.Now(), Produced: 70})
+	m.samplers[s.key] = s
+	if err := m.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	restored := NewManager(time.Hour, DefaultRetention, path)
+	if _, ok := restored.Get("local"); ok {
+		t.Error("Get() returned a sampler that was never started")
+	}
+	started := restored.Start("local", func(context.Context) (*cluster.Handle, func(), error) {
+		return nil, nil, errors.New("offline")
+	})
+	defer restored.Stop()
+
+	rates := started.Rates(5 * time.Minute)
+	if rates[0].Topic != "orders" || rates[0].ProducedCount != 60 {
+		t.Errorf("Rates() = %+v, want 60 produced on orders", rates)
+	}
+}
+
+func TestManager_ConcurrentSaves(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "samples.json")
+
+	m := NewManager(time.Hour, DefaultRetention, path)
+	for _, name := range []string{"dev", "staging", "prod"} {
+		s := newSampler(name, time.Hour, DefaultRetention)
+		s.topics["orders"] = NewRing(s.capacity)
+		s.topics["orders"].Add(Sample{Time: time.Now(), Produced: 10})
+		m.samplers[name] = s
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := m.Save(); err != nil {
+				t.Errorf("Save() error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	restored := NewManager(time.Hour, DefaultRetention, path)
+	if len(restored.history) != 3 {
+		t.Errorf("restored %d clusters, want 3", len(restored.history))
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("directory holds %d files, want only the samples file", len(entries))
+	}
+}
+
+func TestSampler_Snapshot(t *testing.T) {
+	broker := sarama.NewMockBroker(t, 1)
+	defer broker.Close()
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"ApiVersionsRequest": sarama.NewMockApiVersionsResponse(t),
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetController(broker.BrokerID()).
+			SetLeader("orders", 0, broker.BrokerID()),
+		"OffsetRequest": sarama.NewMockOffsetResponse(t).
+			SetOffset("orders", 0, sarama.OffsetNewest, 10),
+		"ListGroupsRequest": sarama.NewMockListGroupsResponse(t).AddGroup("billing", "consumer"),
+		"FindCoordinatorRequest": sarama.NewMockFindCoordinatorResponse(t).
+			SetCoordinator(sarama.CoordinatorGroup, "billing", broker),
+		"OffsetFetchRequest": sarama.NewMockOffsetFetchResponse(t).
+			SetOffset("billing", "orders", 0, 4, "", sarama.ErrNoError),
+	})
+
+	h, err := cluster.NewCluster([]string{broker.Addr()}, sarama.V2_1_0_0).Open(context.Background(), "local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = h.Close() }()
+
+	m := NewManager(time.Hour, DefaultRetention, "")
+	defer m.Stop()
+	s := m.Start("local", func(context.Context) (*cluster.Handle, func(), error) {
+		return h, func() {}, nil
+	})
+	if err := s.sample(h.Client, h.Admin, time.Now()); err != nil {
+		t.Fatalf("sample() error = %v", err)
+	}
+
+	snapshots := m.Snapshots()
+	if len(snapshots) != 1 || !snapshots[0].Up || snapshots[0].Snapshot == nil {
+		t.Fatalf("Snapshots() = %+v, want one sampled cluster", snapshots)
+	}
+	snapshot := snapshots[0]
+	if snapshot.Brokers != 1 || snapshot.Partitions["orders"] != 1 || snapshot.LogEndOffsets["orders"] != 10 {
+		t.Errorf("snapshot = %+v, want 1 broker and orders at offset 10", snapshot.Snapshot)
+	}
+	if lag := snapshot.GroupLag["billing"]["orders"]; lag != 6 {
+		t.Errorf("billing lag on orders = %d, want 6", lag)
+	}
+}
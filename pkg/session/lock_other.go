@@ -0,0 +1,8 @@
+//go:build !unix
+
+package session
+
+// lockFile is a no-op where flock is unavailable; writes are still atomic
+func lockFile(path string, exclusive bool) (unlock func(), err error) {
+	return func() {}, nil
+}
@@ -0,0 +1,223 @@
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/IBM/openkommander/pkg/cluster"
+	"github.com/IBM/openkommander/pkg/output"
+	"github.com/IBM/sarama"
+)
+
+// Output formats a profile can select as the default for its commands
+const (
+	OutputTable = "table"
+	OutputJSON  = output.JSON
+	OutputYAML  = output.YAML
+)
+
+// OutputFormats lists the accepted output formats
+var OutputFormats = []string{OutputTable, OutputJSON, OutputYAML}
+
+// Duration is a time.Duration stored in the session file as a string like "30s"
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("duration must be a string like \"30s\": %w", err)
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// ClusterConnection is a saved cluster profile. Only name and brokers are required; an
+// empty version is detected from the cluster on first connect, and every other setting
+// falls back to sarama's default when unset.
+type ClusterConnection struct {
+	Name            string   `json:"name"`
+	Brokers         []string `json:"brokers"`
+	Version         string   `json:"version"`
+	IsAuthenticated bool     `json:"isAuthenticated,omitempty"`
+
+	ClientID        string            `json:"clientId,omitempty"`
+	DialTimeout     Duration          `json:"dialTimeout,omitempty"`
+	RequestTimeout  Duration          `json:"requestTimeout,omitempty"`
+	MetadataRefresh Duration          `json:"metadataRefresh,omitempty"`
+	SASL            *SASLProfile      `json:"sasl,omitempty"`
+	TLS             *TLSProfile       `json:"tls,omitempty"`
+	OutputFormat    string            `json:"outputFormat,omitempty"`
+	ReadOnly        bool              `json:"readOnly,omitempty"`
+	Labels          map[string]string `json:"labels,omitempty"`
+}
+
+// SASLProfile refers to SASL credentials. The password itself is never saved; it is read
+// from an environment variable or a file when connecting.
+type SASLProfile struct {
+	Mechanism    string `json:"mechanism"`
+	Username     string `json:"username"`
+	PasswordEnv  string `json:"passwordEnv,omitempty"`
+	PasswordFile string `json:"passwordFile,omitempty"`
+}
+
+// TLSProfile refers to the files used to secure broker connections
+type TLSProfile struct {
+	CAFile             string `json:"caFile,omitempty"`
+	CertFile           string `json:"certFile,omitempty"`
+	KeyFile            string `json:"keyFile,omitempty"`
+	InsecureSkipVerify bool   `json:"insecureSkipVerify,omitempty"`
+	// SkipHostnameVerification accepts broker certificates issued for another host name,
+	// as long as they are signed by a trusted CA
+	SkipHostnameVerification bool `json:"skipHostnameVerification,omitempty"`
+}
+
+// IsProduction reports whether the profile is labelled as a production cluster, with an
+// env or environment label of prod or production. Destructive commands ask for typed
+// confirmation on production clusters.
+func (c ClusterConnection) IsProduction() bool {
+	for _, key := range []string{"env", "environment"} {
+		switch strings.ToLower(c.Labels[key]) {
+		case "prod", "production":
+			return true
+		}
+	}
+	return false
+}
+
+// clone returns a deep copy, so callers cannot modify the manager's state
+func (c ClusterConnection) clone() ClusterConnection {
+	c.Brokers = slices.Clone(c.Brokers)
+	c.Labels = maps.Clone(c.Labels)
+	if c.SASL != nil {
+		sasl := *c.SASL
+		c.SASL = &sasl
+	}
+	if c.TLS != nil {
+		tls := *c.TLS
+		c.TLS = &tls
+	}
+	return c
+}
+
+// Validate checks the profile without contacting the cluster
+func (c ClusterConnection) Validate() error {
+	if strings.TrimSpace(c.Name) == "" {
+		return fmt.Errorf("cluster name cannot be empty")
+	}
+	if len(c.Brokers) == 0 {
+		return fmt.Errorf("at least one broker address is required")
+	}
+	for _, broker := range c.Brokers {
+		if strings.TrimSpace(broker) == "" {
+			return fmt.Errorf("broker addresses cannot be empty")
+		}
+	}
+	if c.Version != "" {
+		if _, err := cluster.ParseVersion(c.Version); err != nil {
+			return fmt.Errorf("invalid kafka version '%s': %w", c.Version, err)
+		}
+	}
+	for name, d := range map[string]Duration{"dial timeout": c.DialTimeout, "request timeout": c.RequestTimeout, "metadata refresh": c.MetadataRefresh} {
+		if d < 0 {
+			return fmt.Errorf("%s cannot be negative", name)
+		}
+	}
+	if c.OutputFormat != "" && !slices.Contains(OutputFormats, c.OutputFormat) {
+		return fmt.Errorf("invalid output format '%s', use one of %s", c.OutputFormat, strings.Join(OutputFormats, ", "))
+	}
+	if c.SASL != nil {
+		switch c.SASL.Mechanism {
+		case cluster.SASLMechanismPlain, cluster.SASLMechanismSCRAMSHA256, cluster.SASLMechanismSCRAMSHA512:
+		default:
+			return fmt.Errorf("unsupported SASL mechanism '%s', use %s, %s or %s", c.SASL.Mechanism,
+				cluster.SASLMechanismPlain, cluster.SASLMechanismSCRAMSHA256, cluster.SASLMechanismSCRAMSHA512)
+		}
+		if c.SASL.Username == "" {
+			return fmt.Errorf("SASL username cannot be empty")
+		}
+		if c.SASL.PasswordEnv != "" && c.SASL.PasswordFile != "" {
+			return fmt.Errorf("set either a SASL password environment variable or a password file, not both")
+		}
+	}
+	if c.TLS != nil && (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		return fmt.Errorf("TLS client certificate and key must be set together")
+	}
+	for key := range c.Labels {
+		if strings.TrimSpace(key) == "" {
+			return fmt.Errorf("label keys cannot be empty")
+		}
+	}
+	return nil
+}
+
+// Cluster returns the cluster described by the profile, with SASL credentials resolved
+func (c ClusterConnection) Cluster() (*cluster.Cluster, error) {
+	version := sarama.DefaultVersion
+	if c.Version != "" {
+		var err error
+		if version, err = cluster.ParseVersion(c.Version); err != nil {
+			return nil, fmt.Errorf("invalid kafka version: %w", err)
+		}
+	}
+
+	options := cluster.Options{
+		ClientID:        c.ClientID,
+		DialTimeout:     time.Duration(c.DialTimeout),
+		RequestTimeout:  time.Duration(c.RequestTimeout),
+		MetadataRefresh: time.Duration(c.MetadataRefresh),
+	}
+	if c.SASL != nil {
+		password, err := c.SASL.password()
+		if err != nil {
+			return nil, err
+		}
+		options.SASL = &cluster.SASL{Mechanism: c.SASL.Mechanism, Username: c.SASL.Username, Password: password}
+	}
+	if c.TLS != nil {
+		options.TLS = &cluster.TLS{
+			CAFile:                   c.TLS.CAFile,
+			CertFile:                 c.TLS.CertFile,
+			KeyFile:                  c.TLS.KeyFile,
+			InsecureSkipVerify:       c.TLS.InsecureSkipVerify,
+			SkipHostnameVerification: c.TLS.SkipHostnameVerification,
+		}
+	}
+
+	kafkaCluster := cluster.NewCluster(c.Brokers, version)
+	if err := kafkaCluster.Apply(options); err != nil {
+		return nil, fmt.Errorf("invalid connection settings for cluster '%s': %w", c.Name, err)
+	}
+	return kafkaCluster, nil
+}
+
+func (s *SASLProfile) password() (string, error) {
+	switch {
+	case s.PasswordEnv != "":
+		password, ok := os.LookupEnv(s.PasswordEnv)
+		if !ok {
+			return "", fmt.Errorf("SASL password environment variable %s is not set", s.PasswordEnv)
+		}
+		return password, nil
+	case s.PasswordFile != "":
+		data, err := os.ReadFile(s.PasswordFile)
+		if err != nil {
+			return "", fmt.Errorf("error reading SASL password file: %w", err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	default:
+		return "", nil
+	}
+}
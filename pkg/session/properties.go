@@ -0,0 +1,150 @@
+package session
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/IBM/openkommander/pkg/cluster"
+)
+
+// ParseProperties reads a Java properties file: key=value or key:value lines, '#' and '!'
+// comments, and values continued on the next line after a trailing backslash
+func ParseProperties(r io.Reader) (map[string]string, error) {
+	properties := map[string]string{}
+	scanner := bufio.NewScanner(r)
+	var pending string
+	for scanner.Scan() {
+		line := strings.TrimLeft(scanner.Text(), " \t\f")
+		if pending == "" && (line == "" || line[0] == '#' || line[0] == '!') {
+			continue
+		}
+		if strings.HasSuffix(line, `\`) && !strings.HasSuffix(line, `\\`) {
+			pending += strings.TrimSuffix(line, `\`)
+			continue
+		}
+		line, pending = pending+line, ""
+
+		separator := strings.IndexAny(line, "=:")
+		if separator < 0 {
+			properties[strings.TrimSpace(line)] = ""
+			continue
+		}
+		key := strings.TrimSpace(line[:separator])
+		properties[key] = strings.TrimSpace(line[separator+1:])
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if pending != "" {
+		return nil, fmt.Errorf("properties file ends in a line continuation")
+	}
+	return properties, nil
+}
+
+var jaasOption = regexp.MustCompile(`(\w+)\s*=\s*"((?:[^"\\]|\\.)*)"`)
+
+// ProfileFromClientProperties builds a profile from the settings of a Kafka client
+// configuration file, such as the client.properties used with the Kafka CLI tools. It
+// returns warnings for settings that cannot be carried over, and the SASL password from
+// sasl.jaas.config, which is not part of the profile.
+func ProfileFromClientProperties(name string, properties map[string]string) (connection ClusterConnection, password string, warnings []string, err error) {
+	connection.Name = name
+
+	var ignored []string
+	for key, value := range properties {
+		switch key {
+		case "bootstrap.servers":
+			for _, broker := range strings.Split(value, ",") {
+				if broker = strings.TrimSpace(broker); broker != "" {
+					connection.Brokers = append(connection.Brokers, broker)
+				}
+			}
+		case "client.id":
+			connection.ClientID = value
+		case "socket.connection.setup.timeout.ms", "request.timeout.ms", "metadata.max.age.ms":
+			ms, convErr := strconv.ParseInt(value, 10, 64)
+			if convErr != nil || ms < 0 {
+				return connection, "", nil, fmt.Errorf("%s must be a number of milliseconds, got '%s'", key, value)
+			}
+			d := Duration(time.Duration(ms) * time.Millisecond)
+			switch key {
+			case "socket.connection.setup.timeout.ms":
+				connection.DialTimeout = d
+			case "request.timeout.ms":
+				connection.RequestTimeout = d
+			default:
+				connection.MetadataRefresh = d
+			}
+		case "security.protocol", "sasl.mechanism", "sasl.jaas.config", "ssl.truststore.type", "ssl.keystore.type",
+			"ssl.truststore.location", "ssl.keystore.location", "ssl.endpoint.identification.algorithm":
+			// Handled below, since they depend on each other
+		default:
+			ignored = append(ignored, key)
+		}
+	}
+
+	protocol := strings.ToUpper(properties["security.protocol"])
+	switch protocol {
+	case "", "PLAINTEXT":
+	case "SSL", "SASL_SSL", "SASL_PLAINTEXT":
+	default:
+		return connection, "", nil, fmt.Errorf("unsupported security.protocol '%s'", properties["security.protocol"])
+	}
+
+	if strings.HasPrefix(protocol, "SASL_") {
+		mechanism := strings.ToUpper(properties["sasl.mechanism"])
+		if mechanism == "" {
+			// Kafka's default
+			mechanism = cluster.SASLMechanismPlain
+		}
+		connection.SASL = &SASLProfile{Mechanism: mechanism}
+		for _, match := range jaasOption.FindAllStringSubmatch(properties["sasl.jaas.config"], -1) {
+			value := strings.NewReplacer(`\"`, `"`, `\\`, `\`).Replace(match[2])
+			switch match[1] {
+			case "username":
+				connection.SASL.Username = value
+			case "password":
+				password = value
+			}
+		}
+		if password == "" {
+			warnings = append(warnings, "sasl.jaas.config has no password; set one with 'ok cluster edit --sasl-password-env' or --sasl-password-file")
+		}
+	}
+
+	if protocol == "SSL" || protocol == "SASL_SSL" {
+		connection.TLS = &TLSProfile{}
+		if location := properties["ssl.truststore.location"]; location != "" {
+			if strings.ToUpper(properties["ssl.truststore.type"]) == "PEM" {
+				connection.TLS.CAFile = location
+			} else {
+				warnings = append(warnings, "ssl.truststore.location is only supported with ssl.truststore.type=PEM; set a PEM CA file with 'ok cluster edit --tls-ca'")
+			}
+		}
+		if location := properties["ssl.keystore.location"]; location != "" {
+			if strings.ToUpper(properties["ssl.keystore.type"]) == "PEM" {
+				// A PEM keystore holds both the certificate and its key
+				connection.TLS.CertFile = location
+				connection.TLS.KeyFile = location
+			} else {
+				warnings = append(warnings, "ssl.keystore.location is only supported with ssl.keystore.type=PEM; set PEM files with 'ok cluster edit --tls-cert --tls-key'")
+			}
+		}
+		if algorithm, ok := properties["ssl.endpoint.identification.algorithm"]; ok && algorithm == "" {
+			connection.TLS.SkipHostnameVerification = true
+			warnings = append(warnings, "ssl.endpoint.identification.algorithm is empty, so the host names in broker certificates will not be verified")
+		}
+	}
+
+	if len(ignored) > 0 {
+		slices.Sort(ignored)
+		warnings = append(warnings, "ignored unsupported settings: "+strings.Join(ignored, ", "))
+	}
+	return connection, password, warnings, nil
+}
@@ -3,10 +3,13 @@ package session
 import (
 	"bufio"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"reflect"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/IBM/openkommander/pkg/cluster"
@@ -15,274 +18,548 @@ import (
 	"github.com/IBM/sarama"
 )
 
-type Session interface {
-	Info() string
-	Connect(ctx context.Context) (sarama.Client, error)
-	Disconnect()
-	GetClient() (sarama.Client, error)
-	GetAdminClient() (sarama.ClusterAdmin, error)
-	IsAuthenticated() bool
+type SessionData struct {
+	Version       int                 `json:"version"`
+	Clusters      []ClusterConnection `json:"clusters"`
+	ActiveCluster string              `json:"activeCluster"`
 }
 
-type session struct {
+var (
+	errNoActiveCluster = errors.New("no active cluster selected")
+	errClusterNotFound = errors.New("cluster not found")
+)
+
+// SessionManager holds the saved cluster connections and the active cluster, and caches
+// one open connection per cluster. It is safe for concurrent use, so the REST server can
+// share a single manager between requests.
+type SessionManager struct {
+	path string
+
+	mu            sync.RWMutex
 	clusters      []ClusterConnection
 	activeCluster string
-	client        sarama.Client
-	adminClient   sarama.ClusterAdmin
+	handles       map[string]*cachedHandle
+	// generations counts the changes of every profile, so a connection made while its
+	// profile changed is not cached
+	generations map[string]uint64
+	// retired are connections of changed profiles that callers still hold
+	retired []*cachedHandle
+	// identities caches the brokers advertised by the clusters of read-only profiles
+	identities map[string]clusterIdentity
+	// loaded identifies the session file as last loaded or saved, to notice changes
+	// saved by other ok processes
+	loaded fileVersion
 }
 
-type ClusterConnection struct {
-	Name            string   `json:"name"`
-	Brokers         []string `json:"brokers"`
-	Version         string   `json:"version"`
-	IsAuthenticated bool     `json:"isAuthenticated"`
+// clusterIdentity is the set of broker addresses a cluster advertises, as seen at a
+// generation of its profile
+type clusterIdentity struct {
+	generation uint64
+	brokers    map[string]bool
 }
 
-type SessionData struct {
-	Clusters      []ClusterConnection `json:"clusters"`
-	ActiveCluster string              `json:"activeCluster"`
+// fileVersion is the modification time and size of a session file
+type fileVersion struct {
+	modTime time.Time
+	size    int64
 }
 
-func (s *session) Info() string {
-	if s.activeCluster == "" {
-		return "No active cluster selected"
+func statVersion(path string) fileVersion {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileVersion{}
 	}
+	return fileVersion{modTime: info.ModTime(), size: info.Size()}
+}
 
-	for _, cluster := range s.clusters {
-		if cluster.Name == s.activeCluster {
-			return fmt.Sprintf("Active Cluster: %s, Brokers: %v, Authenticated: %v, Version: %v",
-				cluster.Name, cluster.Brokers, cluster.IsAuthenticated, cluster.Version)
-		}
+// cachedHandle is a shared connection to a cluster. Once its profile changes it is retired,
+// and closed when the last caller holding it releases it.
+type cachedHandle struct {
+	handle  *cluster.Handle
+	refs    int
+	retired bool
+}
+
+// NewSessionManager returns an empty manager that saves to path. Call Load to read the
+// connections saved there.
+func NewSessionManager(path string) *SessionManager {
+	return &SessionManager{
+		path:        path,
+		clusters:    []ClusterConnection{},
+		handles:     map[string]*cachedHandle{},
+		generations: map[string]uint64{},
+		identities:  map[string]clusterIdentity{},
 	}
-	return "Active cluster not found"
 }
 
-func (s *session) getActiveCluster() *ClusterConnection {
-	idx := s.getActiveClusterIndex()
-	if idx >= 0 {
-		return &s.clusters[idx]
+// OpenSessionManager returns a manager loaded from path, creating an empty session file
+// when none exists
+func OpenSessionManager(path string) (*SessionManager, error) {
+	m := NewSessionManager(path)
+	if err := m.Load(); err != nil {
+		return nil, err
 	}
-	return nil
+	return m, nil
 }
 
-func (s *session) getActiveClusterIndex() int {
-	for i := range s.clusters {
-		if s.clusters[i].Name == s.activeCluster {
-			return i
+// Path returns the session file the manager loads from and saves to
+func (m *SessionManager) Path() string {
+	return m.path
+}
+
+// Load replaces the saved connections with the contents of the session file, restoring
+// the last good backup when the file is damaged and creating it when none exists
+func (m *SessionManager) Load() error {
+	unlock, err := lockFile(m.path, true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	data, err := loadSessionFile(m.path)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.setClustersLocked(data)
+
+	if _, err := os.Stat(m.path); errors.Is(err, os.ErrNotExist) {
+		if err := saveSessionFile(m.path, data); err != nil {
+			return err
 		}
 	}
-	return -1
+	m.loaded = statVersion(m.path)
+	return nil
 }
 
-func (s *session) Connect(ctx context.Context) (sarama.Client, error) {
-	if s.client != nil {
-		return s.client, nil
+// refresh reloads the session file when another ok process saved it since it was loaded,
+// so a long-running server sees profiles changed with the CLI
+func (m *SessionManager) refresh() {
+	m.mu.RLock()
+	loaded := m.loaded
+	m.mu.RUnlock()
+	if loaded == (fileVersion{}) || statVersion(m.path) == loaded {
+		return
 	}
-
-	activeCluster := s.getActiveCluster()
-	if activeCluster == nil {
-		return nil, fmt.Errorf("no active cluster selected")
+	if err := m.Load(); err != nil {
+		logger.Warn("Failed to reload the session file", "path", m.path, "error", err)
 	}
+}
 
-	version, err := sarama.ParseKafkaVersion(activeCluster.Version)
-	if err != nil {
-		return nil, fmt.Errorf("invalid kafka version: %w", err)
+// setClustersLocked replaces the profiles with those read from the session file. Cached
+// connections of profiles that changed or were removed are retired. The caller must hold
+// the write lock.
+func (m *SessionManager) setClustersLocked(data SessionData) {
+	for _, previous := range m.clusters {
+		i := slices.IndexFunc(data.Clusters, func(c ClusterConnection) bool { return c.Name == previous.Name })
+		if i < 0 || !reflect.DeepEqual(previous, data.Clusters[i]) {
+			m.retireHandleLocked(previous.Name)
+		}
 	}
-	client, err := cluster.NewCluster(activeCluster.Brokers, version).Connect(ctx)
+	m.clusters = data.Clusters
+	m.activeCluster = data.ActiveCluster
+}
+
+// updateLocked applies change to the session and saves it while holding the file lock.
+// The file is reloaded first, so changes saved by other ok processes since Load are kept.
+// The caller must hold the write lock.
+func (m *SessionManager) updateLocked(change func() error) error {
+	unlock, err := lockFile(m.path, true)
 	if err != nil {
-		return nil, fmt.Errorf("error connecting to cluster: %w", err)
+		return err
 	}
-	adminClient, err := cluster.NewCluster(activeCluster.Brokers, version).ConnectAdmin(ctx)
+	defer unlock()
+
+	data, err := loadSessionFile(m.path)
 	if err != nil {
-		return nil, fmt.Errorf("error connecting to cluster as admin: %w", err)
+		return err
 	}
-	s.client = client
-	s.adminClient = adminClient
-	index := s.getActiveClusterIndex()
-	if index >= 0 {
-		s.clusters[index].IsAuthenticated = true
+	m.setClustersLocked(data)
+
+	if err := change(); err != nil {
+		return err
 	}
-	return client, nil
+
+	err = saveSessionFile(m.path, SessionData{
+		Version:       CurrentSchemaVersion,
+		Clusters:      m.clusters,
+		ActiveCluster: m.activeCluster,
+	})
+	m.loaded = statVersion(m.path)
+	return err
 }
 
-func (s *session) Disconnect() {
-	if s.client != nil {
-		if err := s.client.Close(); err != nil {
-			logger.Error("Error closing client", "error", err)
+// indexLocked returns the index of the named cluster, or -1. The caller must hold the lock.
+func (m *SessionManager) indexLocked(clusterName string) int {
+	for i := range m.clusters {
+		if m.clusters[i].Name == clusterName {
+			return i
 		}
 	}
-	s.client = nil
-	s.adminClient = nil
+	return -1
+}
 
-	// Mark active cluster as disconnected
-	index := s.getActiveClusterIndex()
-	if index >= 0 {
-		s.clusters[index].IsAuthenticated = false
+// Clusters returns a copy of the saved cluster connections. Like the other lookups, it
+// first reloads the session file when another ok process changed it.
+func (m *SessionManager) Clusters() []ClusterConnection {
+	m.refresh()
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	clusters := make([]ClusterConnection, len(m.clusters))
+	for i, c := range m.clusters {
+		clusters[i] = c.clone()
 	}
-	fmt.Println("Logged out successfully!")
+	return clusters
 }
 
-func (s *session) IsAuthenticated() bool {
-	activeCluster := s.getActiveCluster()
-	return activeCluster != nil && activeCluster.IsAuthenticated
+// ClusterByName returns a copy of the named cluster connection
+func (m *SessionManager) ClusterByName(clusterName string) (ClusterConnection, bool) {
+	m.refresh()
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	i := m.indexLocked(clusterName)
+	if i < 0 {
+		return ClusterConnection{}, false
+	}
+	return m.clusters[i].clone(), true
+}
+
+// ActiveClusterName returns the name of the selected cluster, empty when none is selected
+func (m *SessionManager) ActiveClusterName() string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.activeCluster
+}
+
+// IsAuthenticated reports whether a cluster is selected and logged in
+func (m *SessionManager) IsAuthenticated() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	i := m.indexLocked(m.activeCluster)
+	return i >= 0 && m.clusters[i].IsAuthenticated
 }
 
-func (s *session) GetAdminClient() (sarama.ClusterAdmin, error) {
-	if s.adminClient != nil {
-		return s.adminClient, nil
+func (m *SessionManager) Info() string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.activeCluster == "" {
+		return "No active cluster selected"
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
 
-	activeCluster := s.getActiveCluster()
-	if activeCluster == nil {
-		return nil, fmt.Errorf("no active cluster selected")
+	i := m.indexLocked(m.activeCluster)
+	if i < 0 {
+		return "Active cluster not found"
 	}
+	c := m.clusters[i]
+	return fmt.Sprintf("Active Cluster: %s, Brokers: %v, Authenticated: %v, Version: %v",
+		c.Name, c.Brokers, c.IsAuthenticated, c.Version)
+}
 
-	version, err := sarama.ParseKafkaVersion(activeCluster.Version)
-	if err != nil {
-		return nil, fmt.Errorf("invalid kafka version: %w", err)
+// IsReadOnlyCluster reports whether a handle is connected to the cluster of a read-only
+// profile, for callers that connect by address rather than through a profile. Clusters are
+// told apart by the broker addresses they advertise, so the profile is found whichever of
+// its brokers, or alias of them, the handle was opened with. The brokers advertised by a
+// read-only profile's cluster are cached until the profile changes. A read-only profile
+// that cannot be reached to compare it is an error, since the handle may belong to it.
+func (m *SessionManager) IsReadOnlyCluster(ctx context.Context, h *cluster.Handle) (bool, error) {
+	identity := advertisedBrokers(h)
+
+	var candidates []string
+	for _, c := range m.Clusters() {
+		if !c.ReadOnly {
+			continue
+		}
+		if slices.ContainsFunc(c.Brokers, func(address string) bool { return identity[address] }) {
+			return true, nil
+		}
+		candidates = append(candidates, c.Name)
 	}
-	adminClient, err := cluster.NewCluster(activeCluster.Brokers, version).ConnectAdmin(ctx)
-	if err != nil {
-		return nil, err
+
+	var unreachable error
+	for _, name := range candidates {
+		brokers, err := m.readOnlyIdentity(ctx, name)
+		if err != nil {
+			if unreachable == nil {
+				unreachable = fmt.Errorf("could not reach read-only cluster '%s' to compare it: %w", name, err)
+			}
+			continue
+		}
+		for address := range brokers {
+			if identity[address] {
+				return true, nil
+			}
+		}
 	}
-	s.adminClient = adminClient
-	return adminClient, nil
+	return false, unreachable
 }
 
-func (s *session) GetClient() (sarama.Client, error) {
-	if s.client != nil {
-		return s.client, nil
+// readOnlyIdentity returns the brokers advertised by the cluster of a profile, connecting
+// only when they are not cached for the profile's current generation
+func (m *SessionManager) readOnlyIdentity(ctx context.Context, clusterName string) (map[string]bool, error) {
+	m.mu.RLock()
+	cached, ok := m.identities[clusterName]
+	generation := m.generations[clusterName]
+	m.mu.RUnlock()
+	if ok && cached.generation == generation {
+		return cached.brokers, nil
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
 
-	client, err := s.Connect(ctx)
+	h, release, err := m.Acquire(ctx, clusterName)
 	if err != nil {
 		return nil, err
 	}
-	return client, nil
+	brokers := advertisedBrokers(h)
+	release()
+
+	m.mu.Lock()
+	m.identities[clusterName] = clusterIdentity{generation: generation, brokers: brokers}
+	m.mu.Unlock()
+	return brokers, nil
 }
 
-func (s *session) GetBrokers() []string {
-	activeCluster := s.getActiveCluster()
-	if activeCluster == nil {
-		return []string{}
+// advertisedBrokers returns the addresses a handle was opened with and those its cluster
+// advertises in its metadata
+func advertisedBrokers(h *cluster.Handle) map[string]bool {
+	addresses := map[string]bool{}
+	for _, address := range h.Brokers {
+		addresses[address] = true
 	}
-	return activeCluster.Brokers
+	for _, broker := range h.Client.Brokers() {
+		addresses[broker.Addr()] = true
+	}
+	return addresses
 }
 
-func GetCurrentSession() *session {
-	return currentSession
-}
+// ClusterForBroker returns a copy of the first profile listing the broker address, for
+// callers that are given a broker rather than a cluster name
+func (m *SessionManager) ClusterForBroker(address string) (ClusterConnection, bool) {
+	m.refresh()
 
-var currentSession *session
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 
-func createDefaultSession() error {
-	err := os.MkdirAll(constants.OpenKommanderFolder, 0755)
-	if err != nil {
-		return fmt.Errorf("error creating directory %s: %w", constants.OpenKommanderFolder, err)
+	for _, c := range m.clusters {
+		if slices.Contains(c.Brokers, address) {
+			return c.clone(), true
+		}
 	}
+	return ClusterConnection{}, false
+}
 
-	file, err := os.OpenFile(constants.OpenKommanderConfigFilename, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
-	if err != nil {
-		return fmt.Errorf("error creating session file %s: %w", constants.OpenKommanderConfigFilename, err)
-	}
-	defer func() {
-		if err := file.Close(); err != nil {
-			logger.Error("Error closing file", "error", err)
+// Handle returns an open connection to the named cluster, connecting on first use. The
+// connection is cached and shared, so callers must not close it. It stays open until the
+// manager is closed, even when the profile changes meanwhile, which suits callers that use
+// it for the life of the process. The context bounds the connection attempt only.
+func (m *SessionManager) Handle(ctx context.Context, clusterName string) (*cluster.Handle, error) {
+	h, _, err := m.Acquire(ctx, clusterName)
+	return h, err
+}
+
+// Acquire returns the cached connection to the named cluster like Handle, and a function
+// releasing it. A connection whose profile changed is closed once every caller released it,
+// so long-running callers such as the REST server should release what they acquire.
+func (m *SessionManager) Acquire(ctx context.Context, clusterName string) (*cluster.Handle, func(), error) {
+	m.refresh()
+
+	for {
+		m.mu.Lock()
+		if cached, ok := m.handles[clusterName]; ok {
+			cached.refs++
+			m.mu.Unlock()
+			return cached.handle, m.releaser(cached), nil
+		}
+		i := m.indexLocked(clusterName)
+		if i < 0 {
+			m.mu.Unlock()
+			return nil, nil, fmt.Errorf("cluster '%s' not found", clusterName)
+		}
+		connection := m.clusters[i].clone()
+		generation := m.generations[clusterName]
+		m.mu.Unlock()
+
+		// Connect without holding the lock so a slow cluster does not block the others
+		h, err := m.open(ctx, connection)
+		if err != nil {
+			return nil, nil, err
 		}
-	}()
 
-	sessionData := SessionData{Clusters: []ClusterConnection{}, ActiveCluster: ""}
-	return json.NewEncoder(file).Encode(sessionData)
+		m.mu.Lock()
+		if m.generations[clusterName] != generation {
+			// The profile changed or was removed while connecting, so the connection uses
+			// old settings; connect again with the current profile
+			m.mu.Unlock()
+			closeHandle(h)
+			if err := ctx.Err(); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+		cached, ok := m.handles[clusterName]
+		if ok {
+			// Another caller connected first; keep theirs
+			closeHandle(h)
+		} else {
+			cached = &cachedHandle{handle: h}
+			m.handles[clusterName] = cached
+		}
+		cached.refs++
+		m.mu.Unlock()
+		return cached.handle, m.releaser(cached), nil
+	}
 }
 
-func saveSession() error {
-	err := os.MkdirAll(constants.OpenKommanderFolder, 0755)
-	if err != nil {
-		return fmt.Errorf("error creating directory %s: %w", constants.OpenKommanderFolder, err)
+// releaser returns a function releasing one reference to a cached connection, closing it
+// when it has been retired and this was the last reference
+func (m *SessionManager) releaser(cached *cachedHandle) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			m.mu.Lock()
+			defer m.mu.Unlock()
+
+			cached.refs--
+			if cached.retired && cached.refs == 0 {
+				closeHandle(cached.handle)
+				m.retired = slices.DeleteFunc(m.retired, func(c *cachedHandle) bool { return c == cached })
+			}
+		})
 	}
+}
 
-	file, err := os.OpenFile(constants.OpenKommanderConfigFilename, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+// open connects to the cluster of a profile and checks its Kafka version. A profile
+// without a version is connected with the detected one, which is saved; a saved version
+// that no longer matches the cluster is reported, since sarama then uses protocol
+// versions the brokers may not support or misses newer ones.
+func (m *SessionManager) open(ctx context.Context, connection ClusterConnection) (*cluster.Handle, error) {
+	kafkaCluster, err := connection.Cluster()
 	if err != nil {
-		return fmt.Errorf("error creating session file %s: %w", constants.OpenKommanderConfigFilename, err)
+		return nil, err
 	}
-	defer func() {
-		if err := file.Close(); err != nil {
-			logger.Error("Error closing session file", "error", err)
-		}
-	}()
 
-	sessionData := SessionData{
-		Clusters:      currentSession.clusters,
-		ActiveCluster: currentSession.activeCluster,
-	}
-	err = json.NewEncoder(file).Encode(sessionData)
+	h, err := kafkaCluster.Open(ctx, connection.Name)
 	if err != nil {
-		return fmt.Errorf("error encoding session data: %w", err)
+		return nil, fmt.Errorf("error connecting to cluster: %w", err)
 	}
-	return nil
+	h.ReadOnly = connection.ReadOnly
+
+	detected, err := cluster.Await(ctx, func() (sarama.KafkaVersion, error) {
+		return cluster.BrokerVersion(h.Client)
+	})
+	switch {
+	case err != nil:
+		logger.Warn("Could not detect the Kafka version", "cluster", connection.Name, "error", err)
+	case connection.Version != "":
+		if !cluster.VersionMatches(kafkaCluster.Config.Version, detected) {
+			logger.Warn("Saved Kafka version does not match the cluster; update it with 'ok cluster edit <name> --kafka-version auto'",
+				"cluster", connection.Name, "saved", connection.Version, "detected", detected.String())
+		}
+	default:
+		if detected != kafkaCluster.Config.Version {
+			closeHandle(h)
+			kafkaCluster.Config.Version = detected
+			if h, err = kafkaCluster.Open(ctx, connection.Name); err != nil {
+				return nil, fmt.Errorf("error connecting to cluster: %w", err)
+			}
+			h.ReadOnly = connection.ReadOnly
+		}
+		m.saveDetectedVersion(connection.Name, detected)
+	}
+	return h, nil
 }
 
-func loadSession() error {
-	file, err := os.Open(constants.OpenKommanderConfigFilename)
-	if err != nil {
-		err = createDefaultSession()
-		if err != nil {
-			fmt.Println("Error creating session file:", err)
-			return err
-		}
+// saveDetectedVersion stores a detected version in a profile that still has none
+func (m *SessionManager) saveDetectedVersion(clusterName string, version sarama.KafkaVersion) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-		file, err = os.Open(constants.OpenKommanderConfigFilename)
-		if err != nil {
-			fmt.Println("Error opening session file:", err)
-			return err
+	err := m.updateLocked(func() error {
+		if i := m.indexLocked(clusterName); i >= 0 && m.clusters[i].Version == "" {
+			m.clusters[i].Version = version.String()
 		}
+		return nil
+	})
+	if err != nil {
+		logger.Warn("Failed to save the detected Kafka version", "cluster", clusterName, "error", err)
+		return
 	}
-	defer func() {
-		if err := file.Close(); err != nil {
-			logger.Error("Error closing session file", "error", err)
-		}
-	}()
+	logger.Info("Detected Kafka version", "cluster", clusterName, "version", version.String())
+}
 
-	var data SessionData
-	decoder := json.NewDecoder(file)
-	err = decoder.Decode(&data)
-	if err != nil {
-		fmt.Println("Error decoding session data:", err)
-		return err
+// ActiveHandle returns an open connection to the selected cluster
+func (m *SessionManager) ActiveHandle(ctx context.Context) (*cluster.Handle, error) {
+	clusterName := m.ActiveClusterName()
+	if clusterName == "" {
+		return nil, errNoActiveCluster
 	}
+	return m.Handle(ctx, clusterName)
+}
 
-	currentSession.clusters = data.Clusters
-	currentSession.activeCluster = data.ActiveCluster
-	return nil
+// Disconnect closes the cached connection of the selected cluster and marks it logged out
+func (m *SessionManager) Disconnect() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.retireHandleLocked(m.activeCluster)
+	if i := m.indexLocked(m.activeCluster); i >= 0 {
+		m.clusters[i].IsAuthenticated = false
+	}
+	fmt.Println("Logged out successfully!")
 }
 
-func init() {
-	currentSession = &session{
-		clusters:      []ClusterConnection{},
-		activeCluster: "",
-		client:        nil,
-		adminClient:   nil,
+// Close closes every connection, including those callers still hold
+func (m *SessionManager) Close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for name, cached := range m.handles {
+		closeHandle(cached.handle)
+		delete(m.handles, name)
+	}
+	for _, cached := range m.retired {
+		closeHandle(cached.handle)
 	}
+	m.retired = nil
+}
 
-	err := loadSession()
-	if err != nil {
-		logger.Error("Error loading session", "error", err)
+// retireHandleLocked forgets the cached connection of a cluster whose profile changed or
+// was removed, closing it now if no caller holds it and otherwise when the last one
+// releases it. Connections being made for the profile are not cached. The caller must hold
+// the write lock.
+func (m *SessionManager) retireHandleLocked(clusterName string) {
+	m.generations[clusterName]++
+	cached, ok := m.handles[clusterName]
+	if !ok {
+		return
+	}
+	delete(m.handles, clusterName)
+	cached.retired = true
+	if cached.refs == 0 {
+		closeHandle(cached.handle)
+		return
 	}
+	m.retired = append(m.retired, cached)
 }
 
-func Login() {
+func closeHandle(h *cluster.Handle) {
+	if err := h.Close(); err != nil {
+		logger.Error("Error closing client", "cluster", h.Name, "error", err)
+	}
+}
+
+func (m *SessionManager) Login(ctx context.Context) {
 	versionReader := bufio.NewReader(os.Stdin)
-	fmt.Printf("Enter kafka version [%s]: ", constants.KafkaVersion)
+	fmt.Print("Enter kafka version [detect automatically]: ")
 
 	version, _ := versionReader.ReadString('\n')
 	version = strings.TrimSpace(version)
-	if version == "" {
-		version = constants.KafkaVersion
-	}
 
 	reader := bufio.NewReader(os.Stdin)
 
@@ -295,155 +572,222 @@ func Login() {
 		input = constants.KafkaBroker
 	}
 
-	// Create temporary cluster connection for testing
-	tempCluster := ClusterConnection{
-		Brokers:         []string{input},
-		Version:         version,
-		IsAuthenticated: false,
+	fmt.Printf("Connecting to cluster via: %s\n", input)
+
+	discoveredBrokers, version, err := probeCluster(ctx, []string{input}, version)
+	if err != nil {
+		logger.Error("Error connecting to cluster", "error", err)
+		fmt.Println("Failed to connect:", err)
+		return
 	}
 
-	fmt.Printf("Connecting to cluster via: %s\n", input)
+	fmt.Println("Logged in successfully!")
+	fmt.Printf("Kafka Version [%s]\n", version)
 
-	// Test connection
-	kafkaVersion, err := sarama.ParseKafkaVersion(version)
+	// Get cluster name
+	fmt.Print("Enter a name for this cluster connection: ")
+	nameInput, err := reader.ReadString('\n')
 	if err != nil {
-		logger.Error("Invalid Kafka version string", "version", version, "error", err)
-		fmt.Println("Failed to parse Kafka version. Please enter a valid version string (e.g., 2.1.0.0).")
+		logger.Error("Error reading cluster name input", "error", err)
 		return
 	}
+	nameInput = strings.TrimSpace(nameInput)
+	if nameInput == "" {
+		nameInput = fmt.Sprintf("cluster-%d", len(m.Clusters())+1)
+	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-	client, err := cluster.NewCluster(tempCluster.Brokers, kafkaVersion).Connect(ctx)
+	updated, err := m.saveConnection(ClusterConnection{
+		Name:            nameInput,
+		Brokers:         discoveredBrokers,
+		Version:         version,
+		IsAuthenticated: true,
+	})
+	if updated {
+		fmt.Printf("Updated existing cluster connection: %s\n", nameInput)
+	} else {
+		fmt.Printf("Added new cluster connection: %s\n", nameInput)
+	}
+	if err != nil {
+		logger.Error("Error saving session", "error", err)
+	}
+}
 
-	if client != nil && err == nil {
-		fmt.Println("Logged in successfully!")
-		fmt.Printf("Kafka Version [%s]\n", version)
+// LoginWithParams saves a connection after checking that the cluster is reachable. An
+// empty version is detected from the cluster.
+func (m *SessionManager) LoginWithParams(ctx context.Context, brokers []string, version string, clusterName string) (bool, string) {
+	discoveredBrokers, version, err := probeCluster(ctx, brokers, version)
+	if err != nil {
+		logger.Error("Error connecting to cluster", "error", err)
+		return false, "Error connecting to cluster: " + err.Error()
+	}
 
-		discoveredBrokers := discoverBrokers(client)
+	_, err = m.saveConnection(ClusterConnection{
+		Name:            clusterName,
+		Brokers:         discoveredBrokers,
+		Version:         version,
+		IsAuthenticated: true,
+	})
+	if err != nil {
+		logger.Error("Error saving session", "error", err)
+		return false, "Error saving session: " + err.Error()
+	}
+	return true, "Saved cluster connection: " + clusterName
+}
 
-		// Update cluster with discovered brokers
-		tempCluster.Brokers = discoveredBrokers
-		tempCluster.IsAuthenticated = true
+// probeCluster connects to the brokers and returns every broker of the cluster and the
+// Kafka version to save: the detected one when version is empty, otherwise version
+// itself, normalised, with a warning when the cluster does not match it
+func probeCluster(ctx context.Context, brokers []string, version string) ([]string, string, error) {
+	kafkaVersion := sarama.DefaultVersion
+	if version != "" {
+		var err error
+		if kafkaVersion, err = cluster.ParseVersion(version); err != nil {
+			return nil, "", fmt.Errorf("invalid Kafka version '%s' (e.g. 3.9.0): %w", version, err)
+		}
+	}
 
-		// Get cluster name
-		fmt.Print("Enter a name for this cluster connection: ")
-		nameInput, err := reader.ReadString('\n')
-		if err != nil {
-			logger.Error("Error reading cluster name input", "error", err)
-			return
-		}
-		nameInput = strings.TrimSpace(nameInput)
-		if nameInput == "" {
-			nameInput = fmt.Sprintf("cluster-%d", len(currentSession.clusters)+1)
-		}
-		tempCluster.Name = nameInput
-
-		// Check if cluster with this name already exists
-		for i, existingCluster := range currentSession.clusters {
-			if existingCluster.Name == nameInput {
-				currentSession.clusters[i] = tempCluster
-				currentSession.activeCluster = nameInput
-				fmt.Printf("Updated existing cluster connection: %s\n", nameInput)
-
-				// Close the test client
-				err = client.Close()
-				if err != nil {
-					logger.Error("Error closing client", "error", err)
-				}
-
-				// Save session
-				err = saveSession()
-				if err != nil {
-					logger.Error("Error saving session", "error", err)
-				}
-				return
-			}
+	client, err := cluster.NewCluster(brokers, kafkaVersion).Connect(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	defer func() {
+		if err := client.Close(); err != nil {
+			logger.Error("Error closing client", "error", err)
 		}
+	}()
 
-		// Add new cluster
-		currentSession.clusters = append(currentSession.clusters, tempCluster)
-		currentSession.activeCluster = nameInput
-		fmt.Printf("Added new cluster connection: %s\n", nameInput)
+	detected, err := cluster.Await(ctx, func() (sarama.KafkaVersion, error) {
+		return cluster.BrokerVersion(client)
+	})
+	switch {
+	case err != nil && version == "":
+		return nil, "", fmt.Errorf("error detecting the Kafka version, enter it instead: %w", err)
+	case err != nil:
+		logger.Warn("Could not detect the Kafka version", "error", err)
+	case version == "":
+		kafkaVersion = detected
+	case !cluster.VersionMatches(kafkaVersion, detected):
+		logger.Warn("Kafka version does not match the cluster", "entered", kafkaVersion.String(), "detected", detected.String())
+	}
+
+	return discoverBrokers(client), kafkaVersion.String(), nil
+}
 
-		// Close the test client
-		err = client.Close()
+// saveConnection adds or replaces a connection by name, selects it and saves the session.
+// A cached connection to a replaced cluster is closed, since its brokers may have changed.
+func (m *SessionManager) saveConnection(connection ClusterConnection) (updated bool, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	err = m.updateLocked(func() error {
+		if i := m.indexLocked(connection.Name); i >= 0 {
+			m.retireHandleLocked(connection.Name)
+			m.clusters[i] = connection
+			updated = true
+		} else {
+			m.clusters = append(m.clusters, connection)
+		}
+		m.activeCluster = connection.Name
+		return nil
+	})
+	return updated, err
+}
 
-		if err != nil {
-			logger.Error("Error closing client", "error", err)
+// AddCluster saves a new cluster profile without connecting to it, selecting it when
+// selectIt is set
+func (m *SessionManager) AddCluster(connection ClusterConnection, selectIt bool) error {
+	if err := connection.Validate(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.updateLocked(func() error {
+		if m.indexLocked(connection.Name) >= 0 {
+			return fmt.Errorf("cluster '%s' already exists, use 'ok cluster edit' to change it", connection.Name)
+		}
+		m.clusters = append(m.clusters, connection.clone())
+		if selectIt {
+			m.activeCluster = connection.Name
 		}
+		return nil
+	})
+}
 
-		// Save session
-		err = saveSession()
-		if err != nil {
-			logger.Error("Error saving session", "error", err)
+// UpdateCluster applies change to a copy of the named profile and saves it when the result
+// is valid. The cached connection is closed, since its settings may have changed.
+func (m *SessionManager) UpdateCluster(clusterName string, change func(connection *ClusterConnection) error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.updateLocked(func() error {
+		i := m.indexLocked(clusterName)
+		if i < 0 {
+			return fmt.Errorf("cluster '%s' not found", clusterName)
 		}
-	} else {
-		logger.Error("Error connecting to cluster", "error", err)
-	}
+
+		connection := m.clusters[i].clone()
+		if err := change(&connection); err != nil {
+			return err
+		}
+		connection.Name = clusterName
+		if err := connection.Validate(); err != nil {
+			return err
+		}
+
+		m.retireHandleLocked(clusterName)
+		m.clusters[i] = connection
+		return nil
+	})
 }
 
-func LoginWithParams(brokers []string, version string, clusterName string) (bool, string) {
-	// Create temporary cluster connection for testing
-	tempCluster := ClusterConnection{
-		Brokers:         brokers,
-		Version:         version,
-		IsAuthenticated: false,
+// RenameCluster changes the name of a profile, keeping it selected if it was
+func (m *SessionManager) RenameCluster(oldName, newName string) error {
+	if strings.TrimSpace(newName) == "" {
+		return fmt.Errorf("cluster name cannot be empty")
 	}
 
-	// Test connection
-	kafkaVersion, err := sarama.ParseKafkaVersion(version)
-	if err != nil {
-		logger.Error("Invalid Kafka version string", "version", version, "error", err)
-		return false, "Invalid Kafka version string: " + err.Error()
-	}
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-	client, err := cluster.NewCluster(tempCluster.Brokers, kafkaVersion).Connect(ctx)
-
-	if client != nil && err == nil {
-		discoveredBrokers := discoverBrokers(client)
-
-		// Update cluster with discovered brokers
-		tempCluster.Brokers = discoveredBrokers
-		tempCluster.IsAuthenticated = true
-		tempCluster.Name = clusterName
-
-		existing := false
-
-		// Check if cluster with this name already exists
-		for i, existingCluster := range currentSession.clusters {
-			if existingCluster.Name == clusterName {
-				currentSession.clusters[i] = tempCluster
-				currentSession.activeCluster = clusterName
-				existing = true
-				break
-			}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.updateLocked(func() error {
+		i := m.indexLocked(oldName)
+		if i < 0 {
+			return fmt.Errorf("cluster '%s' not found", oldName)
+		}
+		if m.indexLocked(newName) >= 0 {
+			return fmt.Errorf("cluster '%s' already exists", newName)
 		}
 
-		if !existing {
-			// Add new cluster
-			currentSession.clusters = append(currentSession.clusters, tempCluster)
-			currentSession.activeCluster = clusterName
+		m.retireHandleLocked(oldName)
+		m.retireHandleLocked(newName)
+		m.clusters[i].Name = newName
+		if m.activeCluster == oldName {
+			m.activeCluster = newName
 		}
+		return nil
+	})
+}
 
-		// Close the test client
-		err = client.Close()
-		if err != nil {
-			logger.Error("Error closing client", "error", err)
+// RemoveCluster deletes a profile and closes its cached connection
+func (m *SessionManager) RemoveCluster(clusterName string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.updateLocked(func() error {
+		i := m.indexLocked(clusterName)
+		if i < 0 {
+			return fmt.Errorf("cluster '%s' not found", clusterName)
 		}
 
-		// Save session
-		err = saveSession()
-		if err != nil {
-			logger.Error("Error saving session", "error", err)
-			return false, "Error saving session: " + err.Error()
+		m.clusters = append(m.clusters[:i], m.clusters[i+1:]...)
+		m.retireHandleLocked(clusterName)
+		if m.activeCluster == clusterName {
+			m.activeCluster = ""
 		}
-		return true, "Saved cluster connection: " + clusterName
-	} else {
-		logger.Error("Error connecting to cluster", "error", err)
-		return false, "Error connecting to cluster: " + err.Error()
-	}
+		return nil
+	})
 }
 
 func discoverBrokers(client sarama.Client) []string {
@@ -461,155 +805,134 @@ func discoverBrokers(client sarama.Client) []string {
 	return discoveredBrokers
 }
 
-func Logout(clusterName string) bool {
-	if clusterName == "" {
-		if currentSession.activeCluster == "" {
-			fmt.Println("No active cluster session.")
-			return false
-		}
-		clusterName = currentSession.activeCluster
-	}
-
-	// Find and remove the cluster
-	for i, cluster := range currentSession.clusters {
-		if cluster.Name == clusterName {
-			currentSession.clusters = append(currentSession.clusters[:i], currentSession.clusters[i+1:]...)
-
-			// If this was the active cluster, clear it
-			if currentSession.activeCluster == clusterName {
-				currentSession.activeCluster = ""
-				// Disconnect current client if any
-				if currentSession.client != nil {
-					err := currentSession.client.Close()
-					if err != nil {
-						logger.Error("Error closing client", "error", err)
-					}
-					currentSession.client = nil
-				}
-				if currentSession.adminClient != nil {
-					err := currentSession.adminClient.Close()
-					if err != nil {
-						logger.Error("Error closing admin client", "error", err)
-					}
-					currentSession.adminClient = nil
-				}
-			}
+func (m *SessionManager) Logout(clusterName string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-			// Save session
-			err := saveSession()
-			if err != nil {
-				fmt.Println("Error saving session:", err)
-				return false
+	err := m.updateLocked(func() error {
+		if clusterName == "" {
+			if m.activeCluster == "" {
+				return errNoActiveCluster
 			}
+			clusterName = m.activeCluster
+		}
 
-			fmt.Printf("Logged out from cluster: %s\n", clusterName)
-			return true
+		i := m.indexLocked(clusterName)
+		if i < 0 {
+			return errClusterNotFound
 		}
-	}
 
-	fmt.Printf("Cluster '%s' not found in active sessions.\n", clusterName)
-	return false
-}
+		m.clusters = append(m.clusters[:i], m.clusters[i+1:]...)
+		m.retireHandleLocked(clusterName)
 
-func GetClusterConnections() []ClusterConnection {
-	return currentSession.clusters
+		// If this was the active cluster, clear it
+		if m.activeCluster == clusterName {
+			m.activeCluster = ""
+		}
+		return nil
+	})
+
+	switch {
+	case errors.Is(err, errNoActiveCluster):
+		fmt.Println("No active cluster session.")
+		return false
+	case errors.Is(err, errClusterNotFound):
+		fmt.Printf("Cluster '%s' not found in active sessions.\n", clusterName)
+		return false
+	case err != nil:
+		fmt.Println("Error saving session:", err)
+		return false
+	}
+
+	fmt.Printf("Logged out from cluster: %s\n", clusterName)
+	return true
 }
 
-func GetActiveClusterName() string {
-	return currentSession.activeCluster
-}
+func (m *SessionManager) ListClusters() {
+	clusters := m.Clusters()
+	activeCluster := m.ActiveClusterName()
 
-func ListClusters() {
-	if len(currentSession.clusters) == 0 {
+	if len(clusters) == 0 {
 		fmt.Println("No cluster connections found.")
 		return
 	}
 
 	fmt.Println("Available cluster connections:")
-	for i, cluster := range currentSession.clusters {
+	for i, c := range clusters {
 		status := "Disconnected"
-		if cluster.IsAuthenticated {
+		if c.IsAuthenticated {
 			status = "Connected"
 		}
 
 		active := ""
-		if cluster.Name == currentSession.activeCluster {
+		if c.Name == activeCluster {
 			active = " (ACTIVE)"
 		}
 
 		fmt.Printf("%d. %s - %s - %d brokers%s\n",
-			i+1, cluster.Name, status, len(cluster.Brokers), active)
+			i+1, c.Name, status, len(c.Brokers), active)
 
-		for j, broker := range cluster.Brokers {
+		for j, broker := range c.Brokers {
 			fmt.Printf("   Broker %d: %s\n", j+1, broker)
 		}
 	}
 }
 
-func cleanupClients() {
-	if currentSession.client != nil {
-		err := currentSession.client.Close()
-		if err != nil {
-			logger.Error("Error closing client", "error", err)
-		}
-		currentSession.client = nil
-	}
-	if currentSession.adminClient != nil {
-		err := currentSession.adminClient.Close()
-		if err != nil {
-			logger.Error("Error closing admin client", "error", err)
-		}
-		currentSession.adminClient = nil
-	}
-}
-
-func SelectCluster(clusterName string) {
-	for _, cluster := range currentSession.clusters {
-		if cluster.Name == clusterName {
-			cleanupClients()
-
-			currentSession.activeCluster = clusterName
-			fmt.Printf("Selected cluster: %s\n", clusterName)
+func (m *SessionManager) SelectCluster(clusterName string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-			// Save session
-			err := saveSession()
-			if err != nil {
-				logger.Error("Error saving session", "error", err)
-			}
-			return
+	err := m.updateLocked(func() error {
+		if m.indexLocked(clusterName) < 0 {
+			return errClusterNotFound
 		}
+		m.activeCluster = clusterName
+		return nil
+	})
+
+	switch {
+	case errors.Is(err, errClusterNotFound):
+		fmt.Printf("Cluster '%s' not found. Use 'ok cluster list' to see available clusters.\n", clusterName)
+	case err != nil:
+		logger.Error("Error saving session", "error", err)
+	default:
+		fmt.Printf("Selected cluster: %s\n", clusterName)
 	}
-
-	fmt.Printf("Cluster '%s' not found. Use 'ok cluster list' to see available clusters.\n", clusterName)
 }
 
-func DisplaySession() {
-	if currentSession == nil {
-		fmt.Println("No active session.")
-		return
-	}
-
-	if currentSession.IsAuthenticated() {
-		fmt.Println("Current session:", currentSession.Info())
+func (m *SessionManager) DisplaySession() {
+	if m.IsAuthenticated() {
+		fmt.Println("Current session:", m.Info())
 	} else {
 		fmt.Println("No active session.")
 	}
 }
 
-func InitAPI() error {
-	err := loadSession()
-	if err != nil {
-		logger.Error("Error loading session", "error", err)
-		return err
-	}
-	return nil
-}
+var (
+	defaultMu      sync.Mutex
+	defaultManager *SessionManager
+)
 
-func GetClusterByName(clusterName string) *ClusterConnection {
-	for i := range currentSession.clusters {
-		if currentSession.clusters[i].Name == clusterName {
-			return &currentSession.clusters[i]
+// Default returns the manager for the session file under the OpenKommander folder,
+// loading it on first use. A session file that cannot be read is logged and treated as
+// empty, so commands that do not need a cluster keep working.
+func Default() *SessionManager {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+
+	if defaultManager == nil {
+		defaultManager = NewSessionManager(constants.OpenKommanderConfigFilename)
+		if err := defaultManager.Load(); err != nil {
+			logger.Error("Error loading session", "error", err)
 		}
 	}
-	return nil
+	return defaultManager
+}
+
+// SetDefault replaces the manager returned by Default, so tests can keep away from the
+// user's session file. Passing nil makes Default load the session file again.
+func SetDefault(m *SessionManager) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	defaultManager = m
 }
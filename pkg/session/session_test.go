@@ -0,0 +1,331 @@
+package session
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/IBM/openkommander/pkg/cluster"
+	"github.com/IBM/sarama"
+)
+
+func newTestManager(t *testing.T) *SessionManager {
+	t.Helper()
+	m, err := OpenSessionManager(filepath.Join(t.TempDir(), ".ok_config"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(m.Close)
+	return m
+}
+
+func TestSessionManagerPersists(t *testing.T) {
+	m := newTestManager(t)
+	if _, err := m.saveConnection(ClusterConnection{Name: "dev", Brokers: []string{"localhost:9092"}, Version: "3.9.0", IsAuthenticated: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := OpenSessionManager(m.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reloaded.ActiveClusterName() != "dev" || !reloaded.IsAuthenticated() {
+		t.Errorf("active cluster = %q, authenticated = %v, want dev and true", reloaded.ActiveClusterName(), reloaded.IsAuthenticated())
+	}
+	if c, ok := reloaded.ClusterByName("dev"); !ok || c.Brokers[0] != "localhost:9092" {
+		t.Errorf("ClusterByName(dev) = %+v, %v", c, ok)
+	}
+}
+
+func TestSessionManagerSeesProfilesSavedByOtherProcesses(t *testing.T) {
+	server := newTestManager(t)
+	if _, err := server.saveConnection(ClusterConnection{Name: "prod", Brokers: []string{"localhost:9092"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	cli, err := OpenSessionManager(server.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cli.UpdateCluster("prod", func(connection *ClusterConnection) error {
+		connection.ReadOnly = true
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if c, ok := server.ClusterForBroker("localhost:9092"); !ok || !c.ReadOnly {
+		t.Errorf("ClusterForBroker after another process made the profile read-only = %+v, %v", c, ok)
+	}
+}
+
+func TestSessionManagerCachesOneHandlePerCluster(t *testing.T) {
+	// Registered before the manager so the manager's connections are closed first
+	broker := sarama.NewMockBroker(t, 1)
+	t.Cleanup(broker.Close)
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"ApiVersionsRequest": sarama.NewMockApiVersionsResponse(t),
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetController(broker.BrokerID()),
+	})
+
+	m := newTestManager(t)
+	if _, err := m.saveConnection(ClusterConnection{Name: "dev", Brokers: []string{broker.Addr()}, Version: "2.1.0", IsAuthenticated: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	handles := make([]any, 8)
+	for i := range handles {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			h, err := m.ActiveHandle(context.Background())
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			handles[i] = h
+			m.Clusters()
+			m.SelectCluster("dev")
+		}()
+	}
+	wg.Wait()
+
+	for _, h := range handles[1:] {
+		if h != handles[0] {
+			t.Fatal("concurrent callers got different handles for the same cluster")
+		}
+	}
+}
+
+func newHandleTestBroker(t *testing.T) *sarama.MockBroker {
+	t.Helper()
+	broker := sarama.NewMockBroker(t, 1)
+	t.Cleanup(broker.Close)
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"ApiVersionsRequest": sarama.NewMockApiVersionsResponse(t),
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetController(broker.BrokerID()),
+	})
+	return broker
+}
+
+func TestAcquireDoesNotCacheConnectionOfChangedProfile(t *testing.T) {
+	broker := newHandleTestBroker(t)
+	broker.SetLatency(200 * time.Millisecond)
+
+	m := newTestManager(t)
+	if _, err := m.saveConnection(ClusterConnection{Name: "dev", Brokers: []string{broker.Addr()}, Version: "2.1.0", IsAuthenticated: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	type acquired struct {
+		h   *cluster.Handle
+		err error
+	}
+	done := make(chan acquired)
+	go func() {
+		h, release, err := m.Acquire(context.Background(), "dev")
+		if err == nil {
+			defer release()
+		}
+		done <- acquired{h, err}
+	}()
+
+	// Change the profile while the connection is being made
+	time.Sleep(50 * time.Millisecond)
+	if err := m.UpdateCluster("dev", func(connection *ClusterConnection) error {
+		connection.ReadOnly = true
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	got := <-done
+	if got.err != nil {
+		t.Fatal(got.err)
+	}
+	if !got.h.ReadOnly {
+		t.Error("Acquire returned a connection made with the settings from before the profile changed")
+	}
+	cached, err := m.Handle(context.Background(), "dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cached.ReadOnly {
+		t.Error("the connection cached for the profile uses its old settings")
+	}
+}
+
+func TestRetiredHandleStaysOpenUntilReleased(t *testing.T) {
+	broker := newHandleTestBroker(t)
+
+	m := newTestManager(t)
+	if _, err := m.saveConnection(ClusterConnection{Name: "dev", Brokers: []string{broker.Addr()}, Version: "2.1.0", IsAuthenticated: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	h, release, err := m.Acquire(context.Background(), "dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.UpdateCluster("dev", func(connection *ClusterConnection) error {
+		connection.ReadOnly = true
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if h.Client.Closed() {
+		t.Fatal("changing the profile closed a connection that is still in use")
+	}
+
+	fresh, err := m.Handle(context.Background(), "dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fresh == h {
+		t.Error("the connection of the old profile is still cached")
+	}
+
+	release()
+	release()
+	if !h.Client.Closed() {
+		t.Error("the retired connection was not closed when released")
+	}
+	if fresh.Client.Closed() {
+		t.Error("releasing the old connection closed the new one")
+	}
+}
+
+func TestIsReadOnlyClusterMatchesAliases(t *testing.T) {
+	broker := newHandleTestBroker(t)
+	_, port, _ := strings.Cut(broker.Addr(), ":")
+
+	m := newTestManager(t)
+	if _, err := m.saveConnection(ClusterConnection{Name: "dev", Brokers: []string{broker.Addr()}, Version: "2.1.0"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.saveConnection(ClusterConnection{Name: "prod", Brokers: []string{"localhost:" + port}, Version: "2.1.0", ReadOnly: true}); err != nil {
+		t.Fatal(err)
+	}
+	h, err := m.Handle(context.Background(), "dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for range 2 {
+		if readOnly, err := m.IsReadOnlyCluster(context.Background(), h); err != nil || !readOnly {
+			t.Errorf("IsReadOnlyCluster through an alias = %v, %v, want true", readOnly, err)
+		}
+	}
+	if _, ok := m.identities["prod"]; !ok {
+		t.Error("the brokers of the read-only cluster were not cached")
+	}
+
+	if err := m.UpdateCluster("prod", func(connection *ClusterConnection) error {
+		connection.Brokers = []string{"127.0.0.1:1"}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if readOnly, err := m.IsReadOnlyCluster(context.Background(), h); err == nil || readOnly {
+		t.Errorf("IsReadOnlyCluster with an unreachable read-only profile = %v, %v, want an error", readOnly, err)
+	}
+}
+
+func TestHandleSavesDetectedVersion(t *testing.T) {
+	broker := sarama.NewMockBroker(t, 1)
+	t.Cleanup(broker.Close)
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"ApiVersionsRequest": sarama.NewMockApiVersionsResponse(t).SetApiKeys([]sarama.ApiVersionsResponseKey{
+			{ApiKey: 0, MaxVersion: 7},
+			{ApiKey: 19, MaxVersion: 3},
+			{ApiKey: 21, MaxVersion: 1},
+			{ApiKey: 37, MaxVersion: 1},
+			{ApiKey: 42, MaxVersion: 1},
+		}),
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetController(broker.BrokerID()),
+	})
+
+	m := newTestManager(t)
+	if err := m.AddCluster(ClusterConnection{Name: "dev", Brokers: []string{broker.Addr()}, IsAuthenticated: true}, true); err != nil {
+		t.Fatal(err)
+	}
+	h, err := m.ActiveHandle(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if version := h.Client.Config().Version; version != sarama.V2_1_0_0 {
+		t.Errorf("client version = %v, want the detected 2.1.0", version)
+	}
+	reloaded, err := OpenSessionManager(m.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c, _ := reloaded.ClusterByName("dev"); c.Version != "2.1.0" {
+		t.Errorf("saved version = %q, want 2.1.0", c.Version)
+	}
+}
+
+func TestProfileConfiguresCluster(t *testing.T) {
+	t.Setenv("OK_TEST_PASSWORD", "secret")
+	connection := ClusterConnection{
+		Name:           "prod",
+		Brokers:        []string{"localhost:9092"},
+		Version:        "3.9.0",
+		ClientID:       "ok-tests",
+		RequestTimeout: Duration(5 * time.Second),
+		SASL:           &SASLProfile{Mechanism: "SCRAM-SHA-256", Username: "bob", PasswordEnv: "OK_TEST_PASSWORD"},
+		Labels:         map[string]string{"env": "prod"},
+	}
+	if err := connection.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	kafkaCluster, err := connection.Cluster()
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := kafkaCluster.Config
+	if config.ClientID != "ok-tests" || config.Admin.Timeout != 5*time.Second || config.Net.SASL.Password != "secret" {
+		t.Errorf("client ID = %q, admin timeout = %v, SASL password = %q", config.ClientID, config.Admin.Timeout, config.Net.SASL.Password)
+	}
+
+	connection.SASL.Mechanism = "GSSAPI"
+	if err := connection.Validate(); err == nil {
+		t.Error("GSSAPI was accepted, want an unsupported mechanism error")
+	}
+}
+
+func TestRenameAndRemoveCluster(t *testing.T) {
+	m := newTestManager(t)
+	if err := m.AddCluster(ClusterConnection{Name: "dev", Brokers: []string{"localhost:9092"}, Version: "3.9.0"}, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AddCluster(ClusterConnection{Name: "dev", Brokers: []string{"localhost:9092"}, Version: "3.9.0"}, false); err == nil {
+		t.Error("adding a duplicate cluster succeeded")
+	}
+
+	if err := m.RenameCluster("dev", "staging"); err != nil {
+		t.Fatal(err)
+	}
+	if m.ActiveClusterName() != "staging" {
+		t.Errorf("active cluster = %q, want staging", m.ActiveClusterName())
+	}
+
+	if err := m.RemoveCluster("staging"); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Clusters()) != 0 || m.ActiveClusterName() != "" {
+		t.Errorf("clusters = %+v, active = %q, want none", m.Clusters(), m.ActiveClusterName())
+	}
+}
@@ -0,0 +1,169 @@
+package session
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/IBM/openkommander/pkg/logger"
+)
+
+// CurrentSchemaVersion is the version of SessionData written by this build. Files with
+// an older version are migrated when loaded; files with a newer one are refused rather
+// than silently dropping fields this build does not know about.
+const CurrentSchemaVersion = 2
+
+// migrations[n] upgrades session data from schema version n to n+1
+var migrations = []func(data *SessionData) error{
+	// 0 -> 1: files written before versioning. The layout is unchanged, but clusters may
+	// be null in files created by hand.
+	func(data *SessionData) error {
+		if data.Clusters == nil {
+			data.Clusters = []ClusterConnection{}
+		}
+		return nil
+	},
+	// 1 -> 2: cluster profiles gained optional settings (client ID, timeouts, SASL, TLS,
+	// output format, read-only, labels). Unset settings keep sarama's defaults, so
+	// existing profiles need no change.
+	func(data *SessionData) error {
+		return nil
+	},
+}
+
+// migrate upgrades data to CurrentSchemaVersion
+func migrate(data *SessionData) error {
+	if data.Version > CurrentSchemaVersion {
+		return fmt.Errorf("session file has schema version %d, but this build only supports up to %d; upgrade ok",
+			data.Version, CurrentSchemaVersion)
+	}
+	for data.Version < CurrentSchemaVersion {
+		if err := migrations[data.Version](data); err != nil {
+			return fmt.Errorf("error migrating session data from schema version %d: %w", data.Version, err)
+		}
+		data.Version++
+	}
+	return nil
+}
+
+func backupPath(path string) string {
+	return path + ".bak"
+}
+
+func lockPath(path string) string {
+	return path + ".lock"
+}
+
+// readSessionFile decodes and migrates a session file
+func readSessionFile(path string) (SessionData, error) {
+	var data SessionData
+	encoded, err := os.ReadFile(path)
+	if err != nil {
+		return data, err
+	}
+	if err := json.Unmarshal(encoded, &data); err != nil {
+		return data, fmt.Errorf("error decoding session file %s: %w", path, err)
+	}
+	if err := migrate(&data); err != nil {
+		return data, err
+	}
+	return data, nil
+}
+
+// loadSessionFile reads the session file, falling back to the backup of the last good
+// file when it is missing or unreadable. A recovered backup is written back in place and
+// the damaged file is kept next to it for inspection. A missing file without a backup is
+// an empty session.
+func loadSessionFile(path string) (SessionData, error) {
+	data, err := readSessionFile(path)
+	if err == nil {
+		return data, nil
+	}
+	if data.Version > CurrentSchemaVersion {
+		return data, err
+	}
+
+	backup, backupErr := readSessionFile(backupPath(path))
+	if backupErr != nil {
+		if errors.Is(err, os.ErrNotExist) && errors.Is(backupErr, os.ErrNotExist) {
+			return SessionData{Version: CurrentSchemaVersion, Clusters: []ClusterConnection{}}, nil
+		}
+		if errors.Is(err, os.ErrNotExist) {
+			return data, fmt.Errorf("session file %s is missing and its backup is unreadable: %w", path, backupErr)
+		}
+		return data, err
+	}
+
+	if !errors.Is(err, os.ErrNotExist) {
+		logger.Warn("Session file is damaged, restoring the last good backup", "path", path, "error", err)
+		damaged := fmt.Sprintf("%s.corrupt-%s", path, time.Now().Format("20060102T150405"))
+		if renameErr := os.Rename(path, damaged); renameErr != nil {
+			logger.Warn("Failed to keep the damaged session file", "path", path, "error", renameErr)
+		}
+	} else {
+		logger.Warn("Session file is missing, restoring the last good backup", "path", path)
+	}
+
+	if writeErr := writeFileAtomic(path, backup); writeErr != nil {
+		return backup, fmt.Errorf("error restoring session file from backup: %w", writeErr)
+	}
+	return backup, nil
+}
+
+// saveSessionFile keeps the current file as the backup when it is readable and then
+// replaces it atomically, so a crash leaves either the old or the new file in place
+func saveSessionFile(path string, data SessionData) error {
+	data.Version = CurrentSchemaVersion
+
+	if current, err := readSessionFile(path); err == nil {
+		if err := writeFileAtomic(backupPath(path), current); err != nil {
+			logger.Warn("Failed to back up session file", "path", path, "error", err)
+		}
+	}
+	return writeFileAtomic(path, data)
+}
+
+// writeFileAtomic writes data to a temporary file in the same directory, syncs it and
+// renames it over path
+func writeFileAtomic(path string, data SessionData) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("error creating directory %s: %w", dir, err)
+	}
+
+	encoded, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding session data: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("error creating temporary session file in %s: %w", dir, err)
+	}
+	defer func() {
+		// Only left behind when a step below failed
+		_ = os.Remove(tmp.Name())
+	}()
+
+	if _, err := tmp.Write(append(encoded, '\n')); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("error writing session file %s: %w", tmp.Name(), err)
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("error syncing session file %s: %w", tmp.Name(), err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error closing session file %s: %w", tmp.Name(), err)
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return fmt.Errorf("error setting permissions on %s: %w", tmp.Name(), err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("error replacing session file %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package session
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestLoadMigratesUnversionedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".ok_config")
+	legacy := `{"clusters":null,"activeCluster":""}`
+	if err := os.WriteFile(path, []byte(legacy), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := loadSessionFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.Version != CurrentSchemaVersion || data.Clusters == nil {
+		t.Errorf("data = %+v, want version %d with empty clusters", data, CurrentSchemaVersion)
+	}
+}
+
+func TestLoadRefusesNewerSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".ok_config")
+	if err := os.WriteFile(path, []byte(`{"version":99,"clusters":[]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := OpenSessionManager(path); err == nil || !strings.Contains(err.Error(), "schema version 99") {
+		t.Errorf("err = %v, want a schema version error", err)
+	}
+}
+
+func TestLoadRecoversFromBackup(t *testing.T) {
+	m := newTestManager(t)
+	for _, name := range []string{"dev", "prod"} {
+		if _, err := m.saveConnection(ClusterConnection{Name: name, Version: "3.9.0"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Simulate a crash that left a truncated file behind
+	if err := os.WriteFile(m.Path(), []byte(`{"version":1,"clus`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	recovered, err := OpenSessionManager(m.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The backup is the file as it was before the last save
+	if _, ok := recovered.ClusterByName("dev"); !ok {
+		t.Errorf("clusters = %+v, want dev restored from the backup", recovered.Clusters())
+	}
+	if _, err := readSessionFile(m.Path()); err != nil {
+		t.Errorf("session file was not restored: %v", err)
+	}
+	damaged, _ := filepath.Glob(m.Path() + ".corrupt-*")
+	if len(damaged) != 1 {
+		t.Errorf("damaged files = %v, want the truncated file kept", damaged)
+	}
+}
+
+func TestConcurrentManagersKeepEachOthersChanges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".ok_config")
+	managers := make([]*SessionManager, 8)
+	for i := range managers {
+		m, err := OpenSessionManager(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		managers[i] = m
+	}
+
+	var wg sync.WaitGroup
+	for i, m := range managers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			name := string(rune('a' + i))
+			if _, err := m.saveConnection(ClusterConnection{Name: name, Version: "3.9.0"}); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	final, err := OpenSessionManager(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(final.Clusters()); got != len(managers) {
+		t.Errorf("saved %d clusters, want %d", got, len(managers))
+	}
+}
@@ -0,0 +1,206 @@
+package session
+
+import (
+	"fmt"
+	"maps"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// ProfileDocumentVersion is the version of ProfileDocument written by this build
+const ProfileDocumentVersion = 1
+
+// ProfileDocument is the file written by 'ok cluster export' and read by 'ok cluster
+// import'. Profiles only refer to passwords, so they can be shared as they are; resolved
+// SASL passwords are added to Secrets, keyed by cluster name, only when asked for.
+type ProfileDocument struct {
+	Version  int                      `json:"version"`
+	Clusters []ClusterConnection      `json:"clusters"`
+	Secrets  map[string]ProfileSecret `json:"secrets,omitempty"`
+}
+
+// ProfileSecret holds the credentials of one exported profile
+type ProfileSecret struct {
+	SASLPassword string `json:"saslPassword,omitempty"`
+}
+
+// ExportClusters returns the named profiles, or all of them when names is empty. When
+// includeSecrets is set the SASL passwords are resolved and added to the document.
+func (m *SessionManager) ExportClusters(names []string, includeSecrets bool) (ProfileDocument, error) {
+	document := ProfileDocument{Version: ProfileDocumentVersion, Clusters: []ClusterConnection{}}
+	clusters := m.Clusters()
+
+	for _, name := range names {
+		if !slices.ContainsFunc(clusters, func(c ClusterConnection) bool { return c.Name == name }) {
+			return document, fmt.Errorf("cluster '%s' not found", name)
+		}
+	}
+
+	for _, connection := range clusters {
+		if len(names) > 0 && !slices.Contains(names, connection.Name) {
+			continue
+		}
+		// Whether a profile was used is local state, not part of the profile
+		connection.IsAuthenticated = false
+		document.Clusters = append(document.Clusters, connection)
+
+		if !includeSecrets || connection.SASL == nil {
+			continue
+		}
+		password, err := connection.SASL.password()
+		if err != nil {
+			return document, fmt.Errorf("error reading the SASL password of cluster '%s': %w", connection.Name, err)
+		}
+		if password != "" {
+			if document.Secrets == nil {
+				document.Secrets = map[string]ProfileSecret{}
+			}
+			document.Secrets[connection.Name] = ProfileSecret{SASLPassword: password}
+		}
+	}
+	return document, nil
+}
+
+// ImportResult lists the profiles changed by an import
+type ImportResult struct {
+	Added   []string
+	Updated []string
+}
+
+// ImportClusters merges profiles into the session by name. Settings of an imported profile
+// replace those of an existing profile with the same name; settings it leaves unset keep
+// their current value, and labels are merged. Nothing is saved unless every merged profile
+// is valid.
+//
+// Passwords in secrets are written to files readable only by the current user next to the
+// session file, and the profile is pointed at them, so the session file never holds them.
+func (m *SessionManager) ImportClusters(connections []ClusterConnection, secrets map[string]ProfileSecret) (ImportResult, error) {
+	var result ImportResult
+
+	seen := map[string]bool{}
+	for _, connection := range connections {
+		if seen[connection.Name] {
+			return result, fmt.Errorf("cluster '%s' is listed more than once", connection.Name)
+		}
+		seen[connection.Name] = true
+	}
+	for name := range secrets {
+		if !seen[name] {
+			return result, fmt.Errorf("secrets are given for cluster '%s', which is not imported", name)
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	err := m.updateLocked(func() error {
+		merged := slices.Clone(m.clusters)
+		result = ImportResult{}
+
+		for _, imported := range connections {
+			imported = imported.clone()
+			imported.IsAuthenticated = true
+
+			i := slices.IndexFunc(merged, func(c ClusterConnection) bool { return c.Name == imported.Name })
+			if i >= 0 {
+				imported = mergeProfile(merged[i], imported)
+			}
+			if secret, ok := secrets[imported.Name]; ok && secret.SASLPassword != "" {
+				if imported.SASL == nil {
+					return fmt.Errorf("a SASL password is given for cluster '%s', which has no SASL settings", imported.Name)
+				}
+				imported.SASL.PasswordEnv = ""
+				imported.SASL.PasswordFile = m.secretPath(imported.Name)
+			}
+			if err := imported.Validate(); err != nil {
+				return fmt.Errorf("invalid profile for cluster '%s': %w", imported.Name, err)
+			}
+
+			if i >= 0 {
+				merged[i] = imported
+				result.Updated = append(result.Updated, imported.Name)
+			} else {
+				merged = append(merged, imported)
+				result.Added = append(result.Added, imported.Name)
+			}
+		}
+
+		for name, secret := range secrets {
+			if secret.SASLPassword == "" {
+				continue
+			}
+			if err := writeSecretFile(m.secretPath(name), secret.SASLPassword); err != nil {
+				return err
+			}
+		}
+
+		for _, name := range result.Updated {
+			m.retireHandleLocked(name)
+		}
+		m.clusters = merged
+		return nil
+	})
+	if err != nil {
+		return ImportResult{}, err
+	}
+	return result, nil
+}
+
+// mergeProfile overlays the settings set in imported on existing
+func mergeProfile(existing, imported ClusterConnection) ClusterConnection {
+	merged := existing.clone()
+	if len(imported.Brokers) > 0 {
+		merged.Brokers = imported.Brokers
+	}
+	if imported.Version != "" {
+		merged.Version = imported.Version
+	}
+	if imported.ClientID != "" {
+		merged.ClientID = imported.ClientID
+	}
+	if imported.DialTimeout != 0 {
+		merged.DialTimeout = imported.DialTimeout
+	}
+	if imported.RequestTimeout != 0 {
+		merged.RequestTimeout = imported.RequestTimeout
+	}
+	if imported.MetadataRefresh != 0 {
+		merged.MetadataRefresh = imported.MetadataRefresh
+	}
+	if imported.SASL != nil {
+		merged.SASL = imported.SASL
+	}
+	if imported.TLS != nil {
+		merged.TLS = imported.TLS
+	}
+	if imported.OutputFormat != "" {
+		merged.OutputFormat = imported.OutputFormat
+	}
+	merged.ReadOnly = merged.ReadOnly || imported.ReadOnly
+	if len(imported.Labels) > 0 {
+		if merged.Labels == nil {
+			merged.Labels = map[string]string{}
+		}
+		maps.Copy(merged.Labels, imported.Labels)
+	}
+	merged.IsAuthenticated = true
+	return merged
+}
+
+// secretPath is where an imported SASL password of a cluster is kept
+func (m *SessionManager) secretPath(clusterName string) string {
+	return filepath.Join(filepath.Dir(m.path), "secrets", url.PathEscape(clusterName)+".password")
+}
+
+func writeSecretFile(path, secret string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("error creating secrets directory: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(secret+"\n"), 0600); err != nil {
+		return fmt.Errorf("error writing secret file %s: %w", path, err)
+	}
+	// WriteFile keeps the mode of an existing file
+	return os.Chmod(path, 0600)
+}
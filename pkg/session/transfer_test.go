@@ -0,0 +1,101 @@
+package session
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExportImportMergesByName(t *testing.T) {
+	t.Setenv("OK_TEST_PASSWORD", "secret")
+	source := newTestManager(t)
+	if err := source.AddCluster(ClusterConnection{
+		Name:    "prod",
+		Brokers: []string{"prod:9092"},
+		Version: "3.9.0",
+		SASL:    &SASLProfile{Mechanism: "PLAIN", Username: "bob", PasswordEnv: "OK_TEST_PASSWORD"},
+		Labels:  map[string]string{"env": "prod"},
+	}, true); err != nil {
+		t.Fatal(err)
+	}
+
+	document, err := source.ExportClusters(nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(document.Secrets) != 0 {
+		t.Errorf("secrets = %v, want none without includeSecrets", document.Secrets)
+	}
+	document, err = source.ExportClusters([]string{"prod"}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if document.Secrets["prod"].SASLPassword != "secret" {
+		t.Errorf("secrets = %v, want the prod password", document.Secrets)
+	}
+
+	target := newTestManager(t)
+	if err := target.AddCluster(ClusterConnection{Name: "prod", Brokers: []string{"old:9092"}, Version: "2.1.0", ClientID: "mine", Labels: map[string]string{"team": "a"}}, true); err != nil {
+		t.Fatal(err)
+	}
+	result, err := target.ImportClusters(document.Clusters, document.Secrets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Updated) != 1 || len(result.Added) != 0 {
+		t.Errorf("result = %+v, want prod updated", result)
+	}
+
+	merged, _ := target.ClusterByName("prod")
+	if merged.Brokers[0] != "prod:9092" || merged.ClientID != "mine" || merged.Labels["team"] != "a" || merged.Labels["env"] != "prod" {
+		t.Errorf("merged profile = %+v", merged)
+	}
+	if merged.SASL.PasswordEnv != "" || merged.SASL.PasswordFile == "" {
+		t.Fatalf("SASL = %+v, want the password moved to a file", merged.SASL)
+	}
+	if info, err := os.Stat(merged.SASL.PasswordFile); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("password file: %v, %v", info, err)
+	}
+	if password, _ := merged.SASL.password(); password != "secret" {
+		t.Errorf("password = %q, want secret", password)
+	}
+}
+
+func TestProfileFromClientProperties(t *testing.T) {
+	properties, err := ParseProperties(strings.NewReader(`# Kafka CLI settings
+bootstrap.servers=b1:9093,b2:9093
+security.protocol=SASL_SSL
+sasl.mechanism=SCRAM-SHA-512
+sasl.jaas.config=org.apache.kafka.common.security.scram.ScramLoginModule required \
+    username="alice" password="p\"w";
+ssl.truststore.type=PEM
+ssl.truststore.location=/etc/kafka/ca.pem
+ssl.endpoint.identification.algorithm=
+request.timeout.ms=15000
+linger.ms=5
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	connection, password, warnings, err := ProfileFromClientProperties("prod", properties)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(connection.Brokers) != 2 || connection.SASL.Mechanism != "SCRAM-SHA-512" || connection.SASL.Username != "alice" {
+		t.Errorf("connection = %+v, SASL = %+v", connection, connection.SASL)
+	}
+	if password != `p"w` {
+		t.Errorf("password = %q, want p\"w", password)
+	}
+	if connection.TLS == nil || connection.TLS.CAFile != "/etc/kafka/ca.pem" || time.Duration(connection.RequestTimeout) != 15*time.Second {
+		t.Errorf("TLS = %+v, request timeout = %v", connection.TLS, connection.RequestTimeout)
+	}
+	if !connection.TLS.SkipHostnameVerification || connection.TLS.InsecureSkipVerify {
+		t.Errorf("TLS = %+v, want only the host name check skipped", connection.TLS)
+	}
+	if len(warnings) != 2 || !strings.Contains(warnings[0], "host names") || !strings.Contains(warnings[1], "linger.ms") {
+		t.Errorf("warnings = %v, want the host name check skipped and linger.ms ignored", warnings)
+	}
+}